@@ -26,7 +26,7 @@ func initStoreTest(ctx context.Context, require *require.Assertions) {
 	r := repo.NewInMemoryRepo()
 	bs := bstore.NewBlockstore(r.Datastore())
 	cst := hamt.NewCborStore()
-	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), powerTable, genCid, proofs.NewFakeVerifier(true, nil))
+	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), powerTable, genCid, proofs.NewFakeVerifier(true, nil), &th.TestBlockSignatureValidator{}, th.NewTestSectorsView(types.CommR{}))
 	initSyncTest(require, con, initGenesis, cst, bs, r)
 	requireSetTestChain(require, con, true)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/clock"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/state"
@@ -27,8 +28,14 @@ var (
 	ErrNewChainTooLong = errors.New("input chain forked from best chain too far in the past")
 	// ErrUnexpectedStoreState indicates that the syncer's chain store is violating expected invariants.
 	ErrUnexpectedStoreState = errors.New("the chain store is in an unexpected state")
+	// ErrFutureTipSet is returned when syncing a tipset whose epoch hasn't started yet.
+	ErrFutureTipSet = errors.New("input chain contains a tipset from a future epoch")
 )
 
+// MaxClockDrift is how far ahead of the local clock the epoch of a tipset may
+// start for the syncer to accept it, to tolerate clocks that are off a little.
+const MaxClockDrift = 3 * time.Second
+
 var logSyncer = logging.Logger("chain.syncer")
 
 type syncFetcher interface {
@@ -68,12 +75,16 @@ type DefaultSyncer struct {
 	badTipSets *badTipSetCache
 	consensus  consensus.Protocol
 	chainStore Store
+	// clock tells the current epoch, to reject tipsets from future epochs.
+	// It is nil for chains without epochs.
+	clock *clock.ChainClock
 }
 
 var _ Syncer = (*DefaultSyncer)(nil)
 
-// NewDefaultSyncer constructs a DefaultSyncer ready for use.
-func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s Store, f syncFetcher) *DefaultSyncer {
+// NewDefaultSyncer constructs a DefaultSyncer ready for use. The clock is nil
+// if the chain has no epochs.
+func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s Store, f syncFetcher, clk *clock.ChainClock) *DefaultSyncer {
 	return &DefaultSyncer{
 		fetcher:    f,
 		stateStore: cst,
@@ -82,6 +93,7 @@ func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s Store, f
 		},
 		consensus:  c,
 		chainStore: s,
+		clock:      clk,
 	}
 }
 
@@ -140,6 +152,11 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.
 		}
 
 		height, _ := ts.Height()
+		// Tipsets from future epochs aren't bad, they may be valid once
+		// their epoch starts, so they aren't cached as bad.
+		if syncer.isFromFutureEpoch(height) {
+			return nil, errors.Wrapf(ErrFutureTipSet, "tipset %s at height %d", tsKey, height)
+		}
 		if len(chain)%500 == 0 {
 			logSyncer.Infof("syncing the chain, currently at block height %d", height)
 		}
@@ -153,6 +170,15 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.
 	}
 }
 
+// isFromFutureEpoch returns true if the epoch of blocks of the given height
+// starts more than MaxClockDrift after the current time.
+func (syncer *DefaultSyncer) isFromFutureEpoch(height uint64) bool {
+	if syncer.clock == nil {
+		return false
+	}
+	return height > syncer.clock.EpochAtTime(syncer.clock.Now().Add(MaxClockDrift))
+}
+
 // tipSetState returns the state resulting from applying the input tipset to
 // the chain.  Precondition: the tipset must be in the store
 func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey types.SortedCidSet) (state.Tree, error) {
@@ -320,6 +346,11 @@ func (syncer *DefaultSyncer) widen(ctx context.Context, ts types.TipSet) (types.
 	return wts, nil
 }
 
+// IsBadTipSet returns true if the tipset is in the syncer's bad tipset cache.
+func (syncer *DefaultSyncer) IsBadTipSet(tipsetCids types.SortedCidSet) bool {
+	return syncer.badTipSets.Has(tipsetCids.String())
+}
+
 // HandleNewTipset extends the Syncer's chain store with the given tipset if they
 // represent a valid extension. It limits the length of new chains it will
 // attempt to validate and caches invalid blocks it has encountered to
@@ -3,15 +3,18 @@ package chain_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/libp2p/go-libp2p-peer"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/clock"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/gengen/util"
 	"github.com/filecoin-project/go-filecoin/proofs"
@@ -184,7 +187,7 @@ func loadSyncerFromRepo(require *require.Assertions, r repo.Repo) (*chain.Defaul
 	bs := bstore.NewBlockstore(r.Datastore())
 	cst := hamt.NewCborStore()
 	verifier := proofs.NewFakeVerifier(true, nil)
-	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), powerTable, genCid, verifier)
+	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), powerTable, genCid, verifier, &th.TestBlockSignatureValidator{}, th.NewTestSectorsView(types.CommR{}))
 
 	calcGenBlk, err := initGenesis(cst, bs) // flushes state
 	require.NoError(err)
@@ -193,7 +196,7 @@ func loadSyncerFromRepo(require *require.Assertions, r repo.Repo) (*chain.Defaul
 	chainStore := chain.NewDefaultStore(chainDS, cst, calcGenBlk.Cid())
 
 	blockSource := th.NewTestFetcher()
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource, nil) // note we use same cst for on and offline for tests
 
 	ctx := context.Background()
 	err = chainStore.Load(ctx)
@@ -210,7 +213,7 @@ func initSyncTestDefault(require *require.Assertions) (*chain.DefaultSyncer, cha
 	bs := bstore.NewBlockstore(r.Datastore())
 	cst := hamt.NewCborStore()
 	verifier := proofs.NewFakeVerifier(true, nil)
-	con := consensus.NewExpected(cst, bs, processor, powerTable, genCid, verifier)
+	con := consensus.NewExpected(cst, bs, processor, powerTable, genCid, verifier, &th.TestBlockSignatureValidator{}, th.NewTestSectorsView(types.CommR{}))
 	requireSetTestChain(require, con, false)
 	return initSyncTest(require, con, initGenesis, cst, bs, r)
 }
@@ -223,7 +226,7 @@ func initSyncTestWithPowerTable(require *require.Assertions, powerTable consensu
 	bs := bstore.NewBlockstore(r.Datastore())
 	cst := hamt.NewCborStore()
 	verifier := proofs.NewFakeVerifier(true, nil)
-	con := consensus.NewExpected(cst, bs, processor, powerTable, genCid, verifier)
+	con := consensus.NewExpected(cst, bs, processor, powerTable, genCid, verifier, &th.TestBlockSignatureValidator{}, th.NewTestSectorsView(types.CommR{}))
 	requireSetTestChain(require, con, false)
 	sync, testchain, _, fetcher := initSyncTest(require, con, initGenesis, cst, bs, r)
 	return sync, testchain, con, fetcher
@@ -239,7 +242,7 @@ func initSyncTest(require *require.Assertions, con consensus.Protocol, genFunc f
 	chainStore := chain.NewDefaultStore(chainDS, cst, calcGenBlk.Cid())
 
 	fetcher := th.NewTestFetcher()
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, fetcher) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(cst, con, chainStore, fetcher, nil) // note we use same cst for on and offline for tests
 
 	// Initialize stores to contain genesis block and state
 	calcGenTS := th.RequireNewTipSet(require, calcGenBlk)
@@ -591,6 +594,41 @@ func TestBlocksNotATipSet(t *testing.T) {
 	assertNoAdd(assert, chainStore, badCids)
 }
 
+// Syncer rejects tipsets whose epoch starts after the drift tolerance, and
+// syncs them once their epoch comes.
+func TestSyncRejectsFutureTipSet(t *testing.T) {
+	tf.BadUnitTestWithSideEffects(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := hamt.NewCborStore()
+	verifier := proofs.NewFakeVerifier(true, nil)
+	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, genCid, verifier, &th.TestBlockSignatureValidator{}, th.NewTestSectorsView(types.CommR{}))
+	requireSetTestChain(require, con, false)
+	_, chainStore, _, blockSource := initSyncTest(require, con, initGenesis, cst, bs, r)
+	ctx := context.Background()
+
+	genesisTime := time.Unix(1000000, 0)
+	now := genesisTime
+	clk := clock.NewChainClock(genesisTime, time.Minute, func() time.Time { return now })
+	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource, clk)
+	genTS := requireHeadTipset(require, chainStore)
+
+	cids := requirePutBlocks(require, blockSource, link1.ToSlice()...)
+	err := syncer.HandleNewTipset(ctx, cids)
+	require.Error(err)
+	assert.Equal(chain.ErrFutureTipSet, errors.Cause(err))
+	assertHead(assert, chainStore, genTS)
+
+	// Within the drift tolerance of the epoch of link1.
+	now = genesisTime.Add(time.Minute - chain.MaxClockDrift)
+	err = syncer.HandleNewTipset(ctx, cids)
+	assert.NoError(err)
+	assertHead(assert, chainStore, link1)
+}
+
 /* particularly tricky edge cases relating to subtle Expected Consensus requirements */
 
 // Syncer is capable of recovering from a fork reorg after Load.
@@ -958,7 +996,7 @@ func TestTipSetWeightDeep(t *testing.T) {
 	chainStore := chain.NewDefaultStore(r.ChainDatastore(), cst, calcGenBlk.Cid())
 
 	verifier := proofs.NewFakeVerifier(true, nil)
-	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, calcGenBlk.Cid(), verifier)
+	con := consensus.NewExpected(cst, bs, th.NewTestProcessor(), &th.TestView{}, calcGenBlk.Cid(), verifier, &th.TestBlockSignatureValidator{}, th.NewTestSectorsView(types.CommR{}))
 
 	// Initialize stores to contain genesis block and state
 	calcGenTS := th.RequireNewTipSet(require, &calcGenBlk)
@@ -977,8 +1015,8 @@ func TestTipSetWeightDeep(t *testing.T) {
 
 	// Now sync the chainStore with consensus using a MarketView.
 	verifier = proofs.NewFakeVerifier(true, nil)
-	con = consensus.NewExpected(cst, bs, th.NewTestProcessor(), &consensus.MarketView{}, calcGenBlk.Cid(), verifier)
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource)
+	con = consensus.NewExpected(cst, bs, th.NewTestProcessor(), &consensus.MarketView{}, calcGenBlk.Cid(), verifier, &th.TestBlockSignatureValidator{}, th.NewTestSectorsView(types.CommR{}))
+	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource, nil)
 	baseTS := requireHeadTipset(require, chainStore) // this is the last block of the bootstrapping chain creating miners
 	require.Equal(1, len(baseTS))
 	bootstrapStateRoot := baseTS.ToSlice()[0].StateRoot
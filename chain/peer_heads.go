@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// PeerHead is the heaviest tipset a peer told us about.
+type PeerHead struct {
+	Peer   peer.ID
+	Cids   types.SortedCidSet
+	Height uint64
+	// Weight is the parent weight of the peer's heaviest tipset.
+	Weight uint64
+}
+
+// PeerHeadTracker keeps track of the heads announced by connected peers so the
+// node syncs from the peer with the heaviest chain, rather than from every
+// peer it hears from.
+type PeerHeadTracker struct {
+	mu    sync.Mutex
+	heads map[peer.ID]*PeerHead
+}
+
+// NewPeerHeadTracker creates an empty PeerHeadTracker.
+func NewPeerHeadTracker() *PeerHeadTracker {
+	return &PeerHeadTracker{
+		heads: make(map[peer.ID]*PeerHead),
+	}
+}
+
+// Update records the head announced by a peer, replacing any previous one.
+func (t *PeerHeadTracker) Update(head *PeerHead) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.heads[head.Peer] = head
+}
+
+// Remove forgets the head of a peer, e.g. when it disconnects.
+func (t *PeerHeadTracker) Remove(p peer.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.heads, p)
+}
+
+// Heaviest returns the heaviest head announced by any peer, or nil if no peer
+// has announced one. Ties are broken by height and then by peer ID so the
+// choice is deterministic.
+func (t *PeerHeadTracker) Heaviest() *PeerHead {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var best *PeerHead
+	for _, head := range t.heads {
+		if best == nil || isHeavierPeerHead(head, best) {
+			best = head
+		}
+	}
+	return best
+}
+
+// SyncTarget returns the head the node should sync to given the parent weight
+// and height of its own head, or nil if no peer claims a heavier chain. Parent
+// weights are equal for a tipset and its children with no weight of their own
+// (e.g. the genesis tipset and the first tipsets above it), so equal weights are
+// compared by height.
+func (t *PeerHeadTracker) SyncTarget(ourWeight uint64, ourHeight uint64) *PeerHead {
+	targets := t.SyncTargets(ourWeight, ourHeight)
+	if len(targets) == 0 {
+		return nil
+	}
+	return targets[0]
+}
+
+// SyncTargets returns the heads heavier than the node's own head, heaviest
+// first, so the node can fall back to the next one when syncing to a head
+// fails.
+func (t *PeerHeadTracker) SyncTargets(ourWeight uint64, ourHeight uint64) []*PeerHead {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ours := &PeerHead{Weight: ourWeight, Height: ourHeight}
+	var targets []*PeerHead
+	for _, head := range t.heads {
+		if isHeavierPeerHead(head, ours) {
+			targets = append(targets, head)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return isHeavierPeerHead(targets[i], targets[j])
+	})
+	return targets
+}
+
+func isHeavierPeerHead(a, b *PeerHead) bool {
+	if a.Weight != b.Weight {
+		return a.Weight > b.Weight
+	}
+	if a.Height != b.Height {
+		return a.Height > b.Height
+	}
+	return a.Peer < b.Peer
+}
@@ -0,0 +1,68 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/stretchr/testify/assert"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestPeerHeadTracker(t *testing.T) {
+	tf.UnitTest(t)
+
+	light := &PeerHead{Peer: peer.ID("a"), Cids: types.NewSortedCidSet(types.SomeCid()), Height: 10, Weight: 5}
+	heavy := &PeerHead{Peer: peer.ID("b"), Cids: types.NewSortedCidSet(types.SomeCid()), Height: 8, Weight: 7}
+
+	t.Run("empty tracker has no sync target", func(t *testing.T) {
+		tracker := NewPeerHeadTracker()
+		assert.Nil(t, tracker.Heaviest())
+		assert.Nil(t, tracker.SyncTarget(0, 0))
+	})
+
+	t.Run("chooses the heaviest peer rather than the highest", func(t *testing.T) {
+		tracker := NewPeerHeadTracker()
+		tracker.Update(light)
+		tracker.Update(heavy)
+
+		assert.Equal(t, heavy, tracker.Heaviest())
+		assert.Equal(t, heavy, tracker.SyncTarget(6, 20))
+	})
+
+	t.Run("does not sync to chains no heavier than ours", func(t *testing.T) {
+		tracker := NewPeerHeadTracker()
+		tracker.Update(light)
+		tracker.Update(heavy)
+
+		assert.Nil(t, tracker.SyncTarget(7, 8))
+		assert.Nil(t, tracker.SyncTarget(8, 0))
+	})
+
+	t.Run("compares heights when weights are equal", func(t *testing.T) {
+		tracker := NewPeerHeadTracker()
+		tracker.Update(heavy)
+
+		assert.Equal(t, heavy, tracker.SyncTarget(7, 7))
+	})
+
+	t.Run("orders sync targets heaviest first", func(t *testing.T) {
+		tracker := NewPeerHeadTracker()
+		tracker.Update(light)
+		tracker.Update(heavy)
+
+		assert.Equal(t, []*PeerHead{heavy, light}, tracker.SyncTargets(0, 0))
+		assert.Equal(t, []*PeerHead{heavy}, tracker.SyncTargets(6, 0))
+		assert.Empty(t, tracker.SyncTargets(7, 8))
+	})
+
+	t.Run("forgets removed peers", func(t *testing.T) {
+		tracker := NewPeerHeadTracker()
+		tracker.Update(light)
+		tracker.Update(heavy)
+		tracker.Remove(heavy.Peer)
+
+		assert.Equal(t, light, tracker.Heaviest())
+	})
+}
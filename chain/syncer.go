@@ -18,4 +18,7 @@ import (
 // after too many blocks.
 type Syncer interface {
 	HandleNewTipset(ctx context.Context, tipsetCids types.SortedCidSet) error
+	// IsBadTipSet returns true if the tipset, or one of its ancestors, was
+	// found invalid. Callers use it to hold the peers that sent it to account.
+	IsBadTipSet(tipsetCids types.SortedCidSet) bool
 }
@@ -0,0 +1,55 @@
+// Package clock tells the epoch of a chain from the wall-clock time.
+package clock
+
+import (
+	"time"
+)
+
+// ChainClock computes the epochs of a chain from the time of its genesis block
+// and its block time. Epoch n starts n block times after the genesis block,
+// and a block of height n belongs to epoch n.
+type ChainClock struct {
+	genesisTime time.Time
+	blockTime   time.Duration
+	now         func() time.Time
+}
+
+// NewChainClock returns a ChainClock for a chain whose genesis block is from
+// genesisTime and whose epochs last blockTime, reading the wall-clock time
+// with now.
+func NewChainClock(genesisTime time.Time, blockTime time.Duration, now func() time.Time) *ChainClock {
+	return &ChainClock{
+		genesisTime: genesisTime,
+		blockTime:   blockTime,
+		now:         now,
+	}
+}
+
+// Now returns the current wall-clock time.
+func (c *ChainClock) Now() time.Time {
+	return c.now()
+}
+
+// BlockTime returns the duration of an epoch.
+func (c *ChainClock) BlockTime() time.Duration {
+	return c.blockTime
+}
+
+// EpochAtTime returns the epoch at time t. Times before the genesis block are
+// in epoch 0.
+func (c *ChainClock) EpochAtTime(t time.Time) uint64 {
+	if !t.After(c.genesisTime) {
+		return 0
+	}
+	return uint64(t.Sub(c.genesisTime) / c.blockTime)
+}
+
+// CurrentEpoch returns the epoch at the current wall-clock time.
+func (c *ChainClock) CurrentEpoch() uint64 {
+	return c.EpochAtTime(c.Now())
+}
+
+// EpochStart returns the time at which the epoch starts.
+func (c *ChainClock) EpochStart(epoch uint64) time.Time {
+	return c.genesisTime.Add(time.Duration(epoch) * c.blockTime)
+}
@@ -0,0 +1,31 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/clock"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestChainClock(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+
+	genesisTime := time.Unix(1000, 0)
+	now := genesisTime.Add(95 * time.Second)
+	clk := clock.NewChainClock(genesisTime, 30*time.Second, func() time.Time { return now })
+
+	assert.Equal(uint64(3), clk.CurrentEpoch())
+	assert.Equal(uint64(0), clk.EpochAtTime(genesisTime))
+	assert.Equal(uint64(0), clk.EpochAtTime(genesisTime.Add(-time.Hour)))
+	assert.Equal(uint64(0), clk.EpochAtTime(genesisTime.Add(29*time.Second)))
+	assert.Equal(uint64(1), clk.EpochAtTime(genesisTime.Add(30*time.Second)))
+
+	assert.Equal(genesisTime, clk.EpochStart(0))
+	assert.Equal(genesisTime.Add(90*time.Second), clk.EpochStart(3))
+	assert.Equal(uint64(7), clk.EpochAtTime(clk.EpochStart(7)))
+}
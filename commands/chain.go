@@ -11,6 +11,7 @@ import (
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
 
+	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -19,8 +20,9 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"head": chainHeadCmd,
-		"ls":   chainLsCmd,
+		"head":   chainHeadCmd,
+		"ls":     chainLsCmd,
+		"notify": chainNotifyCmd,
 	},
 }
 
@@ -108,3 +110,92 @@ var chainLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+// ChainTipSetResult describes a tipset in a head change.
+type ChainTipSetResult struct {
+	Height uint64
+	Cids   []cid.Cid
+}
+
+// ChainNotifyResult describes a single change of the chain head. Reverted
+// tipsets are listed from the old head downwards, applied tipsets from the
+// common ancestor upwards to the new head.
+type ChainNotifyResult struct {
+	Reverted []ChainTipSetResult
+	Applied  []ChainTipSetResult
+}
+
+var chainNotifyCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Stream changes of the chain head",
+		ShortDescription: `
+Emits an entry each time the chain head changes, listing the tipsets reverted
+from the old chain (from the old head downwards) and the tipsets applied from
+the new chain (in increasing height up to the new head). A change with reverted
+tipsets is a reorg.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		for change := range GetPorcelainAPI(env).ChainNotify(req.Context) {
+			result, err := newChainNotifyResult(change)
+			if err != nil {
+				return err
+			}
+			if err := re.Emit(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: ChainNotifyResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *ChainNotifyResult) error {
+			for _, ts := range res.Reverted {
+				if _, err := fmt.Fprintf(w, "revert\t%d\t%s\n", ts.Height, cidsString(ts.Cids)); err != nil {
+					return err
+				}
+			}
+			for _, ts := range res.Applied {
+				if _, err := fmt.Fprintf(w, "apply\t%d\t%s\n", ts.Height, cidsString(ts.Cids)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+func newChainNotifyResult(change *core.HeadChange) (*ChainNotifyResult, error) {
+	reverted, err := newChainTipSetResults(change.Reverted)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := newChainTipSetResults(change.Applied)
+	if err != nil {
+		return nil, err
+	}
+	return &ChainNotifyResult{Reverted: reverted, Applied: applied}, nil
+}
+
+func newChainTipSetResults(tipSets []types.TipSet) ([]ChainTipSetResult, error) {
+	results := make([]ChainTipSetResult, len(tipSets))
+	for i, ts := range tipSets {
+		height, err := ts.Height()
+		if err != nil {
+			return nil, err
+		}
+		results[i] = ChainTipSetResult{
+			Height: height,
+			Cids:   ts.ToSortedCidSet().ToSlice(),
+		}
+	}
+	return results, nil
+}
+
+func cidsString(cids []cid.Cid) string {
+	strs := make([]string, len(cids))
+	for i, c := range cids {
+		strs[i] = c.String()
+	}
+	return strings.Join(strs, " ")
+}
@@ -2,14 +2,18 @@ package commands_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/filecoin-project/go-filecoin/commands"
 	"github.com/filecoin-project/go-filecoin/fixtures"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
@@ -149,3 +153,56 @@ func TestChainLs(t *testing.T) {
 		assert.Contains(chainLsResult, `"nonce":"0"`)
 	})
 }
+
+func TestChainNotify(t *testing.T) {
+	tf.IntegrationTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// chain notify streams until it is killed, so it runs next to the commands of the test.
+	notify := exec.CommandContext(ctx, th.MustGetFilecoinBinary(), "chain", "notify", "--enc", "json", "--repodir="+d.RepoDir(), "--cmdapiaddr="+d.CmdAddr())
+	stdout, err := notify.StdoutPipe()
+	require.NoError(err)
+	require.NoError(notify.Start())
+	defer notify.Process.Kill() // nolint: errcheck
+
+	results := make(chan commands.ChainNotifyResult, 10)
+	go func() {
+		defer close(results)
+		dec := json.NewDecoder(stdout)
+		for {
+			var res commands.ChainNotifyResult
+			if err := dec.Decode(&res); err != nil {
+				return
+			}
+			results <- res
+		}
+	}()
+
+	// The stream may start after the first blocks are mined, so mine until one is reported.
+	mined := make(map[cid.Cid]bool)
+	for i := 0; i < 10; i++ {
+		c, err := cid.Parse(d.RunSuccess("mining", "once", "--enc", "text").ReadStdoutTrimNewlines())
+		require.NoError(err)
+		mined[c] = true
+
+		select {
+		case res, ok := <-results:
+			require.True(ok, "chain notify exited")
+			assert.Empty(res.Reverted)
+			require.Len(res.Applied, 1)
+			require.Len(res.Applied[0].Cids, 1)
+			assert.True(mined[res.Applied[0].Cids[0]])
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+	t.Fatal("chain notify reported no head change")
+}
@@ -4,16 +4,20 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
 	"github.com/ipfs/go-ipfs-files"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var clientCmd = &cmds.Command{
@@ -25,6 +29,8 @@ var clientCmd = &cmds.Command{
 		"import":               clientImportDataCmd,
 		"propose-storage-deal": clientProposeStorageDealCmd,
 		"query-storage-deal":   clientQueryStorageDealCmd,
+		"list-deals":           clientListDealsCmd,
+		"store":                clientStoreCmd,
 		"list-asks":            clientListAsksCmd,
 		"payments":             paymentsCmd,
 	},
@@ -111,6 +117,18 @@ Duration should be specified with the number of blocks for which to store the
 data. New blocks are generated about every 30 seconds, so the time given should
 be represented as a count of 30 second intervals. For example, 1 minute would
 be 2, 1 hour would be 120, and 1 day would be 2880.
+
+With --manual-transfer, the miner doesn't fetch the data over the network. The
+data is delivered to the miner out of band, e.g. on hard drives, and the miner
+operator imports it with:
+
+$ go-filecoin miner import-deal-data <deal-id> <file>
+
+A miner may answer a proposal whose price or duration it doesn't accept with a
+counter-offer of its own terms. With --max-price, the proposal is sent again
+at the miner's price when it is at most the given price, in FIL per byte per
+block, and the duration is within the miner's bounds. Without it, the command
+fails with the terms of the counter-offer.
 `,
 	},
 	Arguments: []cmdkit.Argument{
@@ -121,9 +139,12 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption("allow-duplicates", "Allows duplicate proposals to be created. Unless this flag is set, you will not be able to make more than one deal per piece per miner. This protection exists to prevent erroneous duplicate deals."),
+		cmdkit.BoolOption("manual-transfer", "Deliver the data to the miner out of band instead of over the network"),
+		cmdkit.StringOption("max-price", "Highest price, in FIL per byte per block, at which to accept a counter-offer of the miner"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		allowDuplicates, _ := req.Options["allow-duplicates"].(bool)
+		manualTransfer, _ := req.Options["manual-transfer"].(bool)
 
 		miner, err := address.NewFromString(req.Arguments[0])
 		if err != nil {
@@ -145,7 +166,16 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 			return err
 		}
 
-		resp, err := GetStorageAPI(env).ProposeStorageDeal(req.Context, data, miner, askid, duration, allowDuplicates)
+		var maxPrice *types.AttoFIL
+		if maxPriceOption, ok := req.Options["max-price"]; ok {
+			price, ok := types.NewAttoFILFromFILString(maxPriceOption.(string))
+			if !ok {
+				return ErrInvalidPrice
+			}
+			maxPrice = price
+		}
+
+		resp, err := GetStorageAPI(env).ProposeStorageDeal(req.Context, data, miner, askid, duration, allowDuplicates, manualTransfer, maxPrice)
 		if err != nil {
 			return err
 		}
@@ -198,6 +228,171 @@ format is specified with the --enc flag.
 	},
 }
 
+var clientListDealsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the storage deals made by this node",
+		ShortDescription: `
+Lists the storage deals this node made as a client. Results will be returned as
+a space separated table with deal id, miner, piece, total price, duration in
+blocks, state, sector and health respectively. The sector is "-" until the
+miner has committed it. The health is the result of the last check of the deal
+by the node's deal monitor, which periodically queries the miner and verifies
+that the miner keeps the deal's sector on chain and keeps proving it.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		deals, err := GetStorageAPI(env).ListStorageDeals()
+		if err != nil {
+			return err
+		}
+
+		for _, deal := range deals {
+			if err := re.Emit(deal); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: storagedeal.Deal{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, deal *storagedeal.Deal) error {
+			return writeDeal(w, deal)
+		}),
+	},
+}
+
+// writeDeal writes a client deal as a line of the list-deals table.
+func writeDeal(w io.Writer, deal *storagedeal.Deal) error {
+	sector := "-"
+	if deal.Response.ProofInfo != nil {
+		sector = strconv.FormatUint(deal.Response.ProofInfo.SectorID, 10)
+	}
+
+	health := "unchecked"
+	if deal.Health != nil {
+		health = "ok"
+		if !deal.Health.Healthy() {
+			health = strings.Join(deal.Health.Problems, "; ")
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s %s %s %d %s %s %s\n",
+		deal.Response.ProposalCid,
+		deal.Miner,
+		deal.Proposal.PieceRef,
+		deal.Proposal.TotalPrice,
+		deal.Proposal.Duration,
+		deal.Response.State,
+		sector,
+		health,
+	)
+	return err
+}
+
+var clientStoreCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Store data with miners picked automatically",
+		ShortDescription: `Proposes storage deals for data to several miners`,
+		LongDescription: `
+Stores data with --replicas distinct miners, picked from the asks of the storage
+market. The data is the file given, or stdin, which is imported first like with
+client import. Pass --cid instead to store data already imported.
+
+Miners are ranked by the price of their asks, then by how reliable they were in
+this node's past deals, then by power. Miners most of whose past deals failed or
+turned unhealthy come last. Deals are proposed to the miners in parallel; when a
+miner doesn't accept a proposal, the next miner in the ranking is tried, until
+enough deals are made or no miner remains.
+
+--max-price, in FIL per byte per block, excludes the asks above it and is the
+highest price of a counter-offer to accept.
+
+The deals made are listed like with client list-deals, followed by the miners
+that didn't accept a proposal and why.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("file", false, false, "Path of a file to import and store").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption("replicas", "Number of distinct miners to store the data with").WithDefault(1),
+		cmdkit.Uint64Option("duration", "Time in blocks (about 30 seconds per block) to store data"),
+		cmdkit.StringOption("max-price", "Highest price, in FIL per byte per block, to pay"),
+		cmdkit.StringOption("cid", "CID of imported data to store in place of a file"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		replicas, _ := req.Options["replicas"].(int)
+		duration, ok := req.Options["duration"].(uint64)
+		if !ok || duration == 0 {
+			return errors.New("a --duration is required")
+		}
+
+		var maxPrice *types.AttoFIL
+		if maxPriceOption, ok := req.Options["max-price"]; ok {
+			price, ok := types.NewAttoFILFromFILString(maxPriceOption.(string))
+			if !ok {
+				return ErrInvalidPrice
+			}
+			maxPrice = price
+		}
+
+		var data cid.Cid
+		if dataCid, ok := req.Options["cid"].(string); ok {
+			c, err := cid.Decode(dataCid)
+			if err != nil {
+				return err
+			}
+			data = c
+		} else {
+			if req.Files == nil {
+				return errors.New("a file or --cid is required")
+			}
+			iter := req.Files.Entries()
+			if !iter.Next() {
+				return fmt.Errorf("no file given: %s", iter.Err())
+			}
+
+			fi, ok := iter.Node().(files.File)
+			if !ok {
+				return fmt.Errorf("given file was not a files.File")
+			}
+
+			node, err := GetPorcelainAPI(env).DAGImportData(req.Context, fi)
+			if err != nil {
+				return err
+			}
+			data = node.Cid()
+		}
+
+		result, err := GetStorageAPI(env).StoreData(req.Context, data, storage.StoreParams{
+			Replicas: replicas,
+			Duration: duration,
+			MaxPrice: maxPrice,
+		})
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(result)
+	},
+	Type: storage.StoreResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, result *storage.StoreResult) error {
+			for _, deal := range result.Deals {
+				if err := writeDeal(w, deal); err != nil {
+					return err
+				}
+			}
+			for _, failure := range result.Failures {
+				if _, err := fmt.Fprintf(w, "failed with %s: %s\n", failure.Miner, failure.Error); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
+
 var clientListAsksCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "List all asks in the storage market",
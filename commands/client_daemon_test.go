@@ -70,6 +70,10 @@ func TestStorageDealsAfterRestart(t *testing.T) {
 	minerDaemon.ConnectSuccess(clientDaemon)
 
 	assert.NotEmpty(clientDaemon.RunSuccess("client", "query-storage-deal", dealCid).ReadStdout())
+
+	listDealsOutput := clientDaemon.RunSuccess("client", "list-deals").ReadStdoutTrimNewlines()
+	assert.Contains(listDealsOutput, dealCid+" "+fixtures.TestMiners[0]+" "+dataCid)
+	assert.Empty(minerDaemon.RunSuccess("client", "list-deals").ReadStdoutTrimNewlines())
 }
 
 func TestDuplicateDeals(t *testing.T) {
@@ -25,9 +25,11 @@ var msgCmd = &cmds.Command{
 		Tagline: "Send and monitor messages",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"send":   msgSendCmd,
-		"status": msgStatusCmd,
-		"wait":   msgWaitCmd,
+		"cancel":  msgCancelCmd,
+		"replace": msgReplaceCmd,
+		"send":    msgSendCmd,
+		"status":  msgStatusCmd,
+		"wait":    msgWaitCmd,
 	},
 }
 
@@ -138,6 +140,89 @@ var msgSendCmd = &cmds.Command{
 	},
 }
 
+var msgReplaceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Re-send a message with a higher gas price",
+		ShortDescription: `
+Re-signs a message that is waiting in the outbox with the same nonce and the
+given gas price and limit, replaces it in the outbox and publishes it. The gas
+price must be high enough for message pools to replace the original message,
+which is then no longer mined.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to replace"),
+	},
+	Options: []cmdkit.Option{
+		priceOption,
+		limitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid cid "+req.Arguments[0])
+		}
+
+		gasPrice, gasLimit, _, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		c, err := GetPorcelainAPI(env).MessageReplace(req.Context, msgCid, gasPrice, gasLimit)
+		if err != nil {
+			return err
+		}
+		return re.Emit(c)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
+var msgCancelCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Cancel a message that has not been mined",
+		ShortDescription: `
+Replaces a message that is waiting in the outbox by a message sending nothing
+from its sender to itself with the same nonce, and publishes it. The gas price
+must be high enough for message pools to replace the original message.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to cancel"),
+	},
+	Options: []cmdkit.Option{
+		priceOption,
+		limitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid cid "+req.Arguments[0])
+		}
+
+		gasPrice, gasLimit, _, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		c, err := GetPorcelainAPI(env).MessageCancel(req.Context, msgCid, gasPrice, gasLimit)
+		if err != nil {
+			return err
+		}
+		return re.Emit(c)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			return PrintString(w, c)
+		}),
+	},
+}
+
 // WaitResult is the result of a message wait call.
 type WaitResult struct {
 	Message   *types.SignedMessage
@@ -9,11 +9,13 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-files"
 	"github.com/libp2p/go-libp2p-peer"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -22,12 +24,13 @@ var minerCmd = &cmds.Command{
 		Tagline: "Manage a single miner actor",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"create":        minerCreateCmd,
-		"owner":         minerOwnerCmd,
-		"pledge":        minerPledgeCmd,
-		"power":         minerPowerCmd,
-		"set-price":     minerSetPriceCmd,
-		"update-peerid": minerUpdatePeerIDCmd,
+		"create":           minerCreateCmd,
+		"import-deal-data": minerImportDealDataCmd,
+		"owner":            minerOwnerCmd,
+		"pledge":           minerPledgeCmd,
+		"power":            minerPowerCmd,
+		"set-price":        minerSetPriceCmd,
+		"update-peerid":    minerUpdatePeerIDCmd,
 	},
 }
 
@@ -180,10 +183,58 @@ type MinerSetPriceResult struct {
 	Preview               bool
 }
 
+var minerImportDealDataCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Import the data of a storage deal transferred out of band",
+		ShortDescription: `
+Imports the data of a storage deal the client proposed with --manual-transfer,
+e.g. from hard drives the client shipped. The data must hash to the piece of
+the deal. The miner then stages it into a sector like data fetched over the
+network.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("deal", true, false, "CID of the deal proposal"),
+		cmdkit.FileArg("file", true, false, "Path to the file of the deal data").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		proposalCid, err := cid.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+
+		resp, err := GetStorageAPI(env).ImportDealData(req.Context, proposalCid, fi)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(resp)
+	},
+	Type: storagedeal.Response{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, resp *storagedeal.Response) error {
+			fmt.Fprintf(w, "State:   %s\n", resp.State.String())       // nolint: errcheck
+			fmt.Fprintf(w, "Message: %s\n", resp.Message)              // nolint: errcheck
+			fmt.Fprintf(w, "DealID:  %s\n", resp.ProposalCid.String()) // nolint: errcheck
+			return nil
+		}),
+	},
+}
+
 var minerSetPriceCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Set the minimum price for storage",
-		ShortDescription: `Sets the mining.minimumPrice in config and creates a new ask for the given price.
+		ShortDescription: `Sets the miner's price in mining.storagePrices in config and creates a new ask for the given price.
 This command waits for the ask to be mined.`,
 	},
 	Arguments: []cmdkit.Argument{
@@ -208,12 +259,9 @@ This command waits for the ask to be mined.`,
 			return err
 		}
 
-		var minerAddr address.Address
-		if req.Options["miner"] != nil {
-			minerAddr, err = address.NewFromString(req.Options["miner"].(string))
-			if err != nil {
-				return errors.Wrap(err, "miner must be an address")
-			}
+		minerAddr, err := optionalMinerAddr(req.Options["miner"])
+		if err != nil {
+			return err
 		}
 
 		expiry, ok := big.NewInt(0).SetString(req.Arguments[1], 10)
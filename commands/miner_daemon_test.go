@@ -36,6 +36,7 @@ func TestMinerHelp(t *testing.T) {
 
 		expected := []string{
 			"miner create <pledge> <collateral>      - Create a new file miner with <pledge> sectors and <collateral> FIL",
+			"miner import-deal-data <deal> <file>    - Import the data of a storage deal transferred out of band",
 			"miner owner <miner>                     - Show the actor address of <miner>",
 			"miner pledge <miner>                    - View number of pledged sectors for <miner>",
 			"miner power <miner>                     - Get the power of a miner versus the total storage market power",
@@ -300,9 +301,9 @@ func TestMinerSetPrice(t *testing.T) {
 	setPrice := d1.RunSuccess("miner", "set-price", "62", "6", "--gas-price", "0", "--gas-limit", "300")
 	assert.Contains(setPrice.ReadStdoutTrimNewlines(), fmt.Sprintf("Set price for miner %s to 62.", fixtures.TestMiners[0]))
 
-	configuredPrice := d1.RunSuccess("config", "mining.storagePrice")
+	configuredPrices := d1.RunSuccess("config", "mining.storagePrices")
 
-	assert.Equal(`"62"`, configuredPrice.ReadStdoutTrimNewlines())
+	assert.Contains(configuredPrices.ReadStdoutTrimNewlines(), fmt.Sprintf(`"%s": "62"`, fixtures.TestMiners[0]))
 }
 
 func TestMinerCreateSuccess(t *testing.T) {
@@ -7,6 +7,11 @@ import (
 	"github.com/ipfs/go-cid"
 	cmdkit "github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/mining"
+	"github.com/filecoin-project/go-filecoin/porcelain"
 )
 
 var miningCmd = &cmds.Command{
@@ -14,15 +19,25 @@ var miningCmd = &cmds.Command{
 		Tagline: "Manage all mining operations for a node",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"once":  miningOnceCmd,
-		"start": miningStartCmd,
-		"stop":  miningStopCmd,
+		"once":     miningOnceCmd,
+		"start":    miningStartCmd,
+		"stats":    miningStatsCmd,
+		"stop":     miningStopCmd,
+		"template": miningTemplateCmd,
 	},
 }
 
 var miningOnceCmd = &cmds.Command{
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("miner", "The address of the miner to mine for, instead of the default miner"),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
-		blk, err := GetBlockAPI(env).MiningOnce(req.Context)
+		minerAddr, err := optionalMinerAddr(req.Options["miner"])
+		if err != nil {
+			return err
+		}
+
+		blk, err := GetBlockAPI(env).MiningOnce(req.Context, minerAddr)
 		if err != nil {
 			return err
 		}
@@ -38,8 +53,16 @@ var miningOnceCmd = &cmds.Command{
 }
 
 var miningStartCmd = &cmds.Command{
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("miner", "The address of the miner to start, instead of all the node's miners"),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
-		if err := GetBlockAPI(env).MiningStart(req.Context); err != nil {
+		minerAddrs, err := miningMinerAddrs(req)
+		if err != nil {
+			return err
+		}
+
+		if err := GetBlockAPI(env).MiningStart(req.Context, minerAddrs...); err != nil {
 			return err
 		}
 		return re.Emit("Started mining")
@@ -49,13 +72,135 @@ var miningStartCmd = &cmds.Command{
 }
 
 var miningStopCmd = &cmds.Command{
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("miner", "The address of the miner to stop, instead of all the node's miners"),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
-		GetBlockAPI(env).MiningStop(req.Context)
+		minerAddrs, err := miningMinerAddrs(req)
+		if err != nil {
+			return err
+		}
+
+		GetBlockAPI(env).MiningStop(req.Context, minerAddrs...)
 		return re.Emit("Stopped mining")
 	},
 	Encoders: stringEncoderMap,
 }
 
+var miningStatsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the mining attempts of a miner",
+		ShortDescription: `
+Shows how many times a miner tried to mine a block, how many times it won and
+how many wins it could expect from its share of the storage power. Blocks it
+mined are canonical if they are in the chain, orphaned if the chain grew past
+them without them and pending if they are higher than the chain head. Rewards
+are the block rewards and gas fees of the canonical blocks.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("miner", "The address of the miner to show, instead of the default miner"),
+		cmdkit.BoolOption("history", "List every attempt"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := optionalMinerAddr(req.Options["miner"])
+		if err != nil {
+			return err
+		}
+
+		stats, err := GetPorcelainAPI(env).MiningStats(req.Context, minerAddr)
+		if err != nil {
+			return err
+		}
+		if history, _ := req.Options["history"].(bool); !history {
+			stats.History = nil
+		}
+		return re.Emit(stats)
+	},
+	Type: porcelain.MiningStats{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, stats *porcelain.MiningStats) error {
+			for _, a := range stats.History {
+				won := "lost"
+				if a.Won {
+					won = "won"
+				}
+				fmt.Fprintf(w, "%d\t%s\t%d\t%s", a.Height, a.Base, a.NullBlocks, won) // nolint: errcheck
+				if a.Block.Defined() {
+					fmt.Fprintf(w, "\t%s\t%s", a.Block, a.Status) // nolint: errcheck
+				}
+				fmt.Fprintln(w) // nolint: errcheck
+			}
+			fmt.Fprintf(w, "miner: %s\n", stats.Miner)                                                                          // nolint: errcheck
+			fmt.Fprintf(w, "attempts: %d, wins: %d, expected wins: %.2f\n", stats.Attempts, stats.Wins, stats.ExpectedWins)     // nolint: errcheck
+			fmt.Fprintf(w, "blocks canonical: %d, orphaned: %d, pending: %d\n", stats.Canonical, stats.Orphaned, stats.Pending) // nolint: errcheck
+			fmt.Fprintf(w, "rewards: %s\n", stats.Rewards.String())                                                             // nolint: errcheck
+			return nil
+		}),
+	},
+}
+
+var miningTemplateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Preview the messages of the next block",
+		ShortDescription: `
+Shows the pending messages this node would pack into the next block it mines,
+in the order it would apply them, and the gas they use and fees they pay.
+Messages whose nonce has already been used are listed as stale.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		tmpl, err := GetPorcelainAPI(env).MiningTemplate(req.Context)
+		if err != nil {
+			return err
+		}
+		return re.Emit(tmpl)
+	},
+	Type: mining.BlockTemplate{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, tmpl *mining.BlockTemplate) error {
+			for _, msg := range tmpl.Messages {
+				c, err := msg.Cid()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\n", c, msg.From, msg.Nonce, msg.GasPrice.String(), msg.GasLimit) // nolint: errcheck
+			}
+			for _, msg := range tmpl.Stale {
+				c, err := msg.Cid()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\tstale\n", c) // nolint: errcheck
+			}
+			fmt.Fprintf(w, "messages: %d, gas limit: %d, fees: %s\n", len(tmpl.Messages), tmpl.GasLimit, tmpl.Fees.String()) // nolint: errcheck
+			return nil
+		}),
+	},
+}
+
+// optionalMinerAddr parses the address given with a --miner option, if any.
+func optionalMinerAddr(o interface{}) (address.Address, error) {
+	if o == nil {
+		return address.Undef, nil
+	}
+	minerAddr, err := address.NewFromString(o.(string))
+	if err != nil {
+		return address.Undef, errors.Wrap(err, "miner must be an address")
+	}
+	return minerAddr, nil
+}
+
+// miningMinerAddrs returns the miner given with the --miner option of a mining
+// command, or no miner if the command applies to all the node's miners.
+func miningMinerAddrs(req *cmds.Request) ([]address.Address, error) {
+	minerAddr, err := optionalMinerAddr(req.Options["miner"])
+	if err != nil || minerAddr.Empty() {
+		return nil, err
+	}
+	return []address.Address{minerAddr}, nil
+}
+
 var stringEncoderMap = cmds.EncoderMap{
 	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, t string) error {
 		fmt.Fprintln(w, t) // nolint: errcheck
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/filecoin-project/go-filecoin/fixtures"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 )
 
@@ -38,3 +39,37 @@ func TestMiningGenBlock(t *testing.T) {
 
 	assert.Equal(sum.Add(beforeBalance, big.NewInt(1000)), afterBalance)
 }
+
+func TestMiningTemplate(t *testing.T) {
+	tf.IntegrationTest(t)
+
+	assert := assert.New(t)
+	d := th.NewDaemon(t, th.KeyFile(fixtures.KeyFilePaths()[0])).Start()
+	defer d.ShutdownSuccess()
+
+	out := d.RunSuccess("message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--gas-price", "0", "--gas-limit", "300",
+		"--value=10", fixtures.TestAddresses[2],
+	)
+	msgCid := strings.TrimSpace(out.ReadStdout())
+
+	tmpl := d.RunSuccess("mining", "template", "--enc", "text").ReadStdout()
+	assert.Contains(tmpl, msgCid)
+	assert.Contains(tmpl, "messages: 1, gas limit: 300, fees: 0")
+}
+
+func TestMiningStats(t *testing.T) {
+	tf.IntegrationTest(t)
+
+	assert := assert.New(t)
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	blk := strings.TrimSpace(d.RunSuccess("mining", "once").ReadStdout())
+
+	stats := d.RunSuccess("mining", "stats", "--history", "--enc", "text").ReadStdout()
+	assert.Contains(stats, "wins: 1,")
+	assert.Contains(stats, "blocks canonical: 1, orphaned: 0, pending: 0")
+	assert.Contains(stats, blk+"\tcanonical")
+}
@@ -1,11 +1,20 @@
 package commands
 
 import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var retrievalClientCmd = &cmds.Command{
@@ -13,6 +22,7 @@ var retrievalClientCmd = &cmds.Command{
 		Tagline: "Manage retrieval client operations",
 	},
 	Subcommands: map[string]*cmds.Command{
+		"find":           clientFindPieceCmd,
 		"retrieve-piece": clientRetrievePieceCmd,
 	},
 }
@@ -20,11 +30,32 @@ var retrievalClientCmd = &cmds.Command{
 var clientRetrievePieceCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Read out piece data stored by a miner on the network",
+		ShortDescription: `
+Retrieves a piece from a miner. When the miner charges for retrieval, the piece
+is paid for as it arrives, from a payment channel to the miner. Pass --max-price,
+in FIL per byte, to accept the price of the miner; without it only free
+retrievals are made.
+
+Pass --offset and --length to retrieve only a range of the bytes of the piece.
+Miners send the blocks of the piece's DAG that hold the bytes retrieved, which
+are checked against the piece's cid as they arrive: the output is cut short
+when a check fails. As the output holds the bytes checked so far, an interrupted
+retrieval can be resumed with --offset set to the size of the output.
+
+Pass --other-miners to retrieve parts of the piece from other miners storing it
+in parallel. A broken transfer is resumed from the same or another miner.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("miner", true, false, "Retrieval miner actor address"),
 		cmdkit.StringArg("cid", true, false, "Content identifier of piece to read"),
 	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("max-price", "Highest price, in FIL per byte, to pay for the piece"),
+		cmdkit.Uint64Option("offset", "Offset in bytes of the range of the piece to retrieve"),
+		cmdkit.Uint64Option("length", "Length in bytes of the range of the piece to retrieve, to the end of the piece by default"),
+		cmdkit.StringOption("other-miners", "Comma separated addresses of other miners to retrieve the piece from"),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		minerAddr, err := address.NewFromString(req.Arguments[0])
 		if err != nil {
@@ -36,16 +67,91 @@ var clientRetrievePieceCmd = &cmds.Command{
 			return err
 		}
 
-		mpid, err := GetPorcelainAPI(env).MinerGetPeerID(req.Context, minerAddr)
+		var maxPrice *types.AttoFIL
+		if maxPriceOption, ok := req.Options["max-price"]; ok {
+			price, ok := types.NewAttoFILFromFILString(maxPriceOption.(string))
+			if !ok {
+				return ErrInvalidPrice
+			}
+			maxPrice = price
+		}
+
+		offset, _ := req.Options["offset"].(uint64)
+		length, _ := req.Options["length"].(uint64)
+
+		minerAddrs := []address.Address{minerAddr}
+		if otherMiners, ok := req.Options["other-miners"].(string); ok {
+			for _, s := range strings.Split(otherMiners, ",") {
+				addr, err := address.NewFromString(strings.TrimSpace(s))
+				if err != nil {
+					return err
+				}
+				minerAddrs = append(minerAddrs, addr)
+			}
+		}
+
+		var mpids []peer.ID
+		for _, addr := range minerAddrs {
+			mpid, err := GetPorcelainAPI(env).MinerGetPeerID(req.Context, addr)
+			if err != nil {
+				return err
+			}
+			mpids = append(mpids, mpid)
+		}
+
+		readCloser, err := GetRetrievalAPI(env).RetrievePiece(req.Context, pieceCID, mpids, offset, length, maxPrice)
 		if err != nil {
 			return err
 		}
 
-		readCloser, err := GetRetrievalAPI(env).RetrievePiece(req.Context, pieceCID, mpid, minerAddr)
+		return re.Emit(readCloser)
+	},
+}
+
+var clientFindPieceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Find miners storing a piece and their retrieval offers",
+		ShortDescription: `
+Looks up the miners that announced the piece on the network and asks each of
+them for its retrieval offer. Offers are listed cheapest first, one per line
+with the miner address, its peer ID, the price in FIL per byte, the size of the
+piece in bytes and the estimated time to unseal the piece.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "Content identifier of the piece to find"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption("count", "Maximum number of providers of the piece to query").WithDefault(20),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		pieceCID, err := cid.Decode(req.Arguments[0])
 		if err != nil {
 			return err
 		}
 
-		return re.Emit(readCloser)
+		count, _ := req.Options["count"].(int)
+		if count <= 0 {
+			return errors.New("a positive --count is required")
+		}
+
+		offers, err := GetRetrievalAPI(env).FindOffers(req.Context, pieceCID, count)
+		if err != nil {
+			return err
+		}
+		for _, offer := range offers {
+			if err := re.Emit(offer); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: retrieval.MinerOffer{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, offer *retrieval.MinerOffer) error {
+			unsealDelay := time.Duration(offer.Offer.UnsealDelay) * time.Second
+			_, err := fmt.Fprintf(w, "%s %s %s %d %s\n", offer.Offer.Miner, offer.PeerID.Pretty(), offer.Offer.Price, offer.Offer.PieceSize, unsealDelay)
+			return err
+		}),
 	},
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
@@ -23,6 +24,7 @@ libp2p peers on the internet.
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
+		"bans":    swarmBansCmd,
 		"connect": swarmConnectCmd,
 		"peers":   swarmPeersCmd,
 	},
@@ -122,3 +124,41 @@ go-filecoin swarm connect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUE
 		}),
 	},
 }
+
+// SwarmBanResult describes a peer banned for misbehaving.
+type SwarmBanResult struct {
+	Peer   string
+	Reason string
+	Until  time.Time
+}
+
+var swarmBansCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List peers banned for misbehaving.",
+		ShortDescription: `
+'go-filecoin swarm bans' lists the peers this node refuses to connect to because
+they sent invalid blocks or messages, timed out or broke protocols too often,
+along with the reason and the time the ban expires.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		out := []SwarmBanResult{}
+		for _, ban := range GetPorcelainAPI(env).NetworkBans() {
+			out = append(out, SwarmBanResult{
+				Peer:   ban.Peer.Pretty(),
+				Reason: ban.Reason,
+				Until:  ban.Until,
+			})
+		}
+		return re.Emit(out)
+	},
+	Type: []SwarmBanResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bans []SwarmBanResult) error {
+			for _, ban := range bans {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", ban.Peer, ban.Until.Format(time.RFC3339), ban.Reason) // nolint: errcheck
+			}
+			return nil
+		}),
+	},
+}
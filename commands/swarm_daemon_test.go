@@ -3,6 +3,8 @@ package commands_test
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 )
@@ -29,3 +31,13 @@ func TestSwarmConnectPeersInvalid(t *testing.T) {
 		"swarm connect /ip4/hello",
 	)
 }
+
+func TestSwarmBansEmpty(t *testing.T) {
+	tf.IntegrationTest(t)
+
+	d1 := th.NewDaemon(t).Start()
+	defer d1.ShutdownSuccess()
+
+	out := d1.RunSuccess("swarm", "bans").ReadStdoutTrimNewlines()
+	assert.Equal(t, "", out)
+}
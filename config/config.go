@@ -103,16 +103,88 @@ func newDefaultBootstrapConfig() *BootstrapConfig {
 
 // MiningConfig holds all configuration options related to mining.
 type MiningConfig struct {
-	MinerAddress            address.Address `json:"minerAddress"`
-	AutoSealIntervalSeconds uint            `json:"autoSealIntervalSeconds"`
-	StoragePrice            *types.AttoFIL  `json:"storagePrice"`
+	// MinerAddress is the default miner, used when a command doesn't name one.
+	MinerAddress address.Address `json:"minerAddress"`
+	// MinerAddresses are the other miners the node mines and stores data for.
+	MinerAddresses          []address.Address `json:"minerAddresses"`
+	AutoSealIntervalSeconds uint              `json:"autoSealIntervalSeconds"`
+	StoragePrice            *types.AttoFIL    `json:"storagePrice"`
+	// StoragePrices are the prices of storage of the miners, by miner address. A miner
+	// without a price of its own charges StoragePrice.
+	StoragePrices map[string]*types.AttoFIL `json:"storagePrices"`
+	// RetrievalPrice is the price per byte the miners charge for retrieving a piece.
+	RetrievalPrice *types.AttoFIL `json:"retrievalPrice"`
+	// DealPolicy controls which storage deal proposals the miners accept.
+	DealPolicy *DealPolicyConfig `json:"dealPolicy"`
 }
 
 func newDefaultMiningConfig() *MiningConfig {
 	return &MiningConfig{
 		MinerAddress:            address.Undef,
+		MinerAddresses:          []address.Address{},
 		AutoSealIntervalSeconds: 120,
 		StoragePrice:            types.NewZeroAttoFIL(),
+		StoragePrices:           map[string]*types.AttoFIL{},
+		RetrievalPrice:          types.NewZeroAttoFIL(),
+		DealPolicy:              newDefaultDealPolicyConfig(),
+	}
+}
+
+// Miners returns the addresses of all the miners the node runs, starting with
+// the default miner.
+func (mc *MiningConfig) Miners() []address.Address {
+	var miners []address.Address
+	seen := make(map[address.Address]bool)
+	for _, addr := range append([]address.Address{mc.MinerAddress}, mc.MinerAddresses...) {
+		if addr.Empty() || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		miners = append(miners, addr)
+	}
+	return miners
+}
+
+// StoragePriceOf returns the price of storage of the miner.
+func (mc *MiningConfig) StoragePriceOf(miner address.Address) *types.AttoFIL {
+	if price, ok := mc.StoragePrices[miner.String()]; ok {
+		return price
+	}
+	return mc.StoragePrice
+}
+
+// DealPolicyConfig holds the rules a miner applies to storage deal proposals that pass
+// its signature, payment and size checks. Zero values mean no limit.
+type DealPolicyConfig struct {
+	// ClientAllowList, when not empty, is the only clients the miner makes deals with.
+	ClientAllowList []address.Address `json:"clientAllowList"`
+	// ClientDenyList is the clients the miner never makes deals with.
+	ClientDenyList []address.Address `json:"clientDenyList"`
+	// MinDuration and MaxDuration bound the duration of a deal, in blocks.
+	MinDuration uint64 `json:"minDuration"`
+	MaxDuration uint64 `json:"maxDuration"`
+	// MinPieceSize and MaxPieceSize bound the size of a deal's piece, in bytes.
+	MinPieceSize uint64 `json:"minPieceSize"`
+	MaxPieceSize uint64 `json:"maxPieceSize"`
+	// MaxClientDeals is the maximum number of deals in progress or complete per client.
+	MaxClientDeals uint64 `json:"maxClientDeals"`
+	// MaxClientBytes is the maximum number of bytes of deals in progress or complete per client.
+	MaxClientBytes uint64 `json:"maxClientBytes"`
+	// Collateral is the amount the miners pledge to a deal, which they advertise in counter-offers.
+	Collateral *types.AttoFIL `json:"collateral"`
+	// Decider is an executable or an http(s) URL that makes the final decision on a
+	// proposal. It receives the proposal as JSON and answers whether to accept it.
+	Decider string `json:"decider"`
+	// DeciderTimeout is how long the miner waits for the decider to answer.
+	DeciderTimeout string `json:"deciderTimeout"`
+}
+
+func newDefaultDealPolicyConfig() *DealPolicyConfig {
+	return &DealPolicyConfig{
+		ClientAllowList: []address.Address{},
+		ClientDenyList:  []address.Address{},
+		Collateral:      types.NewZeroAttoFIL(),
+		DeciderTimeout:  "10s",
 	}
 }
 
@@ -170,16 +242,24 @@ func newDefaultMetricsConfig() *MetricsConfig {
 
 // MetricsConfig holds all configuration options related to nodes message pool (mpool).
 type MessagePoolConfig struct {
-	// MaxPoolSize is the maximum number of pending messages will will allow in the message pool at any time
+	// MaxPoolSize is the maximum number of pending messages will will allow in the message pool at any time.
+	// When the pool is full, a new message evicts the pending message with the lowest gas price if it pays more.
 	MaxPoolSize int `json:"maxPoolSize"`
+	// MaxSenderMessages is the maximum number of pending messages from a single sender, or 0 for no limit
+	MaxSenderMessages int `json:"maxSenderMessages"`
 	// MaxNonceGap is the maximum nonce of a message past the last received on chain
 	MaxNonceGap types.Uint64 `json:"maxNonceGap"`
+	// ReplaceByFeePercent is how much higher, in percent, the gas price of a message must be than
+	// that of a pending message with the same sender and nonce to replace it
+	ReplaceByFeePercent int `json:"replaceByFeePercent"`
 }
 
 func newDefaultMessagePoolConfig() *MessagePoolConfig {
 	return &MessagePoolConfig{
-		MaxPoolSize: 10000,
-		MaxNonceGap: 100,
+		MaxPoolSize:         10000,
+		MaxSenderMessages:   100,
+		MaxNonceGap:         100,
+		ReplaceByFeePercent: 10,
 	}
 }
 
@@ -26,6 +26,25 @@ func TestDefaults(t *testing.T) {
 	assert.Equal(bs, cfg.Bootstrap.Addresses)
 }
 
+func TestMiningConfigMiners(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+
+	newAddr := address.NewForTestGetter()
+	a, b := newAddr(), newAddr()
+
+	cfg := newDefaultMiningConfig()
+	assert.Empty(cfg.Miners())
+
+	cfg.MinerAddresses = []address.Address{a}
+	assert.Equal([]address.Address{a}, cfg.Miners())
+
+	cfg.MinerAddress = b
+	cfg.MinerAddresses = []address.Address{a, b, a}
+	assert.Equal([]address.Address{b, a}, cfg.Miners())
+}
+
 func TestWriteFile(t *testing.T) {
 	tf.UnitTest(t)
 
@@ -72,8 +91,24 @@ func TestWriteFile(t *testing.T) {
 	},
 	"mining": {
 		"minerAddress": "empty",
+		"minerAddresses": [],
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"storagePrices": {},
+		"retrievalPrice": "0",
+		"dealPolicy": {
+			"clientAllowList": [],
+			"clientDenyList": [],
+			"minDuration": 0,
+			"maxDuration": 0,
+			"minPieceSize": 0,
+			"maxPieceSize": 0,
+			"maxClientDeals": 0,
+			"maxClientBytes": 0,
+			"collateral": "0",
+			"decider": "",
+			"deciderTimeout": "10s"
+		}
 	},
 	"wallet": {
 		"defaultAddress": "empty"
@@ -92,7 +127,9 @@ func TestWriteFile(t *testing.T) {
 	},
 	"mpool": {
 		"maxPoolSize": 10000,
-		"maxNonceGap": "100"
+		"maxSenderMessages": 100,
+		"maxNonceGap": "100",
+		"replaceByFeePercent": 10
 	}
 }`,
 		string(content),
@@ -0,0 +1,247 @@
+package consensus
+
+// This implements a round-robin proof-of-authority consensus protocol for
+// private networks. The miners created in the genesis state, ordered by
+// address, are the authorities and take turns producing blocks: the signer at
+// index height % len(signers) is the only one allowed to produce a block at a
+// given height, and the block must be signed with the key of its miner. Each
+// block adds one unit to the chain weight, so the heaviest chain is the one
+// with the fewest null rounds.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// ErrNotInTurn is returned when a block is produced by a signer whose turn it
+// is not.
+var ErrNotInTurn = errors.New("block miner is not the authority in turn")
+
+// Authority implements round-robin proof-of-authority consensus.
+type Authority struct {
+	// signers is the ordered set of addresses allowed to produce blocks.
+	signers []address.Address
+
+	// cstore is used for loading state trees during message running.
+	cstore *hamt.CborIpldStore
+
+	// bstore contains data referenced by actors within the state
+	// during message running.
+	bstore blockstore.Blockstore
+
+	// processor is what we use to process messages and pay rewards
+	processor Processor
+
+	// sigValidator checks the miner's signatures on blocks.
+	sigValidator BlockSignatureValidator
+
+	genesisCid cid.Cid
+}
+
+// Ensure Authority satisfies the Protocol interface at compile time.
+var _ Protocol = (*Authority)(nil)
+
+// NewAuthority is the constructor for the Authority consensus.Protocol module.
+func NewAuthority(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Processor, gCid cid.Cid, sigValidator BlockSignatureValidator, signers []address.Address) (Protocol, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("proof-of-authority consensus requires at least one signer")
+	}
+	return &Authority{
+		signers:      signers,
+		cstore:       cs,
+		bstore:       bs,
+		processor:    processor,
+		sigValidator: sigValidator,
+		genesisCid:   gCid,
+	}, nil
+}
+
+// SignerAt returns the authority allowed to produce a block at the input height.
+func (c *Authority) SignerAt(height uint64) address.Address {
+	return c.signers[height%uint64(len(c.signers))]
+}
+
+// NewValidTipSet creates a new tipset from the input blocks that is guaranteed
+// to be valid. Blocks must be structurally valid, signed and produced by an
+// authority.
+func (c *Authority) NewValidTipSet(ctx context.Context, blks []*types.Block) (types.TipSet, error) {
+	for _, blk := range blks {
+		if !blk.StateRoot.Defined() {
+			return nil, fmt.Errorf("block has nil StateRoot")
+		}
+		if !c.isSigner(blk.Miner) {
+			return nil, errors.Errorf("block miner %s is not an authority", blk.Miner)
+		}
+		if err := c.sigValidator.ValidateSignatures(ctx, nil, blk); err != nil {
+			return nil, err
+		}
+	}
+	return types.NewTipSet(blks...)
+}
+
+// Weight returns the weight of the input tipset, the parent weight plus one for
+// each block in it. The parent state is not used.
+func (c *Authority) Weight(ctx context.Context, ts types.TipSet, pSt state.Tree) (uint64, error) {
+	if len(ts) == 1 && ts.ToSlice()[0].Cid().Equals(c.genesisCid) {
+		return uint64(0), nil
+	}
+	parentW, err := ts.ParentWeight()
+	if err != nil {
+		return uint64(0), err
+	}
+	return parentW + uint64(len(ts)), nil
+}
+
+// IsHeavier returns true if tipset a is heavier than tipset b. Ties are broken
+// as in expected consensus.
+func (c *Authority) IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt state.Tree) (bool, error) {
+	aW, err := c.Weight(ctx, a, aSt)
+	if err != nil {
+		return false, err
+	}
+	bW, err := c.Weight(ctx, b, bSt)
+	if err != nil {
+		return false, err
+	}
+	if aW != bW {
+		return aW > bW, nil
+	}
+	return breakWeightTie(a, b)
+}
+
+// RunStateTransition checks that every block in the tipset was produced and
+// signed by the authority in turn at its height and returns the state resulting
+// from applying the tipset's messages to the parent state.
+func (c *Authority) RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error) {
+	for _, blk := range ts.ToSlice() {
+		if err := c.validateTurn(ctx, blk, pSt); err != nil {
+			return nil, err
+		}
+	}
+
+	vms := vm.NewStorageMap(c.bstore)
+	st, err := runMessages(ctx, c.cstore, c.processor, pSt, vms, ts, ancestors)
+	if err != nil {
+		return nil, err
+	}
+	if err = vms.Flush(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// IsElected returns true if the miner is the authority in turn at the input
+// height. The ticket is ignored.
+func (c *Authority) IsElected(ctx context.Context, st state.Tree, ticket types.Signature, height *types.BlockHeight, miner address.Address) (bool, error) {
+	return c.SignerAt(height.AsBigInt().Uint64()) == miner, nil
+}
+
+// ValidateBlock checks that a block received from the network was produced and
+// signed by the authority in turn at its height. The signatures are checked
+// against the authority's key in the parent state when it is known, and only
+// for presence when pSt is nil.
+func (c *Authority) ValidateBlock(ctx context.Context, blk *types.Block, pSt state.Tree) error {
+	if !blk.StateRoot.Defined() {
+		return fmt.Errorf("block has nil StateRoot")
+	}
+	return c.validateTurn(ctx, blk, pSt)
+}
+
+// validateTurn checks that the block's miner is the authority in turn at its
+// height, and that the block and its ticket are signed with that authority's key.
+func (c *Authority) validateTurn(ctx context.Context, blk *types.Block, pSt state.Tree) error {
+	if blk.Miner != c.SignerAt(uint64(blk.Height)) {
+		return errors.Wrapf(ErrNotInTurn, "block %s at height %d mined by %s", blk.Cid(), blk.Height, blk.Miner)
+	}
+	if err := c.sigValidator.ValidateSignatures(ctx, pSt, blk); err != nil {
+		return errors.Wrapf(err, "invalid signatures on block %s", blk.Cid())
+	}
+	return nil
+}
+
+func (c *Authority) isSigner(addr address.Address) bool {
+	for _, signer := range c.signers {
+		if signer == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthoritiesFromGenesis returns the addresses of the miner actors created in
+// the genesis state, ordered by address. These are the default authorities of
+// a proof-of-authority network.
+func AuthoritiesFromGenesis(ctx context.Context, cst *hamt.CborIpldStore, genesis *types.Block) ([]address.Address, error) {
+	actors, err := state.GetAllActorsFromStore(ctx, cst, genesis.StateRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load genesis state")
+	}
+
+	var signers []address.Address
+	for result := range actors {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if !result.Actor.Code.Equals(types.MinerActorCodeCid) {
+			continue
+		}
+		addr, err := address.NewFromString(result.Address)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, addr)
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("genesis state has no miners to act as authorities")
+	}
+
+	sort.Slice(signers, func(i, j int) bool { return signers[i].String() < signers[j].String() })
+	return signers, nil
+}
+
+// AuthorityView is the power table view used with proof-of-authority
+// consensus. Each authority has one unit of power, and no one else has any.
+type AuthorityView struct {
+	signers []address.Address
+}
+
+var _ PowerTableView = &AuthorityView{}
+
+// NewAuthorityView returns a power table view over the input authorities.
+func NewAuthorityView(signers []address.Address) *AuthorityView {
+	return &AuthorityView{signers: signers}
+}
+
+// Total returns the number of authorities.
+func (v *AuthorityView) Total(ctx context.Context, st state.Tree, bstore blockstore.Blockstore) (uint64, error) {
+	return uint64(len(v.signers)), nil
+}
+
+// Miner returns 1 if the input address is an authority and 0 otherwise.
+func (v *AuthorityView) Miner(ctx context.Context, st state.Tree, bstore blockstore.Blockstore, mAddr address.Address) (uint64, error) {
+	if v.HasPower(ctx, st, bstore, mAddr) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// HasPower returns true if the input address is an authority.
+func (v *AuthorityView) HasPower(ctx context.Context, st state.Tree, bstore blockstore.Blockstore, mAddr address.Address) bool {
+	for _, signer := range v.signers {
+		if signer == mAddr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package consensus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func TestNewAuthority(t *testing.T) {
+	tf.UnitTest(t)
+
+	cst, bstore, _ := setupCborBlockstoreProofs()
+
+	t.Run("requires at least one signer", func(t *testing.T) {
+		_, err := consensus.NewAuthority(cst, bstore, consensus.NewDefaultProcessor(), types.SomeCid(), &testhelpers.TestBlockSignatureValidator{}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("signers take turns by height", func(t *testing.T) {
+		signers := requireSigners(3)
+		auth, err := consensus.NewAuthority(cst, bstore, consensus.NewDefaultProcessor(), types.SomeCid(), &testhelpers.TestBlockSignatureValidator{}, signers)
+		require.NoError(t, err)
+
+		for h := uint64(0); h < 7; h++ {
+			assert.Equal(t, signers[h%3], auth.(*consensus.Authority).SignerAt(h))
+		}
+	})
+}
+
+func TestAuthority_IsElected(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	cst, bstore, _ := setupCborBlockstoreProofs()
+	signers := requireSigners(2)
+	auth, err := consensus.NewAuthority(cst, bstore, consensus.NewDefaultProcessor(), types.SomeCid(), &testhelpers.TestBlockSignatureValidator{}, signers)
+	require.NoError(err)
+
+	elected, err := auth.IsElected(ctx, nil, nil, types.NewBlockHeight(4), signers[0])
+	require.NoError(err)
+	assert.True(elected)
+
+	elected, err = auth.IsElected(ctx, nil, nil, types.NewBlockHeight(4), signers[1])
+	require.NoError(err)
+	assert.False(elected)
+
+	elected, err = auth.IsElected(ctx, nil, nil, types.NewBlockHeight(5), signers[1])
+	require.NoError(err)
+	assert.True(elected)
+}
+
+func TestAuthority_NewValidTipSet(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	cst, bstore, _ := setupCborBlockstoreProofs()
+	signers := requireSigners(2)
+	auth, err := consensus.NewAuthority(cst, bstore, consensus.NewDefaultProcessor(), types.SomeCid(), &testhelpers.TestBlockSignatureValidator{}, signers)
+	require.NoError(t, err)
+
+	parent := types.NewBlockForTest(nil, 0)
+	parent.StateRoot = types.SomeCid()
+
+	t.Run("accepts blocks from authorities", func(t *testing.T) {
+		blk := types.NewBlockForTest(parent, 1)
+		blk.Miner = signers[1]
+		ts, err := auth.NewValidTipSet(ctx, []*types.Block{blk})
+		assert.NoError(t, err)
+		assert.Len(t, ts, 1)
+	})
+
+	t.Run("rejects blocks from other miners", func(t *testing.T) {
+		blk := types.NewBlockForTest(parent, 1)
+		blk.Miner = address.NewForTestGetter()()
+		_, err := auth.NewValidTipSet(ctx, []*types.Block{blk})
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthority_ValidateBlock(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	cst, bstore, _ := setupCborBlockstoreProofs()
+	signers := requireSigners(2)
+	auth, err := consensus.NewAuthority(cst, bstore, consensus.NewDefaultProcessor(), types.SomeCid(), &testhelpers.TestBlockSignatureValidator{}, signers)
+	require.NoError(t, err)
+
+	parent := types.NewBlockForTest(nil, 0)
+	parent.StateRoot = types.SomeCid()
+
+	blk := types.NewBlockForTest(parent, 1)
+	blk.Height = 3
+	blk.Miner = signers[1]
+	assert.NoError(t, auth.ValidateBlock(ctx, blk, nil))
+
+	blk.Miner = signers[0]
+	assert.Equal(t, consensus.ErrNotInTurn, errors.Cause(auth.ValidateBlock(ctx, blk, nil)))
+}
+
+func TestAuthority_Weight(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	cst, bstore, _ := setupCborBlockstoreProofs()
+	genesis := types.NewBlockForTest(nil, 0)
+	auth, err := consensus.NewAuthority(cst, bstore, consensus.NewDefaultProcessor(), genesis.Cid(), &testhelpers.TestBlockSignatureValidator{}, requireSigners(2))
+	require.NoError(err)
+
+	w, err := auth.Weight(ctx, testhelpers.RequireNewTipSet(require, genesis), nil)
+	require.NoError(err)
+	assert.Equal(uint64(0), w)
+
+	a := types.NewBlockForTest(genesis, 1)
+	a.ParentWeight = types.Uint64(5)
+	b := types.NewBlockForTest(genesis, 2)
+	b.ParentWeight = types.Uint64(5)
+
+	w, err = auth.Weight(ctx, testhelpers.RequireNewTipSet(require, a, b), nil)
+	require.NoError(err)
+	assert.Equal(uint64(7), w)
+
+	heavier, err := auth.IsHeavier(ctx, testhelpers.RequireNewTipSet(require, a, b), testhelpers.RequireNewTipSet(require, a), nil, nil)
+	require.NoError(err)
+	assert.True(heavier)
+}
+
+func TestAuthority_RunStateTransition(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	cst, bstore, _ := setupCborBlockstoreProofs()
+	genesisBlock, err := consensus.DefaultGenesis(cst, bstore)
+	require.NoError(err)
+
+	pTipSet := testhelpers.RequireNewTipSet(require, genesisBlock)
+	stateTree, err := state.LoadStateTree(ctx, cst, genesisBlock.StateRoot, builtin.Actors)
+	require.NoError(err)
+
+	// The blocks are all at height 1, mined by three different miners.
+	blocks := requireMakeBlocks(ctx, require, pTipSet, stateTree, vm.NewStorageMap(bstore))
+	signers := []address.Address{blocks[0].Miner, blocks[1].Miner, blocks[2].Miner}
+
+	auth, err := consensus.NewAuthority(cst, bstore, testhelpers.NewTestProcessor(), genesisBlock.Cid(), consensus.NewDefaultBlockSignatureValidator(bstore), signers)
+	require.NoError(err)
+
+	_, err = auth.RunStateTransition(ctx, testhelpers.RequireNewTipSet(require, blocks[1]), []types.TipSet{pTipSet}, stateTree)
+	assert.NoError(err)
+
+	_, err = auth.RunStateTransition(ctx, testhelpers.RequireNewTipSet(require, blocks[0]), []types.TipSet{pTipSet}, stateTree)
+	assert.Equal(consensus.ErrNotInTurn, errors.Cause(err))
+
+	// A block claiming to be from the authority in turn must carry its signature.
+	forged, err := types.DecodeBlock(blocks[1].ToNode().RawData())
+	require.NoError(err)
+	forged.BlockSig = blocks[2].BlockSig
+	_, err = auth.RunStateTransition(ctx, testhelpers.RequireNewTipSet(require, forged), []types.TipSet{pTipSet}, stateTree)
+	assert.Equal(consensus.ErrInvalidBlockSignature, errors.Cause(err))
+	assert.Equal(consensus.ErrInvalidBlockSignature, errors.Cause(auth.ValidateBlock(ctx, forged, stateTree)))
+
+	unsigned, err := types.DecodeBlock(blocks[1].ToNode().RawData())
+	require.NoError(err)
+	unsigned.BlockSig = nil
+	assert.Equal(consensus.ErrMissingBlockSignature, errors.Cause(auth.ValidateBlock(ctx, unsigned, nil)))
+}
+
+func requireSigners(n int) []address.Address {
+	newAddr := address.NewForTestGetter()
+	signers := make([]address.Address, n)
+	for i := range signers {
+		signers[i] = newAddr()
+	}
+	return signers
+}
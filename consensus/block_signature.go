@@ -0,0 +1,96 @@
+package consensus
+
+import (
+	"context"
+
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// ErrMissingBlockSignature is returned for blocks that are not signed.
+var ErrMissingBlockSignature = errors.New("block has no signature")
+
+// ErrInvalidBlockSignature is returned for blocks whose signature was not made
+// with the key of their miner.
+var ErrInvalidBlockSignature = errors.New("block not signed by the miner's key")
+
+// BlockSignatureValidator checks the signatures a miner puts on a block: the
+// ticket and the signature over the block itself.
+type BlockSignatureValidator interface {
+	// ValidateSignatures checks the block signatures against the key of the
+	// block's miner in the state st. When st is nil only the presence of the
+	// block signature is checked.
+	ValidateSignatures(ctx context.Context, st state.Tree, blk *types.Block) error
+}
+
+// DefaultBlockSignatureValidator checks block signatures against the key
+// returned by the getKey method of the miner actor.
+type DefaultBlockSignatureValidator struct {
+	bstore blockstore.Blockstore
+}
+
+var _ BlockSignatureValidator = (*DefaultBlockSignatureValidator)(nil)
+
+// NewDefaultBlockSignatureValidator creates a new DefaultBlockSignatureValidator
+// reading actor storage from bs.
+func NewDefaultBlockSignatureValidator(bs blockstore.Blockstore) *DefaultBlockSignatureValidator {
+	return &DefaultBlockSignatureValidator{bstore: bs}
+}
+
+// ValidateSignatures checks the block ticket and signature.
+func (v *DefaultBlockSignatureValidator) ValidateSignatures(ctx context.Context, st state.Tree, blk *types.Block) error {
+	if len(blk.BlockSig) == 0 {
+		return ErrMissingBlockSignature
+	}
+	if st == nil {
+		return nil
+	}
+
+	signerAddr, err := minerKeyAddress(ctx, st, vm.NewStorageMap(v.bstore), blk.Miner)
+	if err != nil {
+		return err
+	}
+
+	// The ticket is created in CreateTicket.
+	ticketData := append(blk.Proof[:], signerAddr.Bytes()...)
+	if !types.IsValidSignature(ticketData, signerAddr, blk.Ticket) {
+		return errors.New("ticket not signed by the miner's key")
+	}
+	if !types.IsValidSignature(blk.SignatureData(), signerAddr, blk.BlockSig) {
+		return ErrInvalidBlockSignature
+	}
+	return nil
+}
+
+// SignBlock signs the block with the key of signerPubKey, setting BlockSig. It
+// must be called once all other fields of the block are set.
+func SignBlock(blk *types.Block, signerPubKey []byte, signer TicketSigner) error {
+	signerAddr, err := signer.GetAddressForPubKey(signerPubKey)
+	if err != nil {
+		return errors.Wrap(err, "could not get address for signerPubKey")
+	}
+	sig, err := signer.SignBytes(blk.SignatureData(), signerAddr)
+	if err != nil {
+		return errors.Wrap(err, "could not sign block")
+	}
+	blk.BlockSig = sig
+	return nil
+}
+
+// minerKeyAddress returns the address of the public key of the miner, the key
+// that signs the miner's tickets and blocks.
+func minerKeyAddress(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address) (address.Address, error) {
+	ret, code, err := CallQueryMethod(ctx, st, vms, minerAddr, "getKey", []byte{}, address.Undef, types.NewBlockHeight(0))
+	if err != nil {
+		return address.Undef, errors.Wrapf(err, "could not get key of miner %s", minerAddr)
+	}
+	if code != 0 {
+		return address.Undef, errors.Errorf("could not get key of miner %s, error code %d", minerAddr, code)
+	}
+	return address.NewSecp256k1Address(ret[0])
+}
@@ -0,0 +1,161 @@
+package consensus
+
+import (
+	"context"
+
+	"github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// ErrInvalidElectionProof is returned for blocks whose proof of spacetime does
+// not prove the storage of their miner's sectors.
+var ErrInvalidElectionProof = errors.New("election proof does not prove the miner's sectors")
+
+// SectorsView provides the sectors miners have committed in a state. To be
+// elected a miner proves spacetime over these sectors.
+type SectorsView interface {
+	// ElectionSectors returns the replica commitments of the sectors the
+	// miner of the input address proves spacetime over to be elected.
+	ElectionSectors(ctx context.Context, st state.Tree, bstore blockstore.Blockstore, mAddr address.Address) (proofs.SortedCommRs, error)
+
+	// SectorSize returns the size of the sectors proven in the given state.
+	SectorSize(ctx context.Context, st state.Tree, bstore blockstore.Blockstore) (types.SectorSize, error)
+}
+
+// ActorSectorsView is the sectors view used in production. It reads the
+// sectors from the miner actors and the proofs mode from the storage market.
+type ActorSectorsView struct{}
+
+var _ SectorsView = &ActorSectorsView{}
+
+// ElectionSectors returns the replica commitments of the sectors committed by
+// the miner actor. The sectors of bootstrap miners are created in the genesis
+// block without replicas, so like the miner actor, which does not verify their
+// PoSts, elections ask bootstrap miners to prove none.
+func (v *ActorSectorsView) ElectionSectors(ctx context.Context, st state.Tree, bstore blockstore.Blockstore, mAddr address.Address) (proofs.SortedCommRs, error) {
+	vms := vm.NewStorageMap(bstore)
+	ret, code, err := CallQueryMethod(ctx, st, vms, mAddr, "isBootstrapMiner", []byte{}, address.Undef, types.NewBlockHeight(0))
+	if err != nil {
+		return proofs.SortedCommRs{}, errors.Wrapf(err, "could not check if miner %s is a bootstrap miner", mAddr)
+	}
+	if code != 0 {
+		return proofs.SortedCommRs{}, errors.Errorf("could not check if miner %s is a bootstrap miner, error code %d", mAddr, code)
+	}
+	isBootstrap, err := abi.Deserialize(ret[0], abi.Boolean)
+	if err != nil {
+		return proofs.SortedCommRs{}, errors.Wrap(err, "could not deserialize bootstrap flag")
+	}
+	if isBootstrap.Val.(bool) {
+		return proofs.NewSortedCommRs(), nil
+	}
+
+	ret, code, err = CallQueryMethod(ctx, st, vms, mAddr, "getSectorCommitments", []byte{}, address.Undef, types.NewBlockHeight(0))
+	if err != nil {
+		return proofs.SortedCommRs{}, errors.Wrapf(err, "could not get sector commitments of miner %s", mAddr)
+	}
+	if code != 0 {
+		return proofs.SortedCommRs{}, errors.Errorf("could not get sector commitments of miner %s, error code %d", mAddr, code)
+	}
+
+	val, err := abi.Deserialize(ret[0], abi.CommitmentsMap)
+	if err != nil {
+		return proofs.SortedCommRs{}, errors.Wrap(err, "could not deserialize sector commitments")
+	}
+	commitments, ok := val.Val.(map[string]types.Commitments)
+	if !ok {
+		return proofs.SortedCommRs{}, errors.Errorf("expected sector commitments, got %T", val.Val)
+	}
+
+	var commRs []types.CommR
+	for _, c := range commitments {
+		commRs = append(commRs, c.CommR)
+	}
+	return proofs.NewSortedCommRs(commRs...), nil
+}
+
+// SectorSize returns the size of sectors in the proofs mode of the storage
+// market.
+func (v *ActorSectorsView) SectorSize(ctx context.Context, st state.Tree, bstore blockstore.Blockstore) (types.SectorSize, error) {
+	vms := vm.NewStorageMap(bstore)
+	ret, code, err := CallQueryMethod(ctx, st, vms, address.StorageMarketAddress, "getProofsMode", []byte{}, address.Undef, types.NewBlockHeight(0))
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get proofs mode")
+	}
+	if code != 0 {
+		return 0, errors.Errorf("could not get proofs mode, error code %d", code)
+	}
+
+	var proofsMode types.ProofsMode
+	if err := cbor.DecodeInto(ret[0], &proofsMode); err != nil {
+		return 0, errors.Wrap(err, "could not decode proofs mode")
+	}
+	if proofsMode == types.TestProofsMode {
+		return types.OneKiBSectorSize, nil
+	}
+	return types.TwoHundredFiftySixMiBSectorSize, nil
+}
+
+// SeedElectionProof returns the election proof of a miner with no sectors to
+// prove, e.g. a bootstrap miner. Such a miner has nothing to prove spacetime
+// over, so its proof is the challenge seed itself.
+func SeedElectionProof(seed types.PoStChallengeSeed) types.PoStProof {
+	var proof types.PoStProof
+	copy(proof[:], seed[:])
+	return proof
+}
+
+// validateElectionProof checks that the proof of the block is a valid proof of
+// spacetime over the sectors its miner has committed in st, the state of the
+// parent tipset, for the challenge seed of the block's round.
+func (c *Expected) validateElectionProof(ctx context.Context, st state.Tree, blk *types.Block, parentTs types.TipSet) error {
+	parentHeight, err := parentTs.Height()
+	if err != nil {
+		return err
+	}
+	if uint64(blk.Height) <= parentHeight {
+		return errors.Errorf("block height %d is not above parent height %d", blk.Height, parentHeight)
+	}
+	nullBlkCount := uint64(blk.Height) - parentHeight - 1
+	seed, err := CreateChallengeSeed(parentTs, nullBlkCount)
+	if err != nil {
+		return errors.Wrap(err, "could not create challenge seed")
+	}
+
+	commRs, err := c.sectors.ElectionSectors(ctx, st, c.bstore, blk.Miner)
+	if err != nil {
+		return err
+	}
+	if len(commRs.Values()) == 0 {
+		if blk.Proof != SeedElectionProof(seed) {
+			return ErrInvalidElectionProof
+		}
+		return nil
+	}
+
+	sectorSize, err := c.sectors.SectorSize(ctx, st, c.bstore)
+	if err != nil {
+		return err
+	}
+	res, err := c.verifier.VerifyPoST(proofs.VerifyPoSTRequest{
+		ChallengeSeed: seed,
+		SortedCommRs:  commRs,
+		Faults:        []uint64{},
+		Proofs:        []types.PoStProof{blk.Proof},
+		SectorSize:    sectorSize,
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not verify PoSt")
+	}
+	if !res.IsValid {
+		return ErrInvalidElectionProof
+	}
+	return nil
+}
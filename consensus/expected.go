@@ -97,14 +97,21 @@ type Expected struct {
 
 	genesisCid cid.Cid
 
+	// verifier verifies the proofs of spacetime electing miners.
 	verifier proofs.Verifier
+
+	// sigValidator checks the miner's signatures on blocks.
+	sigValidator BlockSignatureValidator
+
+	// sectors provides the sectors over which miners prove spacetime.
+	sectors SectorsView
 }
 
 // Ensure Expected satisfies the Protocol interface at compile time.
 var _ Protocol = (*Expected)(nil)
 
 // NewExpected is the constructor for the Expected consenus.Protocol module.
-func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Processor, pt PowerTableView, gCid cid.Cid, verifier proofs.Verifier) Protocol {
+func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Processor, pt PowerTableView, gCid cid.Cid, verifier proofs.Verifier, sigValidator BlockSignatureValidator, sectors SectorsView) Protocol {
 	return &Expected{
 		cstore:       cs,
 		bstore:       bs,
@@ -112,6 +119,8 @@ func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Pro
 		PwrTableView: pt,
 		genesisCid:   gCid,
 		verifier:     verifier,
+		sigValidator: sigValidator,
+		sectors:      sectors,
 	}
 }
 
@@ -132,16 +141,20 @@ func (c *Expected) NewValidTipSet(ctx context.Context, blks []*types.Block) (typ
 // cryptographically valid. This means checking that all of its fields are
 // properly filled out and its signatures are correct. Checking the validity of
 // state changes must be done separately and only once the state of the
-// previous block has been validated. TODO: not yet signature checking
+// previous block has been validated. The signature can only be verified against
+// the miner's key once the parent state is known, so here it only needs to be
+// present. The genesis block has no miner and is not signed.
 func (c *Expected) validateBlockStructure(ctx context.Context, b *types.Block) error {
-	// TODO: validate signature on block
 	ctx = log.Start(ctx, "Expected.validateBlockStructure")
 	log.LogKV(ctx, "ValidateBlockStructure", b.Cid().String())
 	if !b.StateRoot.Defined() {
 		return fmt.Errorf("block has nil StateRoot")
 	}
+	if b.Cid().Equals(c.genesisCid) {
+		return nil
+	}
 
-	return nil
+	return c.sigValidator.ValidateSignatures(ctx, nil, b)
 }
 
 // Weight returns the EC weight of this TipSet in uint64 encoded fixed point
@@ -207,6 +220,13 @@ func (c *Expected) IsHeavier(ctx context.Context, a, b types.TipSet, aSt, bSt st
 		return aW > bW, nil
 	}
 
+	return breakWeightTie(a, b)
+}
+
+// breakWeightTie returns true if tipset a should be considered heavier than
+// tipset b when both have the same weight. The tipset with the smallest ticket
+// wins, falling back to a comparison of the block cids.
+func breakWeightTie(a, b types.TipSet) (bool, error) {
 	// To break ties compare the min tickets.
 	aTicket, err := a.MinTicket()
 	if err != nil {
@@ -258,7 +278,7 @@ func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, ance
 	}
 
 	vms := vm.NewStorageMap(c.bstore)
-	st, err := c.runMessages(ctx, pSt, vms, ts, ancestors)
+	st, err := runMessages(ctx, c.cstore, c.processor, pSt, vms, ts, ancestors)
 	if err != nil {
 		return nil, err
 	}
@@ -269,20 +289,53 @@ func (c *Expected) RunStateTransition(ctx context.Context, ts types.TipSet, ance
 	return st, nil
 }
 
+// IsElected returns true if the ticket is a winning ticket for the miner given
+// its share of storage power in the state st.
+func (c *Expected) IsElected(ctx context.Context, st state.Tree, ticket types.Signature, height *types.BlockHeight, miner address.Address) (bool, error) {
+	return IsWinningTicket(ctx, c.bstore, c.PwrTableView, st, ticket, miner)
+}
+
+// ValidateBlock checks the structure of a block received from the network and,
+// given the state of its parent tipset, that the block and its ticket were
+// signed by the miner's key and that the ticket wins.
+func (c *Expected) ValidateBlock(ctx context.Context, blk *types.Block, pSt state.Tree) error {
+	if err := c.validateBlockStructure(ctx, blk); err != nil {
+		return err
+	}
+	if pSt == nil {
+		return nil
+	}
+
+	if err := c.sigValidator.ValidateSignatures(ctx, pSt, blk); err != nil {
+		return err
+	}
+	won, err := IsWinningTicket(ctx, c.bstore, c.PwrTableView, pSt, blk.Ticket, blk.Miner)
+	if err != nil {
+		return errors.Wrap(err, "can't check for winning ticket")
+	}
+	if !won {
+		return errors.New("not a winning ticket")
+	}
+	return nil
+}
+
 // validateMining checks validity of the block ticket, proof, and miner address.
 //    Returns an error if:
 //    	* any tipset's block was mined by an invalid miner address.
+//      * the block or its ticket is not signed by the miner's key
 //      * the block proof is invalid for the challenge
 //      * the block ticket fails the power check, i.e. is not a winning ticket
 //    Returns nil if all the above checks pass.
 // See https://github.com/filecoin-project/specs/blob/master/mining.md#chain-validation
 func (c *Expected) validateMining(ctx context.Context, st state.Tree, ts types.TipSet, parentTs types.TipSet) error {
 	for _, blk := range ts.ToSlice() {
-		// TODO: Also need to validate BlockSig
+		if err := c.sigValidator.ValidateSignatures(ctx, st, blk); err != nil {
+			return errors.Wrap(err, "invalid block signatures")
+		}
 
-		// TODO: Once we've picked a delay function (see #2119), we need to
-		// verify its proof here. The proof will likely be written to a field on
-		// the mined block.
+		if err := c.validateElectionProof(ctx, st, blk, parentTs); err != nil {
+			return errors.Wrap(err, "invalid election proof")
+		}
 
 		// See https://github.com/filecoin-project/specs/blob/master/mining.md#ticket-checking
 		result, err := IsWinningTicket(ctx, c.bstore, c.PwrTableView, st, blk.Ticket, blk.Miner)
@@ -354,7 +407,7 @@ func CreateChallengeSeed(parents types.TipSet, nullBlkCount uint64) (types.PoStC
 // An error is returned if individual blocks contain messages that do not
 // lead to successful state transitions.  An error is also returned if the node
 // faults while running aggregate state computation.
-func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (state.Tree, error) {
+func runMessages(ctx context.Context, cstore *hamt.CborIpldStore, processor Processor, st state.Tree, vms vm.StorageMap, ts types.TipSet, ancestors []types.TipSet) (state.Tree, error) {
 	var cpySt state.Tree
 
 	// TODO: order blocks in the tipset by ticket
@@ -365,12 +418,12 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 		// state copied so changes don't propagate between block validations
-		cpySt, err = state.LoadStateTree(ctx, c.cstore, cpyCid, builtin.Actors)
+		cpySt, err = state.LoadStateTree(ctx, cstore, cpyCid, builtin.Actors)
 		if err != nil {
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 
-		receipts, err := c.processor.ProcessBlock(ctx, cpySt, vms, blk, ancestors)
+		receipts, err := processor.ProcessBlock(ctx, cpySt, vms, blk, ancestors)
 		if err != nil {
 			return nil, errors.Wrap(err, "error validating block state")
 		}
@@ -394,7 +447,7 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 	// NOTE: It is possible to optimize further by applying block validation
 	// in sorted order to reuse first block transitions as the starting state
 	// for the tipSetProcessor.
-	_, err := c.processor.ProcessTipSet(ctx, st, vms, ts, ancestors)
+	_, err := processor.ProcessTipSet(ctx, st, vms, ts, ancestors)
 	if err != nil {
 		return nil, errors.Wrap(err, "error validating tipset")
 	}
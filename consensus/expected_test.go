@@ -17,6 +17,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/vm"
 
 	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-hamt-ipld"
 	"github.com/ipfs/go-ipfs-blockstore"
@@ -34,7 +35,7 @@ func TestNewExpected(t *testing.T) {
 	t.Run("a new Expected can be created", func(t *testing.T) {
 		cst, bstore, verifier := setupCborBlockstoreProofs()
 		ptv := testhelpers.NewTestPowerTableView(1, 5)
-		exp := consensus.NewExpected(cst, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier)
+		exp := consensus.NewExpected(cst, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier, consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView(types.CommR{}))
 		assert.NotNil(exp)
 	})
 }
@@ -55,7 +56,7 @@ func TestExpected_NewValidTipSet(t *testing.T) {
 		genesisBlock, err := consensus.DefaultGenesis(cistore, bstore)
 		require.NoError(err)
 
-		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, genesisBlock.Cid(), verifier)
+		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, genesisBlock.Cid(), verifier, consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView(types.CommR{}))
 
 		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
 		require.NoError(err)
@@ -90,7 +91,7 @@ func TestExpected_NewValidTipSet(t *testing.T) {
 		}
 		blocks[0].MessageReceipts = []*types.MessageReceipt{receipt}
 
-		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier)
+		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier, consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView(types.CommR{}))
 
 		tipSet, err := exp.NewValidTipSet(ctx, blocks)
 		assert.Error(err, "Foo")
@@ -155,7 +156,7 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 		totalPower := uint64(1)
 
 		ptv := testhelpers.NewTestPowerTableView(minerPower, totalPower)
-		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier)
+		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier, consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView(types.CommR{}))
 
 		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
 		require.NoError(err)
@@ -176,7 +177,7 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 	t.Run("returns nil + mining error when IsWinningTicket fails due to miner power error", func(t *testing.T) {
 
 		ptv := NewFailingMinerTestPowerTableView(1, 5)
-		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier)
+		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, types.SomeCid(), verifier, consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView(types.CommR{}))
 
 		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
 		require.NoError(err)
@@ -194,6 +195,108 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
 		assert.EqualError(err, "can't check for winning ticket: Couldn't get minerPower: something went wrong with the miner power")
 	})
+
+	t.Run("returns an error when the PoSt does not verify", func(t *testing.T) {
+		ptv := testhelpers.NewTestPowerTableView(1, 1)
+		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), proofs.NewFakeVerifier(false, nil),
+			consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView(types.CommR{}))
+
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(err)
+
+		stateTree, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(err)
+
+		blocks := requireMakeBlocks(ctx, require, pTipSet, stateTree, vm.NewStorageMap(bstore))
+
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		require.NoError(err)
+
+		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		assert.Equal(consensus.ErrInvalidElectionProof, errors.Cause(err))
+	})
+
+	t.Run("requires miners without sectors to use the challenge seed as proof", func(t *testing.T) {
+		ptv := testhelpers.NewTestPowerTableView(1, 1)
+		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier,
+			consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView())
+
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(err)
+
+		stateTree, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(err)
+
+		blocks := requireMakeBlocks(ctx, require, pTipSet, stateTree, vm.NewStorageMap(bstore))
+
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		require.NoError(err)
+
+		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		assert.Equal(consensus.ErrInvalidElectionProof, errors.Cause(err))
+	})
+}
+
+func TestExpected_ValidateBlock(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+
+	cistore, bstore, verifier := setupCborBlockstoreProofs()
+	genesisBlock, err := consensus.DefaultGenesis(cistore, bstore)
+	require.NoError(t, err)
+
+	setup := func(t *testing.T, ptv consensus.PowerTableView) (consensus.Protocol, []*types.Block, state.Tree) {
+		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier, consensus.NewDefaultBlockSignatureValidator(bstore), testhelpers.NewTestSectorsView(types.CommR{}))
+		pTipSet := testhelpers.RequireNewTipSet(require.New(t), genesisBlock)
+		stateTree, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(t, err)
+		blocks := requireMakeBlocks(ctx, require.New(t), pTipSet, stateTree, vm.NewStorageMap(bstore))
+		return exp, blocks, stateTree
+	}
+
+	t.Run("accepts a valid block", func(t *testing.T) {
+		exp, blocks, stateTree := setup(t, testhelpers.NewTestPowerTableView(1, 1))
+		assert.NoError(t, exp.ValidateBlock(ctx, blocks[0], stateTree))
+	})
+
+	t.Run("only checks structure without the parent state", func(t *testing.T) {
+		exp, blocks, _ := setup(t, testhelpers.NewTestPowerTableView(0, 1))
+		assert.NoError(t, exp.ValidateBlock(ctx, blocks[0], nil))
+
+		blocks[0].StateRoot = cid.Undef
+		assert.Error(t, exp.ValidateBlock(ctx, blocks[0], nil))
+	})
+
+	t.Run("rejects a ticket signed by another key", func(t *testing.T) {
+		exp, blocks, stateTree := setup(t, testhelpers.NewTestPowerTableView(1, 1))
+		blocks[0].Ticket = blocks[1].Ticket
+		assert.EqualError(t, exp.ValidateBlock(ctx, blocks[0], stateTree), "ticket not signed by the miner's key")
+	})
+
+	t.Run("rejects a losing ticket", func(t *testing.T) {
+		exp, blocks, stateTree := setup(t, testhelpers.NewTestPowerTableView(0, 1))
+		assert.EqualError(t, exp.ValidateBlock(ctx, blocks[0], stateTree), "not a winning ticket")
+	})
+
+	t.Run("rejects an unsigned block", func(t *testing.T) {
+		exp, blocks, stateTree := setup(t, testhelpers.NewTestPowerTableView(1, 1))
+		blocks[0].BlockSig = nil
+		assert.Equal(t, consensus.ErrMissingBlockSignature, exp.ValidateBlock(ctx, blocks[0], nil))
+		assert.Equal(t, consensus.ErrMissingBlockSignature, exp.ValidateBlock(ctx, blocks[0], stateTree))
+	})
+
+	t.Run("rejects a block changed after signing", func(t *testing.T) {
+		exp, blocks, stateTree := setup(t, testhelpers.NewTestPowerTableView(1, 1))
+		blocks[0].Nonce++
+		assert.Equal(t, consensus.ErrInvalidBlockSignature, exp.ValidateBlock(ctx, blocks[0], stateTree))
+	})
+
+	t.Run("rejects a block signed by another key", func(t *testing.T) {
+		exp, blocks, stateTree := setup(t, testhelpers.NewTestPowerTableView(1, 1))
+		blocks[0].BlockSig = blocks[1].BlockSig
+		assert.Equal(t, consensus.ErrInvalidBlockSignature, exp.ValidateBlock(ctx, blocks[0], stateTree))
+	})
 }
 
 func TestIsWinningTicket(t *testing.T) {
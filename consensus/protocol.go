@@ -12,6 +12,7 @@ package consensus
 import (
 	"context"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -36,4 +37,25 @@ type Protocol interface {
 	// RunStateTransition returns the state resulting from applying the input ts to the parent
 	// state pSt.  It returns an error if the transition is invalid.
 	RunStateTransition(ctx context.Context, ts types.TipSet, ancestors []types.TipSet, pSt state.Tree) (state.Tree, error)
+	// IsElected returns true if the miner, holding the input ticket, may produce a
+	// block at the input height on top of a parent with state st.
+	IsElected(ctx context.Context, st state.Tree, ticket types.Signature, height *types.BlockHeight, miner address.Address) (bool, error)
+	// ValidateBlock checks a single block received from the network before it is
+	// relayed to other peers. pSt is the state of the block's parent tipset, or
+	// nil if it is not known yet, in which case only checks needing no state are done.
+	ValidateBlock(ctx context.Context, blk *types.Block, pSt state.Tree) error
 }
+
+// ElectionValidator is the subset of the Protocol used by miners to decide
+// whether they may produce a block.
+type ElectionValidator interface {
+	IsElected(ctx context.Context, st state.Tree, ticket types.Signature, height *types.BlockHeight, miner address.Address) (bool, error)
+}
+
+// Protocol names, as selected in the node's configuration.
+const (
+	// ExpectedProtocol is the name of expected consensus.
+	ExpectedProtocol = "expected"
+	// AuthorityProtocol is the name of round-robin proof-of-authority consensus.
+	AuthorityProtocol = "authority"
+)
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/cskr/pubsub"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// headChangeTopic is the topic on which the notifier publishes head changes.
+const headChangeTopic = "head-change"
+
+// HeadChange describes the transition of the chain head from one tipset to another.
+// Head is the new head, which may be an ancestor of the old one.
+// Reverted lists the tipsets of the abandoned chain, ordered from the old head
+// towards the common ancestor (decreasing height). Applied lists the tipsets of
+// the adopted chain, ordered from just above the common ancestor up to the new
+// head (increasing height), i.e. in the order they should be applied.
+type HeadChange struct {
+	Head     types.TipSet
+	Reverted []types.TipSet
+	Applied  []types.TipSet
+}
+
+// IsReorg returns true if the head change abandoned some previously applied tipset.
+func (hc *HeadChange) IsReorg() bool {
+	return len(hc.Reverted) > 0
+}
+
+// CollectHeadChange computes the tipsets reverted and applied when the head moves
+// from oldHead to newHead.
+func CollectHeadChange(ctx context.Context, store chain.BlockProvider, oldHead, newHead types.TipSet) (*HeadChange, error) {
+	oldBlocks, newBlocks, err := CollectBlocksToCommonAncestor(ctx, store, oldHead, newHead)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted, err := groupTipSetsByHeight(oldBlocks)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := groupTipSetsByHeight(newBlocks)
+	if err != nil {
+		return nil, err
+	}
+	reverseTipSets(applied)
+
+	return &HeadChange{Head: newHead, Reverted: reverted, Applied: applied}, nil
+}
+
+// groupTipSetsByHeight reassembles the blocks of a single chain into tipsets.
+// A chain has at most one tipset at each height, so blocks are grouped by height.
+// The resulting tipsets are ordered by decreasing height.
+func groupTipSetsByHeight(blocks []*types.Block) ([]types.TipSet, error) {
+	byHeight := make(map[types.Uint64]types.TipSet)
+	var heights []types.Uint64
+	for _, blk := range blocks {
+		ts, ok := byHeight[blk.Height]
+		if !ok {
+			ts = types.TipSet{}
+			byHeight[blk.Height] = ts
+			heights = append(heights, blk.Height)
+		}
+		if err := ts.AddBlock(blk); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+	tipSets := make([]types.TipSet, len(heights))
+	for i, h := range heights {
+		tipSets[i] = byHeight[h]
+	}
+	return tipSets, nil
+}
+
+func reverseTipSets(list []types.TipSet) {
+	for i := len(list)/2 - 1; i >= 0; i-- {
+		opp := len(list) - 1 - i
+		list[i], list[opp] = list[opp], list[i]
+	}
+}
+
+// headChangeStore is the subset of the chain store used by the notifier.
+type headChangeStore interface {
+	chain.BlockProvider
+	HeadEvents() *pubsub.PubSub
+}
+
+// HeadChangeNotifier listens to the chain store's new head events and publishes
+// a HeadChange, listing reverted and applied tipsets, for each of them.
+type HeadChangeNotifier struct {
+	store  headChangeStore
+	events *pubsub.PubSub
+
+	// headCh is the notifier's subscription to the store's head events.
+	headCh chan interface{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHeadChangeNotifier creates a new notifier over the given store. It does not
+// publish anything until started.
+func NewHeadChangeNotifier(store headChangeStore) *HeadChangeNotifier {
+	return &HeadChangeNotifier{
+		store:  store,
+		events: pubsub.New(128),
+	}
+}
+
+// Start begins tracking head changes relative to the given current head.
+func (n *HeadChangeNotifier) Start(ctx context.Context, head types.TipSet) {
+	ctx, n.cancel = context.WithCancel(ctx)
+	n.headCh = n.store.HeadEvents().Sub(chain.NewHeadTopic)
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.loop(ctx, head)
+	}()
+}
+
+// Stop stops publishing head changes and closes all subscriptions.
+func (n *HeadChangeNotifier) Stop() {
+	if n.cancel != nil {
+		n.store.HeadEvents().Unsub(n.headCh)
+		n.cancel()
+		n.wg.Wait()
+	}
+	n.events.Shutdown()
+}
+
+// Subscribe returns a channel on which a HeadChange is delivered for every change
+// of the chain head. The subscription ends, and the channel is closed, when ctx
+// is done or the notifier is stopped.
+func (n *HeadChangeNotifier) Subscribe(ctx context.Context) <-chan *HeadChange {
+	sub := n.events.Sub(headChangeTopic)
+	out := make(chan *HeadChange)
+
+	go func() {
+		defer close(out)
+		defer func() {
+			// Unsub blocks until the subscription is drained, so keep reading.
+			go n.events.Unsub(sub)
+			for range sub {
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-sub:
+				if !ok {
+					return
+				}
+				select {
+				case out <- event.(*HeadChange):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (n *HeadChangeNotifier) loop(ctx context.Context, head types.TipSet) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-n.headCh:
+			if !ok {
+				return
+			}
+			newHead, ok := event.(types.TipSet)
+			if !ok || len(newHead) == 0 {
+				log.Error("invalid tipset published on new head channel")
+				continue
+			}
+
+			change, err := CollectHeadChange(ctx, n.store, head, newHead)
+			if err != nil {
+				log.Errorf("failed to collect head change to %s: %s", newHead.String(), err)
+				continue
+			}
+			head = newHead
+			n.events.Pub(change, headChangeTopic)
+		}
+	}
+}
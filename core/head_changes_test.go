@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cskr/pubsub"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestCollectHeadChange(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	type msgs []*types.SignedMessage
+	type msgsSet [][]*types.SignedMessage
+
+	t.Run("extending the head applies only new tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		store := hamt.NewCborStore()
+
+		chn := NewChainWithMessages(store, types.TipSet{}, msgsSet{}, msgsSet{}, msgsSet{}, msgsSet{})
+
+		change, err := CollectHeadChange(ctx, &storeBlockProvider{store}, chn[1], chn[3])
+		require.NoError(err)
+		assert.False(change.IsReorg())
+		assert.True(chn[3].Equals(change.Head))
+		require.Len(change.Applied, 2)
+		assert.True(chn[2].Equals(change.Applied[0]))
+		assert.True(chn[3].Equals(change.Applied[1]))
+	})
+
+	t.Run("fork reverts old tipsets in decreasing height and applies new ones in increasing height", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		store := hamt.NewCborStore()
+
+		m := types.NewSignedMsgs(3, mockSigner)
+		base := NewChainWithMessages(store, types.TipSet{}, msgsSet{})
+		root := headOf(base)
+
+		oldChain := NewChainWithMessages(store, root, msgsSet{msgs{m[0]}}, msgsSet{msgs{m[1]}})
+		newChain := NewChainWithMessages(store, root,
+			msgsSet{msgs{m[2]}},
+			msgsSet{msgs{}, msgs{m[1]}},
+			msgsSet{msgs{}},
+		)
+
+		change, err := CollectHeadChange(ctx, &storeBlockProvider{store}, headOf(oldChain), headOf(newChain))
+		require.NoError(err)
+		assert.True(change.IsReorg())
+
+		require.Len(change.Reverted, 2)
+		assert.True(oldChain[2].Equals(change.Reverted[0]))
+		assert.True(oldChain[1].Equals(change.Reverted[1]))
+
+		require.Len(change.Applied, 3)
+		assert.True(newChain[1].Equals(change.Applied[0]))
+		assert.True(newChain[2].Equals(change.Applied[1]))
+		assert.True(newChain[3].Equals(change.Applied[2]))
+	})
+}
+
+type fakeHeadEventsStore struct {
+	storeBlockProvider
+	events *pubsub.PubSub
+}
+
+func (s *fakeHeadEventsStore) HeadEvents() *pubsub.PubSub {
+	return s.events
+}
+
+func TestHeadChangeNotifier(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	cst := hamt.NewCborStore()
+	store := &fakeHeadEventsStore{storeBlockProvider{cst}, pubsub.New(128)}
+	chn := NewChainWithMessages(cst, types.TipSet{}, [][]*types.SignedMessage{}, [][]*types.SignedMessage{}, [][]*types.SignedMessage{})
+
+	notifier := NewHeadChangeNotifier(store)
+	notifier.Start(ctx, chn[0])
+	defer notifier.Stop()
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := notifier.Subscribe(subCtx)
+
+	store.events.Pub(chn[2], chain.NewHeadTopic)
+
+	change := <-changes
+	assert.False(change.IsReorg())
+	require.Len(change.Applied, 2)
+	assert.True(chn[1].Equals(change.Applied[0]))
+	assert.True(chn[2].Equals(change.Applied[1]))
+}
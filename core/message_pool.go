@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"math/big"
 	"sync"
 
 	"github.com/ipfs/go-cid"
@@ -49,6 +50,14 @@ func newAddressNonce(msg *types.SignedMessage) addressNonce {
 // via network or directly created via user command that have yet to be included
 // in a block. Messages are removed as they are processed.
 //
+// The pool limits the number of pending messages of each sender. When it is
+// full, a new message evicts the message with the lowest gas price if it pays
+// a higher one. A message replaces the pending message with the same sender
+// and nonce if its gas price is sufficiently higher (replace-by-fee).
+//
+// A pool may persist its messages in a MessageStore, from which it is loaded
+// at startup.
+//
 // MessagePool is safe for concurrent access.
 type MessagePool struct {
 	lk sync.RWMutex
@@ -57,7 +66,9 @@ type MessagePool struct {
 	cfg           *config.MessagePoolConfig
 	validator     MessagePoolValidator
 	pending       map[cid.Cid]*timedmessage // all pending messages
-	addressNonces map[addressNonce]bool     // set of address nonce pairs used to efficiently validate duplicate nonces
+	addressNonces map[addressNonce]cid.Cid  // the pending message of each address nonce pair, to efficiently find duplicate nonces
+	senderCounts  map[address.Address]int   // the number of pending messages of each sender
+	store         *MessageStore             // the store persisting pending messages, if any
 }
 
 // Add adds a message to the pool.
@@ -87,12 +98,23 @@ func (pool *MessagePool) addTimedMessage(ctx context.Context, msg *timedmessage)
 		return c, nil
 	}
 
-	if err = pool.validateMessage(ctx, msg.message); err != nil {
+	displaced, err := pool.validateMessage(ctx, msg.message)
+	if err != nil {
 		return cid.Undef, errors.Wrap(err, "validation error adding message to pool")
 	}
+	if displaced.Defined() {
+		log.Infof("message %s displaces message %s from the pool", c, displaced)
+		pool.remove(displaced)
+	}
 
 	pool.pending[c] = msg
-	pool.addressNonces[newAddressNonce(msg.message)] = true
+	pool.addressNonces[newAddressNonce(msg.message)] = c
+	pool.senderCounts[msg.message.From]++
+	if pool.store != nil {
+		if err := pool.store.Put(&QueuedMessage{Msg: msg.message, Stamp: msg.addedAt}); err != nil {
+			log.Warningf("failed to persist pool message %s: %s", c, err)
+		}
+	}
 	mpSize.Set(ctx, int64(len(pool.pending)))
 	return c, nil
 }
@@ -127,12 +149,56 @@ func (pool *MessagePool) Remove(c cid.Cid) {
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
 
+	pool.remove(c)
+	mpSize.Set(context.TODO(), int64(len(pool.pending)))
+}
+
+// remove removes the message by CID from the pending pool. The caller must
+// hold the lock.
+func (pool *MessagePool) remove(c cid.Cid) {
 	msg, ok := pool.pending[c]
-	if ok {
-		delete(pool.addressNonces, newAddressNonce(msg.message))
-		delete(pool.pending, c)
+	if !ok {
+		return
 	}
-	mpSize.Set(context.TODO(), int64(len(pool.pending)))
+	delete(pool.addressNonces, newAddressNonce(msg.message))
+	delete(pool.pending, c)
+	pool.senderCounts[msg.message.From]--
+	if pool.senderCounts[msg.message.From] <= 0 {
+		delete(pool.senderCounts, msg.message.From)
+	}
+	if pool.store != nil {
+		if err := pool.store.Delete(c); err != nil {
+			log.Warningf("failed to delete pool message %s from store: %s", c, err)
+		}
+	}
+}
+
+// Load adds the messages of the store to the pool, revalidating them, and persists
+// the pool's messages in the store from then on. Messages that are no longer valid
+// are dropped from the store.
+func (pool *MessagePool) Load(ctx context.Context, store *MessageStore) error {
+	qms, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	pool.lk.Lock()
+	pool.store = store
+	pool.lk.Unlock()
+
+	for _, qm := range qms {
+		if _, err := pool.addTimedMessage(ctx, &timedmessage{message: qm.Msg, addedAt: qm.Stamp}); err != nil {
+			log.Infof("dropping stored pool message %s: %s", qm.Msg, err)
+			c, err := qm.Msg.Cid()
+			if err != nil {
+				return err
+			}
+			if err := store.Delete(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // NewMessagePool constructs a new MessagePool.
@@ -142,7 +208,8 @@ func NewMessagePool(api MessagePoolAPI, cfg *config.MessagePoolConfig, validator
 		cfg:           cfg,
 		validator:     validator,
 		pending:       make(map[cid.Cid]*timedmessage),
-		addressNonces: make(map[addressNonce]bool),
+		addressNonces: make(map[addressNonce]cid.Cid),
+		senderCounts:  make(map[address.Address]int),
 	}
 }
 
@@ -152,32 +219,31 @@ func NewMessagePool(api MessagePoolAPI, cfg *config.MessagePoolConfig, validator
 // chain (if any) that do not appear in the new chain. We think
 // that the right model for keeping the message pool up to date is
 // to think about it like a garbage collector.
-func (pool *MessagePool) UpdateMessagePool(ctx context.Context, store chain.BlockProvider, oldHead, newHead types.TipSet) error {
-	oldBlocks, newBlocks, err := CollectBlocksToCommonAncestor(ctx, store, oldHead, newHead)
-	if err != nil {
-		return err
-	}
-
-	// Add all message from the old blocks to the message pool, so they can be mined again.
-	for _, blk := range oldBlocks {
-		for _, msg := range blk.Messages {
-			_, err = pool.addTimedMessage(ctx, &timedmessage{message: msg, addedAt: uint64(blk.Height)})
-			if err != nil {
-				log.Info(err)
+func (pool *MessagePool) UpdateMessagePool(ctx context.Context, store chain.BlockProvider, change *HeadChange) error {
+	// Add all message from the reverted blocks to the message pool, so they can be mined again.
+	for _, ts := range change.Reverted {
+		for _, blk := range ts.ToSlice() {
+			for _, msg := range blk.Messages {
+				_, err := pool.addTimedMessage(ctx, &timedmessage{message: msg, addedAt: uint64(blk.Height)})
+				if err != nil {
+					log.Info(err)
+				}
 			}
 		}
 	}
 
-	// Remove all messages in the new blocks from the pool, now mined.
+	// Remove all messages in the applied blocks from the pool, now mined.
 	// Cid() can error, so collect all the CIDs up front.
 	var removeCids []cid.Cid
-	for _, blk := range newBlocks {
-		for _, msg := range blk.Messages {
-			cid, err := msg.Cid()
-			if err != nil {
-				return err
+	for _, ts := range change.Applied {
+		for _, blk := range ts.ToSlice() {
+			for _, msg := range blk.Messages {
+				cid, err := msg.Cid()
+				if err != nil {
+					return err
+				}
+				removeCids = append(removeCids, cid)
 			}
-			removeCids = append(removeCids, cid)
 		}
 	}
 	for _, c := range removeCids {
@@ -185,7 +251,7 @@ func (pool *MessagePool) UpdateMessagePool(ctx context.Context, store chain.Bloc
 	}
 
 	// prune all messages that have been in the pool too long
-	return pool.timeoutMessages(ctx, store, newHead)
+	return pool.timeoutMessages(ctx, store, change.Head)
 }
 
 // timeoutMessages removes all messages from the pool that arrived more than MessageTimeout tip sets ago.
@@ -251,18 +317,62 @@ func (pool *MessagePool) LargestNonce(address address.Address) (largest uint64,
 }
 
 // validateMessage validates that too many messages aren't added to the pool and the ones that are
-// have a high probability of making it through processing.
-func (pool *MessagePool) validateMessage(ctx context.Context, message *types.SignedMessage) error {
-	if len(pool.pending) >= pool.cfg.MaxPoolSize {
-		return errors.Errorf("message pool is full (%d messages)", pool.cfg.MaxPoolSize)
+// have a high probability of making it through processing. It returns the pending message the
+// message displaces, either by replacing it by fee or by evicting it from a full pool, if any.
+func (pool *MessagePool) validateMessage(ctx context.Context, message *types.SignedMessage) (cid.Cid, error) {
+	var displaced cid.Cid
+
+	// check that message with this nonce does not already exist, unless it pays enough more to replace it
+	if c, found := pool.addressNonces[newAddressNonce(message)]; found {
+		if !pool.replacesByFee(pool.pending[c].message, message) {
+			return cid.Undef, errors.Errorf("message pool contains message with same actor and nonce but different cid (replacing it needs a gas price %d%% higher)", pool.cfg.ReplaceByFeePercent)
+		}
+		displaced = c
+	} else {
+		if pool.cfg.MaxSenderMessages > 0 && pool.senderCounts[message.From] >= pool.cfg.MaxSenderMessages {
+			return cid.Undef, errors.Errorf("message pool contains too many messages from %s (%d messages)", message.From, pool.cfg.MaxSenderMessages)
+		}
+		if len(pool.pending) >= pool.cfg.MaxPoolSize {
+			displaced = pool.lowestGasPrice()
+			if !displaced.Defined() || !message.GasPrice.GreaterThan(&pool.pending[displaced].message.GasPrice) {
+				return cid.Undef, errors.Errorf("message pool is full (%d messages)", pool.cfg.MaxPoolSize)
+			}
+		}
 	}
 
-	// check that message with this nonce does not already exist
-	_, found := pool.addressNonces[newAddressNonce(message)]
-	if found {
-		return errors.Errorf("message pool contains message with same actor and nonce but different cid")
+	// check that the message is likely to succeed in processing
+	return displaced, pool.validator.Validate(ctx, message)
+}
+
+// replacesByFee returns true if the gas price of the message is at least ReplaceByFeePercent
+// higher than that of the pending message.
+func (pool *MessagePool) replacesByFee(pending, message *types.SignedMessage) bool {
+	if !message.GasPrice.GreaterThan(&pending.GasPrice) {
+		return false
 	}
+	price := message.GasPrice.MulBigInt(big.NewInt(100))
+	minPrice := pending.GasPrice.MulBigInt(big.NewInt(int64(100 + pool.cfg.ReplaceByFeePercent)))
+	return price.GreaterEqual(minPrice)
+}
 
-	// check that the message is likely to succeed in processing
-	return pool.validator.Validate(ctx, message)
+// lowestGasPrice returns the message with the lowest gas price among the pending messages with
+// the highest nonce of their sender, so that evicting it leaves no nonce gap.
+func (pool *MessagePool) lowestGasPrice() cid.Cid {
+	last := make(map[address.Address]cid.Cid)
+	for c, msg := range pool.pending {
+		m := msg.message
+		if l, ok := last[m.From]; !ok || m.Nonce > pool.pending[l].message.Nonce {
+			last[m.From] = c
+		}
+	}
+
+	var lowest cid.Cid
+	var lowestMsg *types.SignedMessage
+	for _, c := range last {
+		m := pool.pending[c].message
+		if lowestMsg == nil || m.GasPrice.LessThan(&lowestMsg.GasPrice) {
+			lowest, lowestMsg = c, m
+		}
+	}
+	return lowest
 }
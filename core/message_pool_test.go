@@ -14,6 +14,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/repo"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -73,6 +74,7 @@ func TestMessagePoolValidate(t *testing.T) {
 		// pull the default size from the default config value
 		mpoolCfg := config.NewDefaultConfig().Mpool
 		maxMessagePoolSize := mpoolCfg.MaxPoolSize
+		mpoolCfg.MaxSenderMessages = 0 // the messages all have the same sender
 		ctx := context.Background()
 		pool := NewMessagePool(th.NewTestMessagePoolAPI(0), mpoolCfg, th.NewMockMessagePoolValidator())
 
@@ -109,6 +111,109 @@ func TestMessagePoolValidate(t *testing.T) {
 		assert.Contains(err.Error(), "message with same actor and nonce")
 	})
 
+	t.Run("replaces message with same nonce by fee", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		ctx := context.Background()
+		mpoolCfg := config.NewDefaultConfig().Mpool
+		mpoolCfg.ReplaceByFeePercent = 25
+		pool := NewMessagePool(th.NewTestMessagePoolAPI(0), mpoolCfg, th.NewMockMessagePoolValidator())
+
+		smsg1 := mustSetGasPrice(mockSigner, newSignedMessage(), 100)
+		c1, err := pool.Add(ctx, smsg1)
+		require.NoError(err)
+
+		// 20% more doesn't replace it
+		smsg2 := mustSetGasPrice(mockSigner, mustSetNonce(mockSigner, newSignedMessage(), smsg1.Nonce), 120)
+		_, err = pool.Add(ctx, smsg2)
+		require.Error(err)
+		assert.Contains(err.Error(), "message with same actor and nonce")
+
+		smsg3 := mustSetGasPrice(mockSigner, mustSetNonce(mockSigner, newSignedMessage(), smsg1.Nonce), 125)
+		c3, err := pool.Add(ctx, smsg3)
+		require.NoError(err)
+
+		assert.Len(pool.Pending(), 1)
+		_, ok := pool.Get(c1)
+		assert.False(ok)
+		_, ok = pool.Get(c3)
+		assert.True(ok)
+	})
+
+	t.Run("evicts the lowest gas price message when full", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		ctx := context.Background()
+		mpoolCfg := config.NewDefaultConfig().Mpool
+		mpoolCfg.MaxPoolSize = 3
+		pool := NewMessagePool(th.NewTestMessagePoolAPI(0), mpoolCfg, th.NewMockMessagePoolValidator())
+
+		alice, bob, carol := mockSigner.Addresses[0], mockSigner.Addresses[1], mockSigner.Addresses[2]
+		newMessage := func(from address.Address, nonce types.Uint64, price int64) *types.SignedMessage {
+			return mustSetGasPrice(mockSigner, mustSetFromAndNonce(mockSigner, newSignedMessage(), from, nonce), price)
+		}
+
+		var cids []cid.Cid
+		for _, smsg := range []*types.SignedMessage{newMessage(alice, 0, 10), newMessage(alice, 1, 30), newMessage(bob, 0, 20)} {
+			c, err := pool.Add(ctx, smsg)
+			require.NoError(err)
+			cids = append(cids, c)
+		}
+
+		// Only the last message of a sender may be evicted, so alice's cheapest message in
+		// the middle of her nonces stays and bob's is the lowest price to beat.
+		_, err := pool.Add(ctx, newMessage(carol, 0, 15))
+		require.Error(err)
+		assert.Contains(err.Error(), "message pool is full")
+		_, err = pool.Add(ctx, newMessage(carol, 0, 20))
+		require.Error(err)
+
+		c, err := pool.Add(ctx, newMessage(carol, 0, 21))
+		require.NoError(err)
+
+		assert.Len(pool.Pending(), 3)
+		_, ok := pool.Get(cids[2])
+		assert.False(ok)
+		_, ok = pool.Get(cids[0])
+		assert.True(ok)
+		_, ok = pool.Get(c)
+		assert.True(ok)
+	})
+
+	t.Run("limits the messages of a sender", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		ctx := context.Background()
+		mpoolCfg := config.NewDefaultConfig().Mpool
+		mpoolCfg.MaxSenderMessages = 2
+		pool := NewMessagePool(th.NewTestMessagePoolAPI(0), mpoolCfg, th.NewMockMessagePoolValidator())
+
+		smsgs := types.NewSignedMsgs(3, mockSigner)
+		c, err := pool.Add(ctx, smsgs[0])
+		require.NoError(err)
+		_, err = pool.Add(ctx, smsgs[1])
+		require.NoError(err)
+
+		_, err = pool.Add(ctx, smsgs[2])
+		require.Error(err)
+		assert.Contains(err.Error(), "too many messages")
+
+		// another sender isn't limited
+		other := mustResignMessage(mockSigner, newSignedMessage(), func(m *types.Message) {
+			m.From = mockSigner.Addresses[1]
+		})
+		_, err = pool.Add(ctx, other)
+		require.NoError(err)
+
+		// removing a message makes room
+		pool.Remove(c)
+		_, err = pool.Add(ctx, smsgs[2])
+		require.NoError(err)
+	})
+
 	t.Run("validates using supplied validator", func(t *testing.T) {
 		require := require.New(t)
 		assert := assert.New(t)
@@ -154,6 +259,7 @@ func TestMessagePoolAsync(t *testing.T) {
 	count := 400
 	mpoolCfg := config.NewDefaultConfig().Mpool
 	mpoolCfg.MaxPoolSize = count
+	mpoolCfg.MaxSenderMessages = count
 	msgs := types.NewSignedMsgs(count, mockSigner)
 
 	pool := NewMessagePool(th.NewTestMessagePoolAPI(0), mpoolCfg, th.NewMockMessagePoolValidator())
@@ -243,7 +349,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		newChain := NewChainWithMessages(store, parent, msgsSet{msgs{m[1]}})
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[0])
 	})
 
@@ -260,7 +366,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		oldChain := NewChainWithMessages(store, types.TipSet{}, msgsSet{msgs{m[2]}})
 		oldTipSet := headOf(oldChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, oldTipSet)) // sic
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, oldTipSet))) // sic
 		assertPoolEquals(assert, p, m[0], m[1])
 	})
 
@@ -286,7 +392,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		)
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[1])
 	})
 
@@ -310,7 +416,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		)
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[1])
 	})
 
@@ -330,7 +436,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		newChain := NewChainWithMessages(store, oldChain[0], msgsSet{msgs{m[3]}}, msgsSet{msgs{m[4], m[5]}})
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[1], m[2])
 	})
 
@@ -359,7 +465,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		)
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[6])
 	})
 
@@ -386,7 +492,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		)
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[6])
 	})
 
@@ -412,7 +518,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		)
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[3], m[5])
 	})
 
@@ -433,7 +539,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		oldTipSet := headOf(oldChain)
 
 		oldTipSetPrev := oldChain[1]
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, oldTipSetPrev))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, oldTipSetPrev)))
 		assertPoolEquals(assert, p, m[2], m[3])
 	})
 
@@ -453,7 +559,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		newChain := NewChainWithMessages(store, oldChain[len(oldChain)-1], msgsSet{msgs{m[1], m[2]}})
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p, m[0])
 	})
 
@@ -477,7 +583,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		)
 		newTipSet := headOf(newChain)
 
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, oldTipSet, newTipSet))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, oldTipSet, newTipSet)))
 		assertPoolEquals(assert, p)
 	})
 
@@ -503,7 +609,7 @@ func TestUpdateMessagePool(t *testing.T) {
 
 			// update pool with tipset that has no messages
 			next := headOf(NewChainWithMessages(store, head, msgsSet{msgs{}}))
-			assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, head, next))
+			assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, head, next)))
 
 			// assert all added messages still in pool
 			assertPoolEquals(assert, p, m[:i+1]...)
@@ -513,14 +619,14 @@ func TestUpdateMessagePool(t *testing.T) {
 
 		// next tipset times out first message only
 		next := headOf(NewChainWithMessages(store, head, msgsSet{msgs{}}))
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, head, next))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, head, next)))
 		assertPoolEquals(assert, p, m[1:]...)
 
 		// adding a chain of multiple tipsets times out based on final state
 		for i := 0; i < 4; i++ {
 			next = headOf(NewChainWithMessages(store, next, msgsSet{msgs{}}))
 		}
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, head, next))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, head, next)))
 		assertPoolEquals(assert, p, m[5:]...)
 	})
 
@@ -558,7 +664,7 @@ func TestUpdateMessagePool(t *testing.T) {
 			MustPut(store, blk)
 			next[blk.Cid()] = blk
 
-			assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, head, next))
+			assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, head, next)))
 
 			// assert all added messages still in pool
 			assertPoolEquals(assert, p, m[:i+1]...)
@@ -568,7 +674,7 @@ func TestUpdateMessagePool(t *testing.T) {
 
 		// next tipset times out first message only
 		next := headOf(NewChainWithMessages(store, head, msgsSet{msgs{}}))
-		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, head, next))
+		assert.NoError(p.UpdateMessagePool(ctx, &storeBlockProvider{store}, requireHeadChange(t, store, head, next)))
 		assertPoolEquals(assert, p, m[1:]...)
 	})
 }
@@ -642,6 +748,21 @@ func mustSetNonce(signer types.Signer, message *types.SignedMessage, nonce types
 	})
 }
 
+func mustSetFromAndNonce(signer types.Signer, message *types.SignedMessage, from address.Address, nonce types.Uint64) *types.SignedMessage {
+	return mustResignMessage(signer, message, func(m *types.Message) {
+		m.From = from
+		m.Nonce = nonce
+	})
+}
+
+func mustSetGasPrice(signer types.Signer, message *types.SignedMessage, price int64) *types.SignedMessage {
+	smsg, err := types.NewSignedMessage(message.Message, signer, types.NewGasPrice(price), message.GasLimit)
+	if err != nil {
+		panic("Error signing message")
+	}
+	return smsg
+}
+
 func mustResignMessage(signer types.Signer, message *types.SignedMessage, f func(*types.Message)) *types.SignedMessage {
 	var msg types.Message
 	msg = message.Message
@@ -656,3 +777,61 @@ func mustResignMessage(signer types.Signer, message *types.SignedMessage, f func
 func signMessage(signer types.Signer, message types.Message) (*types.SignedMessage, error) {
 	return types.NewSignedMessage(message, signer, types.NewGasPrice(0), types.NewGasUnits(0))
 }
+
+// rejectValidator rejects the messages with the given cids.
+type rejectValidator map[cid.Cid]bool
+
+func (v rejectValidator) Validate(ctx context.Context, msg *types.SignedMessage) error {
+	c, err := msg.Cid()
+	if err != nil {
+		return err
+	}
+	if v[c] {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+func TestMessagePoolLoad(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	mm := types.NewMessageMaker(t, types.MustGenerateKeyInfo(2, types.GenerateKeyInfoSeed()))
+	alice, bob := mm.Addresses()[0], mm.Addresses()[1]
+	store := NewMessageStore(repo.NewInMemoryRepo().Datastore(), MessagePoolDatastorePrefix)
+
+	pool := NewMessagePool(th.NewTestMessagePoolAPI(5), config.NewDefaultConfig().Mpool, th.NewMockMessagePoolValidator())
+	require.NoError(pool.Load(ctx, store))
+	invalid := mm.NewSignedMessage(alice, 0)
+	valid := mm.NewSignedMessage(alice, 1)
+	removed := mm.NewSignedMessage(bob, 0)
+	MustAdd(pool, invalid, valid, removed)
+	removedCid, err := removed.Cid()
+	require.NoError(err)
+	pool.Remove(removedCid)
+
+	// A restarted node loads the messages that are still valid.
+	invalidCid, err := invalid.Cid()
+	require.NoError(err)
+	restarted := NewMessagePool(th.NewTestMessagePoolAPI(8), config.NewDefaultConfig().Mpool, rejectValidator{invalidCid: true})
+	require.NoError(restarted.Load(ctx, store))
+	pending := restarted.Pending()
+	require.Len(pending, 1)
+	assert.True(valid.Equals(pending[0]))
+
+	stored, err := store.Load()
+	require.NoError(err)
+	require.Len(stored, 1)
+	assert.True(valid.Equals(stored[0].Msg))
+	assert.Equal(uint64(5), stored[0].Stamp)
+}
+
+// requireHeadChange collects the change of the head from oldHead to newHead.
+func requireHeadChange(t *testing.T, store *hamt.CborIpldStore, oldHead, newHead types.TipSet) *HeadChange {
+	change, err := CollectHeadChange(context.Background(), &storeBlockProvider{store}, oldHead, newHead)
+	require.NoError(t, err)
+	return change
+}
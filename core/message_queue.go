@@ -22,11 +22,14 @@ var (
 // not enforced.
 // A message queue is intended to record outbound messages that have been transmitted but not yet appeared in a block,
 // where the stamp could be block height.
+// A queue may persist its messages in a MessageStore, from which it is loaded at startup.
 // MessageQueue is safe for concurrent access.
 type MessageQueue struct {
 	lk sync.RWMutex
 	// Message queues keyed by sending actor address, in nonce order
 	queues map[address.Address][]*QueuedMessage
+	// Store persisting the queued messages, if any
+	store *MessageStore
 }
 
 // QueuedMessage is a message an the stamp it was enqueued with.
@@ -60,10 +63,65 @@ func (mq *MessageQueue) Enqueue(msg *types.SignedMessage, stamp uint64) error {
 			return errors.Errorf("Invalid nonce %d, expected %d", msg.Nonce, nextNonce)
 		}
 	}
-	mq.queues[msg.From] = append(q, &QueuedMessage{msg, stamp})
+	qm := &QueuedMessage{msg, stamp}
+	mq.queues[msg.From] = append(q, qm)
+	mq.persist(qm)
 	return nil
 }
 
+// Replace replaces the queued message with the sender and nonce of msg by msg, with a new stamp,
+// and returns the message it replaced. It is an error if no message with that nonce is queued.
+func (mq *MessageQueue) Replace(msg *types.SignedMessage, stamp uint64) (*types.SignedMessage, error) {
+	mq.lk.Lock()
+	defer mq.lk.Unlock()
+
+	for _, qm := range mq.queues[msg.From] {
+		if qm.Msg.Nonce == msg.Nonce {
+			old := qm.Msg
+			qm.Msg = msg
+			qm.Stamp = stamp
+			mq.unpersist(old)
+			mq.persist(qm)
+			return old, nil
+		}
+	}
+	return nil, errors.Errorf("no message from %s with nonce %d in queue", msg.From, msg.Nonce)
+}
+
+// Requeue puts a message that had been removed from the queue back in its sender's queue, in nonce order,
+// with a new stamp. Returns false, leaving the queue unchanged, if a message with that nonce is already queued
+// or the message's nonce is more than one greater than the largest nonce queued for the sender.
+func (mq *MessageQueue) Requeue(msg *types.SignedMessage, stamp uint64) bool {
+	defer func() {
+		mqSizeGa.Set(context.TODO(), mq.Size())
+	}()
+
+	mq.lk.Lock()
+	defer mq.lk.Unlock()
+
+	q := mq.queues[msg.From]
+	i := 0
+	for ; i < len(q); i++ {
+		if q[i].Msg.Nonce == msg.Nonce {
+			return false
+		}
+		if q[i].Msg.Nonce > msg.Nonce {
+			break
+		}
+	}
+	if i == len(q) && len(q) > 0 && msg.Nonce != q[len(q)-1].Msg.Nonce+1 {
+		return false
+	}
+
+	qm := &QueuedMessage{msg, stamp}
+	requeued := make([]*QueuedMessage, 0, len(q)+1)
+	requeued = append(requeued, q[:i]...)
+	requeued = append(requeued, qm)
+	mq.queues[msg.From] = append(requeued, q[i:]...)
+	mq.persist(qm)
+	return true
+}
+
 // RemoveNext removes and returns a single message from the queue, if it bears the expected nonce value, with found = true.
 // Returns found = false if the queue is empty or the expected nonce is less than any in the queue for that address
 // (indicating the message had already been removed).
@@ -84,6 +142,7 @@ func (mq *MessageQueue) RemoveNext(sender address.Address, expectedNonce uint64)
 			mq.queues[sender] = q[1:] // pop the head
 			msg = head.Msg
 			found = true
+			mq.unpersist(msg)
 		} else if expectedNonce > uint64(head.Msg.Nonce) {
 			err = errors.Errorf("Next message for %s has nonce %d, expected %d", sender, head.Msg.Nonce, expectedNonce)
 		}
@@ -104,6 +163,9 @@ func (mq *MessageQueue) Clear(sender address.Address) bool {
 
 	q := mq.queues[sender]
 	delete(mq.queues, sender)
+	for _, qm := range q {
+		mq.unpersist(qm.Msg)
+	}
 	return len(q) > 0
 }
 
@@ -127,6 +189,7 @@ func (mq *MessageQueue) ExpireBefore(stamp uint64) map[address.Address][]*types.
 			mqExpireCt.Inc(ctx, int64(len(q)))
 			for _, m := range q {
 				expired[sender] = append(expired[sender], m.Msg)
+				mq.unpersist(m.Msg)
 			}
 
 			mq.queues[sender] = []*QueuedMessage{}
@@ -186,3 +249,70 @@ func (mq *MessageQueue) List(sender address.Address) []*QueuedMessage {
 	}
 	return out
 }
+
+// Load enqueues the messages of the store, revalidating them, and persists the queue's messages
+// in the store from then on. It drops from the store the messages that are no longer valid, such as
+// messages mined while the node was down, and the messages that follow an invalid one from the same
+// sender, which could not be mined after it.
+func (mq *MessageQueue) Load(ctx context.Context, store *MessageStore, validator MessagePoolValidator) error {
+	qms, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	mq.lk.Lock()
+	mq.store = store
+	mq.lk.Unlock()
+
+	broken := make(map[address.Address]bool)
+	for _, qm := range qms {
+		sender := qm.Msg.From
+		if !broken[sender] {
+			err := validator.Validate(ctx, qm.Msg)
+			if err == nil {
+				err = mq.Enqueue(qm.Msg, qm.Stamp)
+			}
+			if err == nil {
+				continue
+			}
+			log.Infof("dropping stored outbound message %s: %s", qm.Msg, err)
+			// Messages mined while the node was down precede the sender's queued messages.
+			if _, found := mq.LargestNonce(sender); found {
+				broken[sender] = true
+			}
+		}
+
+		c, err := qm.Msg.Cid()
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persist stores a queued message if the queue has a store. The caller must hold the lock.
+func (mq *MessageQueue) persist(qm *QueuedMessage) {
+	if mq.store == nil {
+		return
+	}
+	if err := mq.store.Put(qm); err != nil {
+		log.Warningf("failed to persist outbound message %s: %s", qm.Msg, err)
+	}
+}
+
+// unpersist removes a message from the queue's store, if any. The caller must hold the lock.
+func (mq *MessageQueue) unpersist(msg *types.SignedMessage) {
+	if mq.store == nil {
+		return
+	}
+	c, err := msg.Cid()
+	if err == nil {
+		err = mq.store.Delete(c)
+	}
+	if err != nil {
+		log.Warningf("failed to delete outbound message %s from store: %s", msg, err)
+	}
+}
@@ -1,6 +1,7 @@
 package core_test
 
 import (
+	"context"
 	"math"
 	"testing"
 
@@ -9,6 +10,8 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -196,6 +199,90 @@ func TestMessageQueue(t *testing.T) {
 		assertLargestNonce(q, alice, 1)
 	})
 
+	t.Run("replace", func(t *testing.T) {
+		msgs := []*types.SignedMessage{
+			mm.NewSignedMessage(alice, 0),
+			mm.NewSignedMessage(alice, 1),
+		}
+		replacement := mm.NewSignedMessage(alice, 1)
+
+		q := core.NewMessageQueue()
+		_, err := q.Replace(replacement, 2)
+		assert.Error(err)
+
+		requireEnqueue(q, msgs[0], 0)
+		requireEnqueue(q, msgs[1], 0)
+		old, err := q.Replace(replacement, 2)
+		require.NoError(err)
+		assert.Equal(msgs[1], old)
+
+		assert.Equal(int64(2), q.Size())
+		assert.Equal(replacement, q.List(alice)[1].Msg)
+		assert.Equal(uint64(2), q.List(alice)[1].Stamp)
+
+		_, err = q.Replace(mm.NewSignedMessage(alice, 2), 2)
+		assert.Error(err)
+	})
+
+	t.Run("requeue", func(t *testing.T) {
+		msgs := []*types.SignedMessage{
+			mm.NewSignedMessage(alice, 0),
+			mm.NewSignedMessage(alice, 1),
+			mm.NewSignedMessage(alice, 2),
+			mm.NewSignedMessage(alice, 3),
+		}
+
+		q := core.NewMessageQueue()
+		assert.True(q.Requeue(msgs[1], 5))
+		assert.True(q.Requeue(msgs[2], 5))
+		assert.False(q.Requeue(msgs[2], 6))
+		assert.True(q.Requeue(msgs[0], 6))
+		assert.False(q.Requeue(mm.NewSignedMessage(alice, 5), 6))
+
+		assert.Equal(int64(3), q.Size())
+		assert.Equal(&core.QueuedMessage{Msg: msgs[0], Stamp: 6}, q.List(alice)[0])
+		assert.Equal(&core.QueuedMessage{Msg: msgs[2], Stamp: 5}, q.List(alice)[2])
+
+		// Requeued messages keep the nonce sequence.
+		requireEnqueue(q, msgs[3], 7)
+		assert.Equal(msgs[0], requireRemoveNext(q, alice, 0))
+	})
+
+	t.Run("persist and load", func(t *testing.T) {
+		ctx := context.Background()
+		store := core.NewMessageStore(repo.NewInMemoryRepo().Datastore(), core.OutboxDatastorePrefix)
+
+		q := core.NewMessageQueue()
+		require.NoError(q.Load(ctx, store, th.NewMockMessagePoolValidator()))
+		requireEnqueue(q, mm.NewSignedMessage(alice, 0), 1)
+		requireEnqueue(q, mm.NewSignedMessage(alice, 1), 2)
+		requireEnqueue(q, mm.NewSignedMessage(bob, 0), 3)
+		requireRemoveNext(q, alice, 0)
+		replacement := mm.NewSignedMessage(bob, 0)
+		_, err := q.Replace(replacement, 4)
+		require.NoError(err)
+
+		loaded := core.NewMessageQueue()
+		require.NoError(loaded.Load(ctx, store, th.NewMockMessagePoolValidator()))
+		require.Len(loaded.List(alice), 1)
+		assert.True(q.List(alice)[0].Msg.Equals(loaded.List(alice)[0].Msg))
+		assert.Equal(uint64(2), loaded.List(alice)[0].Stamp)
+		require.Len(loaded.List(bob), 1)
+		assert.True(replacement.Equals(loaded.List(bob)[0].Msg))
+		assert.Equal(uint64(4), loaded.List(bob)[0].Stamp)
+
+		// Invalid messages are dropped from the store.
+		loaded.Clear(bob)
+		requireEnqueue(loaded, mm.NewSignedMessage(alice, 2), 5)
+		invalid := core.NewMessageQueue()
+		require.NoError(invalid.Load(ctx, store, &th.MockMessagePoolValidator{Valid: false}))
+		assert.Equal(int64(0), invalid.Size())
+
+		stored, err := store.Load()
+		require.NoError(err)
+		assert.Empty(stored)
+	})
+
 	t.Run("independent addresses", func(t *testing.T) {
 		fromAlice := []*types.SignedMessage{
 			mm.NewSignedMessage(alice, 0),
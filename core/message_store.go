@@ -0,0 +1,86 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+func init() {
+	cbor.RegisterCborType(QueuedMessage{})
+}
+
+const (
+	// MessagePoolDatastorePrefix is the datastore prefix for the messages of the message pool.
+	MessagePoolDatastorePrefix = "mpool"
+	// OutboxDatastorePrefix is the datastore prefix for the messages of the outbound message queue.
+	OutboxDatastorePrefix = "outbox"
+)
+
+// MessageStore persists messages with their stamps under a datastore prefix, keyed by message cid,
+// so that a message pool or queue survives restarts.
+type MessageStore struct {
+	ds     repo.Datastore
+	prefix string
+}
+
+// NewMessageStore returns a store of messages under the prefix of the datastore.
+func NewMessageStore(ds repo.Datastore, prefix string) *MessageStore {
+	return &MessageStore{ds: ds, prefix: prefix}
+}
+
+// Put stores a message and its stamp.
+func (ms *MessageStore) Put(qm *QueuedMessage) error {
+	c, err := qm.Msg.Cid()
+	if err != nil {
+		return errors.Wrap(err, "failed to create CID")
+	}
+	datum, err := cbor.DumpObject(qm)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal message")
+	}
+	if err := ms.ds.Put(ms.key(c), datum); err != nil {
+		return errors.Wrap(err, "could not save message")
+	}
+	return nil
+}
+
+// Delete removes a message from the store. Deleting a message that isn't stored is not an error.
+func (ms *MessageStore) Delete(c cid.Cid) error {
+	if err := ms.ds.Delete(ms.key(c)); err != nil && err != datastore.ErrNotFound {
+		return errors.Wrap(err, "could not delete message")
+	}
+	return nil
+}
+
+// Load returns all stored messages, in nonce order.
+func (ms *MessageStore) Load() ([]*QueuedMessage, error) {
+	results, err := ms.ds.Query(query.Query{Prefix: datastore.NewKey(ms.prefix).String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query messages from datastore")
+	}
+
+	var qms []*QueuedMessage
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read messages from datastore")
+		}
+		var qm QueuedMessage
+		if err := cbor.DecodeInto(entry.Value, &qm); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal message from datastore")
+		}
+		qms = append(qms, &qm)
+	}
+	sort.Slice(qms, func(i, j int) bool { return qms[i].Msg.Nonce < qms[j].Msg.Nonce })
+	return qms, nil
+}
+
+func (ms *MessageStore) key(c cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{ms.prefix, c.String()})
+}
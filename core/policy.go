@@ -27,8 +27,8 @@ type policyTarget interface {
 // Messages are removed from the queue as soon as they appear in a block that's part of a heaviest chain.
 // At this point, messages are highly likely to be valid and known to a large number of nodes,
 // even if the block ends up as an abandoned fork.
-// There is no special handling for re-orgs and messages do not revert to the queue if the block
-// ends up childless (in contrast to the message pool).
+// The policy has no special handling for re-orgs: the OutboxRepublisher returns messages of reverted
+// blocks to the queue.
 type MessageQueuePolicy struct {
 	// The queue on which this policy acts
 	queue policyTarget
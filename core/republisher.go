@@ -0,0 +1,169 @@
+package core
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// OutboxRepublishRounds is the number of rounds an outbound message waits to be mined before it is
+// published again. The wait doubles after each publication, up to OutboxMaxRepublishRounds.
+const OutboxRepublishRounds = 3
+
+// OutboxMaxRepublishRounds is the maximum number of rounds between publications of an outbound message.
+const OutboxMaxRepublishRounds = 24
+
+// The outbound queue object the republisher publishes messages of.
+type republisherQueue interface {
+	Queues() []address.Address
+	List(sender address.Address) []*QueuedMessage
+	Requeue(msg *types.SignedMessage, stamp uint64) bool
+}
+
+// The pool to which the republisher returns messages of reverted blocks.
+type republisherPool interface {
+	Add(ctx context.Context, msg *types.SignedMessage) (cid.Cid, error)
+}
+
+// RepublishFunc publishes a message to the network.
+type RepublishFunc func(ctx context.Context, msg *types.SignedMessage) error
+
+// OutboxRepublisher publishes the messages of the outbound queue again when they have not been
+// mined some rounds after they were sent, backing off exponentially between publications.
+// When a re-org reverts blocks that included messages sent by this node, the republisher puts the
+// messages back in the outbound queue and the message pool and publishes them again.
+type OutboxRepublisher struct {
+	queue   republisherQueue
+	pool    republisherPool
+	isOurs  func(address.Address) bool
+	publish RepublishFunc
+	// Number of rounds to wait before the first publication again
+	rounds uint64
+
+	// Publication schedule of the queued messages, by message cid
+	schedule map[cid.Cid]*republishSchedule
+}
+
+type republishSchedule struct {
+	// height at which the message is next published
+	next uint64
+	// rounds to wait after the next publication
+	interval uint64
+}
+
+// NewOutboxRepublisher returns a republisher of the messages in queue that publishes a message again
+// when it hasn't been mined `rounds` rounds after it was queued. isOurs tells whether a message sender
+// is one of the node's addresses.
+func NewOutboxRepublisher(queue *MessageQueue, pool *MessagePool, isOurs func(address.Address) bool, publish RepublishFunc, rounds uint64) *OutboxRepublisher {
+	return &OutboxRepublisher{
+		queue:    queue,
+		pool:     pool,
+		isOurs:   isOurs,
+		publish:  publish,
+		rounds:   rounds,
+		schedule: make(map[cid.Cid]*republishSchedule),
+	}
+}
+
+// OnHeadChange restores the node's messages from blocks the head change reverted and publishes the
+// messages that are due. It must be called after the outbound queue policy removed mined messages.
+func (r *OutboxRepublisher) OnHeadChange(ctx context.Context, change *HeadChange) error {
+	height, err := change.Head.Height()
+	if err != nil {
+		return err
+	}
+
+	if change.IsReorg() {
+		if err := r.restoreReverted(ctx, change, height); err != nil {
+			return err
+		}
+	}
+
+	queued := make(map[cid.Cid]bool)
+	var msgs []*types.SignedMessage
+	for _, sender := range r.queue.Queues() {
+		for _, qm := range r.queue.List(sender) {
+			c, err := qm.Msg.Cid()
+			if err != nil {
+				return err
+			}
+			queued[c] = true
+
+			s, ok := r.schedule[c]
+			if !ok {
+				s = &republishSchedule{next: qm.Stamp + r.rounds, interval: r.rounds}
+				r.schedule[c] = s
+			}
+			if height >= s.next {
+				msgs = append(msgs, qm.Msg)
+				s.interval *= 2
+				if s.interval > OutboxMaxRepublishRounds {
+					s.interval = OutboxMaxRepublishRounds
+				}
+				s.next = height + s.interval
+			}
+		}
+	}
+
+	// Forget the messages no longer queued.
+	for c := range r.schedule {
+		if !queued[c] {
+			delete(r.schedule, c)
+		}
+	}
+
+	for _, msg := range msgs {
+		if err := r.publish(ctx, msg); err != nil {
+			log.Warningf("failed to republish outbound message %s: %s", msg, err)
+		}
+	}
+	return nil
+}
+
+// senderNonce identifies the message of a sender with a nonce. The chain includes at most
+// one message for each.
+type senderNonce struct {
+	from  address.Address
+	nonce types.Uint64
+}
+
+// restoreReverted puts the node's messages of the reverted blocks that the new chain doesn't include
+// back in the outbound queue and the pool, stamped with the new head height, due for publication.
+// Messages whose nonce the new chain uses for another message of the sender can't be mined anymore
+// and are dropped.
+func (r *OutboxRepublisher) restoreReverted(ctx context.Context, change *HeadChange, height uint64) error {
+	applied := make(map[senderNonce]bool)
+	for _, ts := range change.Applied {
+		for _, blk := range ts.ToSlice() {
+			for _, msg := range blk.Messages {
+				applied[senderNonce{msg.From, msg.Nonce}] = true
+			}
+		}
+	}
+
+	// Restore messages in increasing height order, which is nonce order for each sender.
+	for i := len(change.Reverted) - 1; i >= 0; i-- {
+		for _, blk := range change.Reverted[i].ToSlice() {
+			for _, msg := range blk.Messages {
+				if applied[senderNonce{msg.From, msg.Nonce}] || !r.isOurs(msg.From) {
+					continue
+				}
+				c, err := msg.Cid()
+				if err != nil {
+					return err
+				}
+				if !r.queue.Requeue(msg, height) {
+					continue
+				}
+				if _, err := r.pool.Add(ctx, msg); err != nil {
+					log.Infof("failed to return reverted message %s to the pool: %s", c, err)
+				}
+				r.schedule[c] = &republishSchedule{next: height, interval: r.rounds}
+			}
+		}
+	}
+	return nil
+}
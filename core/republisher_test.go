@@ -0,0 +1,100 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/core"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestOutboxRepublisher(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys := types.MustGenerateKeyInfo(2, types.GenerateKeyInfoSeed())
+	mm := types.NewMessageMaker(t, keys)
+
+	alice := mm.Addresses()[0]
+	bob := mm.Addresses()[1]
+	isOurs := func(addr address.Address) bool { return addr == alice }
+
+	var published []*types.SignedMessage
+	publish := func(ctx context.Context, msg *types.SignedMessage) error {
+		published = append(published, msg)
+		return nil
+	}
+
+	t.Run("republishes unmined messages with backoff", func(t *testing.T) {
+		published = nil
+		blocks := th.NewFakeBlockProvider()
+		q := core.NewMessageQueue()
+		pool := core.NewMessagePool(th.NewTestMessagePoolAPI(0), config.NewDefaultConfig().Mpool, th.NewMockMessagePoolValidator())
+		republisher := core.NewOutboxRepublisher(q, pool, isOurs, publish, 3)
+
+		msg := mm.NewSignedMessage(alice, 1)
+		core.MustEnqueue(q, 100, msg)
+
+		head := blocks.NewBlock(0)
+		head.Height = 100
+		var publishedAt []uint64
+		for i := uint64(1); i <= 12; i++ {
+			next := blocks.NewBlock(i, head)
+			change, err := core.CollectHeadChange(ctx, blocks, requireTipset(t, head), requireTipset(t, next))
+			require.NoError(err)
+			require.NoError(republisher.OnHeadChange(ctx, change))
+			if len(published) > len(publishedAt) {
+				publishedAt = append(publishedAt, uint64(next.Height))
+			}
+			head = next
+		}
+
+		// Published 3 rounds after it was queued, then 6 rounds after that.
+		assert.Equal([]uint64{103, 109}, publishedAt)
+		assert.Equal(msg, published[0])
+	})
+
+	t.Run("restores our messages of reverted blocks", func(t *testing.T) {
+		published = nil
+		blocks := th.NewFakeBlockProvider()
+		q := core.NewMessageQueue()
+		pool := core.NewMessagePool(th.NewTestMessagePoolAPI(0), config.NewDefaultConfig().Mpool, th.NewMockMessagePoolValidator())
+		republisher := core.NewOutboxRepublisher(q, pool, isOurs, publish, 3)
+
+		reverted := mm.NewSignedMessage(alice, 1)
+		remined := mm.NewSignedMessage(alice, 2)
+		notOurs := mm.NewSignedMessage(bob, 1)
+		queued := mm.NewSignedMessage(alice, 3)
+		core.MustEnqueue(q, 1, queued)
+		// The new chain has another message with the nonce of the replaced message.
+		replaced := mm.NewSignedMessage(alice, 4)
+		replacement := mm.NewSignedMessage(alice, 4)
+
+		root := blocks.NewBlock(0)
+		fork := blocks.NewBlockWithMessages(1, []*types.SignedMessage{reverted, remined, notOurs, replaced}, root)
+		b1 := blocks.NewBlock(2, root)
+		b2 := blocks.NewBlockWithMessages(3, []*types.SignedMessage{remined, replacement}, b1)
+
+		change, err := core.CollectHeadChange(ctx, blocks, requireTipset(t, fork), requireTipset(t, b2))
+		require.NoError(err)
+		require.NoError(republisher.OnHeadChange(ctx, change))
+
+		require.Len(q.List(alice), 2)
+		assert.Equal(qm(reverted, 2), q.List(alice)[0])
+		assert.Equal(qm(queued, 1), q.List(alice)[1])
+		assert.Empty(q.List(bob))
+
+		assert.Equal([]*types.SignedMessage{reverted}, pool.Pending())
+		assert.Equal([]*types.SignedMessage{reverted}, published)
+	})
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/filecoin-project/go-filecoin/commands"
+	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/gengen/util"
+	"github.com/filecoin-project/go-filecoin/mining"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -75,6 +77,9 @@ func main() {
 	outCar := flag.String("out-car", "", "writes the generated car file to the give path, instead of stdout")
 	configFilePath := flag.String("config", "", "reads configuration from this json file, instead of stdin")
 	seed := flag.Int64("seed", defaultSeed, "provides the seed for randomization, defaults to current unix epoch")
+	genesisTime := flag.Uint64("time", 0, "sets the time of the genesis block in seconds since the unix epoch, unless the configuration sets it, which gives the chain epochs")
+	blockTime := flag.Duration("block-time", mining.DefaultBlockTime, "sets the duration of the epochs of the chain, unless the configuration sets it")
+	consensusProtocol := flag.String("consensus", consensus.ExpectedProtocol, "sets the consensus protocol of the chain, \"expected\" or \"authority\" (proof-of-authority for private networks), unless the configuration sets it")
 
 	// ExitOnError is set
 	flag.Parse(os.Args[1:]) // nolint: errcheck
@@ -94,6 +99,15 @@ func main() {
 		}
 		outfile = f
 	}
+	if cfg.Time == 0 {
+		cfg.Time = *genesisTime
+	}
+	if cfg.BlockTime == 0 {
+		cfg.BlockTime = *blockTime
+	}
+	if cfg.Consensus == "" {
+		cfg.Consensus = *consensusProtocol
+	}
 	cfg.ProofsMode = types.LiveProofsMode
 	if *testProofsMode {
 		cfg.ProofsMode = types.TestProofsMode
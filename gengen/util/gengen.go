@@ -7,6 +7,7 @@ import (
 	"math/big"
 	mrand "math/rand"
 	"strconv"
+	"time"
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
@@ -61,6 +62,20 @@ type GenesisCfg struct {
 
 	// ProofsMode affects sealing, sector packing, PoSt, etc. in the proofs library
 	ProofsMode types.ProofsMode
+
+	// Time is the time of the genesis block, in seconds since the unix epoch.
+	// The epochs of the chain are counted from it. Chains without a genesis
+	// time mine without a chain clock.
+	Time uint64
+
+	// BlockTime is the duration of the epochs of the chain. It is required
+	// when Time is set.
+	BlockTime time.Duration
+
+	// Consensus is the consensus protocol of the chain, "expected" or
+	// "authority". Proof-of-authority chains take the miners set up at genesis
+	// as their authorities. It defaults to expected consensus.
+	Consensus string
 }
 
 // RenderedGenInfo contains information about a genesis block creation
@@ -93,6 +108,19 @@ type RenderedMinerInfo struct {
 //
 // WARNING: Do not use maps in this code, they will make this code non deterministic.
 func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs blockstore.Blockstore, seed int64) (*RenderedGenInfo, error) {
+	if cfg.Time != 0 && cfg.BlockTime < time.Millisecond {
+		return nil, fmt.Errorf("a genesis time requires a block time of at least a millisecond, got %s", cfg.BlockTime)
+	}
+	switch cfg.Consensus {
+	case "", consensus.ExpectedProtocol:
+	case consensus.AuthorityProtocol:
+		if len(cfg.Miners) == 0 {
+			return nil, errors.New("proof-of-authority consensus requires miners to act as authorities")
+		}
+	default:
+		return nil, fmt.Errorf("unknown consensus protocol %q", cfg.Consensus)
+	}
+
 	pnrg := mrand.New(mrand.NewSource(seed))
 	keys, err := genKeys(cfg.Keys, pnrg)
 	if err != nil {
@@ -144,6 +172,13 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 	geneblk := &types.Block{
 		StateRoot: stateRoot,
 	}
+	if cfg.Time != 0 {
+		geneblk.Timestamp = types.Uint64(cfg.Time)
+		geneblk.BlockTime = types.Uint64(cfg.BlockTime / time.Millisecond)
+	}
+	if cfg.Consensus == consensus.AuthorityProtocol {
+		geneblk.Consensus = cfg.Consensus
+	}
 
 	c, err := cst.Put(ctx, geneblk)
 	if err != nil {
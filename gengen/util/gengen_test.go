@@ -4,6 +4,7 @@ import (
 	"context"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
 	ds "github.com/ipfs/go-datastore"
@@ -11,11 +12,14 @@ import (
 	"github.com/ipfs/go-ipfs-blockstore"
 	"github.com/ipfs/go-ipfs-exchange-offline"
 
+	"github.com/filecoin-project/go-filecoin/consensus"
 	. "github.com/filecoin-project/go-filecoin/gengen/util"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var testConfig = &GenesisCfg{
@@ -78,3 +82,71 @@ func TestGenGenDeterministicBetweenBuilds(t *testing.T) {
 		}
 	}
 }
+
+func TestGenGenCommitsEpochs(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	newStores := func() (*hamt.CborIpldStore, blockstore.Blockstore) {
+		bstore := blockstore.NewBlockstore(ds.NewMapDatastore())
+		return &hamt.CborIpldStore{Blocks: bserv.New(bstore, offline.Exchange(bstore))}, bstore
+	}
+
+	cfg := *testConfig
+	cfg.Time = 1553189402
+	cfg.BlockTime = 30 * time.Second
+
+	cst, bstore := newStores()
+	info, err := GenGen(ctx, &cfg, cst, bstore, 0)
+	require.NoError(err)
+
+	var genesis types.Block
+	require.NoError(cst.Get(ctx, info.GenesisCid, &genesis))
+	assert.Equal(types.Uint64(1553189402), genesis.Timestamp)
+	assert.Equal(types.Uint64(30000), genesis.BlockTime)
+
+	// A genesis time is meaningless without the duration of the epochs.
+	cfg.BlockTime = 0
+	cst, bstore = newStores()
+	_, err = GenGen(ctx, &cfg, cst, bstore, 0)
+	assert.Error(err)
+}
+
+func TestGenGenCommitsConsensus(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	newStores := func() (*hamt.CborIpldStore, blockstore.Blockstore) {
+		bstore := blockstore.NewBlockstore(ds.NewMapDatastore())
+		return &hamt.CborIpldStore{Blocks: bserv.New(bstore, offline.Exchange(bstore))}, bstore
+	}
+
+	cfg := *testConfig
+	cfg.Consensus = consensus.AuthorityProtocol
+
+	cst, bstore := newStores()
+	info, err := GenGen(ctx, &cfg, cst, bstore, 0)
+	require.NoError(err)
+
+	var genesis types.Block
+	require.NoError(cst.Get(ctx, info.GenesisCid, &genesis))
+	assert.Equal(consensus.AuthorityProtocol, genesis.Consensus)
+
+	// Proof-of-authority chains need miners to act as authorities.
+	cfg.Miners = nil
+	cst, bstore = newStores()
+	_, err = GenGen(ctx, &cfg, cst, bstore, 0)
+	assert.Error(err)
+
+	cfg = *testConfig
+	cfg.Consensus = "unknown"
+	cst, bstore = newStores()
+	_, err = GenGen(ctx, &cfg, cst, bstore, 0)
+	assert.Error(err)
+}
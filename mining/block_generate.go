@@ -10,6 +10,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
 )
@@ -52,12 +53,22 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 		return nil, errors.Wrap(err, "get base tip set ancestors")
 	}
 
-	pending := w.messageSource.Pending()
-	mq := NewMessageQueue(pending)
-	messages := mq.Drain()
+	tmpl, err := w.templateBuilder.Build(ctx, stateTree.GetActor, w.messageSource.Pending())
+	if err != nil {
+		return nil, errors.Wrap(err, "build block template")
+	}
+	for _, msg := range tmpl.Stale {
+		// The nonces of stale messages have been used, so they can never be mined.
+		mc, err := msg.Cid()
+		if err == nil {
+			w.messageSource.Remove(mc)
+		} else {
+			log.Warningf("failed to get CID from message: %s", err)
+		}
+	}
 
 	vms := vm.NewStorageMap(w.blockstore)
-	res, err := w.processor.ApplyMessagesAndPayRewards(ctx, stateTree, vms, messages, w.minerOwnerAddr, types.NewBlockHeight(blockHeight), ancestors)
+	res, err := w.processor.ApplyMessagesAndPayRewards(ctx, stateTree, vms, tmpl.Messages, w.minerOwnerAddr, types.NewBlockHeight(blockHeight), ancestors)
 	if err != nil {
 		return nil, errors.Wrap(err, "generate apply messages")
 	}
@@ -87,6 +98,9 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 		StateRoot:       newStateTreeCid,
 		Ticket:          ticket,
 	}
+	if err := consensus.SignBlock(next, w.minerPubKey, w.workerSigner); err != nil {
+		return nil, errors.Wrap(err, "sign block")
+	}
 
 	for i, msg := range res.PermanentFailures {
 		// We will not be able to apply this message in the future because the error was permanent.
@@ -98,7 +112,7 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 		if err == nil {
 			w.messageSource.Remove(mc)
 		} else {
-			log.Warningf("failed to get CID from message", err)
+			log.Warningf("failed to get CID from message: %s", err)
 		}
 	}
 
@@ -0,0 +1,134 @@
+package mining
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/clock"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// epochScheduler schedules mining by the epochs of a chain clock rather than
+// by sleeping between mining runs. It makes exactly one mining attempt per
+// epoch: an attempt for epoch n mines on the heaviest tipset with as many
+// null blocks as there are epochs without blocks between the tipset and n.
+//
+// The worker waits a block time before it releases a block, so the attempt
+// for epoch n starts the mining delay after the start of epoch n-1, which
+// leaves the mining delay to collect the blocks of epoch n-1 and releases the
+// block early in epoch n.
+type epochScheduler struct {
+	// worker contains the actual mining logic.
+	worker Worker
+	// clock tells the epoch to mine for.
+	clock *clock.ChainClock
+	// mineDelay is the time the scheduler collects blocks for after the
+	// start of an epoch.
+	mineDelay time.Duration
+	// pollHeadFunc is the function the scheduler uses to poll for the
+	// current heaviest tipset
+	pollHeadFunc func() (*types.TipSet, error)
+
+	isStarted bool
+}
+
+// NewEpochScheduler returns a scheduler that makes one mining attempt with the
+// worker for each epoch of the chain clock.
+func NewEpochScheduler(w Worker, clk *clock.ChainClock, md time.Duration, f func() (*types.TipSet, error)) Scheduler {
+	return &epochScheduler{worker: w, clock: clk, mineDelay: md, pollHeadFunc: f}
+}
+
+// Start starts mining an attempt per epoch, beginning with the next epoch. It
+// returns the channel mined blocks are sent to and a waitgroup that signals
+// that mining stopped. Cancel the miningCtx to stop mining.
+func (s *epochScheduler) Start(miningCtx context.Context) (<-chan Output, *sync.WaitGroup) {
+	// we buffer 1 to make sure we do not get blocked when shutting down
+	outCh := make(chan Output, 1)
+	var doneWg sync.WaitGroup    // for internal use
+	var extDoneWg sync.WaitGroup // for external use
+
+	log.Debugf("Epoch scheduler starting main loop")
+	doneWg.Add(1)
+
+	s.isStarted = true
+	go func() {
+		defer doneWg.Done()
+		defer func() { s.isStarted = false }()
+
+		var lastEpoch uint64
+		var prevBase types.TipSet
+		var prevWon bool
+		for {
+			epoch := s.clock.CurrentEpoch() + 1
+			if epoch <= lastEpoch {
+				epoch = lastEpoch + 1
+			}
+			if !s.waitUntil(miningCtx, s.clock.EpochStart(epoch-1).Add(s.mineDelay)) {
+				return
+			}
+
+			// Ask for the heaviest tipset.
+			base, _ := s.pollHeadFunc()
+			if base == nil { // Don't try to mine on an unset head.
+				outCh <- NewOutput(nil, errors.New("cannot mine on unset (nil) head"))
+				return
+			}
+			if prevWon && prevBase.Equals(*base) {
+				// The block just mined has likely not propagated through
+				// the system yet, look again after the mining delay.
+				if !s.waitUntil(miningCtx, s.clock.Now().Add(s.mineDelay)) {
+					return
+				}
+				continue
+			}
+			height, err := base.Height()
+			if err != nil {
+				outCh <- NewOutput(nil, errors.Wrap(err, "failed to get height of mining base"))
+				return
+			}
+			lastEpoch = epoch
+			if height >= epoch {
+				// The chain already has blocks for this epoch, which happens
+				// when the local clock is behind.
+				continue
+			}
+
+			// Mine synchronously! Ignore all new tipsets.
+			prevWon = s.worker.Mine(miningCtx, *base, int(epoch-height-1), outCh)
+			prevBase = *base
+		}
+	}()
+
+	// This tear down goroutine waits for all work to be done before closing
+	// channels.  When this goroutine is complete, external code can
+	// consider the scheduler to be done.
+	extDoneWg.Add(1)
+	go func() {
+		defer extDoneWg.Done()
+		doneWg.Wait()
+		close(outCh)
+	}()
+	return outCh, &extDoneWg
+}
+
+// IsStarted is called when starting mining to tell whether the scheduler should be
+// started
+func (s *epochScheduler) IsStarted() bool {
+	return s.isStarted
+}
+
+// waitUntil waits until the clock reaches t. It returns false if the context
+// is canceled first.
+func (s *epochScheduler) waitUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(t.Sub(s.clock.Now()))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,67 @@
+package mining
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/clock"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// The epoch scheduler mines once per epoch, with null blocks for the epochs
+// without blocks.
+func TestEpochSchedulerMinesOncePerEpoch(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert, require, ts := newTestUtils(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	blockTime := 100 * time.Millisecond
+	clk := clock.NewChainClock(time.Now().Add(-blockTime/2), blockTime, time.Now)
+
+	epochs := make(chan uint64, 10)
+	countEpochsMine := func(c context.Context, inTS types.TipSet, nBC int, outCh chan<- Output) bool {
+		assert.Equal(ts, inTS)
+		epoch := uint64(nBC) + 1 // the base is at height 0
+		assert.False(clk.Now().Before(clk.EpochStart(epoch - 1)))
+		epochs <- epoch
+		outCh <- Output{}
+		return false
+	}
+	headFunc := func() (*types.TipSet, error) {
+		return &ts, nil
+	}
+	scheduler := NewEpochScheduler(NewTestWorkerWithDeps(countEpochsMine), clk, 10*time.Millisecond, headFunc)
+	outCh, doneWg := scheduler.Start(ctx)
+
+	first := <-epochs
+	<-outCh
+	for i := uint64(1); i < 3; i++ {
+		assert.Equal(first+i, <-epochs)
+		<-outCh
+	}
+	cancel()
+	doneWg.Wait()
+	assert.False(scheduler.IsStarted())
+
+	// A base at the epoch being mined is skipped.
+	blk := &types.Block{StateRoot: types.SomeCid(), Height: 1000}
+	ahead := th.RequireNewTipSet(require, blk)
+	skipMine := func(c context.Context, inTS types.TipSet, nBC int, outCh chan<- Output) bool {
+		assert.Fail("mined on a base from a future epoch")
+		return false
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	scheduler = NewEpochScheduler(NewTestWorkerWithDeps(skipMine), clk, 10*time.Millisecond, func() (*types.TipSet, error) {
+		return &ahead, nil
+	})
+	_, doneWg = scheduler.Start(ctx)
+	time.Sleep(3 * blockTime)
+	cancel()
+	doneWg.Wait()
+}
@@ -0,0 +1,165 @@
+package mining
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+	"go.opencensus.io/tag"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/metrics"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Attempt{})
+}
+
+// minerKey tags the mining metrics with the miner's address. NewKey only
+// fails on invalid key names.
+var minerKey, _ = tag.NewKey("miner")
+
+var (
+	attemptsGa     = metrics.NewInt64Gauge("mining_attempts", "The number of mining attempts of a miner", minerKey)
+	winsGa         = metrics.NewInt64Gauge("mining_wins", "The number of mining attempts a miner won", minerKey)
+	expectedWinsGa = metrics.NewInt64Gauge("mining_expected_wins_milli", "The number of wins a miner expects from its power fraction, in thousandths", minerKey)
+)
+
+// AttemptPrefix is the datastore prefix for mining attempts.
+const AttemptPrefix = "miningattempts"
+
+// Attempt records a mining attempt of a miner.
+type Attempt struct {
+	Miner address.Address `json:"miner"`
+	// Time is when the attempt finished, in nanoseconds since the unix epoch.
+	Time int64 `json:"time"`
+	// Base is the tipset the miner mined on.
+	Base types.SortedCidSet `json:"base"`
+	// Height is the height of the block the miner tried to mine.
+	Height uint64 `json:"height"`
+	// NullBlocks is the number of null rounds between the base and the block.
+	NullBlocks uint64 `json:"nullBlocks"`
+	// MinerPower and TotalPower are the storage power of the miner and of
+	// all miners in the state of the base.
+	MinerPower uint64 `json:"minerPower"`
+	TotalPower uint64 `json:"totalPower"`
+	// Won tells whether the miner's ticket won the election.
+	Won bool `json:"won"`
+	// Block is the block the miner mined, if it won and mined one.
+	Block cid.Cid `json:"block" refmt:",omitempty"`
+}
+
+// History persists the mining attempts of the node's miners and reports
+// their counts as metrics.
+type History struct {
+	ds repo.Datastore
+
+	lk     sync.Mutex
+	totals map[address.Address]*attemptTotals
+}
+
+type attemptTotals struct {
+	attempts     int64
+	wins         int64
+	expectedWins float64
+}
+
+// NewHistory returns a History that stores attempts in the datastore.
+func NewHistory(ds repo.Datastore) *History {
+	return &History{ds: ds, totals: make(map[address.Address]*attemptTotals)}
+}
+
+// Record stores the attempt and updates the miner's mining metrics.
+func (h *History) Record(ctx context.Context, attempt *Attempt) error {
+	datum, err := cbor.DumpObject(attempt)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal mining attempt")
+	}
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	key := datastore.KeyWithNamespaces([]string{AttemptPrefix, attempt.Miner.String(), fmt.Sprintf("%020d", attempt.Time)})
+	if err := h.ds.Put(key, datum); err != nil {
+		return errors.Wrap(err, "could not save mining attempt")
+	}
+
+	totals, ok := h.totals[attempt.Miner]
+	if !ok {
+		// Count the attempts of previous runs of the node.
+		attempts, err := h.attempts(attempt.Miner)
+		if err != nil {
+			return err
+		}
+		totals = &attemptTotals{}
+		for _, a := range attempts {
+			totals.add(a)
+		}
+		h.totals[attempt.Miner] = totals
+	} else {
+		totals.add(attempt)
+	}
+
+	ctx, err = tag.New(ctx, tag.Upsert(minerKey, attempt.Miner.String()))
+	if err != nil {
+		return errors.Wrap(err, "could not tag mining metrics")
+	}
+	attemptsGa.Set(ctx, totals.attempts)
+	winsGa.Set(ctx, totals.wins)
+	expectedWinsGa.Set(ctx, int64(totals.expectedWins*1000))
+	return nil
+}
+
+// Attempts returns the attempts of the miner, oldest first.
+func (h *History) Attempts(minerAddr address.Address) ([]*Attempt, error) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return h.attempts(minerAddr)
+}
+
+func (h *History) attempts(minerAddr address.Address) ([]*Attempt, error) {
+	prefix := datastore.KeyWithNamespaces([]string{AttemptPrefix, minerAddr.String()})
+	results, err := h.ds.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query mining attempts from datastore")
+	}
+
+	var attempts []*Attempt
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read mining attempts from datastore")
+		}
+		var attempt Attempt
+		if err := cbor.DecodeInto(entry.Value, &attempt); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal mining attempt from datastore")
+		}
+		attempts = append(attempts, &attempt)
+	}
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].Time < attempts[j].Time })
+	return attempts, nil
+}
+
+// ExpectedWins returns the probability the attempt had to win, the fraction
+// of the storage power the miner had.
+func (a *Attempt) ExpectedWins() float64 {
+	if a.TotalPower == 0 {
+		return 0
+	}
+	return float64(a.MinerPower) / float64(a.TotalPower)
+}
+
+func (t *attemptTotals) add(a *Attempt) {
+	t.attempts++
+	if a.Won {
+		t.wins++
+	}
+	t.expectedWins += a.ExpectedWins()
+}
@@ -0,0 +1,80 @@
+package mining
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// GetPower is a function that returns the storage power of a miner and the
+// total storage power in the state of a TipSet.
+type GetPower func(ctx context.Context, ts types.TipSet, minerAddr address.Address) (minerPower, totalPower uint64, err error)
+
+// recordingWorker records the mining attempts of a worker in a History.
+type recordingWorker struct {
+	worker    Worker
+	minerAddr address.Address
+	history   *History
+	getPower  GetPower
+}
+
+// NewRecordingWorker returns a worker that mines with w for the miner and
+// records each of its attempts in the history.
+func NewRecordingWorker(w Worker, minerAddr address.Address, history *History, getPower GetPower) Worker {
+	return &recordingWorker{worker: w, minerAddr: minerAddr, history: history, getPower: getPower}
+}
+
+// Mine mines with the worker and records the attempt, unless it was canceled
+// or failed before the election.
+func (w *recordingWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCount int, outCh chan<- Output) bool {
+	// Workers send at most one output per run.
+	runOutCh := make(chan Output, 1)
+	won := w.worker.Mine(ctx, base, nullBlkCount, runOutCh)
+
+	var out *Output
+	select {
+	case o := <-runOutCh:
+		out = &o
+	default:
+	}
+
+	failed := !won && out != nil && out.Err != nil
+	if ctx.Err() == nil && len(base) != 0 && !failed {
+		if err := w.record(ctx, base, nullBlkCount, won, out); err != nil {
+			log.Warningf("failed to record mining attempt of miner %s: %s", w.minerAddr, err)
+		}
+	}
+
+	if out != nil {
+		outCh <- *out
+	}
+	return won
+}
+
+func (w *recordingWorker) record(ctx context.Context, base types.TipSet, nullBlkCount int, won bool, out *Output) error {
+	baseHeight, err := base.Height()
+	if err != nil {
+		return err
+	}
+	minerPower, totalPower, err := w.getPower(ctx, base, w.minerAddr)
+	if err != nil {
+		return err
+	}
+
+	attempt := &Attempt{
+		Miner:      w.minerAddr,
+		Time:       time.Now().UnixNano(),
+		Base:       base.ToSortedCidSet(),
+		Height:     baseHeight + uint64(nullBlkCount) + 1,
+		NullBlocks: uint64(nullBlkCount),
+		MinerPower: minerPower,
+		TotalPower: totalPower,
+		Won:        won,
+	}
+	if out != nil && out.NewBlock != nil {
+		attempt.Block = out.NewBlock.Cid()
+	}
+	return w.history.Record(ctx, attempt)
+}
@@ -0,0 +1,71 @@
+package mining
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestRecordingWorkerRecordsAttempts(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert, require, ts := newTestUtils(t)
+	ctx := context.Background()
+	addrGetter := address.NewForTestGetter()
+	minerAddr := addrGetter()
+	history := NewHistory(repo.NewInMemoryRepo().Datastore())
+	getPower := func(ctx context.Context, ts types.TipSet, minerAddr address.Address) (uint64, uint64, error) {
+		return 1, 4, nil
+	}
+
+	won := true
+	var mineErr error
+	mine := func(c context.Context, inTS types.TipSet, nBC int, outCh chan<- Output) bool {
+		if mineErr != nil {
+			outCh <- Output{Err: mineErr}
+			return false
+		}
+		if won {
+			outCh <- Output{NewBlock: &types.Block{Height: types.Uint64(nBC + 1)}}
+		}
+		return won
+	}
+	worker := NewRecordingWorker(NewTestWorkerWithDeps(mine), minerAddr, history, getPower)
+
+	outCh := make(chan Output, 1)
+	assert.True(worker.Mine(ctx, ts, 0, outCh))
+	out := <-outCh
+	require.NotNil(out.NewBlock)
+
+	won = false
+	assert.False(worker.Mine(ctx, ts, 1, outCh))
+
+	// Failed runs aren't attempts.
+	mineErr = errors.New("no state tree")
+	assert.False(worker.Mine(ctx, ts, 2, outCh))
+	assert.Error((<-outCh).Err)
+
+	attempts, err := history.Attempts(minerAddr)
+	require.NoError(err)
+	require.Len(attempts, 2)
+
+	assert.True(attempts[0].Won)
+	assert.Equal(out.NewBlock.Cid(), attempts[0].Block)
+	assert.Equal(uint64(1), attempts[0].Height)
+	assert.Equal(ts.ToSortedCidSet(), attempts[0].Base)
+	assert.Equal(0.25, attempts[0].ExpectedWins())
+
+	assert.False(attempts[1].Won)
+	assert.False(attempts[1].Block.Defined())
+	assert.Equal(uint64(1), attempts[1].NullBlocks)
+	assert.Equal(uint64(2), attempts[1].Height)
+
+	others, err := history.Attempts(addrGetter())
+	require.NoError(err)
+	assert.Len(others, 0)
+}
@@ -0,0 +1,118 @@
+package mining
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// DefaultMaxBlockMessages is the most messages the template builder packs into
+// a block by default.
+const DefaultMaxBlockMessages = 1000
+
+// GetActor is a function that gets an actor from the state a block is built
+// on. It's its own function so templates can be built on a state tree as well
+// as on the latest state of the chain.
+type GetActor func(context.Context, address.Address) (*actor.Actor, error)
+
+// BlockTemplate is the selection of messages for a block.
+type BlockTemplate struct {
+	// Messages are the messages to include, in the order to apply them.
+	Messages []*types.SignedMessage
+	// GasLimit is the sum of the gas limits of the messages.
+	GasLimit types.GasUnits
+	// Fees is the most the miner can earn in gas fees from the messages.
+	Fees *types.AttoFIL
+	// Stale are the pending messages whose nonce has already been used by
+	// their sender. They can never be mined.
+	Stale []*types.SignedMessage
+}
+
+// TemplateBuilder selects the messages for a block from the pending messages,
+// packing them to maximize the fees earned under a gas limit.
+//
+// Messages are considered greedily by decreasing gas price, in nonce order for
+// each sender. A sender's messages are no longer considered after one of them
+// can't be included because it doesn't follow the sender's nonce, the sender's
+// balance can't cover its gas and value, or it doesn't fit in the remaining gas,
+// since none of the sender's later messages could be applied without it.
+type TemplateBuilder struct {
+	gasLimit    types.GasUnits
+	maxMessages int
+}
+
+// NewTemplateBuilder creates a TemplateBuilder packing at most maxMessages
+// messages using at most gasLimit gas.
+func NewTemplateBuilder(gasLimit types.GasUnits, maxMessages int) *TemplateBuilder {
+	return &TemplateBuilder{
+		gasLimit:    gasLimit,
+		maxMessages: maxMessages,
+	}
+}
+
+// senderState tracks a sender's nonce and balance as its messages are packed.
+type senderState struct {
+	stateNonce types.Uint64
+	nonce      types.Uint64
+	balance    *types.AttoFIL
+	// blocked is set once none of the sender's remaining messages can be packed.
+	blocked bool
+}
+
+// Build selects the messages for a block on the state from which getActor
+// reads actors.
+func (tb *TemplateBuilder) Build(ctx context.Context, getActor GetActor, pending []*types.SignedMessage) (*BlockTemplate, error) {
+	tmpl := &BlockTemplate{Fees: types.NewZeroAttoFIL()}
+	senders := make(map[address.Address]*senderState)
+
+	mq := NewMessageQueue(pending)
+	for msg, more := mq.Pop(); more && len(tmpl.Messages) < tb.maxMessages; msg, more = mq.Pop() {
+		sender, ok := senders[msg.From]
+		if !ok {
+			act, err := getActor(ctx, msg.From)
+			if err != nil && !state.IsActorNotFoundError(err) {
+				return nil, err
+			}
+			if act == nil {
+				// The sender can't pay for messages before it exists.
+				sender = &senderState{blocked: true}
+			} else {
+				sender = &senderState{stateNonce: act.Nonce, nonce: act.Nonce, balance: act.Balance}
+			}
+			senders[msg.From] = sender
+		}
+		if msg.Nonce < sender.stateNonce {
+			tmpl.Stale = append(tmpl.Stale, msg)
+			continue
+		}
+		if sender.blocked {
+			continue
+		}
+		if msg.Nonce != sender.nonce {
+			sender.blocked = true
+			continue
+		}
+
+		fee := msg.GasPrice.MulBigInt(big.NewInt(int64(msg.GasLimit)))
+		cost := fee.Add(msg.Value)
+		if sender.balance.LessThan(cost) {
+			sender.blocked = true
+			continue
+		}
+		if tmpl.GasLimit+msg.GasLimit > tb.gasLimit {
+			sender.blocked = true
+			continue
+		}
+
+		tmpl.Messages = append(tmpl.Messages, msg)
+		tmpl.GasLimit += msg.GasLimit
+		tmpl.Fees = tmpl.Fees.Add(fee)
+		sender.nonce++
+		sender.balance = sender.balance.Sub(cost)
+	}
+	return tmpl, nil
+}
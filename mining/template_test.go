@@ -0,0 +1,114 @@
+package mining
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestTemplateBuilder(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	ki := types.MustGenerateKeyInfo(10, types.GenerateKeyInfoSeed())
+	mockSigner := types.NewMockSigner(ki)
+
+	rich := mockSigner.Addresses[0]
+	poor := mockSigner.Addresses[1]
+	other := mockSigner.Addresses[2]
+	unknown := mockSigner.Addresses[3]
+	to := mockSigner.Addresses[9]
+
+	st := state.NewEmptyStateTree(hamt.NewCborStore())
+	require.NoError(t, st.SetActor(ctx, rich, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(1000))))
+	require.NoError(t, st.SetActor(ctx, poor, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFIL(big.NewInt(100)))))
+	otherActor := actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(1000))
+	otherActor.Nonce = 2
+	require.NoError(t, st.SetActor(ctx, other, otherActor))
+
+	sign := func(from address.Address, nonce uint64, units uint64, price int64) *types.SignedMessage {
+		msg := types.NewMessage(from, to, nonce, types.NewZeroAttoFIL(), "", nil)
+		s, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(price), types.NewGasUnits(units))
+		require.NoError(t, err)
+		return s
+	}
+
+	t.Run("packs messages by gas price in nonce order", func(t *testing.T) {
+		tb := NewTemplateBuilder(types.BlockGasLimit, DefaultMaxBlockMessages)
+		r0, r1 := sign(rich, 0, 10, 1), sign(rich, 1, 10, 5)
+		o2 := sign(other, 2, 10, 3)
+
+		tmpl, err := tb.Build(ctx, st.GetActor, []*types.SignedMessage{r1, o2, r0})
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SignedMessage{o2, r0, r1}, tmpl.Messages)
+		assert.Equal(t, types.NewGasUnits(30), tmpl.GasLimit)
+		assert.True(t, types.NewAttoFIL(big.NewInt(90)).Equal(tmpl.Fees))
+	})
+
+	t.Run("stops at a gap in a sender's nonces", func(t *testing.T) {
+		tb := NewTemplateBuilder(types.BlockGasLimit, DefaultMaxBlockMessages)
+		r0, r2 := sign(rich, 0, 10, 1), sign(rich, 2, 10, 1)
+
+		tmpl, err := tb.Build(ctx, st.GetActor, []*types.SignedMessage{r0, r2})
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SignedMessage{r0}, tmpl.Messages)
+	})
+
+	t.Run("reports messages with used nonces as stale", func(t *testing.T) {
+		tb := NewTemplateBuilder(types.BlockGasLimit, DefaultMaxBlockMessages)
+		o1, o2 := sign(other, 1, 10, 1), sign(other, 2, 10, 1)
+
+		tmpl, err := tb.Build(ctx, st.GetActor, []*types.SignedMessage{o1, o2})
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SignedMessage{o2}, tmpl.Messages)
+		assert.Equal(t, []*types.SignedMessage{o1}, tmpl.Stale)
+	})
+
+	t.Run("skips senders that can't pay", func(t *testing.T) {
+		tb := NewTemplateBuilder(types.BlockGasLimit, DefaultMaxBlockMessages)
+		p0, p1 := sign(poor, 0, 10, 5), sign(poor, 1, 10, 6)
+		u0 := sign(unknown, 0, 10, 1)
+
+		tmpl, err := tb.Build(ctx, st.GetActor, []*types.SignedMessage{p0, p1, u0})
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SignedMessage{p0}, tmpl.Messages)
+		assert.Empty(t, tmpl.Stale)
+	})
+
+	t.Run("fits messages under the gas limit", func(t *testing.T) {
+		tb := NewTemplateBuilder(types.NewGasUnits(25), DefaultMaxBlockMessages)
+		r0, r1 := sign(rich, 0, 20, 5), sign(rich, 1, 5, 5)
+		o2 := sign(other, 2, 10, 3)
+
+		tmpl, err := tb.Build(ctx, st.GetActor, []*types.SignedMessage{r0, r1, o2})
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SignedMessage{r0, r1}, tmpl.Messages)
+
+		// A message that doesn't fit holds back the sender's later messages
+		// but not other senders' messages.
+		r0 = sign(rich, 0, 20, 1)
+		o3 := sign(other, 3, 10, 2)
+		tmpl, err = tb.Build(ctx, st.GetActor, []*types.SignedMessage{r0, r1, o2, o3})
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SignedMessage{o2, o3}, tmpl.Messages)
+	})
+
+	t.Run("caps the number of messages", func(t *testing.T) {
+		tb := NewTemplateBuilder(types.BlockGasLimit, 2)
+		msgs := []*types.SignedMessage{sign(rich, 0, 1, 1), sign(rich, 1, 1, 1), sign(rich, 2, 1, 1)}
+
+		tmpl, err := tb.Build(ctx, st.GetActor, msgs)
+		require.NoError(t, err)
+		assert.Equal(t, msgs[:2], tmpl.Messages)
+	})
+}
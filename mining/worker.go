@@ -16,6 +16,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
@@ -72,6 +73,12 @@ type MessageApplier interface {
 	ApplyMessagesAndPayRewards(ctx context.Context, st state.Tree, vms vm.StorageMap, messages []*types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, ancestors []types.TipSet) (consensus.ApplyMessagesResponse, error)
 }
 
+// PoStGenerator generates proofs of spacetime over a miner's sectors. It is
+// implemented by the sector builder.
+type PoStGenerator interface {
+	GeneratePoSt(sectorbuilder.GeneratePoStRequest) (sectorbuilder.GeneratePoStResponse, error)
+}
+
 // DefaultWorker runs a mining job.
 type DefaultWorker struct {
 	createPoSTFunc DoSomeWorkFunc
@@ -79,6 +86,9 @@ type DefaultWorker struct {
 	minerOwnerAddr address.Address
 	minerPubKey    []byte
 	workerSigner   consensus.TicketSigner
+	election       consensus.ElectionValidator
+	sectors        consensus.SectorsView
+	postGenerator  PoStGenerator
 
 	// consensus things
 	getStateTree GetStateTree
@@ -86,12 +96,13 @@ type DefaultWorker struct {
 	getAncestors GetAncestors
 
 	// core filecoin things
-	messageSource MessageSource
-	processor     MessageApplier
-	powerTable    consensus.PowerTableView
-	blockstore    blockstore.Blockstore
-	cstore        *hamt.CborIpldStore
-	blockTime     time.Duration
+	messageSource   MessageSource
+	templateBuilder *TemplateBuilder
+	processor       MessageApplier
+	powerTable      consensus.PowerTableView
+	blockstore      blockstore.Blockstore
+	cstore          *hamt.CborIpldStore
+	blockTime       time.Duration
 }
 
 // NewDefaultWorker instantiates a new Worker.
@@ -107,6 +118,9 @@ func NewDefaultWorker(messageSource MessageSource,
 	minerOwner address.Address,
 	minerPubKey []byte,
 	workerSigner consensus.TicketSigner,
+	election consensus.ElectionValidator,
+	sectors consensus.SectorsView,
+	postGenerator PoStGenerator,
 	bt time.Duration) *DefaultWorker {
 
 	w := NewDefaultWorkerWithDeps(messageSource,
@@ -121,12 +135,13 @@ func NewDefaultWorker(messageSource MessageSource,
 		minerOwner,
 		minerPubKey,
 		workerSigner,
+		sectors,
+		postGenerator,
 		bt,
 		func() {})
 
-	// TODO: create real PoST.
-	// https://github.com/filecoin-project/go-filecoin/issues/1791
-	w.createPoSTFunc = w.fakeCreatePoST
+	w.createPoSTFunc = w.waitBlockTime
+	w.election = election
 
 	return w
 }
@@ -144,29 +159,47 @@ func NewDefaultWorkerWithDeps(messageSource MessageSource,
 	minerOwner address.Address,
 	minerPubKey []byte,
 	workerSigner consensus.TicketSigner,
+	sectors consensus.SectorsView,
+	postGenerator PoStGenerator,
 	bt time.Duration,
 	createPoST DoSomeWorkFunc) *DefaultWorker {
 	return &DefaultWorker{
-		getStateTree:   getStateTree,
-		getWeight:      getWeight,
-		getAncestors:   getAncestors,
-		messageSource:  messageSource,
-		processor:      processor,
-		powerTable:     powerTable,
-		blockstore:     bs,
-		cstore:         cst,
-		createPoSTFunc: createPoST,
-		minerAddr:      miner,
-		minerOwnerAddr: minerOwner,
-		minerPubKey:    minerPubKey,
-		blockTime:      bt,
-		workerSigner:   workerSigner,
+		getStateTree:    getStateTree,
+		getWeight:       getWeight,
+		getAncestors:    getAncestors,
+		messageSource:   messageSource,
+		templateBuilder: NewTemplateBuilder(types.BlockGasLimit, DefaultMaxBlockMessages),
+		processor:       processor,
+		powerTable:      powerTable,
+		blockstore:      bs,
+		cstore:          cst,
+		createPoSTFunc:  createPoST,
+		minerAddr:       miner,
+		minerOwnerAddr:  minerOwner,
+		minerPubKey:     minerPubKey,
+		blockTime:       bt,
+		workerSigner:    workerSigner,
+		election:        &powerElection{bs, powerTable},
+		sectors:         sectors,
+		postGenerator:   postGenerator,
 	}
 }
 
-// DoSomeWorkFunc is a dummy function that mimics doing something time-consuming
-// in the mining loop such as computing proofs. Pass a function that calls Sleep()
-// is a good idea for now.
+// powerElection is the default election of the worker, electing miners with
+// probability proportional to their share of storage power as in expected
+// consensus.
+type powerElection struct {
+	bs         blockstore.Blockstore
+	powerTable consensus.PowerTableView
+}
+
+func (e *powerElection) IsElected(ctx context.Context, st state.Tree, ticket types.Signature, height *types.BlockHeight, miner address.Address) (bool, error) {
+	return consensus.IsWinningTicket(ctx, e.bs, e.powerTable, st, ticket, miner)
+}
+
+// DoSomeWorkFunc is run in the mining loop while the election proof is being
+// generated, and the proof is only used once it returns. By default it sleeps
+// for the block time, so a fast proof doesn't make the miner mine faster.
 type DoSomeWorkFunc func()
 
 // Mine implements the DefaultWorkers main mining function..
@@ -199,7 +232,7 @@ func (w *DefaultWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCoun
 		outCh <- Output{Err: err}
 		return false
 	}
-	prCh := createProof(challenge, w.createPoSTFunc)
+	prCh := w.createProof(ctx, st, challenge)
 
 	var proof types.PoStProof
 	var ticket []byte
@@ -212,7 +245,11 @@ func (w *DefaultWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCoun
 			log.Errorf("Worker.Mine got zero value from channel prChRead")
 			return false
 		}
-		copy(proof[:], prChRead[:])
+		if prChRead.err != nil {
+			log.Errorf("failed to create election proof: %s", prChRead.err)
+			return false
+		}
+		proof = prChRead.proof
 		ticket, err = consensus.CreateTicket(proof, w.minerPubKey, w.workerSigner)
 		if err != nil {
 			log.Errorf("failed to create ticket: %s", err)
@@ -220,9 +257,14 @@ func (w *DefaultWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCoun
 		}
 	}
 
-	// TODO: Test the interplay of isWinningTicket() and createPoSTFunc()
-	// https://github.com/filecoin-project/go-filecoin/issues/1791
-	weHaveAWinner, err := consensus.IsWinningTicket(ctx, w.blockstore, w.powerTable, st, ticket, w.minerAddr)
+	baseHeight, err := base.Height()
+	if err != nil {
+		outCh <- Output{Err: err}
+		return false
+	}
+	blockHeight := types.NewBlockHeight(baseHeight + uint64(nullBlkCount) + 1)
+
+	weHaveAWinner, err := w.election.IsElected(ctx, st, ticket, blockHeight, w.minerAddr)
 
 	if err != nil {
 		log.Errorf("Worker.Mine couldn't compute ticket: %s", err.Error())
@@ -243,21 +285,61 @@ func (w *DefaultWorker) Mine(ctx context.Context, base types.TipSet, nullBlkCoun
 	return false
 }
 
-// TODO: Actually use the results of the PoST once it is implemented.
-// Currently createProof just passes the challenge seed through.
-func createProof(challengeSeed types.PoStChallengeSeed, createPoST DoSomeWorkFunc) <-chan types.PoStChallengeSeed {
-	c := make(chan types.PoStChallengeSeed)
+type proofResult struct {
+	proof types.PoStProof
+	err   error
+}
+
+// createProof proves spacetime over the miner's sectors in st for the
+// challenge seed. The proof is sent on the returned channel once both it and
+// the createPoSTFunc work are done.
+func (w *DefaultWorker) createProof(ctx context.Context, st state.Tree, challengeSeed types.PoStChallengeSeed) <-chan proofResult {
+	c := make(chan proofResult, 1)
 	go func() {
-		// TODO send new PoST on channel once we can create it
-		//  https://github.com/filecoin-project/go-filecoin/issues/1791
-		createPoST()
-		c <- challengeSeed
+		workDone := make(chan struct{})
+		go func() {
+			w.createPoSTFunc()
+			close(workDone)
+		}()
+		proof, err := w.createElectionProof(ctx, st, challengeSeed)
+		<-workDone
+		c <- proofResult{proof: proof, err: err}
 	}()
 	return c
 }
 
-// fakeCreatePoST is the default implementation of DoSomeWorkFunc.
-// It simply sleeps for the blockTime.
-func (w *DefaultWorker) fakeCreatePoST() {
+// createElectionProof generates the proof of spacetime for the challenge seed
+// over the sectors the miner proves to be elected.
+func (w *DefaultWorker) createElectionProof(ctx context.Context, st state.Tree, challengeSeed types.PoStChallengeSeed) (types.PoStProof, error) {
+	commRs, err := w.sectors.ElectionSectors(ctx, st, w.blockstore, w.minerAddr)
+	if err != nil {
+		return types.PoStProof{}, errors.Wrap(err, "get election sectors")
+	}
+	if len(commRs.Values()) == 0 {
+		return consensus.SeedElectionProof(challengeSeed), nil
+	}
+	if w.postGenerator == nil {
+		return types.PoStProof{}, errors.New("no sector builder to generate PoSt")
+	}
+
+	res, err := w.postGenerator.GeneratePoSt(sectorbuilder.GeneratePoStRequest{
+		SortedCommRs:  commRs,
+		ChallengeSeed: challengeSeed,
+	})
+	if err != nil {
+		return types.PoStProof{}, errors.Wrap(err, "generate PoSt")
+	}
+	if len(res.Faults) != 0 {
+		return types.PoStProof{}, errors.Errorf("faults in sectors %v", res.Faults)
+	}
+	if len(res.Proofs) != 1 {
+		return types.PoStProof{}, errors.Errorf("expected a single PoSt proof, got %d", len(res.Proofs))
+	}
+	return res.Proofs[0], nil
+}
+
+// waitBlockTime is the default implementation of DoSomeWorkFunc. It simply
+// sleeps for the blockTime.
+func (w *DefaultWorker) waitBlockTime() {
 	time.Sleep(w.blockTime)
 }
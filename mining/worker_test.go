@@ -60,20 +60,40 @@ func Test_Mine(t *testing.T) {
 		outCh := make(chan mining.Output)
 		worker := mining.NewDefaultWorkerWithDeps(
 			pool, getStateTree, getWeightTest, getAncestors, th.NewTestProcessor(), mining.NewTestPowerTableView(1),
-			bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest,
+			bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest,
 			CreatePoSTFunc)
 
 		go worker.Mine(ctx, tipSet, 0, outCh)
 		r := <-outCh
 		assert.NoError(r.Err)
 		assert.True(doSomeWorkCalled)
+
+		// The miner has no sectors to prove.
+		challenge, err := consensus.CreateChallengeSeed(tipSet, 0)
+		require.NoError(err)
+		assert.Equal(consensus.SeedElectionProof(challenge), r.NewBlock.Proof)
+		cancel()
+	})
+	t.Run("Proves spacetime over the miner's sectors", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		outCh := make(chan mining.Output)
+		postGenerator := &th.TestPoStGenerator{Proof: th.MakeRandomPoSTProofForTest()}
+		worker := mining.NewDefaultWorkerWithDeps(
+			pool, getStateTree, getWeightTest, getAncestors, th.NewTestProcessor(), mining.NewTestPowerTableView(1),
+			bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.NewTestSectorsView(types.CommR{1}), postGenerator,
+			th.BlockTimeTest, CreatePoSTFunc)
+
+		go worker.Mine(ctx, tipSet, 0, outCh)
+		r := <-outCh
+		assert.NoError(r.Err)
+		assert.Equal(postGenerator.Proof, r.NewBlock.Proof)
 		cancel()
 	})
 	t.Run("Block generation fails", func(t *testing.T) {
 		doSomeWorkCalled = false
 		ctx, cancel := context.WithCancel(context.Background())
 		worker := mining.NewDefaultWorkerWithDeps(pool, makeExplodingGetStateTree(st), getWeightTest, getAncestors, th.NewTestProcessor(),
-			mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+			mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest, CreatePoSTFunc)
 		outCh := make(chan mining.Output)
 		doSomeWorkCalled = false
 		go worker.Mine(ctx, tipSet, 0, outCh)
@@ -88,7 +108,7 @@ func Test_Mine(t *testing.T) {
 		doSomeWorkCalled = false
 		ctx, cancel := context.WithCancel(context.Background())
 		worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, th.NewTestProcessor(),
-			mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+			mining.NewTestPowerTableView(1), bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest, CreatePoSTFunc)
 		input := types.TipSet{}
 		outCh := make(chan mining.Output)
 		go worker.Mine(ctx, input, 0, outCh)
@@ -221,7 +241,7 @@ func TestGenerateMultiBlockTipSet(t *testing.T) {
 	minerOwnerAddr := addrs[3]
 
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, th.NewTestProcessor(),
-		&th.TestView{}, bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest, CreatePoSTFunc)
 
 	parents := types.NewSortedCidSet(newCid())
 	stateRoot := newCid()
@@ -266,7 +286,7 @@ func TestGeneratePoolBlockResults(t *testing.T) {
 		return nil, nil
 	}
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest, CreatePoSTFunc)
 
 	// addr3 doesn't correspond to an extant account, so this will trigger errAccountNotFound -- a temporary failure.
 	msg1 := types.NewMessage(addrs[2], addrs[0], 0, nil, "", nil)
@@ -351,7 +371,7 @@ func TestGenerateSetsBasicFields(t *testing.T) {
 	minerAddr := addrs[4]
 	minerOwnerAddr := addrs[3]
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, minerAddr, minerOwnerAddr, blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest, CreatePoSTFunc)
 
 	h := types.Uint64(100)
 	w := types.Uint64(1000)
@@ -368,6 +388,9 @@ func TestGenerateSetsBasicFields(t *testing.T) {
 	assert.Equal(h+1, blk.Height)
 	assert.Equal(minerAddr, blk.Miner)
 
+	signerAddr := mockSigner.Addresses[len(mockSigner.Addresses)-1]
+	assert.True(types.IsValidSignature(blk.SignatureData(), signerAddr, blk.BlockSig))
+
 	blk, err = worker.Generate(ctx, baseTipSet, nil, types.PoStProof{}, 1)
 	assert.NoError(err)
 
@@ -396,7 +419,7 @@ func TestGenerateWithoutMessages(t *testing.T) {
 		return nil, nil
 	}
 	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest, CreatePoSTFunc)
 
 	assert.Len(pool.Pending(), 0)
 	baseBlock := types.Block{
@@ -433,7 +456,7 @@ func TestGenerateError(t *testing.T) {
 	}
 	worker := mining.NewDefaultWorkerWithDeps(pool, makeExplodingGetStateTree(st), getWeightTest, getAncestors,
 		consensus.NewDefaultProcessor(),
-		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+		&th.TestView{}, bs, cst, addrs[4], addrs[3], blockSignerAddr, mockSigner, th.NewTestSectorsView(), &th.TestPoStGenerator{}, th.BlockTimeTest, CreatePoSTFunc)
 
 	// This is actually okay and should result in a receipt
 	msg := types.NewMessage(addrs[0], addrs[1], 0, nil, "", nil)
@@ -69,6 +69,7 @@ type Network struct {
 	metrics.Reporter
 	*Router
 	*ping.PingService
+	*ReputationManager
 }
 
 // New returns a new Network
@@ -79,14 +80,16 @@ func New(
 	router *Router,
 	reporter metrics.Reporter,
 	pinger *ping.PingService,
+	reputation *ReputationManager,
 ) *Network {
 	return &Network{
-		host:        host,
-		PingService: pinger,
-		Publisher:   publisher,
-		Reporter:    reporter,
-		Router:      router,
-		Subscriber:  subscriber,
+		host:              host,
+		PingService:       pinger,
+		Publisher:         publisher,
+		Reporter:          reporter,
+		Router:            router,
+		Subscriber:        subscriber,
+		ReputationManager: reputation,
 	}
 }
 
@@ -0,0 +1,185 @@
+package net
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	"github.com/libp2p/go-libp2p-peer"
+)
+
+var logReputation = logging.Logger("net.reputation")
+
+// Offense is a kind of peer misbehavior.
+type Offense int
+
+const (
+	// OffenseInvalidBlock is sending a block or tipset that fails validation.
+	OffenseInvalidBlock Offense = iota
+	// OffenseInvalidMessage is sending a malformed or badly signed message.
+	OffenseInvalidMessage
+	// OffenseTimeout is failing to answer a request in time.
+	OffenseTimeout
+	// OffenseProtocolError is sending data that does not follow a protocol.
+	OffenseProtocolError
+)
+
+func (o Offense) String() string {
+	switch o {
+	case OffenseInvalidBlock:
+		return "invalid block"
+	case OffenseInvalidMessage:
+		return "invalid message"
+	case OffenseTimeout:
+		return "timeout"
+	case OffenseProtocolError:
+		return "protocol error"
+	default:
+		return "unknown offense"
+	}
+}
+
+// offensePenalties is the score each offense adds to a peer. A peer whose score
+// reaches BanThreshold is banned.
+var offensePenalties = map[Offense]int{
+	OffenseInvalidBlock:   50,
+	OffenseInvalidMessage: 10,
+	OffenseTimeout:        5,
+	OffenseProtocolError:  20,
+}
+
+// BanThreshold is the score at which a peer is banned.
+const BanThreshold = 100
+
+// DefaultBanDuration is how long a peer stays banned.
+const DefaultBanDuration = time.Hour
+
+// BanInfo describes a banned peer.
+type BanInfo struct {
+	Peer   peer.ID
+	Reason string
+	Until  time.Time
+}
+
+type peerScore struct {
+	score       int
+	lastOffense time.Time
+}
+
+// ReputationManager scores peers on their misbehavior and bans, i.e.
+// disconnects and refuses connections from, those that misbehave too much.
+// A peer's score is forgotten once it has behaved for a whole ban duration.
+type ReputationManager struct {
+	host        host.Host
+	banDuration time.Duration
+
+	mu     sync.Mutex
+	scores map[peer.ID]*peerScore
+	bans   map[peer.ID]BanInfo
+
+	// now is a hook for tests.
+	now func() time.Time
+}
+
+// NewReputationManager creates a new ReputationManager that disconnects banned
+// peers from the given host. The host may be nil, e.g. in offline mode.
+func NewReputationManager(h host.Host, banDuration time.Duration) *ReputationManager {
+	rm := &ReputationManager{
+		host:        h,
+		banDuration: banDuration,
+		scores:      make(map[peer.ID]*peerScore),
+		bans:        make(map[peer.ID]BanInfo),
+		now:         time.Now,
+	}
+	if h != nil {
+		h.Network().Notify(&inet.NotifyBundle{
+			ConnectedF: func(_ inet.Network, c inet.Conn) {
+				if rm.IsBanned(c.RemotePeer()) {
+					c.Close() // nolint: errcheck
+				}
+			},
+		})
+	}
+	return rm
+}
+
+// ReportPeer records an offense by the peer, banning it if its score reaches
+// BanThreshold.
+func (rm *ReputationManager) ReportPeer(p peer.ID, offense Offense, reason string) {
+	rm.mu.Lock()
+	now := rm.now()
+	ps, ok := rm.scores[p]
+	if !ok || now.Sub(ps.lastOffense) > rm.banDuration {
+		ps = &peerScore{}
+		rm.scores[p] = ps
+	}
+	ps.score += offensePenalties[offense]
+	ps.lastOffense = now
+	score := ps.score
+	rm.mu.Unlock()
+
+	logReputation.Infof("peer %s misbehaved (%s: %s), score %d", p, offense, reason, score)
+	if score >= BanThreshold {
+		rm.Ban(p, offense.String()+": "+reason)
+	}
+}
+
+// Ban bans the peer for the ban duration and disconnects it.
+func (rm *ReputationManager) Ban(p peer.ID, reason string) {
+	rm.mu.Lock()
+	rm.bans[p] = BanInfo{Peer: p, Reason: reason, Until: rm.now().Add(rm.banDuration)}
+	delete(rm.scores, p)
+	rm.mu.Unlock()
+
+	logReputation.Warningf("banning peer %s: %s", p, reason)
+	if rm.host != nil {
+		rm.host.Network().ClosePeer(p) // nolint: errcheck
+	}
+}
+
+// Score returns the current misbehavior score of the peer.
+func (rm *ReputationManager) Score(p peer.ID) int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	ps, ok := rm.scores[p]
+	if !ok || rm.now().Sub(ps.lastOffense) > rm.banDuration {
+		return 0
+	}
+	return ps.score
+}
+
+// IsBanned returns true if the peer is currently banned.
+func (rm *ReputationManager) IsBanned(p peer.ID) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	ban, ok := rm.bans[p]
+	if !ok {
+		return false
+	}
+	if !rm.now().Before(ban.Until) {
+		delete(rm.bans, p)
+		return false
+	}
+	return true
+}
+
+// Bans returns the current bans, ordered by expiry.
+func (rm *ReputationManager) Bans() []BanInfo {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	now := rm.now()
+	var out []BanInfo
+	for p, ban := range rm.bans {
+		if !now.Before(ban.Until) {
+			delete(rm.bans, p)
+			continue
+		}
+		out = append(out, ban)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
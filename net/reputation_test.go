@@ -0,0 +1,62 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/stretchr/testify/assert"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestReputationManager(t *testing.T) {
+	tf.UnitTest(t)
+
+	p := peer.ID("misbehaving")
+
+	t.Run("bans peers reaching the threshold", func(t *testing.T) {
+		rm := NewReputationManager(nil, time.Hour)
+
+		rm.ReportPeer(p, OffenseInvalidBlock, "bad tipset")
+		assert.Equal(t, 50, rm.Score(p))
+		assert.False(t, rm.IsBanned(p))
+
+		rm.ReportPeer(p, OffenseInvalidBlock, "bad tipset")
+		assert.True(t, rm.IsBanned(p))
+		assert.Equal(t, 0, rm.Score(p))
+
+		bans := rm.Bans()
+		assert.Len(t, bans, 1)
+		assert.Equal(t, p, bans[0].Peer)
+		assert.Contains(t, bans[0].Reason, "invalid block")
+	})
+
+	t.Run("bans expire", func(t *testing.T) {
+		now := time.Now()
+		rm := NewReputationManager(nil, time.Hour)
+		rm.now = func() time.Time { return now }
+
+		rm.Ban(p, "testing")
+		assert.True(t, rm.IsBanned(p))
+
+		now = now.Add(time.Hour)
+		assert.False(t, rm.IsBanned(p))
+		assert.Empty(t, rm.Bans())
+	})
+
+	t.Run("scores are forgotten after a ban duration of good behavior", func(t *testing.T) {
+		now := time.Now()
+		rm := NewReputationManager(nil, time.Hour)
+		rm.now = func() time.Time { return now }
+
+		rm.ReportPeer(p, OffenseProtocolError, "garbage")
+		assert.Equal(t, 20, rm.Score(p))
+
+		now = now.Add(2 * time.Hour)
+		assert.Equal(t, 0, rm.Score(p))
+
+		rm.ReportPeer(p, OffenseTimeout, "slow")
+		assert.Equal(t, 5, rm.Score(p))
+	})
+}
@@ -43,6 +43,11 @@ func (r *Router) FindProvidersAsync(ctx context.Context, key cid.Cid, count int)
 	return r.routing.FindProvidersAsync(ctx, key, count)
 }
 
+// Provide announces to the network that the node can provide the given key.
+func (r *Router) Provide(ctx context.Context, key cid.Cid) error {
+	return r.routing.Provide(ctx, key, true)
+}
+
 // FindPeer searches the libp2p router for a given peer id
 func (r *Router) FindPeer(ctx context.Context, peerID peer.ID) (pstore.PeerInfo, error) {
 	return r.routing.FindPeer(ctx, peerID)
@@ -2,16 +2,37 @@ package node
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"github.com/ipfs/go-cid"
+	libp2ppeer "github.com/libp2p/go-libp2p-peer"
+	libp2pps "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/net/pubsub"
+	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // BlockTopic is the pubsub topic identifier on which new blocks are announced.
 const BlockTopic = "/fil/blocks"
 
+// maxRelayedBlocks is the number of recent blocks whose relaying peer the node
+// remembers.
+const maxRelayedBlocks = 1000
+
+// blockValidationTimeout bounds the time the pubsub validator spends on a block,
+// loading the state of its parent included. Pubsub drops the blocks that take
+// longer; the syncer still fetches them as parents of later blocks.
+const blockValidationTimeout = 5 * time.Second
+
+// blockValidationConcurrency is the number of blocks the pubsub validator checks
+// at once. Pubsub drops the blocks that arrive while all of them are busy.
+const blockValidationConcurrency = 16
+
 // AddNewBlock receives a newly mined block and stores, validates and propagates it to the network.
 func (node *Node) AddNewBlock(ctx context.Context, b *types.Block) (err error) {
 	// Put block in storage wired to an exchange so this node and other
@@ -46,10 +67,87 @@ func (node *Node) processBlock(ctx context.Context, pubSubMsg pubsub.Message) (e
 	log.Infof("Received new block from network cid: %s", blk.Cid().String())
 	log.Debugf("Received new block from network: %s", blk)
 
-	err = node.Syncer.HandleNewTipset(ctx, types.NewSortedCidSet(blk.Cid()))
+	tipsetCids := types.NewSortedCidSet(blk.Cid())
+	err = node.Syncer.HandleNewTipset(ctx, tipsetCids)
 	if err != nil {
+		// The author of a pubsub message is chosen by its sender, so the peer
+		// reported is the one that relayed the block to us.
+		if node.Syncer.IsBadTipSet(tipsetCids) || errors.Cause(err) == chain.ErrChainHasBadTipSet {
+			if relayer, ok := node.blockRelayers.get(blk.Cid()); ok {
+				node.PorcelainAPI.NetworkReportPeer(relayer, net.OffenseInvalidBlock, "relayed an invalid block")
+			}
+		}
 		return errors.Wrap(err, "processing block from network")
 	}
 
 	return nil
 }
+
+// validateBlockPubSub is the pubsub validator for the block topic. Blocks that
+// fail consensus validation are neither delivered nor relayed, and the peer
+// relaying them is reported. Only the block structure is checked when the
+// parent tipset is not known yet; the syncer validates the rest.
+func (node *Node) validateBlockPubSub(ctx context.Context, from libp2ppeer.ID, pubSubMsg *libp2pps.Message) bool {
+	if from == node.Host().ID() {
+		return true
+	}
+
+	blk, err := types.DecodeBlock(pubSubMsg.GetData())
+	if err != nil {
+		node.PorcelainAPI.NetworkReportPeer(from, net.OffenseInvalidBlock, "undecodable block")
+		return false
+	}
+
+	var pSt state.Tree
+	if node.ChainReader.HasTipSetAndState(ctx, blk.Parents.String()) {
+		pSt, err = node.getStateFromKey(ctx, blk.Parents)
+		if err != nil {
+			log.Errorf("failed to load parent state of block %s: %s", blk.Cid(), err)
+			return false
+		}
+	}
+
+	if err := node.Consensus.ValidateBlock(ctx, blk, pSt); err != nil {
+		log.Infof("rejecting block %s from %s: %s", blk.Cid(), from, err)
+		node.PorcelainAPI.NetworkReportPeer(from, net.OffenseInvalidBlock, err.Error())
+		return false
+	}
+	node.blockRelayers.add(blk.Cid(), from)
+	return true
+}
+
+// relayers remembers the peer that relayed each of a bounded number of recent
+// pubsub messages, dropping the oldest first.
+type relayers struct {
+	lk    sync.Mutex
+	max   int
+	peers map[cid.Cid]libp2ppeer.ID
+	order []cid.Cid
+}
+
+func newRelayers(max int) *relayers {
+	return &relayers{max: max, peers: make(map[cid.Cid]libp2ppeer.ID)}
+}
+
+func (r *relayers) add(c cid.Cid, from libp2ppeer.ID) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if _, ok := r.peers[c]; ok {
+		return
+	}
+	if len(r.order) == r.max {
+		delete(r.peers, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.peers[c] = from
+	r.order = append(r.order, c)
+}
+
+func (r *relayers) get(c cid.Cid) (libp2ppeer.ID, bool) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	from, ok := r.peers[c]
+	return from, ok
+}
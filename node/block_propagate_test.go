@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/testhelpers"
@@ -112,13 +113,26 @@ func TestChainSync(t *testing.T) {
 	require.NoError(err)
 	baseTS := headTipSetAndState.TipSet
 
-	signer, ki := types.NewMockSignersAndKeyInfo(1)
-	mockSignerPubKey := ki[0].PublicKey()
+	minerPubKey, err := nodes[0].PorcelainAPI.MinerGetKey(ctx, minerAddr)
+	require.NoError(err)
 	stateRoot := baseTS.ToSlice()[0].StateRoot
 
-	nextBlk1 := testhelpers.NewValidTestBlockFromTipSet(baseTS, stateRoot, 1, minerAddr, mockSignerPubKey, signer)
-	nextBlk2 := testhelpers.NewValidTestBlockFromTipSet(baseTS, stateRoot, 2, minerAddr, mockSignerPubKey, signer)
-	nextBlk3 := testhelpers.NewValidTestBlockFromTipSet(baseTS, stateRoot, 3, minerAddr, mockSignerPubKey, signer)
+	// The genesis miner is a bootstrap miner, so its election proof is the
+	// challenge seed.
+	makeBlock := func(height uint64) *types.Block {
+		blk := testhelpers.NewValidTestBlockFromTipSet(baseTS, stateRoot, height, minerAddr, minerPubKey, nodes[0].Wallet)
+		challenge, err := consensus.CreateChallengeSeed(baseTS, height-1)
+		require.NoError(err)
+		blk.Proof = consensus.SeedElectionProof(challenge)
+		blk.Ticket, err = consensus.CreateTicket(blk.Proof, minerPubKey, nodes[0].Wallet)
+		require.NoError(err)
+		require.NoError(consensus.SignBlock(blk, minerPubKey, nodes[0].Wallet))
+		return blk
+	}
+
+	nextBlk1 := makeBlock(1)
+	nextBlk2 := makeBlock(2)
+	nextBlk3 := makeBlock(3)
 
 	assert.NoError(nodes[0].AddNewBlock(ctx, nextBlk1))
 	assert.NoError(nodes[0].AddNewBlock(ctx, nextBlk2))
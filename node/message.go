@@ -3,6 +3,10 @@ package node
 import (
 	"context"
 
+	libp2ppeer "github.com/libp2p/go-libp2p-peer"
+	libp2pps "github.com/libp2p/go-libp2p-pubsub"
+
+	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/net/pubsub"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -24,3 +28,29 @@ func (node *Node) processMessage(ctx context.Context, pubSubMsg pubsub.Message)
 	_, err = node.MsgPool.Add(ctx, unmarshaled)
 	return err
 }
+
+// validateMessagePubSub is the pubsub validator for the message topic. Messages
+// that fail ingestion validation are neither delivered nor relayed. Only the
+// peers relaying undecodable or badly signed messages are reported: a message
+// may fail the nonce and balance checks just because it was already mined.
+func (node *Node) validateMessagePubSub(ctx context.Context, from libp2ppeer.ID, pubSubMsg *libp2pps.Message) bool {
+	if from == node.Host().ID() {
+		return true
+	}
+
+	unmarshaled := &types.SignedMessage{}
+	if err := unmarshaled.Unmarshal(pubSubMsg.GetData()); err != nil {
+		node.PorcelainAPI.NetworkReportPeer(from, net.OffenseInvalidMessage, "undecodable message")
+		return false
+	}
+	if !unmarshaled.VerifySignature() {
+		node.PorcelainAPI.NetworkReportPeer(from, net.OffenseInvalidMessage, "bad message signature")
+		return false
+	}
+
+	if err := node.msgValidator.Validate(ctx, unmarshaled); err != nil {
+		log.Debugf("not relaying invalid message from %s: %s", from, err)
+		return false
+	}
+	return true
+}
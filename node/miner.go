@@ -0,0 +1,143 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/mining"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
+)
+
+// Miner is a miner actor run by the node. Each miner seals sectors with its own
+// sector builder, mines blocks with its own worker and makes storage deals with
+// its own storage miner. The miners of a node share its chain, network and
+// message pool.
+type Miner struct {
+	// Address is the address of the miner actor.
+	Address address.Address
+
+	Worker       mining.Worker
+	Scheduler    mining.Scheduler
+	StorageMiner *storage.Miner
+
+	node          *Node
+	sectorBuilder sectorbuilder.SectorBuilder
+
+	mining struct {
+		sync.Mutex
+		isMining bool
+	}
+	miningCtx    context.Context
+	cancelMining context.CancelFunc
+	miningDoneWg *sync.WaitGroup
+
+	// dealsResumed is set once the miner resumed the deals a restart interrupted.
+	dealsResumed bool
+}
+
+// SectorBuilder returns the miner's sector builder, which is nil until the
+// node sets up the miner for mining.
+func (m *Miner) SectorBuilder() sectorbuilder.SectorBuilder {
+	return m.sectorBuilder
+}
+
+// BlockService returns the node's blockservice.
+func (m *Miner) BlockService() bserv.BlockService {
+	return m.node.BlockService()
+}
+
+// GetBlockTime returns the node's block time.
+func (m *Miner) GetBlockTime() time.Duration {
+	return m.node.GetBlockTime()
+}
+
+// IsMining returns a boolean indicating whether the miner is mining blocks.
+func (m *Miner) IsMining() bool {
+	m.mining.Lock()
+	defer m.mining.Unlock()
+	return m.mining.isMining
+}
+
+func (m *Miner) setIsMining(isMining bool) {
+	m.mining.Lock()
+	defer m.mining.Unlock()
+	m.mining.isMining = isMining
+}
+
+// MinerAddresses returns the addresses of the miners the node runs, starting
+// with its default miner.
+func (node *Node) MinerAddresses() []address.Address {
+	return node.Repo.Config().Mining.Miners()
+}
+
+// Miner returns the miner of the given address, or the node's default miner
+// if the address is empty.
+func (node *Node) Miner(minerAddr address.Address) (*Miner, error) {
+	minerAddrs := node.MinerAddresses()
+	if len(minerAddrs) == 0 {
+		return nil, ErrNoMinerAddress
+	}
+	if minerAddr.Empty() {
+		return node.getMiner(minerAddrs[0]), nil
+	}
+	for _, addr := range minerAddrs {
+		if addr == minerAddr {
+			return node.getMiner(addr), nil
+		}
+	}
+	return nil, errors.Errorf("node does not run miner %s", minerAddr)
+}
+
+// Miners returns the miners the node runs, starting with its default miner.
+func (node *Node) Miners() []*Miner {
+	var miners []*Miner
+	for _, addr := range node.MinerAddresses() {
+		miners = append(miners, node.getMiner(addr))
+	}
+	return miners
+}
+
+// selectMiners returns the miners of the given addresses, or all the node's
+// miners if no address is given.
+func (node *Node) selectMiners(minerAddrs []address.Address) ([]*Miner, error) {
+	if len(minerAddrs) == 0 {
+		miners := node.Miners()
+		if len(miners) == 0 {
+			return nil, ErrNoMinerAddress
+		}
+		return miners, nil
+	}
+
+	var miners []*Miner
+	for _, addr := range minerAddrs {
+		m, err := node.Miner(addr)
+		if err != nil {
+			return nil, err
+		}
+		miners = append(miners, m)
+	}
+	return miners, nil
+}
+
+// getMiner returns the miner of the address, creating it the first time the
+// node runs it.
+func (node *Node) getMiner(minerAddr address.Address) *Miner {
+	node.minersLk.Lock()
+	defer node.minersLk.Unlock()
+
+	if node.miners == nil {
+		node.miners = make(map[address.Address]*Miner)
+	}
+	m, ok := node.miners[minerAddr]
+	if !ok {
+		m = &Miner{Address: minerAddr, node: node}
+		node.miners[minerAddr] = m
+	}
+	return m
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -28,6 +29,7 @@ import (
 	"github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/libp2p/go-libp2p-kad-dht/opts"
 	p2pmetrics "github.com/libp2p/go-libp2p-metrics"
+	libp2pnet "github.com/libp2p/go-libp2p-net"
 	libp2ppeer "github.com/libp2p/go-libp2p-peer"
 	dhtprotocol "github.com/libp2p/go-libp2p-protocol"
 	libp2pps "github.com/libp2p/go-libp2p-pubsub"
@@ -41,6 +43,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/clock"
 	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
@@ -97,16 +100,22 @@ type Node struct {
 	RetrievalAPI   *retrieval.API
 	StorageAPI     *storage.API
 
-	// HeavyTipSetCh is a subscription to the heaviest tipset topic on the chain.
-	HeaviestTipSetCh chan interface{}
 	// HeavyTipSetHandled is a hook for tests because pubsub notifications
 	// arrive async. It's called after handling a new heaviest tipset.
 	// Remove this after replacing the tipset "pubsub" with a synchronous event bus:
 	// https://github.com/filecoin-project/go-filecoin/issues/2309
 	HeaviestTipSetHandled func()
 
+	// HeadChanges publishes the tipsets reverted and applied on each head change.
+	HeadChanges *core.HeadChangeNotifier
+
 	// Incoming messages for block mining.
 	MsgPool *core.MessagePool
+	// msgValidator validates messages received from the network.
+	msgValidator *consensus.IngestionValidator
+	// blockRelayers are the peers that relayed the recent blocks received from
+	// the network.
+	blockRelayers *relayers
 	// Messages sent and not yet mined.
 	Outbox *core.MessageQueue
 
@@ -115,21 +124,26 @@ type Node struct {
 	// Mining stuff.
 	AddNewlyMinedBlock newBlockFunc
 	blockTime          time.Duration
-	cancelMining       context.CancelFunc
 	GetAncestorsFunc   mining.GetAncestors
 	GetStateTreeFunc   mining.GetStateTree
 	GetWeightFunc      mining.GetWeight
-	MiningWorker       mining.Worker
-	MiningScheduler    mining.Scheduler
-	mining             struct {
-		sync.Mutex
-		isMining bool
-	}
-	miningCtx    context.Context
-	miningDoneWg *sync.WaitGroup
+
+	// miningHist records the mining attempts of the node's miners.
+	miningHist *mining.History
+
+	// ChainClock tells the epochs of the chain. It is nil if the genesis
+	// block has no timestamp and block time, in which case miners mine on a
+	// timer instead.
+	ChainClock *clock.ChainClock
+
+	// miners are the miners the node runs, by address. Use Miner and Miners
+	// to get them.
+	miners   map[address.Address]*Miner
+	minersLk sync.Mutex
 
 	// Storage Market Interfaces
-	StorageMiner *storage.Miner
+	StorageMiners *storage.MinerRouter
+	StorageClient *storage.Client
 
 	// Retrieval Interfaces
 	RetrievalMiner *retrieval.Miner
@@ -140,15 +154,19 @@ type Node struct {
 	HelloSvc     *hello.Handler
 	Bootstrapper *net.Bootstrapper
 
+	// PeerHeads tracks the chain heads announced by peers, to pick the
+	// heaviest one to sync from.
+	PeerHeads *chain.PeerHeadTracker
+
+	// isRelay is true if the node acts as a libp2p relay.
+	isRelay bool
+
 	// Data Storage Fields
 
 	// Repo is the repo this node was created with
 	// it contains all persistent artifacts of the filecoin node
 	Repo repo.Repo
 
-	// SectorBuilder is used by the miner to fill and seal sectors.
-	sectorBuilder sectorbuilder.SectorBuilder
-
 	// Fetcher is the interface for fetching data from nodes.
 	Fetcher *net.Fetcher
 
@@ -324,6 +342,35 @@ func (nc *Config) buildHost(ctx context.Context, makeDHT func(host host.Host) (r
 	)
 }
 
+// buildConsensus sets up the consensus protocol committed in the genesis block,
+// along with the power table view it uses.
+func (nc *Config) buildConsensus(ctx context.Context, cst *hamt.CborIpldStore, bs bstore.Blockstore, processor consensus.Processor, genesis *types.Block) (consensus.Protocol, consensus.PowerTableView, error) {
+	genCid := genesis.Cid()
+	switch genesis.Consensus {
+	case "", consensus.ExpectedProtocol:
+		powerTable := &consensus.MarketView{}
+		verifier := nc.Verifier
+		if verifier == nil {
+			verifier = &proofs.RustVerifier{}
+		}
+		return consensus.NewExpected(cst, bs, processor, powerTable, genCid, verifier, consensus.NewDefaultBlockSignatureValidator(bs), &consensus.ActorSectorsView{}), powerTable, nil
+	case consensus.AuthorityProtocol:
+		// The authorities are committed in the genesis state, so that all the
+		// nodes of a network agree on them.
+		authorities, err := consensus.AuthoritiesFromGenesis(ctx, cst, genesis)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get authorities from genesis")
+		}
+		authority, err := consensus.NewAuthority(cst, bs, processor, genCid, consensus.NewDefaultBlockSignatureValidator(bs), authorities)
+		if err != nil {
+			return nil, nil, err
+		}
+		return authority, consensus.NewAuthorityView(authorities), nil
+	default:
+		return nil, nil, errors.Errorf("unknown consensus protocol %q", genesis.Consensus)
+	}
+}
+
 // Build instantiates a filecoin Node from the settings specified in the config.
 func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	if nc.Repo == nil {
@@ -369,6 +416,9 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	// set up pinger
 	pinger := ping.NewPingService(peerHost)
 
+	// set up peer reputation, shared by the protocols to punish misbehaving peers
+	reputation := net.NewReputationManager(peerHost, net.DefaultBanDuration)
+
 	// set up bitswap
 	nwork := bsnet.NewFromIpfsHost(peerHost, router)
 	//nwork := bsnet.NewFromIpfsHost(innerHost, router)
@@ -384,7 +434,21 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 
 	// set up chainstore
 	chainStore := chain.NewDefaultStore(nc.Repo.ChainDatastore(), &cstOffline, genCid)
-	powerTable := &consensus.MarketView{}
+
+	// set up the chain clock, for chains whose genesis block starts epochs.
+	// The genesis block fixes the block time so all nodes agree on epochs.
+	var genesis types.Block
+	if err := cstOffline.Get(ctx, genCid, &genesis); err != nil {
+		return nil, errors.Wrap(err, "failed to load genesis block")
+	}
+	var chainClock *clock.ChainClock
+	if genesis.Timestamp != 0 && genesis.BlockTime != 0 {
+		genesisBlockTime := time.Duration(genesis.BlockTime) * time.Millisecond
+		chainClock = clock.NewChainClock(time.Unix(int64(genesis.Timestamp), 0), genesisBlockTime, time.Now)
+		if nc.BlockTime != 0 && nc.BlockTime != genesisBlockTime {
+			log.Warningf("ignoring the configured block time %s, the genesis block sets it to %s", nc.BlockTime, genesisBlockTime)
+		}
+	}
 
 	// set up processor
 	var processor consensus.Processor
@@ -395,17 +459,18 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	}
 
 	// set up consensus
-	var nodeConsensus consensus.Protocol
-	if nc.Verifier == nil {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, &proofs.RustVerifier{})
-	} else {
-		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier)
+	nodeConsensus, powerTable, err := nc.buildConsensus(ctx, &cstOffline, bs, processor, &genesis)
+	if err != nil {
+		return nil, err
 	}
 
 	// only the syncer gets the storage which is online connected
-	chainSyncer := chain.NewDefaultSyncer(&cstOffline, nodeConsensus, chainStore, fetcher)
-	msgPool := core.NewMessagePool(chainStore, nc.Repo.Config().Mpool, consensus.NewIngestionValidator(chainStore, nc.Repo.Config().Mpool))
+	chainSyncer := chain.NewDefaultSyncer(&cstOffline, nodeConsensus, chainStore, fetcher, chainClock)
+	msgValidator := consensus.NewIngestionValidator(chainStore, nc.Repo.Config().Mpool)
+	msgPool := core.NewMessagePool(chainStore, nc.Repo.Config().Mpool, msgValidator)
 	outbox := core.NewMessageQueue()
+	headChanges := core.NewHeadChangeNotifier(chainStore)
+	miningHistory := mining.NewHistory(nc.Repo.Datastore())
 
 	// Set up libp2p pubsub
 	fsub, err := libp2pps.NewFloodSub(ctx, peerHost)
@@ -424,12 +489,14 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		Config:       cfg.NewConfig(nc.Repo),
 		DAG:          dag.NewDAG(merkledag.NewDAGService(bservice)),
 		Deals:        strgdls.New(nc.Repo.DealsDatastore()),
+		HeadChanges:  headChanges,
+		MiningHist:   miningHistory,
 		MsgPool:      msgPool,
 		MsgPreviewer: msg.NewPreviewer(fcWallet, chainStore, &cstOffline, bs),
 		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainStore, &cstOffline, bs),
 		MsgSender:    msg.NewSender(fcWallet, chainStore, &cstOffline, chainStore, outbox, msgPool, consensus.NewOutboundMessageValidator(), fsub.Publish),
 		MsgWaiter:    msg.NewWaiter(chainStore, bs, &cstOffline),
-		Network:      net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker, pinger),
+		Network:      net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker, pinger, reputation),
 		Outbox:       outbox,
 		Wallet:       fcWallet,
 	}))
@@ -440,6 +507,7 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		cborStore:    &cstOffline,
 		Consensus:    nodeConsensus,
 		ChainReader:  chainStore,
+		HeadChanges:  headChanges,
 		Syncer:       chainSyncer,
 		PowerTable:   powerTable,
 		PorcelainAPI: PorcelainAPI,
@@ -447,13 +515,31 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		Exchange:     bswap,
 		host:         peerHost,
 		MsgPool:      msgPool,
+		msgValidator: msgValidator,
 		Outbox:       outbox,
 		OfflineMode:  nc.OfflineMode,
 		PeerHost:     peerHost,
 		Repo:         nc.Repo,
 		Wallet:       fcWallet,
 		blockTime:    nc.BlockTime,
+		ChainClock:   chainClock,
+		miningHist:   miningHistory,
 		Router:       router,
+		PeerHeads:    chain.NewPeerHeadTracker(),
+		isRelay:      nc.IsRelay,
+	}
+	nd.blockRelayers = newRelayers(maxRelayedBlocks)
+
+	// Validate blocks and messages before pubsub relays them to other peers.
+	blockValidatorOpts := []libp2pps.ValidatorOpt{
+		libp2pps.WithValidatorTimeout(blockValidationTimeout),
+		libp2pps.WithValidatorConcurrency(blockValidationConcurrency),
+	}
+	if err := fsub.RegisterTopicValidator(BlockTopic, nd.validateBlockPubSub, blockValidatorOpts...); err != nil {
+		return nil, errors.Wrap(err, "failed to register block validator")
+	}
+	if err := fsub.RegisterTopicValidator(msg.Topic, nd.validateMessagePubSub); err != nil {
+		return nil, errors.Wrap(err, "failed to register message validator")
 	}
 
 	// set up mining worker funcs
@@ -491,8 +577,18 @@ func (node *Node) Start(ctx context.Context) error {
 		return err
 	}
 
-	// Only set these up if there is a miner configured.
-	if _, err := node.miningAddress(); err == nil {
+	// Restore the pending and outbound messages of the previous run, now the head state they are
+	// validated against is loaded.
+	if err := node.MsgPool.Load(ctx, core.NewMessageStore(node.Repo.Datastore(), core.MessagePoolDatastorePrefix)); err != nil {
+		return errors.Wrap(err, "failed to load message pool")
+	}
+	outboxValidator := consensus.NewIngestionValidator(node.ChainReader, node.Repo.Config().Mpool)
+	if err := node.Outbox.Load(ctx, core.NewMessageStore(node.Repo.Datastore(), core.OutboxDatastorePrefix), outboxValidator); err != nil {
+		return errors.Wrap(err, "failed to load outbound message queue")
+	}
+
+	// Only set these up if there are miners configured.
+	if len(node.MinerAddresses()) > 0 {
 		if err := node.setupMining(ctx); err != nil {
 			log.Errorf("setup mining failed: %v", err)
 			return err
@@ -500,20 +596,28 @@ func (node *Node) Start(ctx context.Context) error {
 	}
 
 	// Start up 'hello' handshake service
-	syncCallBack := func(pid libp2ppeer.ID, cids []cid.Cid, height uint64) {
-		cidSet := types.NewSortedCidSet(cids...)
-		err := node.Syncer.HandleNewTipset(context.Background(), cidSet)
-		if err != nil {
-			log.Infof("error handling blocks: %s", cidSet.String())
-		}
-	}
-	node.HelloSvc = hello.New(node.Host(), node.ChainReader.GenesisCid(), syncCallBack, node.PorcelainAPI.ChainHead, node.Repo.Config().Net, flags.Commit)
-
+	syncCallBack := func(pid libp2ppeer.ID, cids []cid.Cid, height uint64, weight uint64) {
+		node.PeerHeads.Update(&chain.PeerHead{
+			Peer:   pid,
+			Cids:   types.NewSortedCidSet(cids...),
+			Height: height,
+			Weight: weight,
+		})
+		node.syncToHeaviestPeer(context.Background())
+	}
+	node.HelloSvc = hello.New(node.Host(), node.ChainReader.GenesisCid(), syncCallBack, node.PorcelainAPI.ChainHead, node.helloRole, node.PorcelainAPI, node.Repo.Config().Net, flags.Commit)
+	node.Host().Network().Notify(&libp2pnet.NotifyBundle{
+		DisconnectedF: func(_ libp2pnet.Network, c libp2pnet.Conn) {
+			node.PeerHeads.Remove(c.RemotePeer())
+		},
+	})
+
+	node.StorageMiners = storage.NewMinerRouter(node.Host(), node.PorcelainAPI)
 	err = node.setupProtocols()
 	if err != nil {
 		return errors.Wrap(err, "failed to set up protocols:")
 	}
-	node.RetrievalMiner = retrieval.NewMiner(node)
+	node.RetrievalMiner = retrieval.NewMiner(node, node.PorcelainAPI, node.Repo.Datastore())
 
 	// subscribe to block notifications
 	blkSub, err := node.PorcelainAPI.PubSubSubscribe(BlockTopic)
@@ -536,17 +640,20 @@ func (node *Node) Start(ctx context.Context) error {
 	go node.handleSubscription(cctx, node.processMessage, "processMessage", node.MessageSub, "MessageSub")
 
 	outboxPolicy := core.NewMessageQueuePolicy(node.Outbox, node.ChainReadStore(), core.OutboxMaxAgeRounds)
+	republisher := core.NewOutboxRepublisher(node.Outbox, node.MsgPool, node.Wallet.HasAddress, node.republishMessage, core.OutboxRepublishRounds)
 
 	node.HeaviestTipSetHandled = func() {}
-	node.HeaviestTipSetCh = node.ChainReader.HeadEvents().Sub(chain.NewHeadTopic)
 	head, err := node.PorcelainAPI.ChainHead()
 	if err != nil {
 		return errors.Wrap(err, "failed to get chain head")
 	}
-	go node.handleNewHeaviestTipSet(cctx, *head, outboxPolicy)
+	go node.handleNewHeaviestTipSet(cctx, *head, node.HeadChanges.Subscribe(cctx), outboxPolicy, republisher)
+	node.HeadChanges.Start(cctx, *head)
 
 	if !node.OfflineMode {
 		node.Bootstrapper.Start(context.Background())
+		go node.StorageClient.MonitorDeals(cctx)
+		go node.RetrievalMiner.CloseChannels(cctx)
 	}
 
 	if err := node.setupHeartbeatServices(ctx); err != nil {
@@ -588,7 +695,23 @@ func (node *Node) setupHeartbeatServices(ctx context.Context) error {
 	return nil
 }
 
+// setupMining sets up the sector builders of the node's miners.
 func (node *Node) setupMining(ctx context.Context) error {
+	for _, m := range node.Miners() {
+		if err := node.setupSectorBuilder(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupSectorBuilder initializes the sector builder of the miner if it doesn't
+// have one yet.
+func (node *Node) setupSectorBuilder(ctx context.Context, m *Miner) error {
+	if m.sectorBuilder != nil {
+		return nil
+	}
+
 	var proofsMode types.ProofsMode
 	values, err := node.PorcelainAPI.MessageQuery(
 		ctx,
@@ -605,43 +728,37 @@ func (node *Node) setupMining(ctx context.Context) error {
 	}
 
 	// initialize a sector builder
-	sectorBuilder, err := initSectorBuilderForNode(ctx, node, proofsMode)
+	sectorBuilder, err := initSectorBuilderForNode(ctx, node, m.Address, proofsMode)
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize sector builder")
 	}
-	node.sectorBuilder = sectorBuilder
+	m.sectorBuilder = sectorBuilder
 
 	return nil
 }
 
-func (node *Node) setIsMining(isMining bool) {
-	node.mining.Lock()
-	defer node.mining.Unlock()
-	node.mining.isMining = isMining
-}
-
-func (node *Node) handleNewMiningOutput(miningOutCh <-chan mining.Output) {
+func (node *Node) handleNewMiningOutput(m *Miner, miningOutCh <-chan mining.Output) {
 	defer func() {
-		node.miningDoneWg.Done()
+		m.miningDoneWg.Done()
 	}()
 	for {
 		select {
-		case <-node.miningCtx.Done():
+		case <-m.miningCtx.Done():
 			return
 		case output, ok := <-miningOutCh:
 			if !ok {
 				return
 			}
 			if output.Err != nil {
-				log.Errorf("stopping mining. error: %s", output.Err.Error())
-				node.StopMining(context.Background())
+				log.Errorf("stopping miner %s. error: %s", m.Address, output.Err.Error())
+				node.StopMining(context.Background(), m.Address)
 			} else {
-				node.miningDoneWg.Add(1)
+				m.miningDoneWg.Add(1)
 				go func() {
-					if node.IsMining() {
-						node.AddNewlyMinedBlock(node.miningCtx, output.NewBlock)
+					if m.IsMining() {
+						node.AddNewlyMinedBlock(m.miningCtx, output.NewBlock)
 					}
-					node.miningDoneWg.Done()
+					m.miningDoneWg.Done()
 				}()
 			}
 		}
@@ -649,33 +766,30 @@ func (node *Node) handleNewMiningOutput(miningOutCh <-chan mining.Output) {
 
 }
 
-func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet, outboxPolicy *core.MessageQueuePolicy) {
+func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet, changes <-chan *core.HeadChange, outboxPolicy *core.MessageQueuePolicy, republisher *core.OutboxRepublisher) {
 	for {
 		select {
-		case ts, ok := <-node.HeaviestTipSetCh:
+		case change, ok := <-changes:
 			if !ok {
 				return
 			}
-			newHead, ok := ts.(types.TipSet)
-			if !ok {
-				log.Error("non-tipset published on heaviest tipset channel")
-				continue
-			}
-			if len(newHead) == 0 {
-				log.Error("tipset of size 0 published on heaviest tipset channel. ignoring and waiting for a new heaviest tipset.")
-				continue
-			}
+			newHead := change.Head
 
 			if err := outboxPolicy.OnNewHeadTipset(ctx, head, newHead); err != nil {
 				log.Error("updating outbound message queue for new tipset", err)
 			}
-			if err := node.MsgPool.UpdateMessagePool(ctx, node.ChainReadStore(), head, newHead); err != nil {
+			if err := republisher.OnHeadChange(ctx, change); err != nil {
+				log.Error("republishing outbound messages for new tipset", err)
+			}
+			if err := node.MsgPool.UpdateMessagePool(ctx, node.ChainReadStore(), change); err != nil {
 				log.Error("updating message pool for new tipset", err)
 			}
 			head = newHead
 
-			if node.StorageMiner != nil {
-				node.StorageMiner.OnNewHeaviestTipSet(newHead)
+			for _, m := range node.Miners() {
+				if m.StorageMiner != nil {
+					m.StorageMiner.OnNewHeaviestTipSet(newHead)
+				}
 			}
 			node.HeaviestTipSetHandled()
 		case <-ctx.Done():
@@ -684,6 +798,15 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 	}
 }
 
+// republishMessage publishes a message of the outbound queue to the network again.
+func (node *Node) republishMessage(ctx context.Context, smsg *types.SignedMessage) error {
+	data, err := smsg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal message")
+	}
+	return node.PorcelainAPI.PubSubPublish(msg.Topic, data)
+}
+
 func (node *Node) cancelSubscriptions() {
 	if node.BlockSub != nil || node.MessageSub != nil {
 		node.cancelSubscriptionsCtx()
@@ -702,17 +825,19 @@ func (node *Node) cancelSubscriptions() {
 
 // Stop initiates the shutdown of the node.
 func (node *Node) Stop(ctx context.Context) {
-	node.ChainReader.HeadEvents().Unsub(node.HeaviestTipSetCh)
 	node.StopMining(ctx)
 
 	node.cancelSubscriptions()
+	node.HeadChanges.Stop()
 	node.ChainReader.Stop()
 
-	if node.SectorBuilder() != nil {
-		if err := node.SectorBuilder().Close(); err != nil {
-			fmt.Printf("error closing sector builder: %s\n", err)
+	for _, m := range node.Miners() {
+		if m.sectorBuilder != nil {
+			if err := m.sectorBuilder.Close(); err != nil {
+				fmt.Printf("error closing sector builder of miner %s: %s\n", m.Address, err)
+			}
+			m.sectorBuilder = nil
 		}
-		node.sectorBuilder = nil
 	}
 
 	if err := node.Host().Close(); err != nil {
@@ -737,15 +862,65 @@ func (node *Node) addNewlyMinedBlock(ctx context.Context, b *types.Block) {
 	}
 }
 
-// miningAddress returns the address of the mining actor mining on behalf of
-// the node.
+// miningAddress returns the address of the node's default miner.
 func (node *Node) miningAddress() (address.Address, error) {
-	addr := node.Repo.Config().Mining.MinerAddress
-	if addr.Empty() {
+	minerAddrs := node.MinerAddresses()
+	if len(minerAddrs) == 0 {
 		return address.Undef, ErrNoMinerAddress
 	}
 
-	return addr, nil
+	return minerAddrs[0], nil
+}
+
+// syncToHeaviestPeer syncs the chain announced by the peer with the heaviest
+// head, if that chain is heavier than ours. When syncing to a peer's head
+// fails the peer is reported, its head forgotten and the next heaviest head
+// tried instead.
+func (node *Node) syncToHeaviestPeer(ctx context.Context) {
+	head, err := node.PorcelainAPI.ChainHead()
+	if err != nil {
+		log.Errorf("failed to get chain head: %s", err)
+		return
+	}
+	ourWeight, err := head.ParentWeight()
+	if err != nil {
+		log.Errorf("failed to get chain head weight: %s", err)
+		return
+	}
+	ourHeight, err := head.Height()
+	if err != nil {
+		log.Errorf("failed to get chain head height: %s", err)
+		return
+	}
+
+	for _, target := range node.PeerHeads.SyncTargets(ourWeight, ourHeight) {
+		err := node.Syncer.HandleNewTipset(ctx, target.Cids)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Infof("error syncing blocks %s from peer %s: %s", target.Cids.String(), target.Peer, err)
+
+		node.PeerHeads.Remove(target.Peer)
+		if node.Syncer.IsBadTipSet(target.Cids) || errors.Cause(err) == chain.ErrChainHasBadTipSet {
+			node.PorcelainAPI.NetworkReportPeer(target.Peer, net.OffenseInvalidBlock, "announced an invalid chain")
+		} else {
+			node.PorcelainAPI.NetworkReportPeer(target.Peer, net.OffenseTimeout, "failed to serve its announced chain")
+		}
+	}
+}
+
+// helloRole returns the role this node announces in the hello protocol.
+func (node *Node) helloRole() hello.Role {
+	if node.isRelay {
+		return hello.RoleRelay
+	}
+	if _, err := node.miningAddress(); err == nil {
+		return hello.RoleMiner
+	}
+	return hello.RoleClient
 }
 
 // MiningTimes returns the configured time it takes to mine a block, and also
@@ -757,34 +932,54 @@ func (node *Node) MiningTimes() (time.Duration, time.Duration) {
 	return node.GetBlockTime(), mineDelay
 }
 
-// GetBlockTime returns the current block time.
+// GetBlockTime returns the current block time. Chains with epochs take it
+// from their genesis block rather than from the node's configuration.
 // TODO this should be surfaced somewhere in the plumbing API.
 func (node *Node) GetBlockTime() time.Duration {
+	if node.ChainClock != nil {
+		return node.ChainClock.BlockTime()
+	}
 	return node.blockTime
 }
 
-// SetBlockTime sets the block time.
+// SetBlockTime sets the block time. Chains with epochs keep the block time of
+// their genesis block, so it is ignored for them.
 func (node *Node) SetBlockTime(blockTime time.Duration) {
+	if node.ChainClock != nil && blockTime != node.ChainClock.BlockTime() {
+		log.Warningf("ignoring block time %s, the genesis block sets it to %s", blockTime, node.ChainClock.BlockTime())
+	}
 	node.blockTime = blockTime
 }
 
-// StartMining causes the node to start feeding blocks to the mining worker and initializes
-// the SectorBuilder for the mining address.
-func (node *Node) StartMining(ctx context.Context) error {
-	if node.IsMining() {
-		return errors.New("Node is already mining")
-	}
-	minerAddr, err := node.miningAddress()
+// StartMining causes the given miners, or all the node's miners if none are
+// given, to start mining blocks and making storage deals. It initializes the
+// SectorBuilder of each miner that doesn't have one.
+func (node *Node) StartMining(ctx context.Context, minerAddrs ...address.Address) error {
+	miners, err := node.selectMiners(minerAddrs)
 	if err != nil {
 		return errors.Wrap(err, "failed to get mining address")
 	}
+	for _, m := range miners {
+		if m.IsMining() {
+			return errors.Errorf("miner %s is already mining", m.Address)
+		}
+	}
 
-	// ensure we have a sector builder
-	if node.SectorBuilder() == nil {
-		if err := node.setupMining(ctx); err != nil {
+	for _, m := range miners {
+		if err := node.startMiner(ctx, m); err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+func (node *Node) startMiner(ctx context.Context, m *Miner) error {
+	minerAddr := m.Address
+
+	// ensure we have a sector builder
+	if err := node.setupSectorBuilder(ctx, m); err != nil {
+		return err
+	}
 
 	minerOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
 	if err != nil {
@@ -793,42 +988,59 @@ func (node *Node) StartMining(ctx context.Context) error {
 
 	_, mineDelay := node.MiningTimes()
 
-	if node.MiningWorker == nil {
-		if node.MiningWorker, err = node.CreateMiningWorker(ctx); err != nil {
+	if m.Worker == nil {
+		if m.Worker, err = node.CreateMiningWorker(ctx, minerAddr); err != nil {
 			return err
 		}
 	}
-	if node.MiningScheduler == nil {
-		node.MiningScheduler = mining.NewScheduler(node.MiningWorker, mineDelay, node.PorcelainAPI.ChainHead)
+	if m.Scheduler == nil {
+		if node.ChainClock != nil {
+			m.Scheduler = mining.NewEpochScheduler(m.Worker, node.ChainClock, mineDelay, node.PorcelainAPI.ChainHead)
+		} else {
+			m.Scheduler = mining.NewScheduler(m.Worker, mineDelay, node.PorcelainAPI.ChainHead)
+		}
 	}
 
 	// paranoid check
-	if !node.MiningScheduler.IsStarted() {
-		node.miningCtx, node.cancelMining = context.WithCancel(context.Background())
-		outCh, doneWg := node.MiningScheduler.Start(node.miningCtx)
+	if !m.Scheduler.IsStarted() {
+		m.miningCtx, m.cancelMining = context.WithCancel(context.Background())
+		outCh, doneWg := m.Scheduler.Start(m.miningCtx)
 
-		node.miningDoneWg = doneWg
+		m.miningDoneWg = doneWg
 		node.AddNewlyMinedBlock = node.addNewlyMinedBlock
-		node.miningDoneWg.Add(1)
-		go node.handleNewMiningOutput(outCh)
+		m.miningDoneWg.Add(1)
+		go node.handleNewMiningOutput(m, outCh)
 	}
 
 	// initialize a storage miner
-	storageMiner, err := initStorageMinerForNode(ctx, node)
+	storageMiner, err := initStorageMinerForNode(ctx, node, m)
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize storage miner")
 	}
-	node.StorageMiner = storageMiner
+	m.StorageMiner = storageMiner
+	node.StorageMiners.AddMiner(storageMiner)
+
+	// Deals in progress when the node stopped are resumed on the first start only,
+	// later starts would process them twice.
+	if !m.dealsResumed {
+		m.dealsResumed = true
+		if err := storageMiner.ResumeDeals(ctx); err != nil {
+			log.Errorf("failed to resume deals of miner %s: %s", minerAddr, err)
+		}
+	}
+	go storageMiner.ProvidePieces(m.miningCtx)
 
 	// loop, turning sealing-results into commitSector messages to be included
 	// in the chain
 	go func() {
 		for {
 			select {
-			case result := <-node.SectorBuilder().SectorSealResults():
+			case result := <-m.SectorBuilder().SectorSealResults():
 				if result.SealingErr != nil {
 					log.Errorf("failed to seal sector with id %d: %s", result.SectorID, result.SealingErr.Error())
+					storageMiner.OnCommitmentAddedToChain(&sectorbuilder.SealedSectorMetadata{SectorID: result.SectorID}, result.SealingErr)
 				} else if result.SealingResult != nil {
+					storageMiner.OnSectorSealed(result.SectorID)
 
 					// TODO: determine these algorithmically by simulating call and querying historical prices
 					gasPrice := types.NewGasPrice(0)
@@ -838,7 +1050,7 @@ func (node *Node) StartMining(ctx context.Context) error {
 					// This call can fail due to, e.g. nonce collisions. Our miners existence depends on this.
 					// We should deal with this, but MessageSendWithRetry is problematic.
 					_, err := node.PorcelainAPI.MessageSend(
-						node.miningCtx,
+						m.miningCtx,
 						minerOwnerAddr,
 						minerAddr,
 						nil,
@@ -856,9 +1068,9 @@ func (node *Node) StartMining(ctx context.Context) error {
 						continue
 					}
 
-					node.StorageMiner.OnCommitmentAddedToChain(val, nil)
+					storageMiner.OnCommitmentAddedToChain(val, nil)
 				}
-			case <-node.miningCtx.Done():
+			case <-m.miningCtx.Done():
 				return
 			}
 		}
@@ -869,12 +1081,12 @@ func (node *Node) StartMining(ctx context.Context) error {
 		go func() {
 			for {
 				select {
-				case <-node.miningCtx.Done():
+				case <-m.miningCtx.Done():
 					return
 				case <-time.After(time.Duration(node.Repo.Config().Mining.AutoSealIntervalSeconds) * time.Second):
-					log.Info("auto-seal has been triggered")
-					if err := node.SectorBuilder().SealAllStagedSectors(node.miningCtx); err != nil {
-						log.Errorf("scheduler received error from node.SectorBuilder.SealAllStagedSectors (%s) - exiting", err.Error())
+					log.Infof("auto-seal has been triggered for miner %s", minerAddr)
+					if err := m.SectorBuilder().SealAllStagedSectors(m.miningCtx); err != nil {
+						log.Errorf("scheduler received error from SectorBuilder.SealAllStagedSectors of miner %s (%s) - exiting", minerAddr, err.Error())
 						return
 					}
 				}
@@ -883,7 +1095,7 @@ func (node *Node) StartMining(ctx context.Context) error {
 	} else {
 		log.Debug("auto-seal is disabled")
 	}
-	node.setIsMining(true)
+	m.setIsMining(true)
 
 	return nil
 }
@@ -915,12 +1127,7 @@ func (node *Node) getLastUsedSectorID(ctx context.Context, minerAddr address.Add
 	return lastUsedSectorID, nil
 }
 
-func initSectorBuilderForNode(ctx context.Context, node *Node, proofsMode types.ProofsMode) (sectorbuilder.SectorBuilder, error) {
-	minerAddr, err := node.miningAddress()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get node's mining address")
-	}
-
+func initSectorBuilderForNode(ctx context.Context, node *Node, minerAddr address.Address, proofsMode types.ProofsMode) (sectorbuilder.SectorBuilder, error) {
 	lastUsedSectorID, err := node.getLastUsedSectorID(ctx, minerAddr)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get last used sector id for miner w/address %s", minerAddr.String())
@@ -933,16 +1140,30 @@ func initSectorBuilderForNode(ctx context.Context, node *Node, proofsMode types.
 		sectorClass = types.NewLiveSectorClass()
 	}
 
+	// The default miner keeps its sectors directly in the staging and sealed
+	// directories, where they were kept before nodes ran several miners. The
+	// other miners keep theirs in subdirectories named after them.
+	stagingDir, sealedDir := node.Repo.StagingDir(), node.Repo.SealedDir()
+	if defaultAddr, err := node.miningAddress(); err == nil && minerAddr != defaultAddr {
+		stagingDir = filepath.Join(stagingDir, minerAddr.String())
+		sealedDir = filepath.Join(sealedDir, minerAddr.String())
+		for _, dir := range []string{stagingDir, sealedDir} {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return nil, errors.Wrapf(err, "failed to create sector directory %s", dir)
+			}
+		}
+	}
+
 	// TODO: Where should we store the RustSectorBuilder metadata? Currently, we
 	// configure the RustSectorBuilder to store its metadata in the staging
 	// directory.
 	cfg := sectorbuilder.RustSectorBuilderConfig{
 		BlockService:     node.blockservice,
 		LastUsedSectorID: lastUsedSectorID,
-		MetadataDir:      node.Repo.StagingDir(),
+		MetadataDir:      stagingDir,
 		MinerAddr:        minerAddr,
-		SealedSectorDir:  node.Repo.SealedDir(),
-		StagedSectorDir:  node.Repo.StagingDir(),
+		SealedSectorDir:  sealedDir,
+		StagedSectorDir:  stagingDir,
 		SectorClass:      sectorClass,
 	}
 
@@ -954,18 +1175,21 @@ func initSectorBuilderForNode(ctx context.Context, node *Node, proofsMode types.
 	return sb, nil
 }
 
-func initStorageMinerForNode(ctx context.Context, node *Node) (*storage.Miner, error) {
-	minerAddr, err := node.miningAddress()
+func initStorageMinerForNode(ctx context.Context, node *Node, m *Miner) (*storage.Miner, error) {
+	miningOwnerAddr, err := node.miningOwnerAddress(ctx, m.Address)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get node's mining address")
+		return nil, errors.Wrap(err, "no mining owner available, skipping storage miner setup")
 	}
 
-	miningOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
-	if err != nil {
-		return nil, errors.Wrap(err, "no mining owner available, skipping storage miner setup")
+	// The default miner owns the deals awaiting seal stored before nodes ran
+	// several miners.
+	if defaultAddr, err := node.miningAddress(); err == nil && m.Address == defaultAddr {
+		if err := storage.MigrateDealsAwaitingSeal(node.Repo.DealsDatastore(), m.Address); err != nil {
+			return nil, errors.Wrap(err, "failed to migrate deals awaiting seal")
+		}
 	}
 
-	miner, err := storage.NewMiner(minerAddr, miningOwnerAddr, node, node.Repo.DealsDatastore(), node.PorcelainAPI)
+	miner, err := storage.NewMiner(m.Address, miningOwnerAddr, m, node.Repo.DealsDatastore(), node.PorcelainAPI)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to instantiate storage miner")
 	}
@@ -973,19 +1197,35 @@ func initStorageMinerForNode(ctx context.Context, node *Node) (*storage.Miner, e
 	return miner, nil
 }
 
-// StopMining stops mining on new blocks.
-func (node *Node) StopMining(ctx context.Context) {
-	node.setIsMining(false)
-
-	if node.cancelMining != nil {
-		node.cancelMining()
+// StopMining stops the given miners, or all the node's miners if none are
+// given, from mining new blocks and making storage deals. Addresses of miners
+// the node doesn't run are ignored.
+func (node *Node) StopMining(ctx context.Context, minerAddrs ...address.Address) {
+	miners := node.Miners()
+	if len(minerAddrs) > 0 {
+		var err error
+		if miners, err = node.selectMiners(minerAddrs); err != nil {
+			log.Warningf("failed to stop mining: %s", err)
+			return
+		}
 	}
 
-	if node.miningDoneWg != nil {
-		node.miningDoneWg.Wait()
-	}
+	for _, m := range miners {
+		m.setIsMining(false)
 
-	// TODO: stop node.StorageMiner
+		if m.cancelMining != nil {
+			m.cancelMining()
+		}
+
+		if m.miningDoneWg != nil {
+			m.miningDoneWg.Wait()
+		}
+
+		// The storage miner's sealing and announcing stopped with the mining
+		// context; it takes no new deals either until the miner starts again.
+		node.StorageMiners.RemoveMiner(m.Address)
+		m.StorageMiner = nil
+	}
 }
 
 // NewAddress creates a new account address on the default wallet backend.
@@ -1034,25 +1274,28 @@ func (node *Node) setupProtocols() error {
 	node.BlockMiningAPI = &blockMiningAPI
 
 	// set up retrieval client and api
-	retapi := retrieval.NewAPI(retrieval.NewClient(node.host, node.blockTime))
+	retapi := retrieval.NewAPI(retrieval.NewClient(node.host, node.blockTime, node.PorcelainAPI, node.Repo.Datastore()))
 	node.RetrievalAPI = &retapi
 
 	// set up storage client and api
 	smc := storage.NewClient(node.blockTime, node.host, node.PorcelainAPI)
-	smcAPI := storage.NewAPI(smc)
+	node.StorageClient = smc
+	smcAPI := storage.NewAPI(smc, node.StorageMiners)
 	node.StorageAPI = &smcAPI
 	return nil
 }
 
-// CreateMiningWorker creates a mining.Worker for the node using the configured
+// CreateMiningWorker creates a mining.Worker for the given miner, or the
+// node's default miner if the address is empty, using the configured
 // getStateTree, getWeight, and getAncestors functions for the node
-func (node *Node) CreateMiningWorker(ctx context.Context) (mining.Worker, error) {
+func (node *Node) CreateMiningWorker(ctx context.Context, minerAddr address.Address) (mining.Worker, error) {
 	processor := consensus.NewDefaultProcessor()
 
-	minerAddr, err := node.miningAddress()
+	m, err := node.Miner(minerAddr)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get mining address")
 	}
+	minerAddr = m.Address
 
 	minerPubKey, err := node.PorcelainAPI.MinerGetKey(ctx, minerAddr)
 	if err != nil {
@@ -1064,10 +1307,16 @@ func (node *Node) CreateMiningWorker(ctx context.Context) (mining.Worker, error)
 		log.Errorf("could not get owner address of miner actor")
 		return nil, err
 	}
-	return mining.NewDefaultWorker(
+
+	// ensure we have a sector builder to generate election PoSts
+	if err := node.setupSectorBuilder(ctx, m); err != nil {
+		return nil, err
+	}
+	worker := mining.NewDefaultWorker(
 		node.MsgPool, node.getStateTree, node.getWeight, node.getAncestors, processor, node.PowerTable,
 		node.Blockstore, node.CborStore(), minerAddr, minerOwnerAddr, minerPubKey,
-		node.Wallet, node.blockTime), nil
+		node.Wallet, node.Consensus, &consensus.ActorSectorsView{}, m.SectorBuilder(), node.blockTime)
+	return mining.NewRecordingWorker(worker, minerAddr, node.miningHist, node.getPower), nil
 }
 
 // getStateFromKey returns the state tree based on tipset fetched with provided key tsKey
@@ -1084,6 +1333,23 @@ func (node *Node) getStateTree(ctx context.Context, ts types.TipSet) (state.Tree
 	return node.getStateFromKey(ctx, ts.ToSortedCidSet())
 }
 
+// getPower is the GetPower function the node records mining attempts with.
+func (node *Node) getPower(ctx context.Context, ts types.TipSet, minerAddr address.Address) (uint64, uint64, error) {
+	st, err := node.getStateTree(ctx, ts)
+	if err != nil {
+		return 0, 0, err
+	}
+	minerPower, err := node.PowerTable.Miner(ctx, st, node.Blockstore, minerAddr)
+	if err != nil {
+		return 0, 0, err
+	}
+	totalPower, err := node.PowerTable.Total(ctx, st, node.Blockstore)
+	if err != nil {
+		return 0, 0, err
+	}
+	return minerPower, totalPower, nil
+}
+
 // getWeight is the default GetWeight function for the mining worker.
 func (node *Node) getWeight(ctx context.Context, ts types.TipSet) (uint64, error) {
 	parent, err := ts.Parents()
@@ -1113,9 +1379,24 @@ func (node *Node) Host() host.Host {
 	return node.host
 }
 
-// SectorBuilder returns the nodes sectorBuilder.
+// SectorBuilder returns the sectorBuilder of the node's default miner.
 func (node *Node) SectorBuilder() sectorbuilder.SectorBuilder {
-	return node.sectorBuilder
+	m, err := node.Miner(address.Undef)
+	if err != nil {
+		return nil
+	}
+	return m.SectorBuilder()
+}
+
+// SectorBuilders returns the sectorBuilders of the node's miners that have one.
+func (node *Node) SectorBuilders() []sectorbuilder.SectorBuilder {
+	var sbs []sectorbuilder.SectorBuilder
+	for _, m := range node.Miners() {
+		if sb := m.SectorBuilder(); sb != nil {
+			sbs = append(sbs, sb)
+		}
+	}
+	return sbs
 }
 
 // BlockService returns the nodes blockservice.
@@ -1133,9 +1414,13 @@ func (node *Node) ChainReadStore() chain.ReadStore {
 	return node.ChainReader
 }
 
-// IsMining returns a boolean indicating whether the node is mining blocks.
+// IsMining returns a boolean indicating whether any of the node's miners is
+// mining blocks.
 func (node *Node) IsMining() bool {
-	node.mining.Lock()
-	defer node.mining.Unlock()
-	return node.mining.isMining
+	for _, m := range node.Miners() {
+		if m.IsMining() {
+			return true
+		}
+	}
+	return false
 }
@@ -7,10 +7,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/gengen/util"
 	"github.com/filecoin-project/go-filecoin/mining"
 	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/node"
@@ -28,6 +30,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/wallet"
 
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/libp2p/go-libp2p-peer"
 	"github.com/libp2p/go-libp2p-peerstore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -173,7 +176,7 @@ func TestNodeStartMining(t *testing.T) {
 		MsgQueryer:   msg.NewQueryer(minerNode.Repo, minerNode.Wallet, minerNode.ChainReader, minerNode.CborStore(), minerNode.Blockstore),
 		MsgSender:    msg.NewSender(minerNode.Wallet, nil, minerNode.CborStore(), nil, minerNode.Outbox, minerNode.MsgPool, validator, minerNode.PorcelainAPI.PubSubPublish),
 		MsgWaiter:    msg.NewWaiter(minerNode.ChainReader, minerNode.Blockstore, minerNode.CborStore()),
-		Network:      net.New(minerNode.Host(), nil, nil, nil, nil, nil),
+		Network:      net.New(minerNode.Host(), nil, nil, nil, nil, nil, nil),
 		Wallet:       wallet.New(walletBackend),
 		Deals:        strgdls.New(minerNode.Repo.DealsDatastore()),
 	})
@@ -189,11 +192,13 @@ func TestNodeStartMining(t *testing.T) {
 	t.Run("Start/Stop/Start results in a MiningScheduler that is started", func(t *testing.T) {
 		assert.NoError(minerNode.StartMining(ctx))
 		defer minerNode.StopMining(ctx)
-		assert.True(minerNode.MiningScheduler.IsStarted())
+		m, err := minerNode.Miner(mineraddr)
+		require.NoError(t, err)
+		assert.True(m.Scheduler.IsStarted())
 		minerNode.StopMining(ctx)
-		assert.False(minerNode.MiningScheduler.IsStarted())
+		assert.False(m.Scheduler.IsStarted())
 		assert.NoError(minerNode.StartMining(ctx))
-		assert.True(minerNode.MiningScheduler.IsStarted())
+		assert.True(m.Scheduler.IsStarted())
 	})
 
 	t.Run("Start + Start gives an error message saying mining is already started", func(t *testing.T) {
@@ -205,6 +210,63 @@ func TestNodeStartMining(t *testing.T) {
 
 }
 
+func TestNodeRunsSeveralMiners(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	peerID, err := peer.IDFromPrivateKey(node.PeerKeys[0])
+	require.NoError(err)
+	genCfg := &gengen.GenesisCfg{
+		Keys: 2,
+		Miners: []gengen.Miner{
+			{Owner: 0, Power: 50, PeerID: peerID.Pretty()},
+			{Owner: 1, Power: 50, PeerID: peerID.Pretty()},
+		},
+		PreAlloc: []string{"10000", "10000"},
+	}
+	seed := node.MakeChainSeed(t, genCfg)
+	minerNode := node.MakeNodeWithChainSeed(t, seed, []node.ConfigOpt{}, node.PeerKeyOpt(node.PeerKeys[0]), node.AutoSealIntervalSecondsOpt(0))
+	seed.GiveKey(t, minerNode, 0)
+	seed.GiveKey(t, minerNode, 1)
+	defaultAddr, _ := seed.GiveMiner(t, minerNode, 0)
+	otherAddr, _ := seed.GiveMiner(t, minerNode, 1)
+
+	require.NoError(minerNode.Start(ctx))
+	defer minerNode.Stop(ctx)
+
+	assert.Equal([]address.Address{defaultAddr, otherAddr}, minerNode.MinerAddresses())
+
+	defaultMiner, err := minerNode.Miner(address.Undef)
+	require.NoError(err)
+	assert.Equal(defaultAddr, defaultMiner.Address)
+	otherMiner, err := minerNode.Miner(otherAddr)
+	require.NoError(err)
+	assert.Equal(otherAddr, otherMiner.Address)
+	_, err = minerNode.Miner(address.NewForTestGetter()())
+	assert.Error(err)
+
+	// Each miner seals with its own sector builder.
+	require.NotNil(defaultMiner.SectorBuilder())
+	require.NotNil(otherMiner.SectorBuilder())
+	assert.NotEqual(defaultMiner.SectorBuilder(), otherMiner.SectorBuilder())
+	assert.Len(minerNode.SectorBuilders(), 2)
+
+	require.NoError(minerNode.StartMining(ctx, otherAddr))
+	assert.True(otherMiner.IsMining())
+	assert.False(defaultMiner.IsMining())
+	assert.NotNil(minerNode.StorageMiners.Miner(otherAddr))
+	assert.Nil(minerNode.StorageMiners.Miner(defaultAddr))
+	assert.Error(minerNode.StartMining(ctx, otherAddr))
+
+	minerNode.StopMining(ctx, otherAddr)
+	assert.False(minerNode.IsMining())
+	assert.Nil(minerNode.StorageMiners.Miner(otherAddr))
+	assert.Nil(otherMiner.StorageMiner)
+}
+
 func TestUpdateMessagePool(t *testing.T) {
 	tf.UnitTest(t)
 
@@ -1,10 +1,17 @@
 package node
 
 import (
+	"context"
+	"errors"
 	"testing"
 
+	"github.com/libp2p/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/chain"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMakePrivateKey(t *testing.T) {
@@ -27,3 +34,74 @@ func TestMakePrivateKey(t *testing.T) {
 	assert.NoError(err)
 	assert.NotNil(goodKey)
 }
+
+func TestRelayers(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+
+	cidGetter := types.NewCidForTestGetter()
+	a, b, c := cidGetter(), cidGetter(), cidGetter()
+
+	r := newRelayers(2)
+	r.add(a, peer.ID("p1"))
+	r.add(a, peer.ID("p2"))
+	r.add(b, peer.ID("p2"))
+
+	// The first peer to relay a block is the one remembered.
+	from, ok := r.get(a)
+	assert.True(ok)
+	assert.Equal(peer.ID("p1"), from)
+
+	// The oldest block is forgotten first.
+	r.add(c, peer.ID("p3"))
+	_, ok = r.get(a)
+	assert.False(ok)
+	from, ok = r.get(c)
+	assert.True(ok)
+	assert.Equal(peer.ID("p3"), from)
+}
+
+type failingSyncer struct {
+	failing map[string]bool
+	synced  []types.SortedCidSet
+}
+
+func (s *failingSyncer) HandleNewTipset(ctx context.Context, tipsetCids types.SortedCidSet) error {
+	s.synced = append(s.synced, tipsetCids)
+	if s.failing[tipsetCids.String()] {
+		return errors.New("fetch failed")
+	}
+	return nil
+}
+
+func (s *failingSyncer) IsBadTipSet(tipsetCids types.SortedCidSet) bool {
+	return false
+}
+
+func TestSyncToHeaviestPeerFallsBack(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	nd := MakeNodesUnstarted(t, 1, true)[0]
+	require.NoError(nd.ChainReader.(chain.Store).Load(ctx))
+
+	cidGetter := types.NewCidForTestGetter()
+	heavy := &chain.PeerHead{Peer: peer.ID("heavy"), Cids: types.NewSortedCidSet(cidGetter()), Height: 3, Weight: 20}
+	light := &chain.PeerHead{Peer: peer.ID("light"), Cids: types.NewSortedCidSet(cidGetter()), Height: 5, Weight: 10}
+	nd.PeerHeads.Update(heavy)
+	nd.PeerHeads.Update(light)
+
+	syncer := &failingSyncer{failing: map[string]bool{heavy.Cids.String(): true}}
+	nd.Syncer = syncer
+
+	nd.syncToHeaviestPeer(ctx)
+
+	// The heaviest head failed to sync so the node fell back to the next one
+	// and forgot the failing peer's head.
+	assert.Equal([]types.SortedCidSet{heavy.Cids, light.Cids}, syncer.synced)
+	assert.Equal(light, nd.PeerHeads.Heaviest())
+}
@@ -105,13 +105,18 @@ func (cs *ChainSeed) GiveKey(t *testing.T, nd *Node, key int) address.Address {
 	return addr
 }
 
-// GiveMiner gives the specified miner to the node. Returns the address and the owner addresss
+// GiveMiner gives the specified miner to the node. The first miner given to a
+// node becomes its default miner. Returns the address and the owner addresss
 func (cs *ChainSeed) GiveMiner(t *testing.T, nd *Node, which int) (address.Address, address.Address) {
 	t.Helper()
 	cfg := nd.Repo.Config()
 	m := cs.info.Miners[which]
 
-	cfg.Mining.MinerAddress = m.Address
+	if cfg.Mining.MinerAddress.Empty() {
+		cfg.Mining.MinerAddress = m.Address
+	} else {
+		cfg.Mining.MinerAddresses = append(cfg.Mining.MinerAddresses, m.Address)
+	}
 	require.NoError(t, nd.Repo.ReplaceConfig(cfg))
 
 	ownerAddr, err := cs.info.Keys[m.Owner].Address()
@@ -21,6 +21,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/mining"
 	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/net/pubsub"
 	"github.com/filecoin-project/go-filecoin/plumbing/bcf"
@@ -46,6 +47,8 @@ type API struct {
 	chain        *bcf.BlockChainFacade
 	config       *cfg.Config
 	dag          *dag.DAG
+	headChanges  *core.HeadChangeNotifier
+	miningHist   *mining.History
 	msgPool      *core.MessagePool
 	msgPreviewer *msg.Previewer
 	msgQueryer   *msg.Queryer
@@ -64,6 +67,8 @@ type APIDeps struct {
 	Config       *cfg.Config
 	DAG          *dag.DAG
 	Deals        *strgdls.Store
+	HeadChanges  *core.HeadChangeNotifier
+	MiningHist   *mining.History
 	MsgPool      *core.MessagePool
 	MsgPreviewer *msg.Previewer
 	MsgQueryer   *msg.Queryer
@@ -83,6 +88,8 @@ func New(deps *APIDeps) *API {
 		chain:        deps.Chain,
 		config:       deps.Config,
 		dag:          deps.DAG,
+		headChanges:  deps.HeadChanges,
+		miningHist:   deps.MiningHist,
 		msgPool:      deps.MsgPool,
 		msgPreviewer: deps.MsgPreviewer,
 		msgQueryer:   deps.MsgQueryer,
@@ -143,6 +150,13 @@ func (api *API) ChainLs(ctx context.Context) (*chain.TipsetIterator, error) {
 	return api.chain.Ls(ctx)
 }
 
+// ChainNotify returns a channel on which a HeadChange, listing the tipsets
+// reverted and applied, is delivered each time the chain head changes. The
+// channel is closed when ctx is done.
+func (api *API) ChainNotify(ctx context.Context) <-chan *core.HeadChange {
+	return api.headChanges.Subscribe(ctx)
+}
+
 // ChainSampleRandomness produces a slice of random bytes sampled from a TipSet
 // in the blockchain at a given height, useful for things like PoSt challenge seed
 // generation.
@@ -175,6 +189,12 @@ func (api *API) OutboxQueueClear(sender address.Address) {
 	api.outbox.Clear(sender)
 }
 
+// MiningAttempts returns the recorded mining attempts of the miner, oldest
+// first.
+func (api *API) MiningAttempts(minerAddr address.Address) ([]*mining.Attempt, error) {
+	return api.miningHist.Attempts(minerAddr)
+}
+
 // MessagePoolPending lists messages un-mined in the pool
 func (api *API) MessagePoolPending() []*types.SignedMessage {
 	return api.msgPool.Pending()
@@ -212,6 +232,20 @@ func (api *API) MessageSend(ctx context.Context, from, to address.Address, value
 	return api.msgSender.Send(ctx, from, to, value, gasPrice, gasLimit, method, params...)
 }
 
+// MessageReplace re-sends an outbound message that has not been mined with a new gas price and
+// limit, in place of the original. The gas price must be high enough for message pools to replace
+// the original by fee.
+func (api *API) MessageReplace(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return api.msgSender.Replace(ctx, msgCid, gasPrice, gasLimit)
+}
+
+// MessageCancel cancels an outbound message that has not been mined by sending an empty message
+// from its sender to itself with the same nonce. The gas price must be high enough for message
+// pools to replace the original by fee.
+func (api *API) MessageCancel(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return api.msgSender.Cancel(ctx, msgCid, gasPrice, gasLimit)
+}
+
 // MessageFind returns a message and receipt from the blockchain, if it exists.
 func (api *API) MessageFind(ctx context.Context, msgCid cid.Cid) (*msg.ChainMessage, bool, error) {
 	return api.msgWaiter.Find(ctx, msgCid)
@@ -256,6 +290,11 @@ func (api *API) NetworkFindProvidersAsync(ctx context.Context, key cid.Cid, coun
 	return api.network.Router.FindProvidersAsync(ctx, key, count)
 }
 
+// NetworkProvide announces to the filecoin network content router that the node can provide key.
+func (api *API) NetworkProvide(ctx context.Context, key cid.Cid) error {
+	return api.network.Router.Provide(ctx, key)
+}
+
 // NetworkGetClosestPeers issues a getClosestPeers query to the filecoin network.
 func (api *API) NetworkGetClosestPeers(ctx context.Context, key string) (<-chan peer.ID, error) {
 	return api.network.GetClosestPeers(ctx, key)
@@ -281,6 +320,16 @@ func (api *API) NetworkPeers(ctx context.Context, verbose, latency, streams bool
 	return api.network.Peers(ctx, verbose, latency, streams)
 }
 
+// NetworkReportPeer records misbehavior by a peer, which may get it banned.
+func (api *API) NetworkReportPeer(p peer.ID, offense net.Offense, reason string) {
+	api.network.ReportPeer(p, offense, reason)
+}
+
+// NetworkBans lists the peers currently banned for misbehaving.
+func (api *API) NetworkBans() []net.BanInfo {
+	return api.network.Bans()
+}
+
 // SignBytes uses private key information associated with the given address to sign the given bytes.
 func (api *API) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
 	return api.wallet.SignBytes(data, addr)
@@ -95,40 +95,82 @@ func (s *Sender) Send(ctx context.Context, from, to address.Address, value *type
 	s.l.Lock()
 	defer s.l.Unlock()
 
-	headTs := s.chainState.GetHead()
-	tsas, err := s.chainState.GetTipSetAndState(headTs)
+	fromActor, err := s.headActor(ctx, from)
 	if err != nil {
-		return cid.Undef, errors.Wrap(err, "couldnt get latest state root")
+		return cid.Undef, err
 	}
-	st, err := state.LoadStateTree(ctx, s.cst, tsas.TipSetStateRoot, builtin.Actors)
+
+	nonce, err := nextNonce(fromActor, s.outbox, from)
 	if err != nil {
-		return cid.Undef, errors.Wrap(err, "failed to load state from chain")
+		return cid.Undef, errors.Wrapf(err, "failed calculating nonce for actor %s", from)
 	}
 
-	fromActor, err := st.GetActor(ctx, from)
+	msg := types.NewMessage(from, to, nonce, value, method, encodedParams)
+	smsg, err := s.sign(ctx, msg, fromActor, gasPrice, gasLimit)
 	if err != nil {
-		return cid.Undef, errors.Wrapf(err, "no actor at address %s", from)
+		return cid.Undef, err
 	}
 
-	nonce, err := nextNonce(fromActor, s.outbox, from)
+	height, err := s.blockTimer.BlockHeight()
 	if err != nil {
-		return cid.Undef, errors.Wrapf(err, "failed calculating nonce for actor %s", from)
+		return cid.Undef, errors.Wrap(err, "failed to get block height")
 	}
 
-	msg := types.NewMessage(from, to, nonce, value, method, encodedParams)
-	smsg, err := types.NewSignedMessage(*msg, s.signer, gasPrice, gasLimit)
+	// Add to the local message queue/pool at the last possible moment before broadcasting to network.
+	if err := s.outbox.Enqueue(smsg, height); err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to add message to outbound queue")
+	}
+	if _, err := s.inbox.Add(ctx, smsg); err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to add message to message pool")
+	}
+
+	if err = s.publishMessage(smsg); err != nil {
+		return cid.Undef, err
+	}
+
+	log.Debugf("MessageSend with message: %s", smsg)
+	return smsg.Cid()
+}
+
+// Replace re-sends the outbound message with the given CID with a new gas price and limit. The
+// replacement has the same nonce, so at most one of them is mined. Its gas price must be high
+// enough for the message pool to replace the original by fee.
+func (s *Sender) Replace(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	queued, err := s.findQueued(msgCid)
 	if err != nil {
-		return cid.Undef, errors.Wrap(err, "failed to sign message")
+		return cid.Undef, err
 	}
+	return s.replace(ctx, &queued.Message, gasPrice, gasLimit)
+}
 
-	err = s.validator.Validate(ctx, smsg, fromActor)
+// Cancel replaces the outbound message with the given CID by a message sending nothing from the
+// sender to itself with the same nonce, so the original message can't be mined. The gas price
+// must be high enough for the message pool to replace the original by fee.
+func (s *Sender) Cancel(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	queued, err := s.findQueued(msgCid)
 	if err != nil {
-		return cid.Undef, errors.Wrap(err, "invalid message")
+		return cid.Undef, err
 	}
+	msg := types.NewMessage(queued.From, queued.From, uint64(queued.Nonce), types.NewZeroAttoFIL(), "", nil)
+	return s.replace(ctx, msg, gasPrice, gasLimit)
+}
 
-	smsgdata, err := smsg.Marshal()
+// replace signs the message, which has the nonce of a queued message, and replaces the queued
+// message and its copy in the message pool with it. The caller must hold the lock.
+func (s *Sender) replace(ctx context.Context, msg *types.Message, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	fromActor, err := s.headActor(ctx, msg.From)
+	if err != nil {
+		return cid.Undef, err
+	}
+	smsg, err := s.sign(ctx, msg, fromActor, gasPrice, gasLimit)
 	if err != nil {
-		return cid.Undef, errors.Wrap(err, "failed to marshal message")
+		return cid.Undef, err
 	}
 
 	height, err := s.blockTimer.BlockHeight()
@@ -136,22 +178,83 @@ func (s *Sender) Send(ctx context.Context, from, to address.Address, value *type
 		return cid.Undef, errors.Wrap(err, "failed to get block height")
 	}
 
-	// Add to the local message queue/pool at the last possible moment before broadcasting to network.
-	if err := s.outbox.Enqueue(smsg, height); err != nil {
-		return cid.Undef, errors.Wrap(err, "failed to add message to outbound queue")
-	}
+	// The pool checks the replacement pays enough more, so add it there first.
 	if _, err := s.inbox.Add(ctx, smsg); err != nil {
 		return cid.Undef, errors.Wrap(err, "failed to add message to message pool")
 	}
+	if _, err := s.outbox.Replace(smsg, height); err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to replace message in outbound queue")
+	}
 
-	if err = s.publish(Topic, smsgdata); err != nil {
-		return cid.Undef, errors.Wrap(err, "failed to publish message to network")
+	if err = s.publishMessage(smsg); err != nil {
+		return cid.Undef, err
 	}
 
-	log.Debugf("MessageSend with message: %s", smsg)
+	log.Debugf("MessageSend replaced message with: %s", smsg)
 	return smsg.Cid()
 }
 
+// findQueued returns the outbound message with the given CID.
+func (s *Sender) findQueued(msgCid cid.Cid) (*types.SignedMessage, error) {
+	for _, addr := range s.outbox.Queues() {
+		for _, qm := range s.outbox.List(addr) {
+			c, err := qm.Msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			if c.Equals(msgCid) {
+				return qm.Msg, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("message %s is not in the outbound queue", msgCid)
+}
+
+// headActor returns the actor at the address in the state of the head of the chain.
+func (s *Sender) headActor(ctx context.Context, addr address.Address) (*actor.Actor, error) {
+	headTs := s.chainState.GetHead()
+	tsas, err := s.chainState.GetTipSetAndState(headTs)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldnt get latest state root")
+	}
+	st, err := state.LoadStateTree(ctx, s.cst, tsas.TipSetStateRoot, builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load state from chain")
+	}
+
+	act, err := st.GetActor(ctx, addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "no actor at address %s", addr)
+	}
+	return act, nil
+}
+
+// sign signs the message and validates it for sending from the actor.
+func (s *Sender) sign(ctx context.Context, msg *types.Message, fromActor *actor.Actor, gasPrice types.AttoFIL, gasLimit types.GasUnits) (*types.SignedMessage, error) {
+	smsg, err := types.NewSignedMessage(*msg, s.signer, gasPrice, gasLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign message")
+	}
+
+	err = s.validator.Validate(ctx, smsg, fromActor)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid message")
+	}
+	return smsg, nil
+}
+
+// publishMessage broadcasts the message to the network.
+func (s *Sender) publishMessage(smsg *types.SignedMessage) error {
+	smsgdata, err := smsg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal message")
+	}
+	if err = s.publish(Topic, smsgdata); err != nil {
+		return errors.Wrap(err, "failed to publish message to network")
+	}
+	return nil
+}
+
 // nextNonce returns the next expected nonce value for an account actor. This is the larger
 // of the actor's nonce value, or one greater than the largest nonce from the actor found in the message pool.
 func nextNonce(act *actor.Actor, outbox *core.MessageQueue, address address.Address) (uint64, error) {
@@ -18,6 +18,7 @@ import (
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/wallet"
+	"github.com/ipfs/go-cid"
 	hamt "github.com/ipfs/go-hamt-ipld"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -124,6 +125,77 @@ func TestSend(t *testing.T) {
 	})
 }
 
+func TestReplaceAndCancel(t *testing.T) {
+	tf.UnitTest(t)
+
+	setup := func(require *require.Assertions) (*Sender, *core.MessageQueue, *core.MessagePool, address.Address, cid.Cid, *int) {
+		w, chainStore, cst := setupSendTest(require)
+		addr := w.Addresses()[0]
+		timer := testhelpers.NewTestMessagePoolAPI(1000)
+		queue := core.NewMessageQueue()
+		pool := core.NewMessagePool(timer, config.NewDefaultConfig().Mpool, testhelpers.NewMockMessagePoolValidator())
+		published := 0
+		publish := func(string, []byte) error {
+			published++
+			return nil
+		}
+
+		s := NewSender(w, chainStore, cst, timer, queue, pool, nullValidator{}, publish)
+		c, err := s.Send(context.Background(), addr, address.NewForTestGetter()(), types.NewAttoFILFromFIL(2), types.NewGasPrice(10), types.NewGasUnits(100), "")
+		require.NoError(err)
+		return s, queue, pool, addr, c, &published
+	}
+
+	t.Run("replace re-sends the message with a higher gas price", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		s, queue, pool, addr, c, published := setup(require)
+		original := queue.List(addr)[0].Msg
+
+		_, err := s.Replace(context.Background(), c, types.NewGasPrice(10), types.NewGasUnits(100))
+		assert.Error(err)
+
+		replaced, err := s.Replace(context.Background(), c, types.NewGasPrice(20), types.NewGasUnits(200))
+		require.NoError(err)
+		assert.Equal(2, *published)
+
+		require.Len(queue.List(addr), 1)
+		msg := queue.List(addr)[0].Msg
+		assert.Equal(original.Message, msg.Message)
+		price := types.NewGasPrice(20)
+		assert.True(price.Equal(&msg.GasPrice))
+		assert.Equal(types.NewGasUnits(200), msg.GasLimit)
+
+		require.Len(pool.Pending(), 1)
+		_, ok := pool.Get(replaced)
+		assert.True(ok)
+
+		_, err = s.Replace(context.Background(), c, types.NewGasPrice(30), types.NewGasUnits(200))
+		assert.Error(err)
+	})
+
+	t.Run("cancel sends nothing to the sender with the same nonce", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		s, queue, pool, addr, c, published := setup(require)
+		original := queue.List(addr)[0].Msg
+
+		canceled, err := s.Cancel(context.Background(), c, types.NewGasPrice(20), types.NewGasUnits(100))
+		require.NoError(err)
+		assert.Equal(2, *published)
+
+		require.Len(queue.List(addr), 1)
+		msg := queue.List(addr)[0].Msg
+		assert.Equal(addr, msg.To)
+		assert.Equal(original.Nonce, msg.Nonce)
+		assert.True(msg.Value.IsZero())
+
+		require.Len(pool.Pending(), 1)
+		_, ok := pool.Get(canceled)
+		assert.True(ok)
+	})
+}
+
 func TestNextNonce(t *testing.T) {
 	tf.UnitTest(t)
 
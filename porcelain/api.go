@@ -10,6 +10,7 @@ import (
 	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/mining"
 	"github.com/filecoin-project/go-filecoin/plumbing"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -64,6 +65,18 @@ func (a *API) MessagePoolWait(ctx context.Context, messageCount uint) ([]*types.
 	return MessagePoolWait(ctx, a, messageCount)
 }
 
+// MiningTemplate previews the messages the node would pack into the next
+// block it mines
+func (a *API) MiningTemplate(ctx context.Context) (*mining.BlockTemplate, error) {
+	return MiningTemplate(ctx, a)
+}
+
+// MiningStats returns the mining attempts of the miner, or of the default
+// miner if the address is empty, and the fate of the blocks it mined
+func (a *API) MiningStats(ctx context.Context, minerAddr address.Address) (*MiningStats, error) {
+	return MiningStats(ctx, a, minerAddr)
+}
+
 // MessageSendWithDefaultAddress calls MessageSend but with a default from
 // address if none is provided
 func (a *API) MessageSendWithDefaultAddress(
@@ -133,6 +146,21 @@ func (a *API) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (pe
 	return MinerGetPeerID(ctx, a, minerAddr)
 }
 
+// MinerGetPower queries for the power of the given miner
+func (a *API) MinerGetPower(ctx context.Context, minerAddr address.Address) (*big.Int, error) {
+	return MinerGetPower(ctx, a, minerAddr)
+}
+
+// MinerGetSectorCommitments queries for the commitments of the sectors of the given miner
+func (a *API) MinerGetSectorCommitments(ctx context.Context, minerAddr address.Address) (map[string]types.Commitments, error) {
+	return MinerGetSectorCommitments(ctx, a, minerAddr)
+}
+
+// MinerGetProvingPeriodStart queries for the start of the current proving period of the given miner
+func (a *API) MinerGetProvingPeriodStart(ctx context.Context, minerAddr address.Address) (*types.BlockHeight, error) {
+	return MinerGetProvingPeriodStart(ctx, a, minerAddr)
+}
+
 // MinerSetPrice configures the price of storage. See implementation for details.
 func (a *API) MinerSetPrice(ctx context.Context, from address.Address, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, price *types.AttoFIL, expiry *big.Int) (MinerSetPriceResponse, error) {
 	return MinerSetPrice(ctx, a, from, miner, gasPrice, gasLimit, price, expiry)
@@ -3,7 +3,6 @@ package porcelain
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"math/big"
 
 	"github.com/ipfs/go-cid"
@@ -11,6 +10,7 @@ import (
 	"github.com/libp2p/go-libp2p-peer"
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
@@ -30,7 +30,9 @@ type mcAPI interface {
 }
 
 // MinerCreate creates a new miner actor for the given account and returns its address.
-// It will wait for the the actor to appear on-chain and add set the address to mining.minerAddress in the config.
+// It will wait for the the actor to appear on-chain and add the address to the node's miners
+// in the config: the first miner of a node is set to mining.minerAddress, the default miner,
+// and later ones are added to mining.minerAddresses.
 // TODO: add ability to pass in a KeyInfo to store for signing blocks.
 //       See https://github.com/filecoin-project/go-filecoin/issues/1843
 func MinerCreate(
@@ -55,14 +57,6 @@ func MinerCreate(
 		log.FinishWithErr(ctx, err)
 	}()
 
-	addr, err := plumbing.ConfigGet("mining.minerAddress")
-	if err != nil {
-		return nil, err
-	}
-	if (addr != address.Address{}) {
-		return nil, fmt.Errorf("can only have one miner per node")
-	}
-
 	pubKey, err := plumbing.WalletGetPubKeyForAddress(minerOwnerAddr)
 	if err != nil {
 		return nil, err
@@ -96,16 +90,37 @@ func MinerCreate(
 		return nil, err
 	}
 
-	if err = plumbing.ConfigSet("mining.minerAddress", minerAddr.String()); err != nil {
+	if err = addMinerToConfig(plumbing, minerAddr); err != nil {
 		return nil, err
 	}
 
 	return &minerAddr, nil
 }
 
+// addMinerToConfig makes the miner the node's default miner if it has none,
+// and adds it to the node's other miners otherwise.
+func addMinerToConfig(plumbing mcAPI, minerAddr address.Address) error {
+	defaultAddr, err := plumbing.ConfigGet("mining.minerAddress")
+	if err != nil {
+		return err
+	}
+	if defaultAddr.(address.Address).Empty() {
+		return plumbing.ConfigSet("mining.minerAddress", minerAddr.String())
+	}
+
+	minerAddrs, err := plumbing.ConfigGet("mining.minerAddresses")
+	if err != nil {
+		return err
+	}
+	jsonAddrs, err := json.Marshal(append(minerAddrs.([]address.Address), minerAddr))
+	if err != nil {
+		return errors.Wrap(err, "could not marshal miner addresses")
+	}
+	return plumbing.ConfigSet("mining.minerAddresses", string(jsonAddrs))
+}
+
 // mpcAPI is the subset of the plumbing.API that MinerPreviewCreate uses.
 type mpcAPI interface {
-	ConfigGet(dottedPath string) (interface{}, error)
 	MessagePreview(ctx context.Context, from, to address.Address, method string, params ...interface{}) (types.GasUnits, error)
 	NetworkGetPeerID() peer.ID
 	WalletDefaultAddress() (address.Address, error)
@@ -132,10 +147,6 @@ func MinerPreviewCreate(
 		pid = plumbing.NetworkGetPeerID()
 	}
 
-	if _, err := plumbing.ConfigGet("mining.minerAddress"); err != nil {
-		return types.NewGasUnits(0), fmt.Errorf("can only have one miner per node")
-	}
-
 	ctx = log.Start(ctx, "Node.CreateMiner")
 	defer func() {
 		log.FinishWithErr(ctx, err)
@@ -183,7 +194,7 @@ type MinerSetPriceResponse struct {
 	Price     *types.AttoFIL
 }
 
-// MinerSetPrice configures the price of storage, then sends an ask advertising that price and waits for it to be mined.
+// MinerSetPrice configures the price of storage of the miner, then sends an ask advertising that price and waits for it to be mined.
 // If minerAddr is empty, the default miner will be used.
 // This method is non-transactional in the sense that it will set the price whether or not it creates the ask successfully.
 func MinerSetPrice(ctx context.Context, plumbing mspAPI, from address.Address, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, price *types.AttoFIL, expiry *big.Int) (MinerSetPriceResponse, error) {
@@ -210,7 +221,7 @@ func MinerSetPrice(ctx context.Context, plumbing mspAPI, from address.Address, m
 	if err != nil {
 		return res, errors.New("Could not marshal price")
 	}
-	if err := plumbing.ConfigSet("mining.storagePrice", string(jsonPrice)); err != nil {
+	if err := plumbing.ConfigSet("mining.storagePrices."+miner.String(), string(jsonPrice)); err != nil {
 		return res, err
 	}
 
@@ -260,7 +271,7 @@ func MinerPreviewSetPrice(ctx context.Context, plumbing mpspAPI, from address.Ad
 	if err != nil {
 		return types.NewGasUnits(0), errors.New("Could not marshal price")
 	}
-	if err := plumbing.ConfigSet("mining.storagePrice", string(jsonPrice)); err != nil {
+	if err := plumbing.ConfigSet("mining.storagePrices."+miner.String(), string(jsonPrice)); err != nil {
 		return types.NewGasUnits(0), err
 	}
 
@@ -343,3 +354,57 @@ func MinerGetPeerID(ctx context.Context, plumbing mgpidAPI, minerAddr address.Ad
 	}
 	return pid, nil
 }
+
+// mgscAPI is the subset of the plumbing.API that MinerGetSectorCommitments uses.
+type mgscAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error)
+}
+
+// MinerGetSectorCommitments queries for the commitments of the sectors of the given miner, by sector id
+func MinerGetSectorCommitments(ctx context.Context, plumbing mgscAPI, minerAddr address.Address) (map[string]types.Commitments, error) {
+	res, err := plumbing.MessageQuery(ctx, address.Undef, minerAddr, "getSectorCommitments")
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := abi.Deserialize(res[0], abi.CommitmentsMap)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode sector commitments")
+	}
+	commitments, ok := val.Val.(map[string]types.Commitments)
+	if !ok {
+		return nil, errors.New("sector commitments have the wrong type")
+	}
+	return commitments, nil
+}
+
+// mgppsAPI is the subset of the plumbing.API that MinerGetProvingPeriodStart uses.
+type mgppsAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error)
+}
+
+// MinerGetProvingPeriodStart queries for the start of the current proving period of the given miner.
+// The miner must submit a PoSt before the period ends, ProvingPeriodBlocks after its start.
+func MinerGetProvingPeriodStart(ctx context.Context, plumbing mgppsAPI, minerAddr address.Address) (*types.BlockHeight, error) {
+	res, err := plumbing.MessageQuery(ctx, address.Undef, minerAddr, "getProvingPeriodStart")
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewBlockHeightFromBytes(res[0]), nil
+}
+
+// mgpAPI is the subset of the plumbing.API that MinerGetPower uses.
+type mgpAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error)
+}
+
+// MinerGetPower queries for the power of the given miner, in sectors
+func MinerGetPower(ctx context.Context, plumbing mgpAPI, minerAddr address.Address) (*big.Int, error) {
+	res, err := plumbing.MessageQuery(ctx, address.Undef, minerAddr, "getPower")
+	if err != nil {
+		return nil, err
+	}
+
+	return big.NewInt(0).SetBytes(res[0]), nil
+}
@@ -10,6 +10,7 @@ import (
 	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/libp2p/go-libp2p-peer"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
@@ -104,6 +105,41 @@ func TestMinerCreate(t *testing.T) {
 		)
 		require.NoError(err)
 		assert.Equal(expectedAddress, *addr)
+
+		defaultAddr, err := plumbing.ConfigGet("mining.minerAddress")
+		require.NoError(err)
+		assert.Equal(expectedAddress, defaultAddr)
+	})
+
+	t.Run("adds miners after the first to the other miners", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ctx := context.Background()
+		newAddr := address.NewForTestGetter()
+		defaultAddress, expectedAddress := newAddr(), newAddr()
+		plumbing := newMinerCreate(assert, require, false, expectedAddress)
+		require.NoError(plumbing.ConfigSet("mining.minerAddress", defaultAddress.String()))
+
+		addr, err := MinerCreate(
+			ctx,
+			plumbing,
+			address.Address{},
+			types.NewGasPrice(0),
+			types.NewGasUnits(100),
+			1,
+			"",
+			types.NewAttoFILFromFIL(1),
+		)
+		require.NoError(err)
+		assert.Equal(expectedAddress, *addr)
+
+		defaultAddr, err := plumbing.ConfigGet("mining.minerAddress")
+		require.NoError(err)
+		assert.Equal(defaultAddress, defaultAddr)
+		minerAddrs, err := plumbing.ConfigGet("mining.minerAddresses")
+		require.NoError(err)
+		assert.Equal([]address.Address{expectedAddress}, minerAddrs)
 	})
 
 	t.Run("failure to send", func(t *testing.T) {
@@ -288,15 +324,18 @@ func TestMinerSetPrice(t *testing.T) {
 
 		plumbing := newMinerSetPricePlumbing(assert, require)
 
+		minerAddr := address.NewForTestGetter()()
+		require.NoError(plumbing.config.Set("mining.minerAddress", minerAddr.String()))
+
 		ctx := context.Background()
 		price := types.NewAttoFILFromFIL(50)
 		_, err := MinerSetPrice(ctx, plumbing, address.Undef, address.Undef, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
 		require.NoError(err)
 
-		configPrice, err := plumbing.config.Get("mining.storagePrice")
+		configPrices, err := plumbing.config.Get("mining.storagePrices")
 		require.NoError(err)
 
-		assert.Equal(price, configPrice)
+		assert.Equal(map[string]*types.AttoFIL{minerAddr.String(): price}, configPrices)
 	})
 
 	t.Run("saves config and reports error when send fails", func(t *testing.T) {
@@ -308,14 +347,15 @@ func TestMinerSetPrice(t *testing.T) {
 
 		ctx := context.Background()
 		price := types.NewAttoFILFromFIL(50)
-		_, err := MinerSetPrice(ctx, plumbing, address.Undef, address.Undef, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
+		minerAddr := address.NewForTestGetter()()
+		_, err := MinerSetPrice(ctx, plumbing, address.Undef, minerAddr, types.NewGasPrice(0), types.NewGasUnits(0), price, big.NewInt(0))
 		require.Error(err)
 		assert.Contains(err.Error(), "Test error in MessageSend")
 
-		configPrice, err := plumbing.config.Get("mining.storagePrice")
+		configPrices, err := plumbing.config.Get("mining.storagePrices")
 		require.NoError(err)
 
-		assert.Equal(price, configPrice)
+		assert.Equal(map[string]*types.AttoFIL{minerAddr.String(): price}, configPrices)
 	})
 
 	t.Run("sends ask to specific miner when miner is given", func(t *testing.T) {
@@ -527,6 +567,67 @@ func TestMinerGetAsk(t *testing.T) {
 	assert.Equal(big.NewInt(4), ask.ID)
 }
 
+type minerGetSectorCommitmentsPlumbing struct {
+	commitments map[string]types.Commitments
+}
+
+func (mgop *minerGetSectorCommitmentsPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error) {
+	out, err := (&abi.Value{Type: abi.CommitmentsMap, Val: mgop.commitments}).Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{out}, nil
+}
+
+func TestMinerGetSectorCommitments(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	comms := types.Commitments{}
+	comms.CommR[0] = 7
+	plumbing := &minerGetSectorCommitmentsPlumbing{commitments: map[string]types.Commitments{"3": comms}}
+
+	commitments, err := MinerGetSectorCommitments(context.Background(), plumbing, address.TestAddress2)
+	require.NoError(err)
+	assert.Equal(map[string]types.Commitments{"3": comms}, commitments)
+}
+
+type minerGetProvingPeriodStartPlumbing struct{}
+
+func (mgop *minerGetProvingPeriodStartPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error) {
+	return [][]byte{types.NewBlockHeight(42).Bytes()}, nil
+}
+
+func TestMinerGetProvingPeriodStart(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start, err := MinerGetProvingPeriodStart(context.Background(), &minerGetProvingPeriodStartPlumbing{}, address.TestAddress2)
+	require.NoError(err)
+	assert.Equal(types.NewBlockHeight(42), start)
+}
+
+type minerGetPowerPlumbing struct{}
+
+func (mgop *minerGetPowerPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error) {
+	return [][]byte{big.NewInt(5).Bytes()}, nil
+}
+
+func TestMinerGetPower(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	power, err := MinerGetPower(context.Background(), &minerGetPowerPlumbing{}, address.TestAddress2)
+	require.NoError(err)
+	assert.Equal(big.NewInt(5), power)
+}
+
 func requirePeerID() peer.ID {
 	id, err := peer.IDB58Decode("QmWbMozPyW6Ecagtxq7SXBXXLY5BNdP1GwHB2WoZCKMvcb")
 	if err != nil {
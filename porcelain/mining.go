@@ -0,0 +1,168 @@
+package porcelain
+
+import (
+	"context"
+	"math"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/mining"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// The subset of plumbing used by MiningTemplate
+type mtPlumbing interface {
+	ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error)
+	MessagePoolPending() []*types.SignedMessage
+}
+
+// MiningTemplate previews the messages the node would pack into the next block
+// it mines on the current head.
+func MiningTemplate(ctx context.Context, plumbing mtPlumbing) (*mining.BlockTemplate, error) {
+	tb := mining.NewTemplateBuilder(types.BlockGasLimit, mining.DefaultMaxBlockMessages)
+	return tb.Build(ctx, plumbing.ActorGet, plumbing.MessagePoolPending())
+}
+
+// BlockStatus tells whether a mined block made it into the chain.
+type BlockStatus string
+
+const (
+	// BlockCanonical is the status of blocks in the chain.
+	BlockCanonical = BlockStatus("canonical")
+	// BlockOrphaned is the status of blocks the chain grew past without.
+	BlockOrphaned = BlockStatus("orphaned")
+	// BlockPending is the status of blocks higher than the chain head.
+	BlockPending = BlockStatus("pending")
+)
+
+// MiningAttempt is a mining attempt of a miner along with what became of the
+// block it mined, if it won.
+type MiningAttempt struct {
+	*mining.Attempt
+	// Status is empty if the attempt didn't mine a block.
+	Status BlockStatus `json:"status,omitempty"`
+	// Reward is the block reward and the gas fees the block earned if it is
+	// in the chain.
+	Reward *types.AttoFIL `json:"reward,omitempty"`
+}
+
+// MiningStats summarizes the mining attempts of a miner.
+type MiningStats struct {
+	Miner    address.Address `json:"miner"`
+	Attempts int             `json:"attempts"`
+	Wins     int             `json:"wins"`
+	// ExpectedWins is the number of wins the miner could expect from its
+	// fraction of the storage power at each attempt.
+	ExpectedWins float64          `json:"expectedWins"`
+	Canonical    int              `json:"canonical"`
+	Orphaned     int              `json:"orphaned"`
+	Pending      int              `json:"pending"`
+	Rewards      *types.AttoFIL   `json:"rewards"`
+	History      []*MiningAttempt `json:"history"`
+}
+
+// The subset of plumbing used by MiningStats
+type msPlumbing interface {
+	ChainHead() (*types.TipSet, error)
+	ChainLs(ctx context.Context) (*chain.TipsetIterator, error)
+	ConfigGet(dottedPath string) (interface{}, error)
+	MiningAttempts(minerAddr address.Address) ([]*mining.Attempt, error)
+}
+
+// MiningStats returns the mining attempts of the miner, or of the node's
+// default miner if the address is empty, and whether the blocks it mined
+// ended up in the chain.
+func MiningStats(ctx context.Context, plumbing msPlumbing, minerAddr address.Address) (*MiningStats, error) {
+	if minerAddr.Empty() {
+		minerValue, err := plumbing.ConfigGet("mining.minerAddress")
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get miner address in config")
+		}
+		var ok bool
+		if minerAddr, ok = minerValue.(address.Address); !ok || minerAddr.Empty() {
+			return nil, errors.New("node has no miner")
+		}
+	}
+
+	attempts, err := plumbing.MiningAttempts(minerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &MiningStats{Miner: minerAddr, Rewards: types.NewZeroAttoFIL()}
+	minHeight := uint64(math.MaxUint64)
+	for _, a := range attempts {
+		stats.Attempts++
+		stats.ExpectedWins += a.ExpectedWins()
+		if a.Won {
+			stats.Wins++
+		}
+		if a.Block.Defined() && a.Height < minHeight {
+			minHeight = a.Height
+		}
+	}
+
+	head, err := plumbing.ChainHead()
+	if err != nil {
+		return nil, err
+	}
+	headHeight, err := head.Height()
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the blocks of the chain down to the lowest block the miner mined.
+	chainBlocks := make(map[cid.Cid]*types.Block)
+	if minHeight <= headHeight {
+		iter, err := plumbing.ChainLs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for ; !iter.Complete(); err = iter.Next() {
+			if err != nil {
+				return nil, err
+			}
+			ts := iter.Value()
+			for _, blk := range ts {
+				chainBlocks[blk.Cid()] = blk
+			}
+			if height, err := ts.Height(); err != nil || height <= minHeight {
+				break
+			}
+		}
+	}
+
+	blockReward := consensus.NewDefaultBlockRewarder().BlockRewardAmount()
+	for _, a := range attempts {
+		ma := &MiningAttempt{Attempt: a}
+		stats.History = append(stats.History, ma)
+		if !a.Block.Defined() {
+			continue
+		}
+
+		if blk, ok := chainBlocks[a.Block]; ok {
+			ma.Status = BlockCanonical
+			ma.Reward = blockReward
+			for _, receipt := range blk.MessageReceipts {
+				if receipt.GasAttoFIL != nil {
+					ma.Reward = ma.Reward.Add(receipt.GasAttoFIL)
+				}
+			}
+			stats.Canonical++
+			stats.Rewards = stats.Rewards.Add(ma.Reward)
+		} else if a.Height > headHeight {
+			ma.Status = BlockPending
+			stats.Pending++
+		} else {
+			ma.Status = BlockOrphaned
+			stats.Orphaned++
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,109 @@
+package porcelain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/mining"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type miningStatsPlumbing struct {
+	minerAddr address.Address
+	head      types.TipSet
+	blocks    map[cid.Cid]*types.Block
+	attempts  []*mining.Attempt
+}
+
+func (p *miningStatsPlumbing) ChainHead() (*types.TipSet, error) {
+	return &p.head, nil
+}
+
+func (p *miningStatsPlumbing) ChainLs(ctx context.Context) (*chain.TipsetIterator, error) {
+	return chain.IterAncestors(ctx, p, p.head), nil
+}
+
+func (p *miningStatsPlumbing) GetBlock(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	blk, ok := p.blocks[c]
+	if !ok {
+		return nil, errors.Errorf("no block %s", c)
+	}
+	return blk, nil
+}
+
+func (p *miningStatsPlumbing) ConfigGet(dottedPath string) (interface{}, error) {
+	return p.minerAddr, nil
+}
+
+func (p *miningStatsPlumbing) MiningAttempts(minerAddr address.Address) ([]*mining.Attempt, error) {
+	if minerAddr != p.minerAddr {
+		return nil, nil
+	}
+	return p.attempts, nil
+}
+
+func TestMiningStats(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	genesis := &types.Block{StateRoot: types.SomeCid()}
+	canonical := &types.Block{
+		Height:          1,
+		Parents:         types.NewSortedCidSet(genesis.Cid()),
+		StateRoot:       types.SomeCid(),
+		MessageReceipts: []*types.MessageReceipt{{GasAttoFIL: types.NewAttoFILFromFIL(2)}},
+	}
+	orphan := &types.Block{Height: 1, Parents: types.NewSortedCidSet(genesis.Cid()), StateRoot: types.SomeCid()}
+	pending := &types.Block{Height: 3, Parents: types.NewSortedCidSet(canonical.Cid()), StateRoot: types.SomeCid()}
+
+	minerAddr := address.NewForTestGetter()()
+	plumbing := &miningStatsPlumbing{
+		minerAddr: minerAddr,
+		head:      th.RequireNewTipSet(require, canonical),
+		blocks: map[cid.Cid]*types.Block{
+			genesis.Cid():   genesis,
+			canonical.Cid(): canonical,
+		},
+		attempts: []*mining.Attempt{
+			{Miner: minerAddr, Height: 1, Won: true, Block: orphan.Cid(), MinerPower: 1, TotalPower: 2},
+			{Miner: minerAddr, Height: 1, Won: true, Block: canonical.Cid(), MinerPower: 1, TotalPower: 2},
+			{Miner: minerAddr, Height: 2, MinerPower: 1, TotalPower: 2},
+			{Miner: minerAddr, Height: 3, Won: true, Block: pending.Cid(), MinerPower: 1, TotalPower: 2},
+		},
+	}
+
+	stats, err := porcelain.MiningStats(ctx, plumbing, address.Undef)
+	require.NoError(err)
+
+	assert.Equal(minerAddr, stats.Miner)
+	assert.Equal(4, stats.Attempts)
+	assert.Equal(3, stats.Wins)
+	assert.Equal(2.0, stats.ExpectedWins)
+	assert.Equal(1, stats.Canonical)
+	assert.Equal(1, stats.Orphaned)
+	assert.Equal(1, stats.Pending)
+
+	reward := consensus.NewDefaultBlockRewarder().BlockRewardAmount().Add(types.NewAttoFILFromFIL(2))
+	assert.True(reward.Equal(stats.Rewards))
+
+	require.Len(stats.History, 4)
+	assert.Equal(porcelain.BlockOrphaned, stats.History[0].Status)
+	assert.Equal(porcelain.BlockCanonical, stats.History[1].Status)
+	assert.True(reward.Equal(stats.History[1].Reward))
+	assert.Equal(porcelain.BlockStatus(""), stats.History[2].Status)
+	assert.Equal(porcelain.BlockPending, stats.History[3].Status)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/mining"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -14,9 +15,9 @@ type MiningAPI struct {
 	addNewBlockFunc  func(context.Context, *types.Block) (err error)
 	chainReader      chain.ReadStore
 	mineDelay        time.Duration
-	startMiningFunc  func(context.Context) error
-	stopMiningFunc   func(context.Context)
-	createWorkerFunc func(ctx context.Context) (mining.Worker, error)
+	startMiningFunc  func(context.Context, ...address.Address) error
+	stopMiningFunc   func(context.Context, ...address.Address)
+	createWorkerFunc func(context.Context, address.Address) (mining.Worker, error)
 }
 
 // New creates a new MiningAPI instance with the provided deps
@@ -24,9 +25,9 @@ func New(
 	addNewBlockFunc func(context.Context, *types.Block) (err error),
 	chainReader chain.ReadStore,
 	blockMineDelay time.Duration,
-	startMiningFunc func(context.Context) error,
-	stopMiningfunc func(context.Context),
-	createWorkerFunc func(ctx context.Context) (mining.Worker, error),
+	startMiningFunc func(context.Context, ...address.Address) error,
+	stopMiningfunc func(context.Context, ...address.Address),
+	createWorkerFunc func(context.Context, address.Address) (mining.Worker, error),
 ) MiningAPI {
 	return MiningAPI{
 		addNewBlockFunc:  addNewBlockFunc,
@@ -38,15 +39,16 @@ func New(
 	}
 }
 
-// MiningOnce mines a single block in the given context, and returns the new block.
-func (a *MiningAPI) MiningOnce(ctx context.Context) (*types.Block, error) {
+// MiningOnce mines a single block for the given miner, or the node's default
+// miner if the address is empty, in the given context, and returns the new block.
+func (a *MiningAPI) MiningOnce(ctx context.Context, minerAddr address.Address) (*types.Block, error) {
 	tsas, err := a.chainReader.GetTipSetAndState(a.chainReader.GetHead())
 	if err != nil {
 		return nil, err
 	}
 	ts := tsas.TipSet
 
-	miningWorker, err := a.createWorkerFunc(ctx)
+	miningWorker, err := a.createWorkerFunc(ctx, minerAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -66,12 +68,14 @@ func (a *MiningAPI) MiningOnce(ctx context.Context) (*types.Block, error) {
 	return res.NewBlock, nil
 }
 
-// MiningStart calls the node's StartMining function
-func (a *MiningAPI) MiningStart(ctx context.Context) error {
-	return a.startMiningFunc(ctx)
+// MiningStart calls the node's StartMining function for the given miners, or
+// all the node's miners if none are given.
+func (a *MiningAPI) MiningStart(ctx context.Context, minerAddrs ...address.Address) error {
+	return a.startMiningFunc(ctx, minerAddrs...)
 }
 
-// MiningStop calls the node's StopMining function
-func (a *MiningAPI) MiningStop(ctx context.Context) {
-	a.stopMiningFunc(ctx)
+// MiningStop calls the node's StopMining function for the given miners, or
+// all the node's miners if none are given.
+func (a *MiningAPI) MiningStop(ctx context.Context, minerAddrs ...address.Address) {
+	a.stopMiningFunc(ctx, minerAddrs...)
 }
@@ -8,6 +8,7 @@ import (
 	req "github.com/stretchr/testify/require"
 	"testing"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/node"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 )
@@ -33,7 +34,7 @@ func TestAPI_MineOnce(t *testing.T) {
 	require.NoError(nd.Start(ctx))
 	defer nd.Stop(ctx)
 
-	blk, err := api.MiningOnce(ctx)
+	blk, err := api.MiningOnce(ctx, address.Undef)
 	require.Nil(err)
 	require.NotNil(blk)
 	assert.NotNil(blk.Ticket)
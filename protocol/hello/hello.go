@@ -14,11 +14,13 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	fcnet "github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
 func init() {
 	cbor.RegisterCborType(Message{})
+	cbor.RegisterCborType(ProtocolVersions{})
 }
 
 // Protocol is the libp2p protocol identifier for the hello protocol.
@@ -26,15 +28,67 @@ const protocol = "/fil/hello/1.0.0"
 
 var log = logging.Logger("/fil/hello")
 
+// Role is the part a node plays in the network.
+type Role uint64
+
+const (
+	// RoleClient is a node that only follows the chain and makes deals.
+	RoleClient Role = iota
+	// RoleMiner is a node with a configured miner.
+	RoleMiner
+	// RoleRelay is a node acting as a libp2p relay.
+	RoleRelay
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleClient:
+		return "client"
+	case RoleMiner:
+		return "miner"
+	case RoleRelay:
+		return "relay"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint64(r))
+	}
+}
+
+// ProtocolVersions are the versions of the protocols a node speaks.
+type ProtocolVersions struct {
+	Sync      uint64
+	Storage   uint64
+	Retrieval uint64
+}
+
+// CurrentVersions are the protocol versions spoken by this node. Peers that do
+// not speak our sync protocol version are disconnected.
+var CurrentVersions = ProtocolVersions{
+	Sync:      1,
+	Storage:   1,
+	Retrieval: 1,
+}
+
 // Message is the data structure of a single message in the hello protocol.
 type Message struct {
 	HeaviestTipSetCids   []cid.Cid
 	HeaviestTipSetHeight uint64
-	GenesisHash          cid.Cid
-	CommitSha            string
+	// HeaviestTipSetParentWeight is the parent weight of the heaviest tipset.
+	HeaviestTipSetParentWeight uint64
+	GenesisHash                cid.Cid
+	CommitSha                  string
+	NetworkName                string
+	Role                       Role
+	Versions                   ProtocolVersions
 }
 
-type syncCallback func(from peer.ID, cids []cid.Cid, height uint64)
+type syncCallback func(from peer.ID, cids []cid.Cid, height uint64, weight uint64)
+
+type getRoleFunc func() Role
+
+// peerReporter is used to report peers that misbehave in the protocol.
+type peerReporter interface {
+	NetworkReportPeer(p peer.ID, offense fcnet.Offense, reason string)
+}
 
 type getTipSetFunc func() (*types.TipSet, error)
 
@@ -54,18 +108,25 @@ type Handler struct {
 	// for filling out our hello messages.
 	getHeaviestTipSet getTipSetFunc
 
+	// getRole is used to retrieve the current role of this node.
+	getRole getRoleFunc
+
+	reporter peerReporter
+
 	net       string
 	commitSha string
 }
 
 // New creates a new instance of the hello protocol and registers it to
 // the given host, with the provided callbacks.
-func New(h host.Host, gen cid.Cid, syncCallback syncCallback, getHeaviestTipSet getTipSetFunc, net string, commitSha string) *Handler {
+func New(h host.Host, gen cid.Cid, syncCallback syncCallback, getHeaviestTipSet getTipSetFunc, getRole getRoleFunc, reporter peerReporter, net string, commitSha string) *Handler {
 	hello := &Handler{
 		host:              h,
 		genesis:           gen,
 		chainSyncCB:       syncCallback,
 		getHeaviestTipSet: getHeaviestTipSet,
+		getRole:           getRole,
+		reporter:          reporter,
 		net:               net,
 		commitSha:         commitSha,
 	}
@@ -85,10 +146,15 @@ func (h *Handler) handleNewStream(s net.Stream) {
 	var hello Message
 	if err := cbu.NewMsgReader(s).ReadMsg(&hello); err != nil {
 		log.Warningf("bad hello message from peer %s: %s", from, err)
+		h.reporter.NetworkReportPeer(from, fcnet.OffenseProtocolError, "bad hello message")
 		return
 	}
 
 	switch err := h.processHelloMessage(from, &hello); err {
+	case ErrWrongNetwork:
+		log.Warningf("peer is on network %q, daemon is on network %q, disconnecting from peer: %s", hello.NetworkName, h.net, from)
+		s.Conn().Close() // nolint: errcheck
+		return
 	case ErrBadGenesis:
 		log.Warningf("genesis cid: %s does not match: %s, disconnecting from peer: %s", &hello.GenesisHash, h.genesis, from)
 		s.Conn().Close() // nolint: errcheck
@@ -97,6 +163,10 @@ func (h *Handler) handleNewStream(s net.Stream) {
 		log.Errorf("code not at same version: peer has version %s, daemon has version %s, disconnecting from peer: %s", hello.CommitSha, h.commitSha, from)
 		s.Conn().Close() // nolint: errcheck
 		return
+	case ErrIncompatibleSync:
+		log.Warningf("peer speaks sync protocol version %d, daemon speaks version %d, disconnecting from peer: %s", hello.Versions.Sync, CurrentVersions.Sync, from)
+		s.Conn().Close() // nolint: errcheck
+		return
 	case nil: // ok, noop
 	default:
 		log.Error(err)
@@ -109,15 +179,31 @@ var ErrBadGenesis = fmt.Errorf("bad genesis block")
 // ErrWrongVersion is the error returned when a mismatch in the code version happens.
 var ErrWrongVersion = fmt.Errorf("code version mismatch")
 
+// ErrWrongNetwork is the error returned when a peer is on a different network.
+var ErrWrongNetwork = fmt.Errorf("network name mismatch")
+
+// ErrIncompatibleSync is the error returned when a peer speaks a different
+// version of the sync protocol.
+var ErrIncompatibleSync = fmt.Errorf("sync protocol version mismatch")
+
 func (h *Handler) processHelloMessage(from peer.ID, msg *Message) error {
+	// Check the network first: nodes of other networks also have another
+	// genesis block, and the network name gives the clearer reason.
+	if msg.NetworkName != h.net {
+		return ErrWrongNetwork
+	}
 	if !msg.GenesisHash.Equals(h.genesis) {
 		return ErrBadGenesis
 	}
 	if (h.net == "devnet-test" || h.net == "devnet-user") && msg.CommitSha != h.commitSha {
 		return ErrWrongVersion
 	}
+	if msg.Versions.Sync != CurrentVersions.Sync {
+		return ErrIncompatibleSync
+	}
 
-	h.chainSyncCB(from, msg.HeaviestTipSetCids, msg.HeaviestTipSetHeight)
+	log.Debugf("hello from %s peer %s at height %d", msg.Role, from, msg.HeaviestTipSetHeight)
+	h.chainSyncCB(from, msg.HeaviestTipSetCids, msg.HeaviestTipSetHeight, msg.HeaviestTipSetParentWeight)
 	return nil
 }
 
@@ -130,12 +216,20 @@ func (h *Handler) getOurHelloMessage() *Message {
 	if err != nil {
 		panic("somehow heaviest tipset is empty")
 	}
+	weight, err := heaviest.ParentWeight()
+	if err != nil {
+		panic("somehow heaviest tipset is empty")
+	}
 
 	return &Message{
-		GenesisHash:          h.genesis,
-		HeaviestTipSetCids:   heaviest.ToSortedCidSet().ToSlice(),
-		HeaviestTipSetHeight: height,
-		CommitSha:            h.commitSha,
+		GenesisHash:                h.genesis,
+		HeaviestTipSetCids:         heaviest.ToSortedCidSet().ToSlice(),
+		HeaviestTipSetHeight:       height,
+		HeaviestTipSetParentWeight: weight,
+		CommitSha:                  h.commitSha,
+		NetworkName:                h.net,
+		Role:                       h.getRole(),
+		Versions:                   CurrentVersions,
 	}
 }
 
@@ -168,6 +262,9 @@ func (hn *helloNotify) Connected(n net.Network, c net.Conn) {
 		p := c.RemotePeer()
 		if err := hn.hello().sayHello(ctx, p); err != nil {
 			log.Warningf("failed to send hello handshake to peer %s: %s", p, err)
+			if ctx.Err() == context.DeadlineExceeded {
+				hn.hello().reporter.NetworkReportPeer(p, fcnet.OffenseTimeout, "hello handshake timed out")
+			}
 		}
 	}()
 }
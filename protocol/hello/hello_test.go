@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/libp2p/go-libp2p-peer"
 	"github.com/libp2p/go-libp2p/p2p/net/mock"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	fcnet "github.com/filecoin-project/go-filecoin/net"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -22,10 +24,18 @@ type mockSyncCallback struct {
 	mock.Mock
 }
 
-func (msb *mockSyncCallback) SyncCallback(p peer.ID, cids []cid.Cid, h uint64) {
-	msb.Called(p, cids, h)
+func (msb *mockSyncCallback) SyncCallback(p peer.ID, cids []cid.Cid, h uint64, w uint64) {
+	msb.Called(p, cids, h, w)
 }
 
+func clientRole() Role {
+	return RoleClient
+}
+
+type nopReporter struct{}
+
+func (nopReporter) NetworkReportPeer(p peer.ID, offense fcnet.Offense, reason string) {}
+
 type mockHeaviestGetter struct {
 	heaviest types.TipSet
 }
@@ -56,11 +66,11 @@ func TestHelloHandshake(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg1, hg2 := &mockHeaviestGetter{heavy1}, &mockHeaviestGetter{heavy2}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, "", "")
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, "", "")
+	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, clientRole, nopReporter{}, "", "")
+	New(b, genesisA.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, clientRole, nopReporter{}, "", "")
 
-	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3)).Return()
-	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2)).Return()
+	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3), uint64(0)).Return()
+	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2), uint64(0)).Return()
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
@@ -111,11 +121,11 @@ func TestHelloBadGenesis(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg1, hg2 := &mockHeaviestGetter{heavy1}, &mockHeaviestGetter{heavy2}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, "", "")
-	New(b, genesisB.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, "", "")
+	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, clientRole, nopReporter{}, "", "")
+	New(b, genesisB.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, clientRole, nopReporter{}, "", "")
 
-	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
-	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
@@ -145,11 +155,11 @@ func TestHelloWrongVersion(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg := &mockHeaviestGetter{heavy}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg.getHeaviestTipSet, "devnet-user", "sha1")
-	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	New(a, genesisA.Cid(), msc1.SyncCallback, hg.getHeaviestTipSet, clientRole, nopReporter{}, "devnet-user", "sha1")
+	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg.getHeaviestTipSet, "devnet-user", "sha2")
-	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	New(b, genesisA.Cid(), msc2.SyncCallback, hg.getHeaviestTipSet, clientRole, nopReporter{}, "devnet-user", "sha2")
+	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
@@ -179,11 +189,11 @@ func TestHelloWrongVersionTestDevnet(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg := &mockHeaviestGetter{heavy}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg.getHeaviestTipSet, "devnet-test", "sha1")
-	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	New(a, genesisA.Cid(), msc1.SyncCallback, hg.getHeaviestTipSet, clientRole, nopReporter{}, "devnet-test", "sha1")
+	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg.getHeaviestTipSet, "devnet-test", "sha2")
-	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	New(b, genesisA.Cid(), msc2.SyncCallback, hg.getHeaviestTipSet, clientRole, nopReporter{}, "devnet-test", "sha2")
+	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
@@ -223,11 +233,11 @@ func TestHelloMultiBlock(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg1, hg2 := &mockHeaviestGetter{heavy1}, &mockHeaviestGetter{heavy2}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, "", "")
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, "", "")
+	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, clientRole, nopReporter{}, "", "")
+	New(b, genesisA.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, clientRole, nopReporter{}, "", "")
 
-	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3)).Return()
-	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2)).Return()
+	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3), uint64(0)).Return()
+	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2), uint64(0)).Return()
 
 	assert.NoError(t, mn.LinkAll())
 	assert.NoError(t, mn.ConnectAllButSelf())
@@ -237,3 +247,78 @@ func TestHelloMultiBlock(t *testing.T) {
 	msc1.AssertExpectations(t)
 	msc2.AssertExpectations(t)
 }
+
+func TestHelloWrongNetwork(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	mn, err := mocknet.WithNPeers(ctx, 2)
+	require.NoError(err)
+
+	a, b := mn.Hosts()[0], mn.Hosts()[1]
+
+	genesisA := &types.Block{Nonce: 451}
+
+	heavy := th.RequireNewTipSet(require, &types.Block{Nonce: 1000, Height: 2})
+
+	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
+	hg := &mockHeaviestGetter{heavy}
+
+	New(a, genesisA.Cid(), msc1.SyncCallback, hg.getHeaviestTipSet, clientRole, nopReporter{}, "devnet-user", "sha")
+	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	New(b, genesisA.Cid(), msc2.SyncCallback, hg.getHeaviestTipSet, clientRole, nopReporter{}, "devnet-test", "sha")
+	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	require.NoError(mn.LinkAll())
+	require.NoError(mn.ConnectAllButSelf())
+
+	time.Sleep(time.Millisecond * 50)
+
+	msc1.AssertNumberOfCalls(t, "SyncCallback", 0)
+	msc2.AssertNumberOfCalls(t, "SyncCallback", 0)
+}
+
+func TestHelloMessageContents(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	genesis := &types.Block{Nonce: 451}
+	head := &types.Block{Nonce: 1000, Height: 2, ParentWeight: 17}
+	hg := &mockHeaviestGetter{th.RequireNewTipSet(require, head)}
+
+	h := &Handler{
+		genesis:           genesis.Cid(),
+		getHeaviestTipSet: hg.getHeaviestTipSet,
+		getRole:           func() Role { return RoleMiner },
+		net:               "devnet-user",
+		commitSha:         "sha",
+	}
+
+	msg := h.getOurHelloMessage()
+	assert.Equal(uint64(2), msg.HeaviestTipSetHeight)
+	assert.Equal(uint64(17), msg.HeaviestTipSetParentWeight)
+	assert.Equal("devnet-user", msg.NetworkName)
+	assert.Equal(RoleMiner, msg.Role)
+	assert.Equal(CurrentVersions, msg.Versions)
+
+	t.Run("round trips through cbor", func(t *testing.T) {
+		data, err := cbor.DumpObject(msg)
+		require.NoError(err)
+
+		var decoded Message
+		require.NoError(cbor.DecodeInto(data, &decoded))
+		assert.Equal(*msg, decoded)
+	})
+
+	t.Run("rejects peers speaking another sync version", func(t *testing.T) {
+		other := *msg
+		other.Versions.Sync = CurrentVersions.Sync + 1
+		assert.Equal(ErrIncompatibleSync, h.processHelloMessage(peer.ID("p"), &other))
+	})
+}
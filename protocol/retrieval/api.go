@@ -7,7 +7,7 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-peer"
 
-	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // API here is the API for a retrieval client.
@@ -20,7 +20,15 @@ func NewAPI(rc *Client) API {
 	return API{rc: rc}
 }
 
-// RetrievePiece retrieves bytes referenced by CID pieceCID
-func (a *API) RetrievePiece(ctx context.Context, pieceCID cid.Cid, mpid peer.ID, minerAddr address.Address) (io.ReadCloser, error) {
-	return a.rc.RetrievePiece(ctx, mpid, pieceCID)
+// RetrievePiece retrieves bytes referenced by CID pieceCID from the miners with peer IDs
+// mpids, or length bytes of them from offset when either is set, paying at most
+// maxPrice per byte
+func (a *API) RetrievePiece(ctx context.Context, pieceCID cid.Cid, mpids []peer.ID, offset, length uint64, maxPrice *types.AttoFIL) (io.ReadCloser, error) {
+	return a.rc.RetrievePiece(ctx, mpids, pieceCID, offset, length, maxPrice)
+}
+
+// FindOffers finds up to count miners storing the piece with CID pieceCID and returns
+// their offers, cheapest first.
+func (a *API) FindOffers(ctx context.Context, pieceCID cid.Cid, count int) ([]*MinerOffer, error) {
+	return a.rc.FindOffers(ctx, pieceCID, count)
 }
@@ -1,20 +1,28 @@
 package retrieval
 
 import (
-	"bytes"
 	"context"
+	"fmt"
 	"io"
-	"io/ioutil"
+	"math/big"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
 	logging "github.com/ipfs/go-log"
 	host "github.com/libp2p/go-libp2p-host"
-	inet "github.com/libp2p/go-libp2p-net"
 	"github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	"github.com/libp2p/go-libp2p-protocol"
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // RetrievePieceChunkSize defines the size of piece-chunks to be sent from miner to client. The maximum size of readable
@@ -22,68 +30,513 @@ import (
 // succeed.
 const RetrievePieceChunkSize = 256 << 8
 
+// ChannelLifetime is the number of blocks the payment channels a client opens to pay
+// for retrievals last (about a day).
+const ChannelLifetime = 2880
+
+const createChannelGasPrice = 0
+const createChannelGasLimit = 300
+
+// clientPorcelainAPI is the subset of the porcelain API the Client uses.
+type clientPorcelainAPI interface {
+	ChainBlockHeight() (*types.BlockHeight, error)
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error)
+	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	NetworkFindProvidersAsync(ctx context.Context, key cid.Cid, count int) <-chan pstore.PeerInfo
+	types.Signer
+	WalletDefaultAddress() (address.Address, error)
+}
+
 // Client is a client interface to the retrieval market protocols.
 type Client struct {
 	host host.Host
+	api  clientPorcelainAPI
+	ds   repo.Datastore
 	log  logging.EventLogger
+
+	// channelsLk protects channelsInUse.
+	channelsLk sync.Mutex
+	// channelsInUse are the payment channels of ongoing retrievals. A channel pays
+	// for one retrieval at a time, so that its vouchers reach the miner in order.
+	channelsInUse map[string]bool
+
+	// segmentSize is the size of the largest segment retrieved from a miner at
+	// a time.
+	segmentSize uint64
+
+	// openStream opens a stream of the paid retrieval protocol to a miner.
+	openStream func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error)
+	// openQueryStream opens a stream of the retrieval query protocol to a miner.
+	openQueryStream func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error)
 }
 
 // NewClient produces a new Client.
-func NewClient(host host.Host, blockTime time.Duration) *Client {
-	return &Client{
-		host: host,
-		log:  logging.Logger("retrieval/client"),
+func NewClient(host host.Host, blockTime time.Duration, api clientPorcelainAPI, ds repo.Datastore) *Client {
+	sc := &Client{
+		host:          host,
+		api:           api,
+		ds:            ds,
+		log:           logging.Logger("retrieval/client"),
+		channelsInUse: make(map[string]bool),
+		segmentSize:   maxSegmentSize,
+	}
+	sc.openStream = func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error) {
+		return sc.newStream(ctx, minerPeerID, retrievalPaidProtocol)
+	}
+	sc.openQueryStream = func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error) {
+		return sc.newStream(ctx, minerPeerID, retrievalQueryProtocol)
 	}
+	return sc
 }
 
-// RetrievePiece connects to a miner and transfers a piece of content.
-func (sc *Client) RetrievePiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid) (io.ReadCloser, error) {
-	s, err := sc.host.NewStream(ctx, minerPeerID, retrievalFreeProtocol)
+func (sc *Client) newStream(ctx context.Context, minerPeerID peer.ID, pid protocol.ID) (io.ReadWriteCloser, error) {
+	s, err := sc.host.NewStream(ctx, minerPeerID, pid)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create stream to retrieval miner")
 	}
+	return s, nil
+}
+
+// MinerOffer is the offer of a miner found to store a piece.
+type MinerOffer struct {
+	PeerID peer.ID
+	Offer  *RetrievalOffer
+}
+
+// FindOffers looks up up to count providers of the piece on the network and asks
+// each of them for its offer, returning the offers of the miners that serve the
+// piece, cheapest first and then quickest to unseal it. Providers that don't answer
+// the query, such as peers that hold the piece's blocks without being miners, are
+// skipped.
+func (sc *Client) FindOffers(ctx context.Context, pieceCID cid.Cid, count int) ([]*MinerOffer, error) {
+	var offers []*MinerOffer
+	for pi := range sc.api.NetworkFindProvidersAsync(ctx, pieceCID, count) {
+		offer, err := sc.QueryMiner(ctx, pi.ID, pieceCID)
+		if err != nil {
+			log.Infof("no offer from %s for piece %s: %s", pi.ID.Pretty(), pieceCID.String(), err)
+			continue
+		}
+		offers = append(offers, &MinerOffer{PeerID: pi.ID, Offer: offer})
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(offers, func(i, j int) bool {
+		a, b := offers[i].Offer, offers[j].Offer
+		if !a.Price.Equal(b.Price) {
+			return a.Price.LessThan(b.Price)
+		}
+		return a.UnsealDelay < b.UnsealDelay
+	})
+	return offers, nil
+}
+
+// QueryMiner asks a miner for its offer for the piece over the retrieval query
+// protocol.
+func (sc *Client) QueryMiner(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid) (*RetrievalOffer, error) {
+	s, err := sc.openQueryStream(ctx, minerPeerID)
+	if err != nil {
+		return nil, err
+	}
 	defer sc.safeCloseStream(s)
 
-	streamReader := cbu.NewMsgReader(s)
+	if err := cbu.NewMsgWriter(s).WriteMsg(&RetrievalQuery{PieceRef: pieceCID}); err != nil {
+		return nil, errors.Wrap(err, "failed to send retrieval query")
+	}
+
+	var offer RetrievalOffer
+	if err := cbu.NewMsgReader(s).ReadMsg(&offer); err != nil {
+		return nil, errors.Wrap(err, "failed to read retrieval offer")
+	}
+	if offer.Status != Success {
+		return nil, fmt.Errorf("miner doesn't serve the piece: %s", offer.ErrorMessage)
+	}
+	if offer.Price == nil {
+		return nil, errors.New("miner sent an offer without a price")
+	}
+	return &offer, nil
+}
+
+// RetrievePiece retrieves a piece of content, or the length bytes of it from offset
+// (a zero length reads to the end of the piece), from miners storing the piece. The
+// range is split between the miners that serve the piece at a price per byte of at
+// most maxPrice, and the client pays each of them from a payment channel as their
+// part arrives. A nil maxPrice only accepts free retrievals.
+//
+// The bytes of the range are checked against the piece cid as they arrive, and the
+// returned reader fails as soon as a miner sends data that doesn't match. When a
+// transfer breaks, the client resumes it from the first byte it didn't receive, from
+// the same miner or another one.
+func (sc *Client) RetrievePiece(ctx context.Context, miners []peer.ID, pieceCID cid.Cid, offset, length uint64, maxPrice *types.AttoFIL) (io.ReadCloser, error) {
+	// Ask the miners for their offers first, to retrieve only from the ones that serve
+	// the piece at an acceptable price and to learn the size of the piece.
+	var serving []peer.ID
+	var pieceSize uint64
+	var queryErr error
+	for _, miner := range miners {
+		offer, err := sc.QueryMiner(ctx, miner, pieceCID)
+		if err == nil {
+			err = checkPrice(offer.Price, maxPrice)
+		}
+		if err != nil {
+			log.Infof("not retrieving piece %s from %s: %s", pieceCID.String(), miner.Pretty(), err)
+			if queryErr == nil {
+				queryErr = err
+			}
+			continue
+		}
+		serving = append(serving, miner)
+		pieceSize = offer.PieceSize
+	}
+	if len(serving) == 0 {
+		if queryErr == nil {
+			queryErr = errors.New("no miner to retrieve the piece from")
+		}
+		return nil, queryErr
+	}
 
-	req := RetrievePieceRequest{
+	req := &RetrievePieceRequest{
 		PieceRef: pieceCID,
+		Offset:   offset,
+		Length:   length,
+	}
+	end := req.rangeEnd()
+	if end > pieceSize {
+		end = pieceSize
 	}
 
-	if err := cbu.NewMsgWriter(s).WriteMsg(&req); err != nil {
-		return nil, errors.Wrap(err, "failed to write request message to stream")
+	r, w := io.Pipe()
+	segments := splitSegments(offset, end, len(serving), sc.segmentSize, w)
+	go func() {
+		w.CloseWithError(sc.retrieveSegments(ctx, serving, pieceCID, pieceSize, segments, maxPrice, w)) // nolint: errcheck
+	}()
+	return r, nil
+}
+
+// requestTerms sends the request to the miner and reads the terms it answers with,
+// which must have a price of at most maxPrice.
+func requestTerms(reader *cbu.MsgReader, writer *cbu.MsgWriter, req *RetrievePieceRequest, maxPrice *types.AttoFIL) (*RetrievalTerms, error) {
+	if err := writer.WriteMsg(req); err != nil {
+		return nil, transferError{errors.Wrap(err, "failed to write request message to stream")}
 	}
 
 	var res RetrievePieceResponse
-	if err := streamReader.ReadMsg(&res); err != nil {
-		return nil, errors.Wrap(err, "failed to read response message from stream")
+	if err := reader.ReadMsg(&res); err != nil {
+		return nil, transferError{errors.Wrap(err, "failed to read response message from stream")}
 	}
 
 	if res.Status != Success {
 		return nil, errors.Errorf("could not retrieve piece - error from miner: %s", res.ErrorMessage)
 	}
 
-	var buf []byte
-	for {
+	terms := res.Terms
+	if terms == nil || terms.Price == nil {
+		return nil, errors.New("miner sent no retrieval terms")
+	}
+	if err := checkPrice(terms.Price, maxPrice); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+// checkPrice checks that a price per byte is free or at most maxPrice.
+func checkPrice(price, maxPrice *types.AttoFIL) error {
+	if !price.IsZero() && (maxPrice == nil || price.GreaterThan(maxPrice)) {
+		return fmt.Errorf("miner asks %s per byte for the piece; use --max-price to accept it", price)
+	}
+	return nil
+}
+
+// receivePiece retrieves the range of the piece the request asks for over the paid
+// retrieval protocol, and writes the bytes of the range to w as the blocks holding
+// them arrive and check against the piece cid. It returns the number of bytes written.
+// Unless the piece is free, the client pays from the channel of payments: it opens the
+// payment with a voucher for what it already promised on the channel, then pays for
+// the bytes received every payment interval and at the end of the range. The piece
+// must have pieceSize bytes.
+func (sc *Client) receivePiece(ctx context.Context, rw io.ReadWriter, req *RetrievePieceRequest, pieceSize uint64, maxPrice *types.AttoFIL, payments *minerPayments, w io.Writer) (uint64, error) {
+	streamReader := cbu.NewMsgReader(rw)
+	streamWriter := cbu.NewMsgWriter(rw)
+
+	terms, err := requestTerms(streamReader, streamWriter, req, maxPrice)
+	if err != nil {
+		return 0, err
+	}
+	if terms.PieceSize != pieceSize {
+		return 0, fmt.Errorf("miner has a piece of %d bytes instead of %d", terms.PieceSize, pieceSize)
+	}
+
+	chunks := &chunkReader{
+		ctx:    ctx,
+		client: sc,
+		reader: streamReader,
+		writer: streamWriter,
+		terms:  terms,
+	}
+	if !terms.Price.IsZero() {
+		if err := sc.fundPayments(ctx, payments, terms, req.Length); err != nil {
+			return 0, errors.Wrap(err, "failed to open payment channel")
+		}
+		if err := sc.pay(ctx, streamWriter, payments.channel, types.ZeroAttoFIL, payments.msgCid); err != nil {
+			return 0, transferError{err}
+		}
+		chunks.channel = payments.channel
+	}
+
+	n, err := copyRange(req, pieceSize, chunks, w)
+	if n < payments.share {
+		payments.share -= n
+	} else {
+		payments.share = 0
+	}
+	return n, err
+}
+
+// minerPayments is the payment channel a client pays a miner from across the segments
+// of a retrieval.
+type minerPayments struct {
+	// share is the number of bytes of the range the client expects to retrieve from
+	// the miner but didn't yet.
+	share uint64
+
+	channel *ChannelRecord
+	// msgCid is the cid of the message that created the channel, if the client
+	// created it for the retrieval.
+	msgCid *cid.Cid
+	// funded is the amount up to which the client funded the channel for the
+	// retrieval.
+	funded *types.AttoFIL
+}
+
+// fundPayments makes sure the channel of payments has the funds to pay for a retrieval
+// on the terms, of a range of length bytes. When it doesn't, it releases the channel
+// and opens one funded for the rest of the miner's share, assuming each range of
+// length bytes of the share costs the same as this one.
+func (sc *Client) fundPayments(ctx context.Context, payments *minerPayments, terms *RetrievalTerms, length uint64) error {
+	cost := terms.Price.CalculatePrice(types.NewBytesAmount(terms.Size))
+	if payments.channel != nil && !payments.funded.Sub(payments.channel.Promised).LessThan(cost) {
+		return nil
+	}
+	sc.releasePayments(payments)
+
+	funds := cost
+	if length > 0 && payments.share > length {
+		ranges := (payments.share + length - 1) / length
+		funds = cost.MulBigInt(new(big.Int).SetUint64(ranges))
+	}
+
+	channel, msgCid, err := sc.openChannel(ctx, terms.PaymentAddress, funds)
+	if err != nil {
+		return err
+	}
+	payments.channel = channel
+	payments.msgCid = msgCid
+	payments.funded = channel.Promised.Add(funds)
+	return nil
+}
+
+// releasePayments releases the channel of payments, if any.
+func (sc *Client) releasePayments(payments *minerPayments) {
+	if payments.channel != nil {
+		sc.releaseChannel(payments.channel)
+		payments.channel = nil
+	}
+}
+
+// transferError is the error of a transfer that broke, which the client can resume.
+type transferError struct {
+	error
+}
+
+// chunkReader reads the data of the chunks a miner sends, paying for it every payment
+// interval and at the end of the data when it has a channel to pay from.
+type chunkReader struct {
+	ctx     context.Context
+	client  *Client
+	reader  *cbu.MsgReader
+	writer  *cbu.MsgWriter
+	terms   *RetrievalTerms
+	channel *ChannelRecord
+
+	buf      []byte
+	received uint64
+	paidFor  uint64
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.received == r.terms.Size {
+			return 0, io.EOF
+		}
+
 		var chunk RetrievePieceChunk
-		if err := streamReader.ReadMsg(&chunk); err != nil {
-			if err == io.EOF {
-				break
+		if err := r.reader.ReadMsg(&chunk); err != nil {
+			return 0, transferError{errors.Wrap(err, "could not read chunk from stream")}
+		}
+		if r.received+uint64(len(chunk.Data)) > r.terms.Size {
+			return 0, fmt.Errorf("miner sent more than the %d bytes of the retrieval", r.terms.Size)
+		}
+		r.buf = chunk.Data
+		r.received += uint64(len(chunk.Data))
+
+		if r.channel != nil && (r.received-r.paidFor >= r.terms.PaymentInterval || r.received == r.terms.Size) {
+			amount := r.terms.Price.CalculatePrice(types.NewBytesAmount(r.received - r.paidFor))
+			if err := r.client.pay(r.ctx, r.writer, r.channel, amount, nil); err != nil {
+				return 0, transferError{err}
+			}
+			r.paidFor = r.received
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// openChannel returns a payment channel to the target with funds of at least cost left,
+// reusing one of the channels the client opened before when possible. When it opens a
+// new channel, it also returns the cid of the message creating it.
+func (sc *Client) openChannel(ctx context.Context, target address.Address, cost *types.AttoFIL) (*ChannelRecord, *cid.Cid, error) {
+	payer, err := sc.api.WalletDefaultAddress()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	height, err := sc.api.ChainBlockHeight()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not get chain height")
+	}
+
+	records, err := loadChannels(sc.ds, payer, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) > 0 {
+		channels, err := sc.payerChannels(ctx, payer)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// A reused channel must last long enough for the miner to redeem the vouchers.
+		minEol := height.Add(types.NewBlockHeight(ChannelLifetime / 2))
+
+		sc.channelsLk.Lock()
+		for _, r := range records {
+			ch, ok := channels[r.Channel.KeyString()]
+			if !ok || sc.channelsInUse[inUseKey(r)] || ch.Eol.LessThan(minEol) || ch.Amount.Sub(r.Promised).LessThan(cost) {
+				continue
 			}
+			sc.channelsInUse[inUseKey(r)] = true
+			sc.channelsLk.Unlock()
+			return r, nil, nil
+		}
+		sc.channelsLk.Unlock()
+	}
+
+	eol := height.Add(types.NewBlockHeight(ChannelLifetime))
+	msgCid, err := sc.api.MessageSend(
+		ctx,
+		payer,
+		address.PaymentBrokerAddress,
+		cost,
+		types.NewGasPrice(createChannelGasPrice),
+		types.NewGasUnits(createChannelGasLimit),
+		"createChannel",
+		target,
+		eol,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
 
-			return nil, errors.Errorf("could not read chunk from stream: %s", err.Error())
+	var channelID *types.ChannelID
+	err = sc.api.MessageWait(ctx, msgCid, func(block *types.Block, message *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != 0 {
+			return fmt.Errorf("createChannel failed %d", receipt.ExitCode)
 		}
+		channelID = types.NewChannelIDFromBytes(receipt.Return[0])
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-		buf = append(buf, chunk.Data...)
+	record := &ChannelRecord{
+		Payer:    payer,
+		Target:   target,
+		Channel:  channelID,
+		Promised: types.ZeroAttoFIL,
+	}
+	if err := saveChannel(sc.ds, record); err != nil {
+		return nil, nil, err
+	}
+
+	sc.channelsLk.Lock()
+	sc.channelsInUse[inUseKey(record)] = true
+	sc.channelsLk.Unlock()
+	return record, &msgCid, nil
+}
+
+func (sc *Client) releaseChannel(record *ChannelRecord) {
+	sc.channelsLk.Lock()
+	defer sc.channelsLk.Unlock()
+	delete(sc.channelsInUse, inUseKey(record))
+}
+
+func inUseKey(record *ChannelRecord) string {
+	return record.Payer.String() + "/" + record.Channel.KeyString()
+}
+
+func (sc *Client) payerChannels(ctx context.Context, payer address.Address) (map[string]*paymentbroker.PaymentChannel, error) {
+	ret, err := sc.api.MessageQuery(ctx, address.Undef, address.PaymentBrokerAddress, "ls", payer)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting payment channels for payer")
 	}
 
-	// TODO: Figure out how to stream piece-bytes w/out having to buffer.
-	buffered := ioutil.NopCloser(bytes.NewReader(buf))
+	var channels map[string]*paymentbroker.PaymentChannel
+	if err := cbor.DecodeInto(ret[0], &channels); err != nil {
+		return nil, errors.Wrap(err, "Could not decode payment channels for payer")
+	}
+	return channels, nil
+}
+
+// pay sends the miner a voucher promising amount more than the client already
+// promised on the channel.
+func (sc *Client) pay(ctx context.Context, w *cbu.MsgWriter, channel *ChannelRecord, amount *types.AttoFIL, msgCid *cid.Cid) error {
+	promised := channel.Promised.Add(amount)
+
+	validAt, err := sc.api.ChainBlockHeight()
+	if err != nil {
+		return errors.Wrap(err, "could not get chain height")
+	}
+
+	ret, err := sc.api.MessageQuery(ctx, channel.Payer, address.PaymentBrokerAddress, "voucher", channel.Channel, promised, validAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to create voucher")
+	}
+
+	var voucher paymentbroker.PaymentVoucher
+	if err := cbor.DecodeInto(ret[0], &voucher); err != nil {
+		return errors.Wrap(err, "failed to decode voucher")
+	}
+
+	sig, err := paymentbroker.SignVoucher(channel.Channel, promised, validAt, channel.Payer, sc.api)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign voucher")
+	}
+	voucher.Signature = sig
+
+	if err := w.WriteMsg(&RetrievePiecePayment{Voucher: &voucher, ChannelMsgCid: msgCid}); err != nil {
+		return errors.Wrap(err, "failed to write payment to stream")
+	}
 
-	return buffered, nil
+	channel.Promised = promised
+	return saveChannel(sc.ds, channel)
 }
 
-func (sc *Client) safeCloseStream(stream inet.Stream) {
+func (sc *Client) safeCloseStream(stream io.Closer) {
 	if err := stream.Close(); err != nil {
 		log.Errorf("error closing stream: %s", err)
 	}
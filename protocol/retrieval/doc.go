@@ -5,4 +5,29 @@
 // 3. MINER sends CLIENT a RetrievePieceResponse with Status set to Success if it has PieceRef in a sealed sector
 // 4. MINER sends CLIENT RetrievePieceChunks until all data associated with PieceRef has been sent
 // 5. CLIENT reads RetrievePieceChunk from stream until EOF and then closes stream
+//
+// Miners serve the free protocol to older clients when they don't charge for retrieval. Clients retrieve pieces
+// over the paid protocol, which also serves free pieces and works like this:
+//
+// 1. CLIENT opens /fil/retrieval/paid/0.0.0 stream to MINER
+// 2. CLIENT sends MINER a RetrievePieceRequest
+// 3. MINER sends CLIENT a RetrievePieceResponse with the RetrievalTerms: the size of the data to send, its price per byte, the address to pay and the payment interval
+// 4. Unless the piece is free, CLIENT opens or reuses a payment channel to the address and sends MINER a RetrievePiecePayment with a voucher for the amount it already promised on the channel
+// 5. MINER sends CLIENT RetrievePieceChunks of the blocks of the piece's UnixFS DAG that hold the requested range of the piece. Every payment interval, and after the last chunk, MINER waits for a RetrievePiecePayment with a voucher paying for the bytes sent since the previous payment
+// 6. MINER closes the stream
+//
+// MINER keeps the last voucher of each payment channel, and closes the channel with it, redeeming the
+// payments of all the retrievals the channel paid for, as the channel nears its end of life.
+//
+// CLIENT checks the blocks against the piece CID as they arrive, so it can stop paying a MINER that
+// sends bad data, and resume a broken retrieval from the first byte it misses, possibly from another
+// MINER. CLIENT may retrieve different ranges of a piece from several MINERs at once, paying each MINER
+// from one payment channel for all the ranges it serves.
+//
+// MINERs announce the pieces of their committed sectors as provider records on the DHT. CLIENT finds the
+// MINERs storing a piece by looking up its providers and asking each of them for an offer:
+//
+// 1. CLIENT opens /fil/retrieval/query/0.0.0 stream to MINER
+// 2. CLIENT sends MINER a RetrievalQuery
+// 3. MINER sends CLIENT a RetrievalOffer with Status set to Success if it stores PieceRef, the size of the piece, its price per byte and an estimate of the time to unseal it
 package retrieval
@@ -1,39 +1,135 @@
 package retrieval
 
 import (
-	"io/ioutil"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
 
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	cbor "github.com/ipfs/go-ipld-cbor"
 	logging "github.com/ipfs/go-log"
+	"github.com/ipfs/go-merkledag"
 	host "github.com/libp2p/go-libp2p-host"
 	inet "github.com/libp2p/go-libp2p-net"
+	"github.com/libp2p/go-libp2p-peer"
 	"github.com/libp2p/go-libp2p-protocol"
+	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var log = logging.Logger("/fil/retrieval")
 
 const retrievalFreeProtocol = protocol.ID("/fil/retrieval/free/0.0.0")
 
+const retrievalPaidProtocol = protocol.ID("/fil/retrieval/paid/0.0.0")
+
+const retrievalQueryProtocol = protocol.ID("/fil/retrieval/query/0.0.0")
+
+// PaymentInterval is the number of bytes a miner sends before it waits to be paid
+// for them.
+const PaymentInterval = 16 * RetrievePieceChunkSize
+
+// paymentTimeout is how long a miner waits for a payment before it abandons a
+// retrieval. It includes waiting for the payment channel to be created.
+const paymentTimeout = 2 * time.Minute
+
+// unsealDelayEstimate is the time a miner estimates it takes to unseal a piece it
+// doesn't hold unsealed.
+const unsealDelayEstimate = 10 * time.Minute
+
+// unsealCooldown is how long a peer must wait after a retrieval made the miner
+// unseal a piece before another can, so that peers can't keep the miner busy
+// unsealing pieces they don't pay for.
+const unsealCooldown = unsealDelayEstimate
+
+// closeMargin is the number of blocks before the end of life of a payment channel at
+// which the miner closes it, redeeming the last voucher it received on it. Clients
+// stop paying from channels with less than half of ChannelLifetime left.
+const closeMargin = ChannelLifetime / 4
+
+// closeInterval is how often the miner looks for payment channels to close.
+const closeInterval = time.Hour
+
+const closeGasPrice = 0
+const closeGasLimit = 300
+
 // TODO: better name
 type minerNode interface {
+	// BlockService is used to read the DAGs of pieces for ranged retrievals.
+	BlockService() bserv.BlockService
 	Host() host.Host
-	SectorBuilder() sectorbuilder.SectorBuilder
+	// MinerAddresses returns the addresses of the node's miners.
+	MinerAddresses() []address.Address
+	// SectorBuilders returns the sector builders of all the node's miners.
+	SectorBuilders() []sectorbuilder.SectorBuilder
+}
+
+// minerPorcelain is the subset of the porcelain API the Miner uses.
+type minerPorcelain interface {
+	ChainBlockHeight() (*types.BlockHeight, error)
+	ConfigGet(dottedPath string) (interface{}, error)
+	DealsLs() ([]*storagedeal.Deal, error)
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error)
+	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
+	// NetworkReportPeer is used to report peers that misbehave in the protocol.
+	NetworkReportPeer(p peer.ID, offense net.Offense, reason string)
 }
 
 // Miner serves requests for pieces from RetrievalClients.
 type Miner struct {
-	node minerNode
+	node         minerNode
+	porcelainAPI minerPorcelain
+	ds           repo.Datastore
+
+	// vouchersLk serializes the checking and saving of the vouchers clients pay with,
+	// so that a voucher can't pay for two retrievals.
+	vouchersLk sync.Mutex
+
+	// unsealsLk protects unseals.
+	unsealsLk sync.Mutex
+	// unseals is the time each peer last made the miner unseal a piece.
+	unseals map[peer.ID]time.Time
 }
 
-// NewMiner is used to create a Miner and bind a handling function to the piece retrieval protocol.
-func NewMiner(nd minerNode) *Miner {
+// paymentSession tracks the payments of a client during a paid retrieval.
+type paymentSession struct {
+	terms  *RetrievalTerms
+	reader *cbu.MsgReader
+
+	// channel is the payment channel the client pays from.
+	channel *paymentbroker.PaymentChannel
+	// voucher is the last voucher the client paid with.
+	voucher *paymentbroker.PaymentVoucher
+	// paidFor is the number of bytes the client paid for.
+	paidFor uint64
+}
+
+// NewMiner is used to create a Miner and bind handling functions to the piece retrieval protocols.
+func NewMiner(nd minerNode, porcelainAPI minerPorcelain, ds repo.Datastore) *Miner {
 	rm := &Miner{
-		node: nd,
+		node:         nd,
+		porcelainAPI: porcelainAPI,
+		ds:           ds,
+		unseals:      make(map[peer.ID]time.Time),
 	}
 
 	nd.Host().SetStreamHandler(retrievalFreeProtocol, rm.handleRetrievePieceForFree)
+	nd.Host().SetStreamHandler(retrievalPaidProtocol, rm.handleRetrievePiece)
+	nd.Host().SetStreamHandler(retrievalQueryProtocol, rm.handleQuery)
 
 	return rm
 }
@@ -41,13 +137,17 @@ func NewMiner(nd minerNode) *Miner {
 func (rm *Miner) handleRetrievePieceForFree(s inet.Stream) {
 	defer s.Close() // nolint: errcheck
 
+	reader := cbu.NewMsgReader(s)
+	writer := cbu.NewMsgWriter(s)
+
 	var req RetrievePieceRequest
-	if err := cbu.NewMsgReader(s).ReadMsg(&req); err != nil {
+	if err := reader.ReadMsg(&req); err != nil {
 		log.Errorf("failed to read piece retrieval request: %s", err)
+		rm.porcelainAPI.NetworkReportPeer(s.Conn().RemotePeer(), net.OffenseProtocolError, "invalid piece retrieval request")
 		return
 	}
 
-	reader, err := rm.node.SectorBuilder().ReadPieceFromSealedSector(req.PieceRef)
+	piece, err := rm.readFreePiece(req.PieceRef)
 	if err != nil {
 		log.Warningf("failed to obtain a reader for piece with CID %s: %s", req.PieceRef.String(), err)
 
@@ -56,41 +156,497 @@ func (rm *Miner) handleRetrievePieceForFree(s inet.Stream) {
 			ErrorMessage: err.Error(),
 		}
 
-		if err := cbu.NewMsgWriter(s).WriteMsg(&resp); err != nil {
+		if err := writer.WriteMsg(&resp); err != nil {
 			log.Warningf("failed to write response for piece with CID %s: %s", req.PieceRef.String(), err)
 		}
 
 		return
 	}
 
-	bs, err := ioutil.ReadAll(reader)
+	resp := RetrievePieceResponse{
+		Status: Success,
+	}
+
+	if err := writer.WriteMsg(&resp); err != nil {
+		log.Warningf("failed to write response for piece with CID %s: %s", req.PieceRef.String(), err)
+		return
+	}
+
+	if _, err := rm.sendChunks(context.Background(), writer, piece, nil); err != nil {
+		log.Warningf("failed to send piece with CID %s: %s", req.PieceRef.String(), err)
+	}
+}
+
+func (rm *Miner) handleRetrievePiece(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	if err := rm.servePiece(context.Background(), s, s.Conn().RemotePeer()); err != nil {
+		log.Warningf("paid retrieval for %s failed: %s", s.Conn().RemotePeer(), err)
+	}
+}
+
+func (rm *Miner) handleQuery(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	if err := rm.answerQuery(s, s.Conn().RemotePeer()); err != nil {
+		log.Warningf("retrieval query from %s failed: %s", s.Conn().RemotePeer(), err)
+	}
+}
+
+// answerQuery answers a query of the retrieval query protocol with the miner's offer
+// for the piece.
+func (rm *Miner) answerQuery(rw io.ReadWriter, remote peer.ID) error {
+	var query RetrievalQuery
+	if err := cbu.NewMsgReader(rw).ReadMsg(&query); err != nil {
+		rm.porcelainAPI.NetworkReportPeer(remote, net.OffenseProtocolError, "invalid retrieval query")
+		return errors.Wrap(err, "failed to read retrieval query")
+	}
+
+	offer, err := rm.makeOffer(query.PieceRef)
+	if err != nil {
+		offer = &RetrievalOffer{
+			Status:       Failure,
+			ErrorMessage: err.Error(),
+		}
+	}
+
+	if err := cbu.NewMsgWriter(rw).WriteMsg(offer); err != nil {
+		return errors.Wrapf(err, "failed to write offer for piece with CID %s", query.PieceRef.String())
+	}
+	return nil
+}
+
+// makeOffer returns the miner's offer for the piece.
+func (rm *Miner) makeOffer(pieceRef cid.Cid) (*RetrievalOffer, error) {
+	deal, err := rm.findDeal(pieceRef)
+	if err != nil {
+		return nil, err
+	}
+
+	price, err := rm.getRetrievalPrice()
 	if err != nil {
-		log.Errorf("failed to read all bytes: %s", err)
+		return nil, err
+	}
+
+	offer := &RetrievalOffer{
+		Status:    Success,
+		Miner:     deal.Miner,
+		PieceSize: deal.Proposal.Size.Uint64(),
+		Price:     price,
+	}
+
+	// The miner serves the piece from the blocks of its DAG when it has them, and
+	// unseals the piece to rebuild them otherwise.
+	unsealed, err := rm.node.BlockService().Blockstore().Has(pieceRef)
+	if err != nil || !unsealed {
+		offer.UnsealDelay = uint64(unsealDelayEstimate / time.Second)
+	}
+	return offer, nil
+}
+
+// servePiece serves a request of the paid retrieval protocol. It answers with the
+// terms of the retrieval and, unless the piece is free, waits for the client to open
+// the payment before it streams the blocks of the requested range of the piece.
+func (rm *Miner) servePiece(ctx context.Context, rw io.ReadWriter, remote peer.ID) error {
+	reader := cbu.NewMsgReader(rw)
+	writer := cbu.NewMsgWriter(rw)
+
+	var req RetrievePieceRequest
+	if err := reader.ReadMsg(&req); err != nil {
+		rm.porcelainAPI.NetworkReportPeer(remote, net.OffenseProtocolError, "invalid piece retrieval request")
+		return errors.Wrap(err, "failed to read piece retrieval request")
+	}
+
+	terms, piece, err := rm.preparePiece(ctx, &req, remote)
+	if err != nil {
+		resp := RetrievePieceResponse{
+			Status:       Failure,
+			ErrorMessage: err.Error(),
+		}
+		if err := writer.WriteMsg(&resp); err != nil {
+			log.Warningf("failed to write response for piece with CID %s: %s", req.PieceRef.String(), err)
+		}
+		return errors.Wrapf(err, "failed to obtain piece with CID %s", req.PieceRef.String())
 	}
 
 	resp := RetrievePieceResponse{
 		Status: Success,
+		Terms:  terms,
+	}
+	if err := writer.WriteMsg(&resp); err != nil {
+		return errors.Wrapf(err, "failed to write response for piece with CID %s", req.PieceRef.String())
 	}
 
-	if err := cbu.NewMsgWriter(s).WriteMsg(&resp); err != nil {
-		log.Warningf("failed to write response for piece with CID %s: %s", req.PieceRef.String(), err)
-		return
+	var session *paymentSession
+	if !terms.Price.IsZero() {
+		session = &paymentSession{terms: terms, reader: reader}
+
+		// The client opens the payment with a voucher for what it already promised
+		// on the channel, which lets the miner check the channel before sending data.
+		if err := rm.receivePayment(ctx, session, 0); err != nil {
+			return err
+		}
+	}
+
+	sent, err := rm.sendChunks(ctx, writer, io.LimitReader(piece, int64(terms.Size)), session)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send piece with CID %s", req.PieceRef.String())
+	}
+	if sent != terms.Size {
+		return fmt.Errorf("piece with CID %s has %d bytes instead of %d", req.PieceRef.String(), sent, terms.Size)
+	}
+	return nil
+}
+
+// preparePiece returns the terms on which the miner serves the request of the remote
+// peer and a reader of the blocks of the range of the piece it asks for.
+func (rm *Miner) preparePiece(ctx context.Context, req *RetrievePieceRequest, remote peer.ID) (*RetrievalTerms, io.Reader, error) {
+	deal, err := rm.findDeal(req.PieceRef)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pieceSize := deal.Proposal.Size.Uint64()
+	if req.Offset >= pieceSize {
+		return nil, nil, fmt.Errorf("range starts at byte %d of a %d byte piece", req.Offset, pieceSize)
+	}
+
+	price, err := rm.getRetrievalPrice()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owner, err := rm.porcelainAPI.MinerGetOwnerAddress(ctx, deal.Miner)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not get owner of miner")
 	}
 
-	for i := 0; i < len(bs); i += RetrievePieceChunkSize {
-		end := i + RetrievePieceChunkSize
+	bs := rm.node.BlockService().Blockstore()
+	dag := merkledag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
 
-		if end > len(bs) {
-			end = len(bs)
+	cids, size, err := rangeBlocks(ctx, dag, req)
+	if err != nil {
+		// The miner fetched the DAG of the piece when it accepted the deal, but its
+		// blocks may be gone since: rebuild them from the sealed sector.
+		if err := rm.allowUnseal(remote); err != nil {
+			return nil, nil, err
 		}
+		piece, err := rm.readPiece(req.PieceRef)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := importPiece(ctx, dag, req.PieceRef, piece); err != nil {
+			return nil, nil, err
+		}
+		if cids, size, err = rangeBlocks(ctx, dag, req); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to find the blocks of the range")
+		}
+	}
 
-		chunk := RetrievePieceChunk{
-			Data: bs[i:end],
+	terms := &RetrievalTerms{
+		Size:            size,
+		PieceSize:       pieceSize,
+		Price:           price,
+		PaymentAddress:  owner,
+		PaymentInterval: PaymentInterval,
+	}
+	return terms, &blockReader{ctx: ctx, dag: dag, cids: cids}, nil
+}
+
+// allowUnseal records that the remote peer makes the miner unseal a piece, unless
+// it did less than unsealCooldown ago.
+func (rm *Miner) allowUnseal(remote peer.ID) error {
+	rm.unsealsLk.Lock()
+	defer rm.unsealsLk.Unlock()
+
+	now := time.Now()
+	for p, last := range rm.unseals {
+		if now.Sub(last) >= unsealCooldown {
+			delete(rm.unseals, p)
+		}
+	}
+	if last, ok := rm.unseals[remote]; ok {
+		return fmt.Errorf("piece must be unsealed, try again in %s", (unsealCooldown - now.Sub(last)).Round(time.Second))
+	}
+	rm.unseals[remote] = now
+	return nil
+}
+
+// findDeal returns a deal of one of the node's miners for the piece.
+func (rm *Miner) findDeal(pieceRef cid.Cid) (*storagedeal.Deal, error) {
+	deals, err := rm.porcelainAPI.DealsLs()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list deals")
+	}
+
+	miners := make(map[address.Address]bool)
+	for _, addr := range rm.node.MinerAddresses() {
+		miners[addr] = true
+	}
+
+	for _, d := range deals {
+		if !miners[d.Miner] || !d.Proposal.PieceRef.Equals(pieceRef) || d.Proposal.Size == nil || d.Response == nil {
+			continue
+		}
+		switch d.Response.State {
+		case storagedeal.Unknown, storagedeal.Rejected, storagedeal.Failed, storagedeal.CounterOffered:
+			continue
 		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("no deal for piece %s", pieceRef.String())
+}
+
+func (rm *Miner) getRetrievalPrice() (*types.AttoFIL, error) {
+	retrievalPrice, err := rm.porcelainAPI.ConfigGet("mining.retrievalPrice")
+	if err != nil {
+		return nil, err
+	}
+	retrievalPriceAF, ok := retrievalPrice.(*types.AttoFIL)
+	if !ok || retrievalPriceAF == nil {
+		return nil, errors.New("Could not retrieve retrievalPrice from config")
+	}
+	return retrievalPriceAF, nil
+}
+
+// readFreePiece returns a reader of the piece if the miner serves pieces for free.
+func (rm *Miner) readFreePiece(pieceRef cid.Cid) (io.Reader, error) {
+	price, err := rm.getRetrievalPrice()
+	if err != nil {
+		return nil, err
+	}
+	if !price.IsZero() {
+		return nil, fmt.Errorf("miner charges %s per byte for retrieval", price)
+	}
+	return rm.readPiece(pieceRef)
+}
+
+// sendChunks streams the piece in chunks and returns the number of bytes sent. With a
+// payment session, it waits for the client to pay for the bytes sent every time their
+// number reaches the payment interval, and at the end of the piece.
+func (rm *Miner) sendChunks(ctx context.Context, writer *cbu.MsgWriter, piece io.Reader, session *paymentSession) (uint64, error) {
+	buf := make([]byte, RetrievePieceChunkSize)
+	sent := uint64(0)
+	for {
+		n, err := io.ReadFull(piece, buf)
+		if n > 0 {
+			if err := writer.WriteMsg(&RetrievePieceChunk{Data: buf[:n]}); err != nil {
+				return sent, errors.Wrap(err, "failed to write chunk")
+			}
+			sent += uint64(n)
+
+			if session != nil && sent-session.paidFor >= session.terms.PaymentInterval {
+				if err := rm.receivePayment(ctx, session, sent); err != nil {
+					return sent, err
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return sent, errors.Wrap(err, "failed to read piece")
+		}
+	}
+
+	if session != nil && session.paidFor < sent {
+		if err := rm.receivePayment(ctx, session, sent); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// receivePayment waits for the client to pay for the bytes sent, and checks and saves
+// the voucher it pays with.
+func (rm *Miner) receivePayment(ctx context.Context, session *paymentSession, sent uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, paymentTimeout)
+	defer cancel()
+
+	var payment RetrievePiecePayment
+	read := make(chan error, 1)
+	go func() {
+		read <- session.reader.ReadMsg(&payment)
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			return errors.Wrap(err, "failed to read payment")
+		}
+	case <-ctx.Done():
+		return fmt.Errorf("client didn't pay for %d bytes within %s", sent-session.paidFor, paymentTimeout)
+	}
+
+	voucher := payment.Voucher
+	if voucher == nil {
+		return errors.New("payment has no voucher")
+	}
+	if session.voucher != nil && (voucher.Payer != session.voucher.Payer || !voucher.Channel.Equal(&session.voucher.Channel)) {
+		return errors.New("payment is from another channel than the previous payments")
+	}
+	if !paymentbroker.VerifyVoucherSignature(voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, voucher.Signature) {
+		return errors.New("invalid signature in voucher")
+	}
+
+	if session.channel == nil {
+		channel, err := rm.getPaymentChannel(ctx, voucher, payment.ChannelMsgCid)
+		if err != nil {
+			return err
+		}
+		if channel.Target != session.terms.PaymentAddress {
+			return fmt.Errorf("miner account (%s) is not target of payment channel (%s)", session.terms.PaymentAddress.String(), channel.Target.String())
+		}
+		session.channel = channel
+	}
+	if !voucher.ValidAt.LessThan(session.channel.Eol) {
+		return fmt.Errorf("voucher is valid at %s, after the payment channel expires at %s", voucher.ValidAt.String(), session.channel.Eol.String())
+	}
+
+	rm.vouchersLk.Lock()
+	defer rm.vouchersLk.Unlock()
 
-		if err := cbu.NewMsgWriter(s).WriteMsg(&chunk); err != nil {
-			log.Warningf("failed to write chunk for CID %s: %s", req.PieceRef.String(), err)
+	last, err := loadVoucher(rm.ds, voucher.Payer, &voucher.Channel)
+	if err != nil {
+		return err
+	}
+	paid := &voucher.Amount
+	if last != nil {
+		paid = voucher.Amount.Sub(&last.Amount)
+	}
+
+	owed := session.terms.Price.CalculatePrice(types.NewBytesAmount(sent - session.paidFor))
+	if paid.LessThan(owed) {
+		return fmt.Errorf("voucher pays %s for %d bytes costing %s", paid.String(), sent-session.paidFor, owed.String())
+	}
+
+	rest := session.terms.Price.CalculatePrice(types.NewBytesAmount(session.terms.Size - sent))
+	if session.channel.Amount.LessThan(voucher.Amount.Add(rest)) {
+		return fmt.Errorf("payment channel does not contain enough funds (%s < %s)", session.channel.Amount.String(), voucher.Amount.Add(rest).String())
+	}
+
+	if err := saveVoucher(rm.ds, voucher); err != nil {
+		return err
+	}
+	session.voucher = voucher
+	session.paidFor = sent
+	return nil
+}
+
+// getPaymentChannel returns the channel of the voucher, once the message creating it,
+// if any, is on chain.
+func (rm *Miner) getPaymentChannel(ctx context.Context, voucher *paymentbroker.PaymentVoucher, msgCid *cid.Cid) (*paymentbroker.PaymentChannel, error) {
+	if msgCid != nil {
+		err := rm.porcelainAPI.MessageWait(ctx, *msgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "could not wait for payment channel")
+		}
+	}
+
+	channels, err := rm.payerChannels(ctx, voucher.Payer)
+	if err != nil {
+		return nil, err
+	}
+	channel, ok := channels[voucher.Channel.KeyString()]
+	if !ok {
+		return nil, fmt.Errorf("could not find payment channel for payer %s and id %s", voucher.Payer.String(), voucher.Channel.KeyString())
+	}
+	return channel, nil
+}
+
+func (rm *Miner) payerChannels(ctx context.Context, payer address.Address) (map[string]*paymentbroker.PaymentChannel, error) {
+	ret, err := rm.porcelainAPI.MessageQuery(ctx, address.Undef, address.PaymentBrokerAddress, "ls", payer)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting payment channel for payer")
+	}
+
+	var channels map[string]*paymentbroker.PaymentChannel
+	if err := cbor.DecodeInto(ret[0], &channels); err != nil {
+		return nil, errors.Wrap(err, "Could not decode payment channels for payer")
+	}
+	return channels, nil
+}
+
+// CloseChannels closes the payment channels clients paid the miner from as they near
+// their end of life, checking for them every closeInterval until the context is done.
+// The miner redeems the payments on a channel once, when it closes it, rather than
+// after each retrieval the channel pays for.
+func (rm *Miner) CloseChannels(ctx context.Context) {
+	ticker := time.NewTicker(closeInterval)
+	defer ticker.Stop()
+
+	for {
+		rm.closeChannels(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+// closeChannels closes the payment channels of the vouchers the miner received that
+// end within closeMargin blocks, and forgets the vouchers of the channels that are
+// gone. Failing to close a channel leaves its voucher for the next attempt.
+func (rm *Miner) closeChannels(ctx context.Context) {
+	vouchers, err := loadVouchers(rm.ds)
+	if err != nil {
+		log.Errorf("failed to load vouchers: %s", err)
+		return
+	}
+
+	height, err := rm.porcelainAPI.ChainBlockHeight()
+	if err != nil {
+		log.Errorf("could not get chain height: %s", err)
+		return
+	}
+	closeBy := height.Add(types.NewBlockHeight(closeMargin))
+
+	for _, v := range vouchers {
+		channels, err := rm.payerChannels(ctx, v.Payer)
+		if err != nil {
+			log.Warningf("failed to get payment channels of %s: %s", v.Payer.String(), err)
+			continue
+		}
+
+		channel, ok := channels[v.Channel.KeyString()]
+		if !ok {
+			if err := deleteVoucher(rm.ds, v); err != nil {
+				log.Warningf("failed to delete voucher of %s for channel %s: %s", v.Payer.String(), v.Channel.String(), err)
+			}
+			continue
+		}
+		if v.Amount.IsZero() || closeBy.LessThan(channel.Eol) {
+			continue
+		}
+
+		_, err = rm.porcelainAPI.MessageSend(
+			ctx,
+			channel.Target,
+			address.PaymentBrokerAddress,
+			types.ZeroAttoFIL,
+			types.NewGasPrice(closeGasPrice),
+			types.NewGasUnits(closeGasLimit),
+			"close",
+			v.Payer, &v.Channel, &v.Amount, &v.ValidAt, []byte(v.Signature),
+		)
+		if err != nil {
+			log.Warningf("failed to close channel %s of %s: %s", v.Channel.String(), v.Payer.String(), err)
+		}
+	}
+}
+
+// readPiece reads the piece from the sealed sectors of whichever of the node's
+// miners stored it.
+func (rm *Miner) readPiece(pieceRef cid.Cid) (io.Reader, error) {
+	err := errors.New("no miner to read the piece from")
+	for _, sb := range rm.node.SectorBuilders() {
+		var reader io.Reader
+		if reader, err = sb.ReadPieceFromSealedSector(pieceRef); err == nil {
+			return reader, nil
+		}
+	}
+	return nil, err
+}
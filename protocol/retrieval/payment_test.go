@@ -0,0 +1,458 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	gonet "net"
+	"sync"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-ipfs-blockstore"
+	chunk "github.com/ipfs/go-ipfs-chunker"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	imp "github.com/ipfs/go-unixfs/importer"
+	"github.com/libp2p/go-libp2p-host"
+	"github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/net"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/repo"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestPaidRetrieval(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	price := types.NewAttoFILFromFIL(2)
+
+	piece := make([]byte, 3*PaymentInterval+1000)
+	_, err := rand.Read(piece)
+	require.NoError(t, err)
+
+	t.Run("Pays for the piece as it arrives", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+		cost := api.cost(t, &RetrievePieceRequest{PieceRef: api.pieceRef})
+
+		data, err := api.retrieve(ctx, miner, client, price)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece, data))
+
+		// One opening voucher, one per payment interval and one for the rest of the piece.
+		require.Len(api.vouchers, 5)
+		assert.True(api.vouchers[0].Amount.IsZero())
+		for i := 1; i < 4; i++ {
+			paid := price.CalculatePrice(types.NewBytesAmount(uint64(i * PaymentInterval)))
+			assert.True(paid.Equal(&api.vouchers[i].Amount))
+		}
+		assert.True(cost.Equal(&api.vouchers[4].Amount))
+
+		last, err := loadVoucher(miner.ds, api.payer, &api.vouchers[4].Channel)
+		require.NoError(err)
+		assert.True(cost.Equal(&last.Amount))
+
+		// The miner redeems the payments when it closes the channel.
+		assert.Empty(api.redeemed)
+	})
+
+	t.Run("Reuses a channel with enough funds", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+		cost := api.cost(t, &RetrievePieceRequest{PieceRef: api.pieceRef})
+
+		data, err := api.retrieve(ctx, miner, client, price)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece, data))
+		require.Len(api.channels[api.payer], 1)
+
+		// The channel holds the cost of one retrieval, add funds for another one.
+		for _, ch := range api.channels[api.payer] {
+			ch.Amount = ch.Amount.Add(cost)
+		}
+
+		data, err = api.retrieve(ctx, miner, client, price)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece, data))
+		assert.Len(api.channels[api.payer], 1)
+
+		last, err := loadVoucher(miner.ds, api.payer, &api.vouchers[0].Channel)
+		require.NoError(err)
+		assert.True(cost.Add(cost).Equal(&last.Amount))
+	})
+
+	t.Run("Closes a channel near its end of life", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+		cost := api.cost(t, &RetrievePieceRequest{PieceRef: api.pieceRef})
+
+		_, err := api.retrieve(ctx, miner, client, price)
+		require.NoError(err)
+		require.Len(api.channels[api.payer], 1)
+		channel := api.vouchers[0].Channel
+
+		miner.closeChannels(ctx)
+		assert.Empty(api.redeemed)
+
+		for _, ch := range api.channels[api.payer] {
+			api.height = ch.Eol.Sub(types.NewBlockHeight(closeMargin))
+		}
+		miner.closeChannels(ctx)
+		require.Len(api.redeemed, 1)
+		assert.True(cost.Equal(api.redeemed[0]))
+		assert.Empty(api.channels[api.payer])
+
+		// The miner forgets the voucher once the channel is gone.
+		miner.closeChannels(ctx)
+		assert.Len(api.redeemed, 1)
+		last, err := loadVoucher(miner.ds, api.payer, &channel)
+		require.NoError(err)
+		assert.Nil(last)
+	})
+
+	t.Run("Opens a new channel when the others are short of funds", func(t *testing.T) {
+		require := require.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+
+		_, err := api.retrieve(ctx, miner, client, price)
+		require.NoError(err)
+		_, err = api.retrieve(ctx, miner, client, price)
+		require.NoError(err)
+		require.Len(api.channels[api.payer], 2)
+	})
+
+	t.Run("Declines a price above the max price", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+
+		_, err := api.retrieve(ctx, miner, client, types.NewAttoFILFromFIL(1))
+		require.Error(err)
+		assert.Contains(err.Error(), "use --max-price")
+
+		_, err = api.retrieve(ctx, miner, client, nil)
+		require.Error(err)
+		assert.Empty(api.channels[api.payer])
+	})
+
+	t.Run("Stops when the vouchers don't pay for the bytes sent", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+		cost := api.cost(t, &RetrievePieceRequest{PieceRef: api.pieceRef})
+
+		_, err := api.retrieve(ctx, miner, client, price)
+		require.NoError(err)
+
+		// Make the miner believe it was already paid more on the channel than the
+		// client promised, so that the client's vouchers fall short.
+		for _, ch := range api.channels[api.payer] {
+			ch.Amount = ch.Amount.Add(cost).Add(cost)
+		}
+		last := *api.vouchers[len(api.vouchers)-1]
+		last.Amount = *last.Amount.Add(cost)
+		require.NoError(saveVoucher(miner.ds, &last))
+
+		_, err = api.retrieve(ctx, miner, client, price)
+		require.Error(err)
+		assert.Contains(api.serveErr.Error(), "costing")
+	})
+
+	t.Run("Retrieves free pieces without payment", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, types.ZeroAttoFIL, piece)
+		miner, client := api.newMinerAndClient()
+
+		data, err := api.retrieve(ctx, miner, client, nil)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece, data))
+		assert.Empty(api.vouchers)
+		assert.Empty(api.channels[api.payer])
+	})
+}
+
+// testPaymentAPI fakes the porcelain APIs of a retrieval miner and client sharing a
+// chain with a payment broker.
+type testPaymentAPI struct {
+	types.MockSigner
+
+	payer    address.Address
+	owner    address.Address
+	minerAdr address.Address
+	height   *types.BlockHeight
+	price    *types.AttoFIL
+	deals    []*storagedeal.Deal
+	piece    []byte
+	pieceRef cid.Cid
+	blocks   bserv.BlockService
+	// providers are the peers the network finds to provide any cid.
+	providers []peer.ID
+
+	lk          sync.Mutex
+	channels    map[address.Address]map[string]*paymentbroker.PaymentChannel
+	nextChannel uint64
+	created     map[cid.Cid]*types.ChannelID
+	cidGetter   func() cid.Cid
+	vouchers    []*paymentbroker.PaymentVoucher
+	redeemed    []*types.AttoFIL
+	serveErr    error
+}
+
+func newTestPaymentAPI(t *testing.T, price *types.AttoFIL, piece []byte) *testPaymentAPI {
+	signer, _ := types.NewMockSignersAndKeyInfo(1)
+	addressGetter := address.NewForTestGetter()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+
+	api := &testPaymentAPI{
+		MockSigner: signer,
+		payer:      signer.Addresses[0],
+		owner:      addressGetter(),
+		minerAdr:   addressGetter(),
+		height:     types.NewBlockHeight(100),
+		price:      price,
+		piece:      piece,
+		blocks:     bserv.New(bs, offline.Exchange(bs)),
+		channels:   make(map[address.Address]map[string]*paymentbroker.PaymentChannel),
+		created:    make(map[cid.Cid]*types.ChannelID),
+		cidGetter:  types.NewCidForTestGetter(),
+	}
+
+	// Import the piece the way clients import data, as the miner fetched it.
+	bufds := ipld.NewBufferedDAG(context.Background(), merkledag.NewDAGService(api.blocks))
+	nd, err := imp.BuildDagFromReader(bufds, chunk.DefaultSplitter(bytes.NewReader(piece)))
+	require.NoError(t, err)
+	require.NoError(t, bufds.Commit())
+	api.pieceRef = nd.Cid()
+
+	api.deals = []*storagedeal.Deal{{
+		Miner:    api.minerAdr,
+		Proposal: &storagedeal.Proposal{PieceRef: api.pieceRef, Size: types.NewBytesAmount(uint64(len(piece)))},
+		Response: &storagedeal.Response{State: storagedeal.Complete},
+	}}
+	return api
+}
+
+// newMinerAndClient returns a miner and a client of the api. The client's streams to
+// any peer are served by the miner.
+func (api *testPaymentAPI) newMinerAndClient() (*Miner, *Client) {
+	miner := api.newMiner()
+	client := &Client{api: api, ds: repo.NewInMemoryRepo().Datastore(), channelsInUse: make(map[string]bool), segmentSize: maxSegmentSize}
+	client.openStream = func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error) {
+		return api.serve(ctx, miner), nil
+	}
+	return miner, client
+}
+
+func (api *testPaymentAPI) newMiner() *Miner {
+	return &Miner{node: api, porcelainAPI: api, ds: repo.NewInMemoryRepo().Datastore(), unseals: make(map[peer.ID]time.Time)}
+}
+
+// serve returns the client end of a pipe the miner serves a retrieval on.
+func (api *testPaymentAPI) serve(ctx context.Context, miner *Miner) gonet.Conn {
+	minerEnd, clientEnd := gonet.Pipe()
+	go func() {
+		miner.servePiece(ctx, minerEnd, peer.ID("")) // nolint: errcheck
+		minerEnd.Close()                             // nolint: errcheck
+	}()
+	return clientEnd
+}
+
+// cost returns the price of the blocks of the range of the request.
+func (api *testPaymentAPI) cost(t *testing.T, req *RetrievePieceRequest) *types.AttoFIL {
+	_, size, err := rangeBlocks(context.Background(), merkledag.NewDAGService(api.blocks), req)
+	require.NoError(t, err)
+	return api.price.CalculatePrice(types.NewBytesAmount(size))
+}
+
+// retrieve runs a paid retrieval of the piece between the miner and the client over
+// a pipe.
+func (api *testPaymentAPI) retrieve(ctx context.Context, miner *Miner, client *Client, maxPrice *types.AttoFIL) ([]byte, error) {
+	return api.retrieveRange(ctx, miner, client, &RetrievePieceRequest{PieceRef: api.pieceRef}, maxPrice)
+}
+
+// retrieveRange runs a paid retrieval of the request between the miner and the
+// client over a pipe.
+func (api *testPaymentAPI) retrieveRange(ctx context.Context, miner *Miner, client *Client, req *RetrievePieceRequest, maxPrice *types.AttoFIL) ([]byte, error) {
+	minerEnd, clientEnd := gonet.Pipe()
+
+	served := make(chan error, 1)
+	go func() {
+		err := miner.servePiece(ctx, minerEnd, peer.ID(""))
+		minerEnd.Close() // nolint: errcheck
+		served <- err
+	}()
+
+	payments := &minerPayments{}
+	defer client.releasePayments(payments)
+
+	var buf bytes.Buffer
+	_, err := client.receivePiece(ctx, clientEnd, req, uint64(len(api.piece)), maxPrice, payments, &buf)
+	clientEnd.Close() // nolint: errcheck
+	api.serveErr = <-served
+	return buf.Bytes(), err
+}
+
+func (api *testPaymentAPI) BlockService() bserv.BlockService {
+	return api.blocks
+}
+
+func (api *testPaymentAPI) Host() host.Host {
+	panic("not implemented")
+}
+
+func (api *testPaymentAPI) MinerAddresses() []address.Address {
+	return []address.Address{api.minerAdr}
+}
+
+func (api *testPaymentAPI) SectorBuilders() []sectorbuilder.SectorBuilder {
+	return []sectorbuilder.SectorBuilder{&testSectorBuilder{piece: api.piece}}
+}
+
+func (api *testPaymentAPI) ChainBlockHeight() (*types.BlockHeight, error) {
+	return api.height, nil
+}
+
+func (api *testPaymentAPI) ConfigGet(dottedPath string) (interface{}, error) {
+	if dottedPath != "mining.retrievalPrice" {
+		return nil, fmt.Errorf("unexpected config key %s", dottedPath)
+	}
+	return api.price, nil
+}
+
+func (api *testPaymentAPI) DealsLs() ([]*storagedeal.Deal, error) {
+	return api.deals, nil
+}
+
+func (api *testPaymentAPI) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error) {
+	api.lk.Lock()
+	defer api.lk.Unlock()
+
+	switch method {
+	case "ls":
+		channels := api.channels[params[0].(address.Address)]
+		if channels == nil {
+			channels = make(map[string]*paymentbroker.PaymentChannel)
+		}
+		encoded, err := cbor.DumpObject(channels)
+		return [][]byte{encoded}, err
+	case "voucher":
+		chid := params[0].(*types.ChannelID)
+		channel := api.channels[optFrom][chid.KeyString()]
+		voucher := &paymentbroker.PaymentVoucher{
+			Channel: *chid,
+			Payer:   optFrom,
+			Target:  channel.Target,
+			Amount:  *params[1].(*types.AttoFIL),
+			ValidAt: *params[2].(*types.BlockHeight),
+		}
+		api.vouchers = append(api.vouchers, voucher)
+		encoded, err := cbor.DumpObject(voucher)
+		return [][]byte{encoded}, err
+	}
+	return nil, fmt.Errorf("unexpected query of %s", method)
+}
+
+func (api *testPaymentAPI) MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	api.lk.Lock()
+	defer api.lk.Unlock()
+
+	msgCid := api.cidGetter()
+	switch method {
+	case "createChannel":
+		api.nextChannel++
+		chid := types.NewChannelID(api.nextChannel)
+		if api.channels[from] == nil {
+			api.channels[from] = make(map[string]*paymentbroker.PaymentChannel)
+		}
+		api.channels[from][chid.KeyString()] = &paymentbroker.PaymentChannel{
+			Target:         params[0].(address.Address),
+			Amount:         value,
+			AmountRedeemed: types.ZeroAttoFIL,
+			Eol:            params[1].(*types.BlockHeight),
+		}
+		api.created[msgCid] = chid
+	case "close":
+		if from != api.owner {
+			return cid.Undef, fmt.Errorf("close sent from %s instead of the channel target", from)
+		}
+		chid := params[1].(*types.ChannelID)
+		delete(api.channels[params[0].(address.Address)], chid.KeyString())
+		api.redeemed = append(api.redeemed, params[2].(*types.AttoFIL))
+	default:
+		return cid.Undef, fmt.Errorf("unexpected message %s", method)
+	}
+	return msgCid, nil
+}
+
+func (api *testPaymentAPI) MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
+	api.lk.Lock()
+	chid := api.created[msgCid]
+	api.lk.Unlock()
+
+	return cb(nil, nil, &types.MessageReceipt{Return: [][]byte{chid.Bytes()}})
+}
+
+func (api *testPaymentAPI) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return api.owner, nil
+}
+
+func (api *testPaymentAPI) NetworkFindProvidersAsync(ctx context.Context, key cid.Cid, count int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo, len(api.providers))
+	for i, p := range api.providers {
+		if i == count {
+			break
+		}
+		out <- pstore.PeerInfo{ID: p}
+	}
+	close(out)
+	return out
+}
+
+func (api *testPaymentAPI) NetworkReportPeer(p peer.ID, offense net.Offense, reason string) {}
+
+func (api *testPaymentAPI) WalletDefaultAddress() (address.Address, error) {
+	return api.payer, nil
+}
+
+type testSectorBuilder struct {
+	sectorbuilder.SectorBuilder
+	piece []byte
+}
+
+func (sb *testSectorBuilder) ReadPieceFromSealedSector(pieceCid cid.Cid) (io.Reader, error) {
+	return bytes.NewReader(sb.piece), nil
+}
@@ -0,0 +1,131 @@
+package retrieval
+
+import (
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(ChannelRecord{})
+}
+
+// VoucherPrefix is the datastore prefix for the last voucher a miner received on
+// each payment channel.
+const VoucherPrefix = "retrievalvouchers"
+
+// ChannelPrefix is the datastore prefix for the payment channels a client pays
+// retrievals from.
+const ChannelPrefix = "retrievalchannels"
+
+// ChannelRecord records a payment channel a client opened to pay for retrievals.
+type ChannelRecord struct {
+	Payer   address.Address
+	Target  address.Address
+	Channel *types.ChannelID
+	// Promised is the amount of the last voucher the client sent on the channel.
+	Promised *types.AttoFIL
+}
+
+func voucherKey(payer address.Address, channel *types.ChannelID) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{VoucherPrefix, payer.String(), channel.String()})
+}
+
+// loadVoucher returns the last voucher received on the channel, or nil if there is none.
+func loadVoucher(ds repo.Datastore, payer address.Address, channel *types.ChannelID) (*paymentbroker.PaymentVoucher, error) {
+	datum, err := ds.Get(voucherKey(payer, channel))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read voucher from datastore")
+	}
+
+	var voucher paymentbroker.PaymentVoucher
+	if err := cbor.DecodeInto(datum, &voucher); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal voucher")
+	}
+	return &voucher, nil
+}
+
+// loadVouchers returns the last voucher the miner received on each payment channel.
+func loadVouchers(ds repo.Datastore) ([]*paymentbroker.PaymentVoucher, error) {
+	results, err := ds.Query(query.Query{Prefix: datastore.NewKey(VoucherPrefix).String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query vouchers from datastore")
+	}
+
+	var vouchers []*paymentbroker.PaymentVoucher
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read vouchers from datastore")
+		}
+		var voucher paymentbroker.PaymentVoucher
+		if err := cbor.DecodeInto(entry.Value, &voucher); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal voucher from datastore")
+		}
+		vouchers = append(vouchers, &voucher)
+	}
+	return vouchers, nil
+}
+
+func deleteVoucher(ds repo.Datastore, voucher *paymentbroker.PaymentVoucher) error {
+	if err := ds.Delete(voucherKey(voucher.Payer, &voucher.Channel)); err != nil {
+		return errors.Wrap(err, "could not delete voucher")
+	}
+	return nil
+}
+
+func saveVoucher(ds repo.Datastore, voucher *paymentbroker.PaymentVoucher) error {
+	datum, err := cbor.DumpObject(voucher)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal voucher")
+	}
+	if err := ds.Put(voucherKey(voucher.Payer, &voucher.Channel), datum); err != nil {
+		return errors.Wrap(err, "could not save voucher")
+	}
+	return nil
+}
+
+func channelKey(payer, target address.Address, channel *types.ChannelID) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{ChannelPrefix, payer.String(), target.String(), channel.String()})
+}
+
+// loadChannels returns the channels the payer opened to pay the target.
+func loadChannels(ds repo.Datastore, payer, target address.Address) ([]*ChannelRecord, error) {
+	prefix := datastore.KeyWithNamespaces([]string{ChannelPrefix, payer.String(), target.String()})
+	results, err := ds.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query payment channels from datastore")
+	}
+
+	var records []*ChannelRecord
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read payment channels from datastore")
+		}
+		var record ChannelRecord
+		if err := cbor.DecodeInto(entry.Value, &record); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal payment channel from datastore")
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+func saveChannel(ds repo.Datastore, record *ChannelRecord) error {
+	datum, err := cbor.DumpObject(record)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal payment channel")
+	}
+	if err := ds.Put(channelKey(record.Payer, record.Target, record.Channel), datum); err != nil {
+		return errors.Wrap(err, "could not save payment channel")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package retrieval
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	gonet "net"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestFindOffers(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	price := types.NewAttoFILFromFIL(2)
+
+	piece := make([]byte, 3*PaymentInterval+1000)
+	_, err := rand.Read(piece)
+	require.NoError(t, err)
+
+	t.Run("Queries a miner for its offer", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+		api.serveQueries(client, map[peer.ID]*Miner{"a": miner})
+
+		offer, err := client.QueryMiner(ctx, "a", api.pieceRef)
+		require.NoError(err)
+		assert.Equal(api.minerAdr, offer.Miner)
+		assert.Equal(uint64(len(piece)), offer.PieceSize)
+		assert.True(price.Equal(offer.Price))
+		assert.Equal(uint64(0), offer.UnsealDelay)
+	})
+
+	t.Run("Fails a query for a piece the miner doesn't store", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		miner, client := api.newMinerAndClient()
+		api.serveQueries(client, map[peer.ID]*Miner{"a": miner})
+		api.deals = nil
+
+		_, err := client.QueryMiner(ctx, "a", api.pieceRef)
+		require.Error(err)
+		assert.Contains(err.Error(), "doesn't serve the piece")
+	})
+
+	t.Run("Sorts the offers of the providers by price and unseal delay", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		expensive, client := api.newMinerAndClient()
+
+		cheap := newTestPaymentAPI(t, types.NewAttoFILFromFIL(1), piece)
+		sealed := newTestPaymentAPI(t, types.NewAttoFILFromFIL(1), piece)
+		bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+		sealed.blocks = bserv.New(bs, offline.Exchange(bs))
+		other := newTestPaymentAPI(t, price, piece)
+		other.deals = nil
+
+		api.providers = []peer.ID{"a", "b", "c", "d"}
+		api.serveQueries(client, map[peer.ID]*Miner{
+			"a": expensive,
+			"b": sealed.newMiner(),
+			"c": cheap.newMiner(),
+			"d": other.newMiner(),
+		})
+
+		offers, err := client.FindOffers(ctx, api.pieceRef, 10)
+		require.NoError(err)
+		require.Len(offers, 3)
+		assert.Equal(peer.ID("c"), offers[0].PeerID)
+		assert.Equal(peer.ID("b"), offers[1].PeerID)
+		assert.Equal(uint64(unsealDelayEstimate.Seconds()), offers[1].Offer.UnsealDelay)
+		assert.Equal(peer.ID("a"), offers[2].PeerID)
+
+		offers, err = client.FindOffers(ctx, api.pieceRef, 1)
+		require.NoError(err)
+		require.Len(offers, 1)
+		assert.Equal(peer.ID("a"), offers[0].PeerID)
+	})
+}
+
+// serveQueries serves the client's queries to each peer with its miner.
+func (api *testPaymentAPI) serveQueries(client *Client, miners map[peer.ID]*Miner) {
+	client.openQueryStream = func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error) {
+		minerEnd, clientEnd := gonet.Pipe()
+		go func() {
+			miners[minerPeerID].answerQuery(minerEnd, minerPeerID) // nolint: errcheck
+			minerEnd.Close()                                       // nolint: errcheck
+		}()
+		return clientEnd, nil
+	}
+}
@@ -0,0 +1,235 @@
+package retrieval
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	chunk "github.com/ipfs/go-ipfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	imp "github.com/ipfs/go-unixfs/importer"
+	"github.com/pkg/errors"
+)
+
+// The paid protocol transfers the blocks of the piece's UnixFS DAG that hold the bytes
+// of the requested range, instead of the bytes themselves, so that the client can
+// check them against the piece CID as they arrive. The blocks are sent in the order
+// walkRange visits them, each prefixed with its length as a uvarint.
+
+// maxBlockSize is the size of the largest block a client accepts from a miner.
+const maxBlockSize = 2 << 20
+
+// rangeEnd returns the end of the range of the request, excluded.
+func (req *RetrievePieceRequest) rangeEnd() uint64 {
+	if req.Length == 0 || req.Offset+req.Length < req.Offset {
+		return math.MaxUint64
+	}
+	return req.Offset + req.Length
+}
+
+// walkRange visits the blocks of the UnixFS file DAG rooted at c that hold bytes in
+// [offset, end) of the file, depth first. It calls visit with each block's data and
+// the position of the data in the file, and returns the size of the file.
+func walkRange(get func(cid.Cid) (ipld.Node, error), c cid.Cid, pos, offset, end uint64, visit func(data []byte, pos uint64) error) (uint64, error) {
+	nd, err := get(c)
+	if err != nil {
+		return 0, err
+	}
+
+	var data []byte
+	var links []*ipld.Link
+	var sizes []uint64
+	switch n := nd.(type) {
+	case *merkledag.RawNode:
+		data = n.RawData()
+	case *merkledag.ProtoNode:
+		fsNode, err := unixfs.FSNodeFromBytes(n.Data())
+		if err != nil {
+			return 0, errors.Wrapf(err, "block %s is not a UnixFS node", c.String())
+		}
+		if fsNode.Type() != unixfs.TFile && fsNode.Type() != unixfs.TRaw {
+			return 0, fmt.Errorf("block %s is not part of a file", c.String())
+		}
+		if fsNode.NumChildren() != len(n.Links()) {
+			return 0, fmt.Errorf("block %s has %d links but sizes for %d", c.String(), len(n.Links()), fsNode.NumChildren())
+		}
+		data = fsNode.Data()
+		links = n.Links()
+		for i := range links {
+			sizes = append(sizes, fsNode.BlockSize(i))
+		}
+	default:
+		return 0, fmt.Errorf("unrecognized node type: %T", nd)
+	}
+
+	if err := visit(data, pos); err != nil {
+		return 0, err
+	}
+
+	size := uint64(len(data))
+	for i, l := range links {
+		if pos+size < end && pos+size+sizes[i] > offset {
+			if _, err := walkRange(get, l.Cid, pos+size, offset, end, visit); err != nil {
+				return 0, err
+			}
+		}
+		size += sizes[i]
+	}
+	return size, nil
+}
+
+// rangeBlocks returns the cids of the blocks of the range of the request, in the
+// order they are sent, and the number of bytes sending them takes.
+func rangeBlocks(ctx context.Context, dag ipld.DAGService, req *RetrievePieceRequest) ([]cid.Cid, uint64, error) {
+	var cids []cid.Cid
+	size := uint64(0)
+	get := func(c cid.Cid) (ipld.Node, error) {
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		cids = append(cids, c)
+		size += uint64(len(appendBlock(nil, nd.RawData())))
+		return nd, nil
+	}
+
+	noop := func([]byte, uint64) error { return nil }
+	if _, err := walkRange(get, req.PieceRef, 0, req.Offset, req.rangeEnd(), noop); err != nil {
+		return nil, 0, err
+	}
+	return cids, size, nil
+}
+
+// importPiece rebuilds the DAG of a piece into the DAG service from the piece's bytes
+// the way clients import data, and checks that it has the piece's cid.
+func importPiece(ctx context.Context, dag ipld.DAGService, pieceRef cid.Cid, piece io.Reader) error {
+	bufds := ipld.NewBufferedDAG(ctx, dag)
+	nd, err := imp.BuildDagFromReader(bufds, chunk.DefaultSplitter(piece))
+	if err != nil {
+		return errors.Wrap(err, "failed to rebuild the DAG of the piece")
+	}
+	if err := bufds.Commit(); err != nil {
+		return errors.Wrap(err, "failed to save the DAG of the piece")
+	}
+	if !nd.Cid().Equals(pieceRef) {
+		return fmt.Errorf("rebuilt DAG of piece %s has cid %s", pieceRef.String(), nd.Cid().String())
+	}
+	return nil
+}
+
+// copyRange reads the blocks of the range of the request from blocks, checking them
+// against the piece cid as they arrive, and writes the bytes of the range to w. It
+// returns the number of bytes written. The piece must have pieceSize bytes.
+func copyRange(req *RetrievePieceRequest, pieceSize uint64, blocks io.Reader, w io.Writer) (uint64, error) {
+	r := bufio.NewReader(blocks)
+	get := func(c cid.Cid) (ipld.Node, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "missing block %s", c.String())
+		}
+		if l > maxBlockSize {
+			return nil, fmt.Errorf("block %s has %d bytes", c.String(), l)
+		}
+		data := make([]byte, l)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errors.Wrapf(err, "block %s is cut short", c.String())
+		}
+		return decodeBlock(c, data)
+	}
+
+	written := uint64(0)
+	end := req.rangeEnd()
+	visit := func(data []byte, pos uint64) error {
+		from, to := pos, pos+uint64(len(data))
+		if from < req.Offset {
+			from = req.Offset
+		}
+		if to > end {
+			to = end
+		}
+		if from >= to {
+			return nil
+		}
+		n, err := w.Write(data[from-pos : to-pos])
+		written += uint64(n)
+		return err
+	}
+
+	size, err := walkRange(get, req.PieceRef, 0, req.Offset, end, visit)
+	if err != nil {
+		return written, err
+	}
+	if size != pieceSize {
+		return written, fmt.Errorf("piece has %d bytes instead of %d", size, pieceSize)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		if err != nil {
+			return written, err
+		}
+		return written, errors.New("miner sent data beyond the blocks of the range")
+	}
+	return written, nil
+}
+
+// decodeBlock decodes the data of a block after checking that it hashes to the cid.
+func decodeBlock(c cid.Cid, data []byte) (ipld.Node, error) {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("block doesn't hash to %s", c.String())
+	}
+
+	blk, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Type() {
+	case cid.DagProtobuf:
+		return merkledag.DecodeProtobufBlock(blk)
+	case cid.Raw:
+		return merkledag.DecodeRawBlock(blk)
+	default:
+		return nil, fmt.Errorf("block %s has unsupported codec %d", c.String(), c.Type())
+	}
+}
+
+// appendBlock appends the data of a block, prefixed with its length, to buf.
+func appendBlock(buf []byte, data []byte) []byte {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+	return append(append(buf, prefix[:n]...), data...)
+}
+
+// blockReader reads the length prefixed data of blocks, fetching them as it goes.
+type blockReader struct {
+	ctx  context.Context
+	dag  ipld.DAGService
+	cids []cid.Cid
+	buf  []byte
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if len(r.cids) == 0 {
+			return 0, io.EOF
+		}
+		nd, err := r.dag.Get(r.ctx, r.cids[0])
+		if err != nil {
+			return 0, err
+		}
+		r.cids = r.cids[1:]
+		r.buf = appendBlock(nil, nd.RawData())
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
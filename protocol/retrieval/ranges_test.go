@@ -0,0 +1,172 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-ipfs-blockstore"
+	chunk "github.com/ipfs/go-ipfs-chunker"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestRangedRetrieval(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	price := types.NewAttoFILFromFIL(2)
+
+	piece := make([]byte, 3*PaymentInterval+1000)
+	_, err := rand.Read(piece)
+	require.NoError(t, err)
+
+	t.Run("Retrieves and pays for the blocks of a range", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		pieceRef := api.pieceRef
+		miner, client := api.newMinerAndClient()
+
+		// The range straddles the first two leaves of the DAG.
+		req := &RetrievePieceRequest{PieceRef: pieceRef, Offset: uint64(chunk.DefaultBlockSize) - 100, Length: 200}
+		data, err := api.retrieveRange(ctx, miner, client, req, price)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece[req.Offset:req.Offset+req.Length], data))
+
+		cids, size, err := rangeBlocks(ctx, merkledag.NewDAGService(api.blocks), req)
+		require.NoError(err)
+		assert.Len(cids, 3)
+
+		cost := price.CalculatePrice(types.NewBytesAmount(size))
+		last, err := loadVoucher(miner.ds, api.payer, &api.vouchers[0].Channel)
+		require.NoError(err)
+		assert.True(cost.Equal(&last.Amount))
+	})
+
+	t.Run("Retrieves a range to the end of the piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, types.ZeroAttoFIL, piece)
+		pieceRef := api.pieceRef
+		miner, client := api.newMinerAndClient()
+
+		req := &RetrievePieceRequest{PieceRef: pieceRef, Offset: uint64(len(piece)) - 10}
+		data, err := api.retrieveRange(ctx, miner, client, req, nil)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece[len(piece)-10:], data))
+	})
+
+	t.Run("Rebuilds the blocks of the piece from the sealed sector", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, types.ZeroAttoFIL, piece)
+		pieceRef := api.pieceRef
+		miner, client := api.newMinerAndClient()
+		bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+		api.blocks = bserv.New(bs, offline.Exchange(bs))
+
+		req := &RetrievePieceRequest{PieceRef: pieceRef, Offset: 1000, Length: 1000}
+		data, err := api.retrieveRange(ctx, miner, client, req, nil)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece[1000:2000], data))
+
+		has, err := api.blocks.Blockstore().Has(pieceRef)
+		require.NoError(err)
+		assert.True(has)
+	})
+
+	t.Run("Limits how often a peer makes the miner unseal a piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, types.ZeroAttoFIL, piece)
+		pieceRef := api.pieceRef
+		miner, client := api.newMinerAndClient()
+		bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+		api.blocks = bserv.New(bs, offline.Exchange(bs))
+
+		req := &RetrievePieceRequest{PieceRef: pieceRef, Offset: 0, Length: 1}
+		_, err := api.retrieveRange(ctx, miner, client, req, nil)
+		require.NoError(err)
+
+		// The blocks are gone again, and the peer just made the miner unseal.
+		bs = blockstore.NewBlockstore(datastore.NewMapDatastore())
+		api.blocks = bserv.New(bs, offline.Exchange(bs))
+		_, err = api.retrieveRange(ctx, miner, client, req, nil)
+		require.Error(err)
+		assert.Contains(err.Error(), "piece must be unsealed")
+
+		// Other peers may still make the miner unseal.
+		assert.NoError(miner.allowUnseal(peer.ID("other")))
+	})
+
+	t.Run("Refuses a range past the end of the piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, types.ZeroAttoFIL, piece)
+		pieceRef := api.pieceRef
+		miner, client := api.newMinerAndClient()
+
+		req := &RetrievePieceRequest{PieceRef: pieceRef, Offset: uint64(len(piece))}
+		_, err := api.retrieveRange(ctx, miner, client, req, nil)
+		require.Error(err)
+		assert.Contains(err.Error(), "range starts at byte")
+	})
+
+	t.Run("Rejects blocks that don't match the piece cid", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, types.ZeroAttoFIL, piece)
+		pieceRef := api.pieceRef
+		req := &RetrievePieceRequest{PieceRef: pieceRef, Offset: 10, Length: 10}
+
+		dag := merkledag.NewDAGService(api.blocks)
+		cids, _, err := rangeBlocks(ctx, dag, req)
+		require.NoError(err)
+
+		var blocksData []byte
+		for _, c := range cids {
+			nd, err := dag.Get(ctx, c)
+			require.NoError(err)
+			blocksData = appendBlock(blocksData, nd.RawData())
+		}
+
+		pieceSize := uint64(len(piece))
+		var data bytes.Buffer
+		n, err := copyRange(req, pieceSize, bytes.NewReader(blocksData), &data)
+		require.NoError(err)
+		assert.Equal(uint64(10), n)
+		assert.True(bytes.Equal(piece[10:20], data.Bytes()))
+
+		tampered := append([]byte{}, blocksData...)
+		tampered[len(tampered)-1] ^= 0xff
+		_, err = copyRange(req, pieceSize, bytes.NewReader(tampered), &bytes.Buffer{})
+		require.Error(err)
+		assert.Contains(err.Error(), "doesn't hash to")
+
+		_, err = copyRange(req, pieceSize, bytes.NewReader(blocksData[:len(blocksData)-1]), &bytes.Buffer{})
+		assert.Error(err)
+
+		_, err = copyRange(req, pieceSize, bytes.NewReader(append(blocksData, 0)), &bytes.Buffer{})
+		assert.Error(err)
+
+		_, err = copyRange(req, pieceSize+1, bytes.NewReader(blocksData), &bytes.Buffer{})
+		require.Error(err)
+		assert.Contains(err.Error(), "piece has")
+	})
+}
@@ -36,12 +36,12 @@ func TestRetrievalProtocolPieceNotFound(t *testing.T) {
 	minerPID, err := minerNode.PorcelainAPI.MinerGetPeerID(ctx, minerAddr)
 	require.NoError(err)
 
-	_, err = retrievePieceBytes(ctx, minerNode.RetrievalAPI, someRandomCid, minerPID, minerAddr)
+	_, err = retrievePieceBytes(ctx, minerNode.RetrievalAPI, someRandomCid, minerPID)
 	require.Error(err)
 }
 
-func retrievePieceBytes(ctx context.Context, retrievalAPI *retrieval.API, data cid.Cid, minerPID peer.ID, addr address.Address) ([]byte, error) {
-	r, err := retrievalAPI.RetrievePiece(ctx, data, minerPID, addr)
+func retrievePieceBytes(ctx context.Context, retrievalAPI *retrieval.API, data cid.Cid, minerPID peer.ID) ([]byte, error) {
+	r, err := retrievalAPI.RetrievePiece(ctx, data, []peer.ID{minerPID}, 0, 0, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,196 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// retrieveAttempts is the number of transfers in a row that may break before the
+// client stops retrieving from a miner.
+const retrieveAttempts = 3
+
+// maxSegmentSize is the size of the largest segment the client retrieves from a
+// miner at a time. Segments retrieved ahead of the one the client writes are kept
+// in memory until their turn, so their size bounds the memory of a retrieval.
+const maxSegmentSize = 4 * PaymentInterval
+
+// segmentsAhead is the number of segments per miner the client retrieves ahead
+// of the one it writes.
+const segmentsAhead = 2
+
+// segment is a range of a piece the client retrieves from one miner at a time.
+type segment struct {
+	start, end uint64
+	// written is the number of bytes of the segment retrieved so far.
+	written uint64
+	// out receives the bytes of the segment: the reader of the retrieval for the
+	// first segment, buf for the others until the segments before them are read.
+	out io.Writer
+	buf *bytes.Buffer
+	// done is closed once the segment is retrieved.
+	done chan struct{}
+}
+
+// splitSegments splits [start, end) into a segment per miner, or into segments of
+// at most maxSize bytes when the range is larger.
+func splitSegments(start, end uint64, miners int, maxSize uint64, w io.Writer) []*segment {
+	var segments []*segment
+	size := (end - start + uint64(miners) - 1) / uint64(miners)
+	if size > maxSize {
+		size = maxSize
+	}
+	for s := start; s < end; s += size {
+		seg := &segment{
+			start: s,
+			end:   s + size,
+			done:  make(chan struct{}),
+		}
+		if seg.end > end {
+			seg.end = end
+		}
+		if len(segments) == 0 {
+			seg.out = w
+		}
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+// retrieveSegments retrieves the segments of a piece from the miners and writes them
+// to w in order. Each miner starts with a segment; when a transfer breaks, the rest of
+// its segment goes to the next miner that is free, which may be the same one. The
+// miners retrieve at most segmentsAhead segments each ahead of the one written to w.
+func (sc *Client) retrieveSegments(ctx context.Context, miners []peer.ID, pieceCID cid.Cid, pieceSize uint64, segments []*segment, maxPrice *types.AttoFIL, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Segments are queued once the segments more than segmentsAhead per miner
+	// before them are written, so at most ahead segments are ever queued.
+	ahead := segmentsAhead * len(miners)
+	queue := make(chan *segment, ahead)
+	queued := 0
+	enqueue := func(limit int) {
+		for ; queued < len(segments) && queued < limit; queued++ {
+			seg := segments[queued]
+			if seg.out == nil {
+				seg.buf = &bytes.Buffer{}
+				seg.out = seg.buf
+			}
+			queue <- seg
+		}
+	}
+	enqueue(ahead)
+
+	// Each miner pays from a channel funded for its share of the range.
+	size := segments[len(segments)-1].end - segments[0].start
+	share := (size + uint64(len(miners)) - 1) / uint64(len(miners))
+
+	var wg sync.WaitGroup
+	for _, miner := range miners {
+		wg.Add(1)
+		go func(miner peer.ID) {
+			defer wg.Done()
+			sc.retrieveFromMiner(ctx, miner, pieceCID, pieceSize, maxPrice, share, queue)
+		}(miner)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	for i, seg := range segments {
+		select {
+		case <-seg.done:
+		case <-stopped:
+			select {
+			case <-seg.done:
+			default:
+				return fmt.Errorf("no miner left to retrieve bytes %d to %d of the piece from", seg.start+seg.written, seg.end)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if seg.buf != nil {
+			if _, err := w.Write(seg.buf.Bytes()); err != nil {
+				return err
+			}
+			seg.buf = nil
+		}
+
+		enqueue(i + 1 + ahead)
+	}
+	return nil
+}
+
+// retrieveFromMiner retrieves the segments of the queue from a miner until the context
+// is done, paying for them from one channel funded for the miner's share of bytes of
+// the range. It gives up on the miner when it sends invalid data or after a few broken
+// transfers in a row, leaving its segment in the queue.
+func (sc *Client) retrieveFromMiner(ctx context.Context, miner peer.ID, pieceCID cid.Cid, pieceSize uint64, maxPrice *types.AttoFIL, share uint64, queue chan *segment) {
+	payments := &minerPayments{share: share}
+	defer sc.releasePayments(payments)
+
+	broken := 0
+	for {
+		var seg *segment
+		select {
+		case seg = <-queue:
+		case <-ctx.Done():
+			return
+		}
+
+		err := sc.retrieveSegment(ctx, miner, pieceCID, pieceSize, seg, maxPrice, payments)
+		if err == nil {
+			close(seg.done)
+			broken = 0
+			continue
+		}
+
+		log.Warningf("retrieval of piece %s from %s stopped at byte %d: %s", pieceCID.String(), miner.Pretty(), seg.start+seg.written, err)
+		queue <- seg
+
+		if _, ok := errors.Cause(err).(transferError); !ok {
+			return
+		}
+		broken++
+		if broken == retrieveAttempts {
+			return
+		}
+	}
+}
+
+// retrieveSegment retrieves the rest of the segment from the miner, paying for it
+// with payments.
+func (sc *Client) retrieveSegment(ctx context.Context, miner peer.ID, pieceCID cid.Cid, pieceSize uint64, seg *segment, maxPrice *types.AttoFIL, payments *minerPayments) error {
+	s, err := sc.openStream(ctx, miner)
+	if err != nil {
+		return transferError{err}
+	}
+	defer sc.safeCloseStream(s)
+
+	req := &RetrievePieceRequest{
+		PieceRef: pieceCID,
+		Offset:   seg.start + seg.written,
+		Length:   seg.end - seg.start - seg.written,
+	}
+	n, err := sc.receivePiece(ctx, s, req, pieceSize, maxPrice, payments, seg.out)
+	seg.written += n
+	if err != nil {
+		return err
+	}
+	if seg.written != seg.end-seg.start {
+		return fmt.Errorf("miner sent %d bytes of the %d of the range", n, req.Length)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	gonet "net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestRetrieveFromMiners(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	price := types.NewAttoFILFromFIL(2)
+
+	piece := make([]byte, 3*PaymentInterval+1000)
+	_, err := rand.Read(piece)
+	require.NoError(t, err)
+
+	t.Run("Splits the piece between the miners", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		_, client := api.newMinerAndClient()
+		streams := api.serveMiners(client, nil)
+
+		r, err := client.RetrievePiece(ctx, []peer.ID{"a", "b"}, api.pieceRef, 0, 0, price)
+		require.NoError(err)
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece, data))
+
+		// A segment each, after a query over the query protocol.
+		assert.Equal(1, streams["a"])
+		assert.Equal(1, streams["b"])
+		assert.Len(api.channels[api.payer], 2)
+	})
+
+	t.Run("Resumes a broken transfer from another miner", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		_, client := api.newMinerAndClient()
+
+		// The first segment breaks after its first payment, when it reaches b for good.
+		breaks := map[peer.ID]bool{"a": true}
+		api.serveMiners(client, breaks)
+
+		r, err := client.RetrievePiece(ctx, []peer.ID{"a", "b"}, api.pieceRef, 1000, 0, price)
+		require.NoError(err)
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece[1000:], data))
+	})
+
+	t.Run("Retrieves a range of many segments a few segments ahead", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		_, client := api.newMinerAndClient()
+		client.segmentSize = PaymentInterval / 4
+		api.serveMiners(client, nil)
+
+		var opened int32
+		serve := client.openStream
+		client.openStream = func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error) {
+			atomic.AddInt32(&opened, 1)
+			return serve(ctx, minerPeerID)
+		}
+
+		r, err := client.RetrievePiece(ctx, []peer.ID{"a", "b"}, api.pieceRef, 0, 0, price)
+		require.NoError(err)
+
+		// Nothing reads the first segment, so the miners stop once they are
+		// segmentsAhead segments each ahead of it.
+		time.Sleep(200 * time.Millisecond)
+		assert.True(atomic.LoadInt32(&opened) <= 2*segmentsAhead)
+
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece, data))
+
+		segments := (uint64(len(piece)) + client.segmentSize - 1) / client.segmentSize
+		assert.Equal(int32(segments), atomic.LoadInt32(&opened))
+	})
+
+	t.Run("Pays a miner from one channel for all its segments", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		_, client := api.newMinerAndClient()
+		client.segmentSize = PaymentInterval / 4
+		api.serveMiners(client, nil)
+
+		r, err := client.RetrievePiece(ctx, []peer.ID{"a"}, api.pieceRef, 0, 0, price)
+		require.NoError(err)
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.True(bytes.Equal(piece, data))
+
+		require.Len(api.channels[api.payer], 1)
+		for _, ch := range api.channels[api.payer] {
+			assert.True(api.vouchers[len(api.vouchers)-1].Amount.LessEqual(ch.Amount))
+		}
+	})
+
+	t.Run("Fails without a miner serving the piece", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		api := newTestPaymentAPI(t, price, piece)
+		_, client := api.newMinerAndClient()
+
+		_, err := client.RetrievePiece(ctx, []peer.ID{"a"}, api.pieceRef, 0, 0, nil)
+		require.Error(err)
+		assert.Contains(err.Error(), "use --max-price")
+	})
+}
+
+// serveMiners serves the client's queries and streams to each peer with a miner of its
+// own, and returns the number of paid retrieval streams the client opened to each peer.
+// The first stream to each peer in breaks breaks after a payment interval, and the
+// miners of the peers in breaks fail all the following streams.
+func (api *testPaymentAPI) serveMiners(client *Client, breaks map[peer.ID]bool) map[peer.ID]int {
+	var lk sync.Mutex
+	streams := make(map[peer.ID]int)
+	miners := make(map[peer.ID]*Miner)
+	minerOf := func(p peer.ID) *Miner {
+		if miners[p] == nil {
+			miners[p] = api.newMiner()
+		}
+		return miners[p]
+	}
+
+	client.openQueryStream = func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error) {
+		lk.Lock()
+		defer lk.Unlock()
+
+		miner := minerOf(minerPeerID)
+		minerEnd, clientEnd := gonet.Pipe()
+		go func() {
+			miner.answerQuery(minerEnd, minerPeerID) // nolint: errcheck
+			minerEnd.Close()                         // nolint: errcheck
+		}()
+		return clientEnd, nil
+	}
+	client.openStream = func(ctx context.Context, minerPeerID peer.ID) (io.ReadWriteCloser, error) {
+		lk.Lock()
+		defer lk.Unlock()
+
+		streams[minerPeerID]++
+		miner := minerOf(minerPeerID)
+		if breaks[minerPeerID] && streams[minerPeerID] > 1 {
+			return nil, errors.New("miner is gone")
+		}
+
+		conn := api.serve(ctx, miner)
+		if breaks[minerPeerID] && streams[minerPeerID] == 1 {
+			return &breakingConn{Conn: conn, left: PaymentInterval}, nil
+		}
+		return conn, nil
+	}
+	return streams
+}
+
+// breakingConn is a connection that breaks after reading a number of bytes.
+type breakingConn struct {
+	gonet.Conn
+	left int
+}
+
+func (c *breakingConn) Read(p []byte) (int, error) {
+	if c.left <= 0 {
+		c.Conn.Close() // nolint: errcheck
+		return 0, errors.New("connection broke")
+	}
+	if len(p) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.Conn.Read(p)
+	c.left -= n
+	return n, err
+}
@@ -3,12 +3,20 @@ package retrieval
 import (
 	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 func init() {
 	cbor.RegisterCborType(RetrievePieceRequest{})
 	cbor.RegisterCborType(RetrievePieceResponse{})
 	cbor.RegisterCborType(RetrievePieceChunk{})
+	cbor.RegisterCborType(RetrievalTerms{})
+	cbor.RegisterCborType(RetrievePiecePayment{})
+	cbor.RegisterCborType(RetrievalQuery{})
+	cbor.RegisterCborType(RetrievalOffer{})
 }
 
 // RetrievePieceStatus communicates a successful (or failed) piece retrieval
@@ -28,15 +36,71 @@ const (
 // RetrievePieceRequest represents a retrieval miner's request for content.
 type RetrievePieceRequest struct {
 	PieceRef cid.Cid
+
+	// Offset and Length select the range of the piece to retrieve over the paid
+	// protocol. A zero Length runs to the end of the piece.
+	Offset uint64 `refmt:",omitempty"`
+	Length uint64 `refmt:",omitempty"`
 }
 
 // RetrievePieceResponse contains the requested content.
 type RetrievePieceResponse struct {
 	Status       RetrievePieceStatus
 	ErrorMessage string
+
+	// Terms are the terms of a paid retrieval, sent by the miner on success.
+	Terms *RetrievalTerms `refmt:",omitempty"`
+}
+
+// RetrievalTerms are the terms on which a miner serves a piece over the paid
+// retrieval protocol.
+type RetrievalTerms struct {
+	// Size is the size in bytes of the blocks the miner sends for the range.
+	Size uint64
+	// PieceSize is the size of the piece in bytes.
+	PieceSize uint64
+	// Price is the price per byte sent. A zero price makes the retrieval free.
+	Price *types.AttoFIL
+	// PaymentAddress is the target of the payment channel the client pays from.
+	PaymentAddress address.Address
+	// PaymentInterval is the number of bytes the miner sends before it waits to be
+	// paid for them.
+	PaymentInterval uint64
+}
+
+// RetrievePiecePayment pays a miner for the bytes received so far.
+type RetrievePiecePayment struct {
+	// Voucher is a voucher for the total amount the client promised the miner on
+	// the channel, including the amount of previous retrievals.
+	Voucher *paymentbroker.PaymentVoucher
+	// ChannelMsgCid is the cid of the message that created the channel, which the
+	// miner waits for when it doesn't know the channel yet.
+	ChannelMsgCid *cid.Cid `refmt:",omitempty"`
 }
 
 // RetrievePieceChunk is a subset of bytes for a piece being retrieved.
 type RetrievePieceChunk struct {
 	Data []byte
 }
+
+// RetrievalQuery asks a miner whether it serves a piece, and on what terms.
+type RetrievalQuery struct {
+	PieceRef cid.Cid
+}
+
+// RetrievalOffer is a miner's answer to a RetrievalQuery.
+type RetrievalOffer struct {
+	// Status is Success when the miner serves the piece.
+	Status       RetrievePieceStatus
+	ErrorMessage string
+
+	// Miner is the address of the miner storing the piece.
+	Miner address.Address
+	// PieceSize is the size of the piece in bytes.
+	PieceSize uint64
+	// Price is the price per byte the miner charges for retrieval.
+	Price *types.AttoFIL
+	// UnsealDelay is an estimate, in seconds, of the time the miner takes to unseal
+	// the piece before it can send it.
+	UnsealDelay uint64
+}
@@ -2,29 +2,37 @@ package storage
 
 import (
 	"context"
+	"io"
 
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
-// API here is the API for a storage client.
+// API here is the API for a storage client and the node's storage miners.
 type API struct {
-	sc *Client
+	sc     *Client
+	miners *MinerRouter
 }
 
-// NewAPI creates a new API for a storage client.
-func NewAPI(storageClient *Client) API {
-	return API{sc: storageClient}
+// NewAPI creates a new API for a storage client and the storage miners of the router.
+func NewAPI(storageClient *Client, miners *MinerRouter) API {
+	return API{sc: storageClient, miners: miners}
 }
 
 // ProposeStorageDeal calls the storage client ProposeDeal function
 func (a *API) ProposeStorageDeal(ctx context.Context, data cid.Cid, miner address.Address,
-	askid uint64, duration uint64, allowDuplicates bool) (*storagedeal.Response, error) {
+	askid uint64, duration uint64, allowDuplicates bool, manualTransfer bool, maxPrice *types.AttoFIL) (*storagedeal.Response, error) {
 
-	return a.sc.ProposeDeal(ctx, miner, data, askid, duration, allowDuplicates)
+	return a.sc.ProposeDeal(ctx, miner, data, askid, duration, allowDuplicates, manualTransfer, maxPrice)
+}
+
+// StoreData proposes deals to store data with several miners picked automatically
+func (a *API) StoreData(ctx context.Context, data cid.Cid, params StoreParams) (*StoreResult, error) {
+	return a.sc.Store(ctx, data, params)
 }
 
 // QueryStorageDeal calls the storage client QueryDeal function
@@ -32,6 +40,17 @@ func (a *API) QueryStorageDeal(ctx context.Context, prop cid.Cid) (*storagedeal.
 	return a.sc.QueryDeal(ctx, prop)
 }
 
+// ListStorageDeals returns the deals the storage client made
+func (a *API) ListStorageDeals() ([]*storagedeal.Deal, error) {
+	return a.sc.ListDeals()
+}
+
+// ImportDealData imports the data of a manual transfer deal into the storage
+// miner the deal was made with.
+func (a *API) ImportDealData(ctx context.Context, proposalCid cid.Cid, data io.Reader) (*storagedeal.Response, error) {
+	return a.miners.ImportDealData(ctx, proposalCid, data)
+}
+
 // Payments calls the storage client LoadVouchersForDeal function
 func (a *API) Payments(ctx context.Context, dealCid cid.Cid) ([]*paymentbroker.PaymentVoucher, error) {
 	return a.sc.LoadVouchersForDeal(dealCid)
@@ -53,6 +53,7 @@ const (
 
 type clientPorcelainAPI interface {
 	ChainBlockHeight() (*types.BlockHeight, error)
+	ClientListAsks(ctx context.Context) <-chan porcelain.Ask
 	CreatePayments(ctx context.Context, config porcelain.CreatePaymentsParams) (*porcelain.CreatePaymentsReturn, error)
 	DealGet(cid.Cid) *storagedeal.Deal
 	DAGGetFileSize(context.Context, cid.Cid) (uint64, error)
@@ -62,8 +63,12 @@ type clientPorcelainAPI interface {
 	MinerGetAsk(ctx context.Context, minerAddr address.Address, askID uint64) (miner.Ask, error)
 	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
 	MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error)
+	MinerGetPower(ctx context.Context, minerAddr address.Address) (*big.Int, error)
+	MinerGetProvingPeriodStart(ctx context.Context, minerAddr address.Address) (*types.BlockHeight, error)
+	MinerGetSectorCommitments(ctx context.Context, minerAddr address.Address) (map[string]types.Commitments, error)
 	types.Signer
 	NetworkPing(ctx context.Context, p peer.ID) (<-chan time.Duration, error)
+	WalletAddresses() []address.Address
 	WalletDefaultAddress() (address.Address, error)
 }
 
@@ -89,8 +94,12 @@ func NewClient(blockTime time.Duration, host host.Host, api clientPorcelainAPI)
 }
 
 // ProposeDeal proposes a storage deal to a miner.  Pass allowDuplicates = true to
-// allow duplicate proposals without error.
-func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, allowDuplicates bool) (*storagedeal.Response, error) {
+// allow duplicate proposals without error. The client checks the terms of the proposal
+// with the miner before it creates the payments. When the miner answers with a
+// counter-offer at a price of at most maxPrice per byte per block, and a duration range
+// including the proposed duration, the client proposes the deal at the miner's price. A
+// nil maxPrice declines all counter-offers.
+func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, allowDuplicates bool, manualTransfer bool, maxPrice *types.AttoFIL) (*storagedeal.Response, error) {
 	ctxSetup, cancel := context.WithTimeout(ctx, 5*smc.GetBlockTime())
 	defer cancel()
 
@@ -125,53 +134,118 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	}
 	price := ask.Price
 
-	chainHeight, err := smc.api.ChainBlockHeight()
+	totalPrice := price.MulBigInt(big.NewInt(int64(size * duration)))
+
+	proposal := &storagedeal.Proposal{
+		PieceRef:       data,
+		Size:           types.NewBytesAmount(size),
+		TotalPrice:     totalPrice,
+		Duration:       duration,
+		MinerAddress:   miner,
+		ManualTransfer: manualTransfer,
+	}
+
+	if smc.isMaybeDupDeal(proposal) && !allowDuplicates {
+		return nil, Errors[ErrDuplicateDeal]
+	}
+
+	// see if we managed to connect to the miner
+	select {
+	case err := <-minerAlive:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctxSetup.Done():
+		return nil, ctxSetup.Err()
+	}
+
+	// Agree on the terms with the miner before funding a payment channel, so that
+	// a counter-offer doesn't leave a funded channel behind.
+	terms, err := smc.checkTerms(ctx, pid, proposal)
 	if err != nil {
 		return nil, err
 	}
+	switch terms.State {
+	case storagedeal.Accepted:
+	case storagedeal.CounterOffered:
+		proposal, err = counterProposal(proposal, terms, maxPrice)
+		if err != nil {
+			return nil, err
+		}
+		smc.log.Debugf("accepting counter-offer of %s at %s", miner.String(), terms.CounterOffer.Price)
+	default:
+		return nil, errors.Wrap(smc.checkDealResponse(ctx, terms), "response check failed")
+	}
+
+	response, err := smc.sendProposal(ctx, pid, proposal)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := smc.checkDealResponse(ctx, response); err != nil {
+		return nil, errors.Wrap(err, "response check failed")
+	}
+
+	// Note: currently the miner requests the data out of band
+
+	if err := smc.recordResponse(response, miner, proposal); err != nil {
+		return nil, errors.Wrap(err, "failed to track response")
+	}
+	smc.log.Debugf("proposed deal for: %s, %v\n", miner.String(), proposal)
 
+	return response, nil
+}
+
+// checkTerms sends the proposal to the miner without payments, and returns the
+// response the miner would give to it: accepted, rejected or counter-offered.
+func (smc *Client) checkTerms(ctx context.Context, pid peer.ID, proposal *storagedeal.Proposal) (*storagedeal.Response, error) {
 	fromAddress, err := smc.api.WalletDefaultAddress()
 	if err != nil {
 		return nil, err
 	}
 
-	minerOwner, err := smc.api.MinerGetOwnerAddress(ctxSetup, miner)
+	unpaid := *proposal
+	unpaid.Payment = storagedeal.PaymentInfo{Payer: fromAddress}
+	signedProposal, err := unpaid.NewSignedProposal(fromAddress, smc.api)
 	if err != nil {
 		return nil, err
 	}
 
-	totalPrice := price.MulBigInt(big.NewInt(int64(size * duration)))
+	var response storagedeal.Response
+	if err := smc.ProtocolRequestFunc(ctx, dealTermsProtocol, pid, smc.host, signedProposal, &response); err != nil {
+		return nil, errors.Wrap(err, "error checking proposal terms")
+	}
+	return &response, nil
+}
 
-	proposal := &storagedeal.Proposal{
-		PieceRef:     data,
-		Size:         types.NewBytesAmount(size),
-		TotalPrice:   totalPrice,
-		Duration:     duration,
-		MinerAddress: miner,
+// sendProposal creates the payments of the proposal, signs it and sends it to the miner.
+func (smc *Client) sendProposal(ctx context.Context, pid peer.ID, proposal *storagedeal.Proposal) (*storagedeal.Response, error) {
+	ctxSetup, cancel := context.WithTimeout(ctx, 5*smc.GetBlockTime())
+	defer cancel()
+
+	chainHeight, err := smc.api.ChainBlockHeight()
+	if err != nil {
+		return nil, err
 	}
 
-	if smc.isMaybeDupDeal(proposal) && !allowDuplicates {
-		return nil, Errors[ErrDuplicateDeal]
+	fromAddress, err := smc.api.WalletDefaultAddress()
+	if err != nil {
+		return nil, err
 	}
 
-	// see if we managed to connect to the miner
-	select {
-	case err := <-minerAlive:
-		if err != nil {
-			return nil, err
-		}
-	case <-ctxSetup.Done():
-		return nil, ctxSetup.Err()
+	minerOwner, err := smc.api.MinerGetOwnerAddress(ctxSetup, proposal.MinerAddress)
+	if err != nil {
+		return nil, err
 	}
 
 	// create payment information
 	cpResp, err := smc.api.CreatePayments(ctxSetup, porcelain.CreatePaymentsParams{
 		From:            fromAddress,
 		To:              minerOwner,
-		Value:           *price.MulBigInt(big.NewInt(int64(size * duration))),
-		Duration:        duration,
+		Value:           *proposal.TotalPrice,
+		Duration:        proposal.Duration,
 		PaymentInterval: VoucherInterval,
-		ChannelExpiry:   *chainHeight.Add(types.NewBlockHeight(duration + ChannelExpiryInterval)),
+		ChannelExpiry:   *chainHeight.Add(types.NewBlockHeight(proposal.Duration + ChannelExpiryInterval)),
 		GasPrice:        *types.NewAttoFIL(big.NewInt(CreateChannelGasPrice)),
 		GasLimit:        types.NewGasUnits(CreateChannelGasLimit),
 	})
@@ -198,19 +272,31 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	if err != nil {
 		return nil, errors.Wrap(err, "error sending proposal")
 	}
+	return &response, nil
+}
 
-	if err := smc.checkDealResponse(ctx, &response); err != nil {
-		return nil, errors.Wrap(err, "response check failed")
+// counterProposal returns a proposal of the same data on the terms of the miner's counter-offer,
+// or an error if the terms are outside of the client's limits.
+func counterProposal(p *storagedeal.Proposal, resp *storagedeal.Response, maxPrice *types.AttoFIL) (*storagedeal.Proposal, error) {
+	offer := resp.CounterOffer
+	if offer == nil {
+		return nil, fmt.Errorf("miner made a counter-offer without terms: %s", resp.Message)
 	}
-
-	// Note: currently the miner requests the data out of band
-
-	if err := smc.recordResponse(&response, miner, proposal); err != nil {
-		return nil, errors.Wrap(err, "failed to track response")
+	if !offer.AcceptsDuration(p.Duration) {
+		return nil, fmt.Errorf("miner made a counter-offer for durations of %d to %d blocks: %s", offer.MinDuration, offer.MaxDuration, resp.Message)
+	}
+	if maxPrice == nil || offer.Price.GreaterThan(maxPrice) {
+		return nil, fmt.Errorf("miner made a counter-offer at a price of %s: %s; use --max-price to accept it", offer.Price, resp.Message)
 	}
-	smc.log.Debugf("proposed deal for: %s, %v\n", miner.String(), proposal)
 
-	return &response, nil
+	return &storagedeal.Proposal{
+		PieceRef:       p.PieceRef,
+		Size:           p.Size,
+		TotalPrice:     offer.Price.MulBigInt(big.NewInt(0).SetUint64(p.Size.Uint64() * p.Duration)),
+		Duration:       p.Duration,
+		MinerAddress:   p.MinerAddress,
+		ManualTransfer: p.ManualTransfer,
+	}, nil
 }
 
 func (smc *Client) pingMiner(ctx context.Context, pid peer.ID, timeout time.Duration) error {
@@ -259,6 +345,8 @@ func (smc *Client) checkDealResponse(ctx context.Context, resp *storagedeal.Resp
 		return fmt.Errorf("deal rejected: %s", resp.Message)
 	case storagedeal.Failed:
 		return fmt.Errorf("deal failed: %s", resp.Message)
+	case storagedeal.CounterOffered:
+		return fmt.Errorf("miner made another counter-offer: %s", resp.Message)
 	case storagedeal.Accepted:
 		return nil
 	default:
@@ -2,7 +2,9 @@ package storage_test
 
 import (
 	"context"
+	"errors"
 	"math/big"
+	"sync"
 	"testing"
 	"time"
 
@@ -59,7 +61,7 @@ func TestProposeDeal(t *testing.T) {
 	minerAddr := addressCreator()
 	askID := uint64(67)
 	duration := uint64(10000)
-	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, false)
+	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, false, false, nil)
 	require.NoError(err)
 
 	t.Run("and creates proposal from parameters", func(t *testing.T) {
@@ -115,6 +117,289 @@ func TestProposeDeal(t *testing.T) {
 	})
 }
 
+func TestProposeDealCounterOffer(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	dataCid := types.SomeCid()
+	duration := uint64(10000)
+	offeredPrice := types.NewAttoFILFromFIL(40)
+
+	// The test miner counter-offers all proposals below its price.
+	var proposals []*storagedeal.SignedDealProposal
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		p := request.(*storagedeal.SignedDealProposal)
+		proposals = append(proposals, p)
+
+		pcid, err := convert.ToCid(p.Proposal)
+		if err != nil {
+			return nil, err
+		}
+		expectedPrice := offeredPrice.MulBigInt(big.NewInt(int64(p.Size.Uint64() * p.Duration)))
+		if p.TotalPrice.LessThan(expectedPrice) {
+			return &storagedeal.Response{
+				State:        storagedeal.CounterOffered,
+				Message:      "price too low",
+				ProposalCid:  pcid,
+				CounterOffer: &storagedeal.CounterOffer{Price: offeredPrice, MinDuration: 1000},
+			}, nil
+		}
+		return &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: pcid}, nil
+	})
+
+	t.Run("accepts counter-offers within the max price", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		proposals = nil
+		testAPI := newTestClientAPI(require)
+		client := NewClient(testNode.GetBlockTime(), th.NewFakeHost(), testAPI)
+		client.ProtocolRequestFunc = testNode.MakeTestProtocolRequest
+
+		resp, err := client.ProposeDeal(ctx, address.TestAddress2, dataCid, 0, duration, false, false, types.NewAttoFILFromFIL(50))
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, resp.State)
+
+		// The terms are agreed on before a single payment channel is created.
+		require.Len(proposals, 2)
+		assert.Nil(proposals[0].Payment.Channel)
+		assert.Equal(1, testAPI.paymentsCreated)
+		expectedPrice := offeredPrice.MulBigInt(big.NewInt(int64(proposals[1].Size.Uint64() * duration)))
+		assert.True(expectedPrice.Equal(proposals[1].TotalPrice))
+
+		storageDeal := testAPI.DealGet(resp.ProposalCid)
+		require.NotNil(storageDeal)
+		assert.True(expectedPrice.Equal(storageDeal.Proposal.TotalPrice))
+	})
+
+	t.Run("declines counter-offers above the max price", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		proposals = nil
+		testAPI := newTestClientAPI(require)
+		client := NewClient(testNode.GetBlockTime(), th.NewFakeHost(), testAPI)
+		client.ProtocolRequestFunc = testNode.MakeTestProtocolRequest
+
+		_, err := client.ProposeDeal(ctx, address.TestAddress2, dataCid, 0, duration, false, false, types.NewAttoFILFromFIL(35))
+		require.Error(err)
+		assert.Contains(err.Error(), "miner made a counter-offer at a price of 40: price too low")
+		assert.Len(proposals, 1)
+		assert.Equal(0, testAPI.paymentsCreated)
+
+		_, err = client.ProposeDeal(ctx, address.TestAddress2, dataCid, 0, duration, false, false, nil)
+		require.Error(err)
+		assert.Contains(err.Error(), "use --max-price to accept it")
+	})
+}
+
+func TestCheckDeals(t *testing.T) {
+	tf.UnitTest(t)
+
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.Background()
+	cidGetter := types.NewCidForTestGetter()
+	minerAddr := address.NewForTestGetter()()
+
+	minerResponses := make(map[cid.Cid]*storagedeal.Response)
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		q, ok := request.(storagedeal.QueryRequest)
+		require.True(ok)
+		resp, ok := minerResponses[q.Cid]
+		if !ok {
+			return &storagedeal.Response{State: storagedeal.Unknown, Message: "no such deal"}, nil
+		}
+		return resp, nil
+	})
+
+	testAPI := newTestClientAPI(require)
+	client := NewClient(testNode.GetBlockTime(), th.NewFakeHost(), testAPI)
+	client.ProtocolRequestFunc = testNode.MakeTestProtocolRequest
+
+	newDeal := func(payer address.Address, state storagedeal.State, info *storagedeal.ProofInfo) *storagedeal.Deal {
+		d := &storagedeal.Deal{
+			Miner:    minerAddr,
+			Proposal: &storagedeal.Proposal{Payment: storagedeal.PaymentInfo{Payer: payer}},
+			Response: &storagedeal.Response{State: state, ProposalCid: cidGetter(), ProofInfo: info},
+		}
+		require.NoError(testAPI.DealPut(d))
+		return d
+	}
+
+	committed := newDeal(testAPI.payer, storagedeal.Posted, &storagedeal.ProofInfo{SectorID: 1, CommR: []byte{1}})
+	minerResponses[committed.Response.ProposalCid] = &storagedeal.Response{
+		State:       storagedeal.Complete,
+		ProposalCid: committed.Response.ProposalCid,
+		ProofInfo:   committed.Response.ProofInfo,
+	}
+	comms := types.Commitments{}
+	comms.CommR[0] = 1
+	testAPI.commitments["1"] = comms
+
+	uncommitted := newDeal(testAPI.payer, storagedeal.Posted, &storagedeal.ProofInfo{SectorID: 2, CommR: []byte{2}})
+	minerResponses[uncommitted.Response.ProposalCid] = uncommitted.Response
+
+	forgotten := newDeal(testAPI.payer, storagedeal.Staged, nil)
+	failed := newDeal(testAPI.payer, storagedeal.Failed, nil)
+	notOurs := newDeal(testAPI.target, storagedeal.Staged, nil)
+
+	deals, err := client.ListDeals()
+	require.NoError(err)
+	assert.Len(deals, 4)
+
+	require.NoError(client.CheckDeals(ctx))
+
+	assert.Equal(storagedeal.Complete, committed.Response.State)
+	assert.True(committed.Health.Healthy())
+	assert.Equal(testAPI.blockHeight, committed.Health.CheckedAt)
+
+	assert.Equal([]string{"sector 2 is not committed on chain"}, uncommitted.Health.Problems)
+	assert.Equal([]string{"miner doesn't know the deal"}, forgotten.Health.Problems)
+	assert.Nil(failed.Health)
+	assert.Nil(notOurs.Health)
+
+	t.Run("flags miners that stopped submitting PoSts", func(t *testing.T) {
+		testAPI.blockHeight = testAPI.provingPeriodStart.Add(miner.ProvingPeriodBlocks).Add(types.NewBlockHeight(1))
+		require.NoError(client.CheckDeals(ctx))
+
+		require.Len(committed.Health.Problems, 1)
+		assert.Contains(committed.Health.Problems[0], "miner has not submitted a PoSt")
+	})
+}
+
+func TestStore(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	addressCreator := address.NewForTestGetter()
+	cidGetter := types.NewCidForTestGetter()
+
+	cheap := addressCreator()
+	cheapPowerful := addressCreator()
+	expensive := addressCreator()
+	overpriced := addressCreator()
+	expired := addressCreator()
+	unreliable := addressCreator()
+
+	// The rejecting miner rejects every proposal, the others accept them.
+	newStoreClient := func(require *require.Assertions, rejecting address.Address) (*Client, *clientTestAPI) {
+		testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+			p, ok := request.(*storagedeal.SignedDealProposal)
+			if !ok {
+				return nil, errors.New("unexpected request")
+			}
+			pcid, err := convert.ToCid(p.Proposal)
+			if err != nil {
+				return nil, err
+			}
+			if p.MinerAddress == rejecting {
+				return &storagedeal.Response{State: storagedeal.Rejected, Message: "no room", ProposalCid: pcid}, nil
+			}
+			return &storagedeal.Response{State: storagedeal.Accepted, Message: "OK", ProposalCid: pcid}, nil
+		})
+
+		testAPI := newTestClientAPI(require)
+		expiry := types.NewBlockHeight(1000)
+		testAPI.asks = []porcelain.Ask{
+			{Miner: expensive, Price: types.NewAttoFILFromFIL(10), Expiry: expiry, ID: 1},
+			{Miner: cheap, Price: types.NewAttoFILFromFIL(20), Expiry: expiry, ID: 2},
+			{Miner: cheap, Price: types.NewAttoFILFromFIL(5), Expiry: expiry, ID: 3},
+			{Miner: cheapPowerful, Price: types.NewAttoFILFromFIL(5), Expiry: expiry, ID: 4},
+			{Miner: overpriced, Price: types.NewAttoFILFromFIL(20), Expiry: expiry, ID: 5},
+			{Miner: expired, Price: types.NewAttoFILFromFIL(1), Expiry: types.NewBlockHeight(10), ID: 6},
+		}
+		testAPI.powers[cheap] = big.NewInt(1)
+		testAPI.powers[cheapPowerful] = big.NewInt(2)
+		testAPI.powers[expensive] = big.NewInt(1)
+		testAPI.powers[overpriced] = big.NewInt(1)
+		testAPI.powers[expired] = big.NewInt(1)
+
+		client := NewClient(testNode.GetBlockTime(), th.NewFakeHost(), testAPI)
+		client.ProtocolRequestFunc = testNode.MakeTestProtocolRequest
+		return client, testAPI
+	}
+
+	dealMiners := func(result *StoreResult) []address.Address {
+		var miners []address.Address
+		for _, d := range result.Deals {
+			miners = append(miners, d.Miner)
+		}
+		return miners
+	}
+
+	t.Run("Stores with the cheapest miners, most powerful first", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		client, _ := newStoreClient(require, address.Undef)
+		result, err := client.Store(ctx, cidGetter(), StoreParams{Replicas: 1, Duration: 2000, MaxPrice: types.NewAttoFILFromFIL(15)})
+		require.NoError(err)
+		assert.Equal([]address.Address{cheapPowerful}, dealMiners(result))
+		assert.Empty(result.Failures)
+
+		result, err = client.Store(ctx, cidGetter(), StoreParams{Replicas: 2, Duration: 2000, MaxPrice: types.NewAttoFILFromFIL(15)})
+		require.NoError(err)
+		assert.ElementsMatch([]address.Address{cheapPowerful, cheap}, dealMiners(result))
+	})
+
+	t.Run("Proposes to the next miner when a miner rejects the proposal", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		client, _ := newStoreClient(require, cheap)
+		result, err := client.Store(ctx, cidGetter(), StoreParams{Replicas: 2, Duration: 2000, MaxPrice: types.NewAttoFILFromFIL(15)})
+		require.NoError(err)
+		assert.ElementsMatch([]address.Address{cheapPowerful, expensive}, dealMiners(result))
+		require.Len(result.Failures, 1)
+		assert.Equal(cheap, result.Failures[0].Miner)
+		assert.Contains(result.Failures[0].Error, "no room")
+	})
+
+	t.Run("Stores with fewer miners than replicas when no miner remains", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		client, _ := newStoreClient(require, address.Undef)
+		result, err := client.Store(ctx, cidGetter(), StoreParams{Replicas: 5, Duration: 2000, MaxPrice: types.NewAttoFILFromFIL(15)})
+		require.NoError(err)
+		assert.ElementsMatch([]address.Address{cheapPowerful, cheap, expensive}, dealMiners(result))
+	})
+
+	t.Run("Ranks miners whose past deals failed last", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		client, testAPI := newStoreClient(require, address.Undef)
+		testAPI.powers[unreliable] = big.NewInt(10)
+		testAPI.asks = append(testAPI.asks, porcelain.Ask{Miner: unreliable, Price: types.NewAttoFILFromFIL(1), Expiry: types.NewBlockHeight(1000), ID: 7})
+		for i := 0; i < 2; i++ {
+			require.NoError(testAPI.DealPut(&storagedeal.Deal{
+				Miner:    unreliable,
+				Proposal: &storagedeal.Proposal{PieceRef: cidGetter(), Payment: storagedeal.PaymentInfo{Payer: testAPI.payer}},
+				Response: &storagedeal.Response{State: storagedeal.Failed, ProposalCid: cidGetter()},
+			}))
+		}
+
+		result, err := client.Store(ctx, cidGetter(), StoreParams{Replicas: 1, Duration: 2000, MaxPrice: types.NewAttoFILFromFIL(15)})
+		require.NoError(err)
+		assert.Equal([]address.Address{cheapPowerful}, dealMiners(result))
+	})
+
+	t.Run("Fails when no miner accepts a deal", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+
+		client, _ := newStoreClient(require, address.Undef)
+		_, err := client.Store(ctx, cidGetter(), StoreParams{Replicas: 1, Duration: 2000, MaxPrice: types.NewAttoFILFromFIL(1)})
+		require.Error(err)
+		assert.Contains(err.Error(), "no miner has an ask within the maximum price")
+
+		_, err = client.Store(ctx, cidGetter(), StoreParams{Replicas: 0, Duration: 2000})
+		assert.Error(err)
+	})
+}
+
 type clientTestAPI struct {
 	blockHeight *types.BlockHeight
 	channelID   *types.ChannelID
@@ -123,7 +408,18 @@ type clientTestAPI struct {
 	target      address.Address
 	perPayment  *types.AttoFIL
 	require     *require.Assertions
-	deals       map[cid.Cid]*storagedeal.Deal
+
+	dealsLk sync.Mutex
+	deals   map[cid.Cid]*storagedeal.Deal
+
+	commitments        map[string]types.Commitments
+	provingPeriodStart *types.BlockHeight
+
+	asks   []porcelain.Ask
+	powers map[address.Address]*big.Int
+
+	// paymentsCreated counts the calls to CreatePayments.
+	paymentsCreated int
 }
 
 func newTestClientAPI(require *require.Assertions) *clientTestAPI {
@@ -139,6 +435,11 @@ func newTestClientAPI(require *require.Assertions) *clientTestAPI {
 		perPayment:  types.NewAttoFILFromFIL(10),
 		require:     require,
 		deals:       make(map[cid.Cid]*storagedeal.Deal),
+
+		commitments:        make(map[string]types.Commitments),
+		provingPeriodStart: types.NewBlockHeight(700),
+
+		powers: make(map[address.Address]*big.Int),
 	}
 }
 
@@ -146,7 +447,17 @@ func (ctp *clientTestAPI) ChainBlockHeight() (*types.BlockHeight, error) {
 	return ctp.blockHeight, nil
 }
 
+func (ctp *clientTestAPI) ClientListAsks(ctx context.Context) <-chan porcelain.Ask {
+	out := make(chan porcelain.Ask, len(ctp.asks))
+	for _, ask := range ctp.asks {
+		out <- ask
+	}
+	close(out)
+	return out
+}
+
 func (ctp *clientTestAPI) CreatePayments(ctx context.Context, config porcelain.CreatePaymentsParams) (*porcelain.CreatePaymentsReturn, error) {
+	ctp.paymentsCreated++
 	resp := &porcelain.CreatePaymentsReturn{
 		CreatePaymentsParams: config,
 		Channel:              ctp.channelID,
@@ -190,6 +501,22 @@ func (ctp *clientTestAPI) MinerGetPeerID(ctx context.Context, minerAddr address.
 	return id, nil
 }
 
+func (ctp *clientTestAPI) MinerGetPower(ctx context.Context, minerAddr address.Address) (*big.Int, error) {
+	power, ok := ctp.powers[minerAddr]
+	if !ok {
+		return nil, errors.New("miner not found")
+	}
+	return power, nil
+}
+
+func (ctp *clientTestAPI) MinerGetProvingPeriodStart(ctx context.Context, minerAddr address.Address) (*types.BlockHeight, error) {
+	return ctp.provingPeriodStart, nil
+}
+
+func (ctp *clientTestAPI) MinerGetSectorCommitments(ctx context.Context, minerAddr address.Address) (map[string]types.Commitments, error) {
+	return ctp.commitments, nil
+}
+
 func (ctp *clientTestAPI) NetworkPing(ctx context.Context, p peer.ID) (<-chan time.Duration, error) {
 	out := make(chan time.Duration, 1)
 	out <- 0
@@ -201,6 +528,10 @@ func (ctp *clientTestAPI) SignBytes(data []byte, addr address.Address) (types.Si
 	return testSignature, nil
 }
 
+func (ctp *clientTestAPI) WalletAddresses() []address.Address {
+	return []address.Address{ctp.payer}
+}
+
 func (ctp *clientTestAPI) WalletDefaultAddress() (address.Address, error) {
 	// always just default address
 	return ctp.payer, nil
@@ -234,6 +565,9 @@ func (tcn *testClientNode) MakeTestProtocolRequest(ctx context.Context, protocol
 }
 
 func (ctp *clientTestAPI) DealsLs() ([]*storagedeal.Deal, error) {
+	ctp.dealsLk.Lock()
+	defer ctp.dealsLk.Unlock()
+
 	var results []*storagedeal.Deal
 
 	for _, storageDeal := range ctp.deals {
@@ -243,10 +577,16 @@ func (ctp *clientTestAPI) DealsLs() ([]*storagedeal.Deal, error) {
 }
 
 func (ctp *clientTestAPI) DealGet(dealCid cid.Cid) *storagedeal.Deal {
+	ctp.dealsLk.Lock()
+	defer ctp.dealsLk.Unlock()
+
 	return ctp.deals[dealCid]
 }
 
 func (ctp *clientTestAPI) DealPut(storageDeal *storagedeal.Deal) error {
+	ctp.dealsLk.Lock()
+	defer ctp.dealsLk.Unlock()
+
 	ctp.deals[storageDeal.Response.ProposalCid] = storageDeal
 	return nil
 }
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// DealMonitorRounds is the number of rounds between two checks of the client's deals.
+const DealMonitorRounds = 10
+
+// ListDeals returns the deals the client made, which are the deals paid from
+// one of the node's wallet addresses.
+func (smc *Client) ListDeals() ([]*storagedeal.Deal, error) {
+	deals, err := smc.api.DealsLs()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list deals")
+	}
+
+	payers := make(map[address.Address]bool)
+	for _, addr := range smc.api.WalletAddresses() {
+		payers[addr] = true
+	}
+
+	var clientDeals []*storagedeal.Deal
+	for _, d := range deals {
+		if payers[d.Proposal.Payment.Payer] {
+			clientDeals = append(clientDeals, d)
+		}
+	}
+	return clientDeals, nil
+}
+
+// MonitorDeals checks the client's deals every DealMonitorRounds rounds until
+// the context is done.
+func (smc *Client) MonitorDeals(ctx context.Context) {
+	ticker := time.NewTicker(DealMonitorRounds * smc.blockTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := smc.CheckDeals(ctx); err != nil {
+				smc.log.Warningf("failed to check storage deals: %s", err)
+			}
+		}
+	}
+}
+
+// CheckDeals queries the miners of the client's deals for their state and
+// checks that the miners keep the sectors holding the deals on chain and keep
+// submitting proofs of spacetime for them. It records the result in the deals'
+// health. Rejected and failed deals are not checked.
+func (smc *Client) CheckDeals(ctx context.Context) error {
+	deals, err := smc.ListDeals()
+	if err != nil {
+		return err
+	}
+
+	height, err := smc.api.ChainBlockHeight()
+	if err != nil {
+		return errors.Wrap(err, "could not get chain height")
+	}
+
+	for _, d := range deals {
+		if d.Response.State == storagedeal.Rejected || d.Response.State == storagedeal.Failed {
+			continue
+		}
+
+		d.Health = smc.checkDeal(ctx, d, height)
+		for _, problem := range d.Health.Problems {
+			smc.log.Warningf("storage deal %s with miner %s: %s", d.Response.ProposalCid, d.Miner, problem)
+		}
+		if err := smc.api.DealPut(d); err != nil {
+			return errors.Wrap(err, "could not save deal")
+		}
+	}
+	return nil
+}
+
+// checkDeal updates the deal with the miner's response and returns the deal's health.
+func (smc *Client) checkDeal(ctx context.Context, d *storagedeal.Deal, height *types.BlockHeight) *storagedeal.Health {
+	health := &storagedeal.Health{CheckedAt: height}
+	problem := func(format string, args ...interface{}) {
+		health.Problems = append(health.Problems, fmt.Sprintf(format, args...))
+	}
+
+	resp, err := smc.QueryDeal(ctx, d.Response.ProposalCid)
+	switch {
+	case err != nil:
+		problem("could not query miner: %s", err)
+	case resp.State == storagedeal.Unknown:
+		problem("miner doesn't know the deal")
+	default:
+		d.Response = resp
+	}
+
+	// The miner sends the proof info once the sector holding the deal is committed.
+	info := d.Response.ProofInfo
+	if info == nil {
+		return health
+	}
+
+	commitments, err := smc.api.MinerGetSectorCommitments(ctx, d.Miner)
+	if err != nil {
+		problem("could not get sector commitments of miner: %s", err)
+	} else if comms, ok := commitments[strconv.FormatUint(info.SectorID, 10)]; !ok {
+		problem("sector %d is not committed on chain", info.SectorID)
+	} else if !bytes.Equal(comms.CommR[:], info.CommR) {
+		problem("commR of sector %d on chain doesn't match the miner's proof", info.SectorID)
+	}
+
+	start, err := smc.api.MinerGetProvingPeriodStart(ctx, d.Miner)
+	if err != nil {
+		problem("could not get proving period of miner: %s", err)
+	} else if end := start.Add(miner.ProvingPeriodBlocks); height.GreaterThan(end) {
+		problem("miner has not submitted a PoSt since its proving period ended at block %s", end)
+	}
+
+	return health
+}
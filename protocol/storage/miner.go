@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
 	"strconv"
 	"sync"
@@ -13,11 +14,10 @@ import (
 	cid "github.com/ipfs/go-cid"
 	datastore "github.com/ipfs/go-datastore"
 	cbor "github.com/ipfs/go-ipld-cbor"
+	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log"
 	dag "github.com/ipfs/go-merkledag"
 	uio "github.com/ipfs/go-unixfs/io"
-	host "github.com/libp2p/go-libp2p-host"
-	inet "github.com/libp2p/go-libp2p-net"
 	"github.com/libp2p/go-libp2p-protocol"
 	"github.com/pkg/errors"
 
@@ -25,7 +25,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
-	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
@@ -39,6 +39,7 @@ var log = logging.Logger("/fil/storage")
 
 const makeDealProtocol = protocol.ID("/fil/storage/mk/1.0.0")
 const queryDealProtocol = protocol.ID("/fil/storage/qry/1.0.0")
+const dealTermsProtocol = protocol.ID("/fil/storage/terms/1.0.0")
 
 // TODO: replace this with a queries to pick reasonable gas price and limits.
 const submitPostGasPrice = 0
@@ -46,6 +47,13 @@ const submitPostGasLimit = 300
 
 const waitForPaymentChannelDuration = 2 * time.Minute
 
+// announceTimeout is how long a miner tries to announce a piece it committed.
+const announceTimeout = time.Minute
+
+// reprovideInterval is how often a miner announces the pieces it committed again.
+// The records of announcements expire after a day.
+const reprovideInterval = 12 * time.Hour
+
 const dealsAwatingSealDatastorePrefix = "dealsAwaitingSeal"
 
 // Miner represents a storage miner.
@@ -58,6 +66,9 @@ type Miner struct {
 	postInProcessLk sync.Mutex
 	postInProcess   *types.BlockHeight
 
+	// dealsLk serializes the client quota checks with the recording of accepted deals.
+	dealsLk sync.Mutex
+
 	dealsAwaitingSeal *dealsAwaitingSealStruct
 
 	porcelainAPI minerPorcelain
@@ -75,6 +86,8 @@ type minerPorcelain interface {
 	ChainSampleRandomness(ctx context.Context, sampleHeight *types.BlockHeight) ([]byte, error)
 	ConfigGet(dottedPath string) (interface{}, error)
 
+	DAGImportData(ctx context.Context, data io.Reader) (ipld.Node, error)
+
 	DealsLs() ([]*storagedeal.Deal, error)
 	DealGet(cid.Cid) *storagedeal.Deal
 	DealPut(*storagedeal.Deal) error
@@ -82,6 +95,13 @@ type minerPorcelain interface {
 	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, error)
 	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+
+	NetworkProvide(ctx context.Context, key cid.Cid) error
+}
+
+// dealGetter gets deals from the deals store.
+type dealGetter interface {
+	DealGet(cid.Cid) *storagedeal.Deal
 }
 
 // node is subset of node on which this protocol depends. These deps
@@ -90,7 +110,6 @@ type minerPorcelain interface {
 type node interface {
 	GetBlockTime() time.Duration
 	BlockService() bserv.BlockService
-	Host() host.Host
 	SectorBuilder() sectorbuilder.SectorBuilder
 }
 
@@ -125,33 +144,9 @@ func NewMiner(minerAddr, minerOwnerAddr address.Address, nd node, dealsDs repo.D
 	sm.dealsAwaitingSeal.onSuccess = sm.onCommitSuccess
 	sm.dealsAwaitingSeal.onFail = sm.onCommitFail
 
-	nd.Host().SetStreamHandler(makeDealProtocol, sm.handleMakeDeal)
-	nd.Host().SetStreamHandler(queryDealProtocol, sm.handleQueryDeal)
-
 	return sm, nil
 }
 
-func (sm *Miner) handleMakeDeal(s inet.Stream) {
-	defer s.Close() // nolint: errcheck
-
-	var signedProposal storagedeal.SignedDealProposal
-	if err := cbu.NewMsgReader(s).ReadMsg(&signedProposal); err != nil {
-		log.Errorf("received invalid proposal: %s", err)
-		return
-	}
-
-	ctx := context.Background()
-	resp, err := sm.receiveStorageProposal(ctx, &signedProposal)
-	if err != nil {
-		log.Errorf("failed to process proposal: %s", err)
-		return
-	}
-
-	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
-		log.Errorf("failed to write proposal response: %s", err)
-	}
-}
-
 // receiveStorageProposal is the entry point for the miner storage protocol
 func (sm *Miner) receiveStorageProposal(ctx context.Context, sp *storagedeal.SignedDealProposal) (*storagedeal.Response, error) {
 	// Validate deal signature
@@ -165,6 +160,20 @@ func (sm *Miner) receiveStorageProposal(ctx context.Context, sp *storagedeal.Sig
 		return sm.proposalRejector(sm, p, fmt.Sprint("invalid deal signature"))
 	}
 
+	// Check the operator's policy before waiting on the payment channel
+	if err := sm.validateDealPolicy(p); err != nil {
+		return sm.proposalRejector(sm, p, err.Error())
+	}
+
+	// Counter-offer mismatching terms before waiting on the payment channel
+	offer, reason, err := sm.counterOffer(p)
+	if err != nil {
+		return sm.proposalRejector(sm, p, err.Error())
+	}
+	if offer != nil {
+		return counterOfferProposal(sm, p, offer, reason)
+	}
+
 	if err := sm.validateDealPayment(ctx, p); err != nil {
 		return sm.proposalRejector(sm, p, err.Error())
 	}
@@ -178,10 +187,81 @@ func (sm *Miner) receiveStorageProposal(ctx context.Context, sp *storagedeal.Sig
 		return sm.proposalRejector(sm, p, fmt.Sprintf("piece is %s bytes but sector size is %d bytes", sp.Size.String(), sectorSize))
 	}
 
+	if err := sm.decideDeal(ctx, p); err != nil {
+		return sm.proposalRejector(sm, p, err.Error())
+	}
+
+	// Check the client's quota and record the deal under one lock, so that concurrent
+	// proposals from the client can't both fit in what is left of its quota
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+	if err := sm.validateClientQuota(p); err != nil {
+		return sm.proposalRejector(sm, p, err.Error())
+	}
+
 	// Payment is valid, everything else checks out, let's accept this proposal
 	return sm.proposalAcceptor(sm, p)
 }
 
+// checkDealTerms answers a proposal that is not paid for yet with the response
+// the miner would give once it is: rejected, counter-offered, or accepted when
+// its terms suit the miner. Nothing is stored, so that clients agree on terms
+// before they fund a payment channel.
+func (sm *Miner) checkDealTerms(ctx context.Context, sp *storagedeal.SignedDealProposal) (*storagedeal.Response, error) {
+	p := &sp.Proposal
+	proposalCid, err := convert.ToCid(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cid of proposal")
+	}
+	resp := &storagedeal.Response{
+		State:       storagedeal.Accepted,
+		ProposalCid: proposalCid,
+	}
+
+	bdp, err := p.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if !types.IsValidSignature(bdp, p.Payment.Payer, sp.Signature) {
+		resp.State, resp.Message = storagedeal.Rejected, "invalid deal signature"
+		return resp, nil
+	}
+
+	if err := sm.validateDealPolicy(p); err != nil {
+		resp.State, resp.Message = storagedeal.Rejected, err.Error()
+		return resp, nil
+	}
+	if err := sm.validateClientQuota(p); err != nil {
+		resp.State, resp.Message = storagedeal.Rejected, err.Error()
+		return resp, nil
+	}
+
+	offer, reason, err := sm.counterOffer(p)
+	if err != nil {
+		resp.State, resp.Message = storagedeal.Rejected, err.Error()
+		return resp, nil
+	}
+	if offer != nil {
+		resp.State, resp.Message, resp.CounterOffer = storagedeal.CounterOffered, reason, offer
+		return resp, nil
+	}
+
+	sectorSize, err := sm.getSectorSize(ctx)
+	if err != nil {
+		resp.State, resp.Message = storagedeal.Rejected, "failed to get sector size"
+		return resp, nil
+	}
+	if p.Size.GreaterThan(types.NewBytesAmount(sectorSize)) {
+		resp.State, resp.Message = storagedeal.Rejected, fmt.Sprintf("piece is %s bytes but sector size is %d bytes", p.Size.String(), sectorSize)
+		return resp, nil
+	}
+
+	if err := sm.decideDeal(ctx, p); err != nil {
+		resp.State, resp.Message = storagedeal.Rejected, err.Error()
+	}
+	return resp, nil
+}
+
 func (sm *Miner) validateDealPayment(ctx context.Context, p *storagedeal.Proposal) error {
 	// compute expected total price for deal (storage price * duration * bytes)
 	price, err := sm.getStoragePrice()
@@ -274,16 +354,17 @@ func (sm *Miner) validateDealPayment(ctx context.Context, p *storagedeal.Proposa
 	return nil
 }
 
+// getStoragePrice returns the price of storage of the miner.
 func (sm *Miner) getStoragePrice() (*types.AttoFIL, error) {
-	storagePrice, err := sm.porcelainAPI.ConfigGet("mining.storagePrice")
+	mining, err := sm.porcelainAPI.ConfigGet("mining")
 	if err != nil {
 		return nil, err
 	}
-	storagePriceAF, ok := storagePrice.(*types.AttoFIL)
+	miningConfig, ok := mining.(*config.MiningConfig)
 	if !ok {
 		return nil, errors.New("Could not retrieve storagePrice from config")
 	}
-	return storagePriceAF, nil
+	return miningConfig.StoragePriceOf(sm.minerAddr), nil
 }
 
 // some parts of this should be porcelain
@@ -378,6 +459,33 @@ func rejectProposal(sm *Miner, p *storagedeal.Proposal, reason string) (*storage
 	return resp, nil
 }
 
+// counterOfferProposal answers a proposal with the terms the miner would accept instead.
+func counterOfferProposal(sm *Miner, p *storagedeal.Proposal, offer *storagedeal.CounterOffer, reason string) (*storagedeal.Response, error) {
+	proposalCid, err := convert.ToCid(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cid of proposal")
+	}
+
+	resp := &storagedeal.Response{
+		State:        storagedeal.CounterOffered,
+		ProposalCid:  proposalCid,
+		Message:      reason,
+		Signature:    types.Signature("signaturrreee"),
+		CounterOffer: offer,
+	}
+
+	storageDeal := &storagedeal.Deal{
+		Miner:    sm.minerAddr,
+		Proposal: p,
+		Response: resp,
+	}
+	if err := sm.porcelainAPI.DealPut(storageDeal); err != nil {
+		return nil, errors.Wrap(err, "failed to save miner deal")
+	}
+
+	return resp, nil
+}
+
 func (sm *Miner) updateDealResponse(proposalCid cid.Cid, f func(*storagedeal.Response)) error {
 	storageDeal := sm.porcelainAPI.DealGet(proposalCid)
 	if storageDeal == nil {
@@ -393,6 +501,38 @@ func (sm *Miner) updateDealResponse(proposalCid cid.Cid, f func(*storagedeal.Res
 	return nil
 }
 
+// transitionDeal moves the deal to the next state and applies f, if any, to its
+// response. It is an error if the deal can't move from its state to the next.
+func (sm *Miner) transitionDeal(proposalCid cid.Cid, next storagedeal.State, f func(*storagedeal.Response)) error {
+	var invalid error
+	err := sm.updateDealResponse(proposalCid, func(resp *storagedeal.Response) {
+		if !resp.State.CanTransitionTo(next) {
+			invalid = fmt.Errorf("deal %s can't move from state %s to %s", proposalCid, resp.State, next)
+			return
+		}
+		resp.State = next
+		if f != nil {
+			f(resp)
+		}
+	})
+	if invalid != nil {
+		return invalid
+	}
+	return err
+}
+
+// failDeal moves the deal to the Failed state with the message.
+func (sm *Miner) failDeal(proposalCid cid.Cid, message string) {
+	err := sm.transitionDeal(proposalCid, storagedeal.Failed, func(resp *storagedeal.Response) {
+		resp.Message = message
+	})
+	if err != nil {
+		log.Errorf("could not update deal to 'Failed' state: %s", err)
+	}
+}
+
+// processStorageDeal transfers the data of an accepted deal and stages it into
+// a sector. It resumes the processing of a deal interrupted while transferring.
 func (sm *Miner) processStorageDeal(c cid.Cid) {
 	log.Debugf("Miner.processStorageDeal(%s)", c.String())
 	ctx, cancel := context.WithCancel(context.Background())
@@ -401,10 +541,36 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 	d := sm.porcelainAPI.DealGet(c)
 	if d == nil {
 		log.Errorf("could not retrieve deal with proposal CID %s", c.String())
+		return
 	}
-	if d.Response.State != storagedeal.Accepted {
-		// TODO: handle resumption of deal processing across miner restarts
-		log.Error("attempted to process an already started deal")
+	if d.Response.State != storagedeal.Accepted && d.Response.State != storagedeal.Transferring {
+		log.Errorf("attempted to process deal %s in state %s", c.String(), d.Response.State)
+		return
+	}
+
+	// A restart may have interrupted the deal after its piece was added to a sector.
+	if _, ok := sm.dealsAwaitingSeal.sectorOf(c); ok {
+		if err := sm.transitionDeal(c, storagedeal.Staged, nil); err != nil {
+			log.Errorf("could not update deal to 'Staged' state: %s", err)
+		}
+		return
+	}
+
+	if d.Response.State == storagedeal.Accepted {
+		err := sm.transitionDeal(c, storagedeal.Transferring, func(resp *storagedeal.Response) {
+			if d.Proposal.ManualTransfer {
+				resp.Message = "awaiting import of deal data"
+			}
+		})
+		if err != nil {
+			log.Errorf("could not update deal to 'Transferring' state: %s", err)
+			return
+		}
+	}
+
+	// The data of a manual transfer deal arrives with ImportDealData.
+	if d.Proposal.ManualTransfer {
+		log.Infof("deal %s awaits import of its data", c.String())
 		return
 	}
 
@@ -414,40 +580,63 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 	log.Debug("Miner.processStorageDeal - FetchGraph")
 	if err := dag.FetchGraph(ctx, d.Proposal.PieceRef, dag.NewDAGService(sm.node.BlockService())); err != nil {
 		log.Errorf("failed to fetch data: %s", err)
-		err := sm.updateDealResponse(c, func(resp *storagedeal.Response) {
-			resp.Message = "Transfer failed"
-			resp.State = storagedeal.Failed
-			// TODO: signature?
-		})
-		if err != nil {
-			log.Errorf("could not update to deal to 'Failed' state: %s", err)
-		}
+		// TODO: signature?
+		sm.failDeal(c, "Transfer failed")
 		return
 	}
 
-	fail := func(message, logerr string) {
-		log.Errorf(logerr)
-		err := sm.updateDealResponse(c, func(resp *storagedeal.Response) {
-			resp.Message = message
-			resp.State = storagedeal.Failed
-		})
-		if err != nil {
-			log.Errorf("could not update to deal to 'Failed' state in fail callback: %s", err)
-		}
+	if err := sm.stageDealData(ctx, c, d); err != nil {
+		log.Errorf("failed to stage data of deal %s: %s", c.String(), err)
+	}
+}
+
+// ImportDealData imports the data of a manual transfer deal awaiting it, checks
+// that it is the deal's piece and stages it into a sector. Data that isn't the
+// piece is rejected and the deal keeps waiting.
+func (sm *Miner) ImportDealData(ctx context.Context, c cid.Cid, data io.Reader) error {
+	d := sm.porcelainAPI.DealGet(c)
+	if d == nil {
+		return fmt.Errorf("no deal with proposal %s", c.String())
+	}
+	if !d.Proposal.ManualTransfer {
+		return fmt.Errorf("deal %s doesn't transfer its data manually", c.String())
+	}
+	if d.Response.State != storagedeal.Transferring {
+		return fmt.Errorf("deal %s isn't awaiting data, it is %s", c.String(), d.Response.State)
+	}
+	if _, ok := sm.dealsAwaitingSeal.sectorOf(c); ok {
+		return fmt.Errorf("data of deal %s was already imported", c.String())
+	}
+
+	nd, err := sm.porcelainAPI.DAGImportData(ctx, data)
+	if err != nil {
+		return errors.Wrap(err, "failed to import deal data")
+	}
+	if !nd.Cid().Equals(d.Proposal.PieceRef) {
+		return fmt.Errorf("imported data hashes to %s, not to the deal's piece %s", nd.Cid().String(), d.Proposal.PieceRef.String())
+	}
+
+	return sm.stageDealData(ctx, c, d)
+}
+
+// stageDealData adds the piece of a deal, whose data is available locally, to a
+// sector. It fails the deal if the piece can't be added.
+func (sm *Miner) stageDealData(ctx context.Context, c cid.Cid, d *storagedeal.Deal) error {
+	fail := func(message, logerr string) error {
+		sm.failDeal(c, message)
+		return errors.New(logerr)
 	}
 
 	dagService := dag.NewDAGService(sm.node.BlockService())
 
 	rootIpldNode, err := dagService.Get(ctx, d.Proposal.PieceRef)
 	if err != nil {
-		fail("internal error", fmt.Sprintf("failed to add piece: %s", err))
-		return
+		return fail("internal error", fmt.Sprintf("failed to add piece: %s", err))
 	}
 
 	r, err := uio.NewDagReader(ctx, rootIpldNode, dagService)
 	if err != nil {
-		fail("internal error", fmt.Sprintf("failed to add piece: %s", err))
-		return
+		return fail("internal error", fmt.Sprintf("failed to add piece: %s", err))
 	}
 
 	// There is a race here that requires us to use dealsAwaitingSeal below. If the
@@ -461,23 +650,82 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 	// the call is inelegant.
 	sectorID, err := sm.node.SectorBuilder().AddPiece(ctx, d.Proposal.PieceRef, d.Proposal.Size.Uint64(), r)
 	if err != nil {
-		fail("failed to submit seal proof", fmt.Sprintf("failed to add piece: %s", err))
-		return
-	}
-
-	err = sm.updateDealResponse(c, func(resp *storagedeal.Response) {
-		resp.State = storagedeal.Staged
-	})
-	if err != nil {
-		log.Errorf("could update to 'Staged': %s", err)
+		return fail("failed to submit seal proof", fmt.Sprintf("failed to add piece: %s", err))
 	}
 
-	// Careful: this might update state to success or failure so it should go after
-	// updating state to Staged.
+	// Record the sector before updating the state to Staged so that a resumed deal
+	// is never staged twice. This might update the state to Posted or Failed, in
+	// which case the deal can't move back to Staged.
 	sm.dealsAwaitingSeal.add(sectorID, c)
 	if err := sm.saveDealsAwaitingSeal(); err != nil {
 		log.Errorf("could not save deal awaiting seal: %s", err)
 	}
+
+	if err := sm.transitionDeal(c, storagedeal.Staged, nil); err != nil {
+		log.Debugf("did not update deal to 'Staged' state: %s", err)
+	}
+	return nil
+}
+
+// ResumeDeals resumes the processing of the miner's deals that a restart
+// interrupted, from the last state they durably reached. Deals accepted or
+// transferring are transferred again. Staged and sealing deals wait for their
+// sector, unless its commitment is already on chain. Deals whose sector is
+// unknown can't make progress and fail.
+func (sm *Miner) ResumeDeals(ctx context.Context) error {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		return errors.Wrap(err, "failed to list deals")
+	}
+
+	var commitments map[string]types.Commitments
+	for _, d := range deals {
+		if d.Miner != sm.minerAddr || d.Response == nil {
+			continue
+		}
+		c := d.Response.ProposalCid
+
+		switch d.Response.State {
+		case storagedeal.Accepted, storagedeal.Transferring:
+			log.Infof("resuming transfer of deal %s", c)
+			go sm.processStorageDeal(c)
+		case storagedeal.Staged, storagedeal.Sealing:
+			// The deal may have been posted with another deal of its sector.
+			if current := sm.porcelainAPI.DealGet(c); current == nil || current.Response.State != d.Response.State {
+				continue
+			}
+			sectorID, ok := sm.dealsAwaitingSeal.sectorOf(c)
+			if !ok {
+				sm.failDeal(c, "deal processing interrupted")
+				continue
+			}
+			if commitments == nil {
+				if commitments, err = sm.getActorSectorCommitments(ctx); err != nil {
+					return errors.Wrap(err, "failed to get miner actor commitments")
+				}
+			}
+			// The sector was committed but the node stopped before recording it.
+			if comm, ok := commitments[strconv.FormatUint(sectorID, 10)]; ok {
+				sm.OnCommitmentAddedToChain(&sectorbuilder.SealedSectorMetadata{
+					SectorID:  sectorID,
+					CommD:     comm.CommD,
+					CommR:     comm.CommR,
+					CommRStar: comm.CommRStar,
+				}, nil)
+			}
+		}
+	}
+	return nil
+}
+
+// OnSectorSealed is a callback, called when a sector was sealed, before its
+// commitment is posted to the chain.
+func (sm *Miner) OnSectorSealed(sectorID uint64) {
+	for _, dealCid := range sm.dealsAwaitingSeal.deals(sectorID) {
+		if err := sm.transitionDeal(dealCid, storagedeal.Sealing, nil); err != nil {
+			log.Errorf("could not update deal to 'Sealing' state: %s", err)
+		}
+	}
 }
 
 // dealsAwaitingSealStruct is a container for keeping track of which sectors have
@@ -505,7 +753,7 @@ func (sm *Miner) loadDealsAwaitingSeal() error {
 		FailedSectors:     make(map[uint64]string),
 	}
 
-	key := datastore.KeyWithNamespaces([]string{dealsAwatingSealDatastorePrefix})
+	key := sm.dealsAwaitingSealKey()
 	result, notFound := sm.dealsAwaitingSealDs.Get(key)
 	if notFound == nil {
 		if err := json.Unmarshal(result, &sm.dealsAwaitingSeal); err != nil {
@@ -516,12 +764,44 @@ func (sm *Miner) loadDealsAwaitingSeal() error {
 	return nil
 }
 
+// dealsAwaitingSealKey is the datastore key of the miner's deals awaiting
+// seal. Miners of the same node share the datastore so the key names the miner.
+func (sm *Miner) dealsAwaitingSealKey() datastore.Key {
+	return datastore.KeyWithNamespaces([]string{dealsAwatingSealDatastorePrefix, sm.minerAddr.String()})
+}
+
+// MigrateDealsAwaitingSeal moves the deals awaiting seal a node stored before
+// it ran several miners, under the key without a miner address, to the key of
+// minerAddr. Nodes call it for their default miner, which owns those deals,
+// before creating its storage miner.
+func MigrateDealsAwaitingSeal(dealsDs repo.Datastore, minerAddr address.Address) error {
+	legacyKey := datastore.NewKey(dealsAwatingSealDatastorePrefix)
+	legacy, err := dealsDs.Get(legacyKey)
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read legacy deals awaiting seal")
+	}
+
+	key := datastore.KeyWithNamespaces([]string{dealsAwatingSealDatastorePrefix, minerAddr.String()})
+	if has, err := dealsDs.Has(key); err != nil {
+		return errors.Wrap(err, "failed to check deals awaiting seal")
+	} else if !has {
+		if err := dealsDs.Put(key, legacy); err != nil {
+			return errors.Wrap(err, "failed to save migrated deals awaiting seal")
+		}
+	}
+
+	return errors.Wrap(dealsDs.Delete(legacyKey), "failed to delete legacy deals awaiting seal")
+}
+
 func (sm *Miner) saveDealsAwaitingSeal() error {
 	marshalledDealsAwaitingSeal, err := json.Marshal(sm.dealsAwaitingSeal)
 	if err != nil {
 		return errors.Wrap(err, "Could not marshal dealsAwaitingSeal")
 	}
-	key := datastore.KeyWithNamespaces([]string{dealsAwatingSealDatastorePrefix})
+	key := sm.dealsAwaitingSealKey()
 	err = sm.dealsAwaitingSealDs.Put(key, marshalledDealsAwaitingSeal)
 	if err != nil {
 		return errors.Wrap(err, "could not save deal awaiting seal record to disk, in-memory deals differ from persisted deals!")
@@ -558,6 +838,29 @@ func (dealsAwaitingSeal *dealsAwaitingSealStruct) add(sectorID uint64, dealCid c
 	}
 }
 
+// sectorOf returns the sector of a deal awaiting seal.
+func (dealsAwaitingSeal *dealsAwaitingSealStruct) sectorOf(dealCid cid.Cid) (uint64, bool) {
+	dealsAwaitingSeal.l.Lock()
+	defer dealsAwaitingSeal.l.Unlock()
+
+	for sectorID, deals := range dealsAwaitingSeal.SectorsToDeals {
+		for _, c := range deals {
+			if c.Equals(dealCid) {
+				return sectorID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// deals returns the deals awaiting the seal of a sector.
+func (dealsAwaitingSeal *dealsAwaitingSealStruct) deals(sectorID uint64) []cid.Cid {
+	dealsAwaitingSeal.l.Lock()
+	defer dealsAwaitingSeal.l.Unlock()
+
+	return append([]cid.Cid{}, dealsAwaitingSeal.SectorsToDeals[sectorID]...)
+}
+
 func (dealsAwaitingSeal *dealsAwaitingSealStruct) success(sector *sectorbuilder.SealedSectorMetadata) {
 	dealsAwaitingSeal.l.Lock()
 	defer dealsAwaitingSeal.l.Unlock()
@@ -601,25 +904,107 @@ func (sm *Miner) OnCommitmentAddedToChain(sector *sectorbuilder.SealedSectorMeta
 }
 
 func (sm *Miner) onCommitSuccess(dealCid cid.Cid, sector *sectorbuilder.SealedSectorMetadata) {
-	err := sm.updateDealResponse(dealCid, func(resp *storagedeal.Response) {
-		resp.State = storagedeal.Posted
+	committedAt, err := sm.porcelainAPI.ChainBlockHeight()
+	if err != nil {
+		log.Errorf("failed to get the block height of the commitment of deal %s: %s", dealCid, err)
+		return
+	}
+
+	err = sm.transitionDeal(dealCid, storagedeal.Posted, func(resp *storagedeal.Response) {
 		resp.ProofInfo = &storagedeal.ProofInfo{
-			SectorID: sector.SectorID,
-			CommR:    sector.CommR[:],
-			CommD:    sector.CommD[:],
+			SectorID:    sector.SectorID,
+			CommR:       sector.CommR[:],
+			CommD:       sector.CommD[:],
+			CommittedAt: committedAt,
 		}
 	})
 	if err != nil {
 		log.Errorf("commit succeeded but could not update to deal 'Posted' state: %s", err)
+		return
+	}
+
+	if deal := sm.porcelainAPI.DealGet(dealCid); deal != nil {
+		go sm.announcePiece(context.Background(), deal.Proposal.PieceRef)
+	}
+}
+
+// ProvidePieces announces the pieces of the miner's committed deals to the network,
+// then again every reprovideInterval until the context is done, so that retrieval
+// clients find them after the node restarts and after earlier announcements expire.
+func (sm *Miner) ProvidePieces(ctx context.Context) {
+	ticker := time.NewTicker(reprovideInterval)
+	defer ticker.Stop()
+
+	for {
+		sm.announcePieces(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// announcePieces announces the pieces of the miner's committed deals.
+func (sm *Miner) announcePieces(ctx context.Context) {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		log.Errorf("failed to list deals: %s", err)
+		return
+	}
+
+	announced := make(map[cid.Cid]bool)
+	for _, d := range deals {
+		if d.Miner != sm.minerAddr || d.Response == nil || d.Response.State != storagedeal.Posted {
+			continue
+		}
+		if pieceRef := d.Proposal.PieceRef; !announced[pieceRef] {
+			announced[pieceRef] = true
+			sm.announcePiece(ctx, pieceRef)
+		}
+	}
+}
+
+// announcePiece announces to the network that the miner provides the piece, so that
+// retrieval clients can find it.
+func (sm *Miner) announcePiece(ctx context.Context, pieceRef cid.Cid) {
+	ctx, cancel := context.WithTimeout(ctx, announceTimeout)
+	defer cancel()
+
+	if err := sm.porcelainAPI.NetworkProvide(ctx, pieceRef); err != nil {
+		log.Warningf("failed to announce piece %s: %s", pieceRef.String(), err)
+	}
+}
+
+// completeDeals moves the posted deals of the miner whose duration has passed
+// since their sector was committed to the Complete state.
+func (sm *Miner) completeDeals(height *types.BlockHeight) {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		log.Errorf("failed to list deals: %s", err)
+		return
+	}
+
+	for _, d := range deals {
+		if d.Miner != sm.minerAddr || d.Response == nil || d.Response.State != storagedeal.Posted {
+			continue
+		}
+		proofInfo := d.Response.ProofInfo
+		if proofInfo == nil || proofInfo.CommittedAt == nil {
+			continue
+		}
+		if height.LessThan(proofInfo.CommittedAt.Add(types.NewBlockHeight(d.Proposal.Duration))) {
+			continue
+		}
+		if err := sm.transitionDeal(d.Response.ProposalCid, storagedeal.Complete, nil); err != nil {
+			log.Errorf("could not update deal to 'Complete' state: %s", err)
+		}
 	}
 }
 
 func (sm *Miner) onCommitFail(dealCid cid.Cid, message string) {
-	err := sm.updateDealResponse(dealCid, func(resp *storagedeal.Response) {
-		resp.Message = message
-		resp.State = storagedeal.Failed
-	})
-	log.Errorf("commit failure but could not update to deal 'Failed' state: %s", err)
+	sm.failDeal(dealCid, message)
 }
 
 // currentProvingPeriodPoStChallengeSeed produces a PoSt challenge seed for
@@ -702,11 +1087,20 @@ func (sm *Miner) getActorSectorCommitments(ctx context.Context) (map[string]type
 }
 
 // OnNewHeaviestTipSet is a callback called by node, every time the the latest
-// head is updated. It is used to check if we are in a new proving period and
-// need to trigger PoSt submission.
+// head is updated. It completes the deals whose duration has passed, and checks
+// if we are in a new proving period and need to trigger PoSt submission.
 func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 	ctx := context.Background()
 
+	height, err := ts.Height()
+	if err != nil {
+		log.Errorf("failed to get block height: %s", err)
+		return
+	}
+	h := types.NewBlockHeight(height)
+
+	sm.completeDeals(h)
+
 	isBootstrapMinerActor, err := sm.isBootstrapMinerActor(ctx)
 	if err != nil {
 		log.Errorf("could not determine if actor created for bootstrapping: %s", err)
@@ -759,13 +1153,6 @@ func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 		return
 	}
 
-	height, err := ts.Height()
-	if err != nil {
-		log.Errorf("failed to get block height: %s", err)
-		return
-	}
-
-	h := types.NewBlockHeight(height)
 	provingPeriodEnd := provingPeriodStart.Add(miner.ProvingPeriodBlocks)
 
 	if h.GreaterEqual(provingPeriodStart) {
@@ -873,7 +1260,13 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, seed types.PoStChalle
 
 // Query responds to a query for the proposal referenced by the given cid
 func (sm *Miner) Query(c cid.Cid) *storagedeal.Response {
-	storageDeal := sm.porcelainAPI.DealGet(c)
+	return queryDeal(sm.porcelainAPI, c)
+}
+
+// queryDeal returns the response to the proposal referenced by the given cid
+// from the deals store.
+func queryDeal(deals dealGetter, c cid.Cid) *storagedeal.Response {
+	storageDeal := deals.DealGet(c)
 	if storageDeal == nil {
 		return &storagedeal.Response{
 			State:   storagedeal.Unknown,
@@ -884,22 +1277,6 @@ func (sm *Miner) Query(c cid.Cid) *storagedeal.Response {
 	return storageDeal.Response
 }
 
-func (sm *Miner) handleQueryDeal(s inet.Stream) {
-	defer s.Close() // nolint: errcheck
-
-	var q storagedeal.QueryRequest
-	if err := cbu.NewMsgReader(s).ReadMsg(&q); err != nil {
-		log.Errorf("received invalid query: %s", err)
-		return
-	}
-
-	resp := sm.Query(q.Cid)
-
-	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
-		log.Errorf("failed to write query response: %s", err)
-	}
-}
-
 func (sm *Miner) getSectorSize(ctx context.Context) (uint64, error) {
 	var proofsMode types.ProofsMode
 	values, err := sm.porcelainAPI.MessageQuery(ctx, address.Address{}, address.StorageMarketAddress, "getProofsMode")
@@ -1,26 +1,40 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/net"
 	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/repo"
 	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/convert"
 )
 
 var (
@@ -67,7 +81,7 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert.Equal("", message)
 	})
 
-	t.Run("Rejects proposals with insufficient TotalPrice", func(t *testing.T) {
+	t.Run("Counter-offers proposals with insufficient TotalPrice", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
 
@@ -75,12 +89,69 @@ func TestReceiveStorageProposal(t *testing.T) {
 
 		// configure storage price
 		assert.NoError(porcelainAPI.config.Set("mining.storagePrice", `".0005"`))
+		assert.NoError(porcelainAPI.config.Set("mining.dealPolicy.collateral", `"3"`))
 
 		res, err := miner.receiveStorageProposal(context.Background(), proposal)
 		require.NoError(err)
 
-		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal(storagedeal.CounterOffered, res.State)
 		assert.Equal("proposed price (2500) is less than expected (5000) given asking price of 0.0005", res.Message)
+
+		expectedPrice, _ := types.NewAttoFILFromFILString(".0005")
+		require.NotNil(res.CounterOffer)
+		assert.True(expectedPrice.Equal(res.CounterOffer.Price))
+		assert.True(types.NewAttoFILFromFIL(3).Equal(res.CounterOffer.Collateral))
+
+		// The miner keeps the counter-offer for queries.
+		assert.Equal(res, miner.Query(res.ProposalCid))
+	})
+
+	t.Run("Charges the storage price of its miner", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		porcelainAPI.noChannels = true
+		addressGetter := address.NewForTestGetter()
+		miner.minerAddr = addressGetter()
+
+		// The price of another miner doesn't apply.
+		require.NoError(porcelainAPI.config.Set("mining.storagePrices."+addressGetter().String(), `".0005"`))
+		res, err := miner.checkDealTerms(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, res.State)
+
+		require.NoError(porcelainAPI.config.Set("mining.storagePrices."+miner.minerAddr.String(), `".0005"`))
+		res, err = miner.checkDealTerms(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.CounterOffered, res.State)
+
+		// The miner's own price replaces the price of the node's miners.
+		require.NoError(porcelainAPI.config.Set("mining.storagePrice", `".0005"`))
+		require.NoError(porcelainAPI.config.Set("mining.storagePrices."+miner.minerAddr.String(), `"0"`))
+		res, err = miner.checkDealTerms(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, res.State)
+	})
+
+	t.Run("Checks the terms of unpaid proposals without storing them", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		porcelainAPI.noChannels = true
+
+		res, err := miner.checkDealTerms(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, res.State)
+
+		assert.NoError(porcelainAPI.config.Set("mining.storagePrice", `".0005"`))
+		res, err = miner.checkDealTerms(context.Background(), proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.CounterOffered, res.State)
+		require.NotNil(res.CounterOffer)
+
+		assert.Nil(porcelainAPI.DealGet(res.ProposalCid))
 	})
 
 	t.Run("Rejects proposals with invalid payment channel", func(t *testing.T) {
@@ -247,6 +318,221 @@ func TestReceiveStorageProposal(t *testing.T) {
 	})
 }
 
+func TestDealPolicy(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+
+	t.Run("Rejects clients of the deny list", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.clientDenyList", fmt.Sprintf(`["%s"]`, porcelainAPI.payerAddress)))
+
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "is not allowed to make deals")
+	})
+
+	t.Run("Accepts only clients of the allow list", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.clientAllowList", fmt.Sprintf(`["%s"]`, address.TestAddress)))
+
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "is not allowed to make deals")
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.clientAllowList", fmt.Sprintf(`["%s", "%s"]`, address.TestAddress, porcelainAPI.payerAddress)))
+
+		res, err = miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, res.State)
+	})
+
+	t.Run("Counter-offers proposals out of the duration bounds", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.minDuration", "20000"))
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.CounterOffered, res.State)
+		assert.Equal("duration of 10000 blocks is less than the minimum of 20000", res.Message)
+		assert.Equal(uint64(20000), res.CounterOffer.MinDuration)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.minDuration", "0"))
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxDuration", "5000"))
+		res, err = miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.CounterOffered, res.State)
+		assert.Equal("duration of 10000 blocks is more than the maximum of 5000", res.Message)
+		assert.Equal(uint64(5000), res.CounterOffer.MaxDuration)
+	})
+
+	t.Run("Rejects proposals out of the size bounds", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.minPieceSize", "2000"))
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("piece is 1000 bytes but the minimum is 2000 bytes", res.Message)
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.minPieceSize", "0"))
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxPieceSize", "500"))
+		res, err = miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("piece is 1000 bytes but the maximum is 500 bytes", res.Message)
+	})
+
+	t.Run("Enforces per-client quotas", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		cidGetter := types.NewCidForTestGetter()
+
+		// A failed deal doesn't count towards the quota.
+		porcelainAPI.deals[cidGetter()] = &storagedeal.Deal{
+			Miner:    miner.minerAddr,
+			Proposal: &storagedeal.Proposal{Size: types.NewBytesAmount(defaultPieceSize), Payment: storagedeal.PaymentInfo{Payer: porcelainAPI.payerAddress}},
+			Response: &storagedeal.Response{State: storagedeal.Failed},
+		}
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxClientDeals", "1"))
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxClientBytes", "1500"))
+
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, res.State)
+
+		porcelainAPI.deals[cidGetter()] = &storagedeal.Deal{
+			Miner:    miner.minerAddr,
+			Proposal: &storagedeal.Proposal{Size: types.NewBytesAmount(defaultPieceSize), Payment: storagedeal.PaymentInfo{Payer: porcelainAPI.payerAddress}},
+			Response: &storagedeal.Response{State: storagedeal.Staged},
+		}
+
+		res, err = miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "has reached its quota of 1 deals")
+
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxClientDeals", "0"))
+		res, err = miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "would exceed its quota of 1500 bytes")
+	})
+
+	t.Run("Holds concurrent proposals to the client's quota", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.maxClientDeals", "1"))
+
+		cidGetter := types.NewCidForTestGetter()
+		miner.proposalAcceptor = func(m *Miner, p *storagedeal.Proposal) (*storagedeal.Response, error) {
+			resp := &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: cidGetter()}
+			return resp, m.porcelainAPI.DealPut(&storagedeal.Deal{Miner: m.minerAddr, Proposal: p, Response: resp})
+		}
+
+		results := make(chan storagedeal.State, 4)
+		for i := 0; i < cap(results); i++ {
+			go func() {
+				res, err := miner.receiveStorageProposal(ctx, proposal)
+				if !assert.NoError(err) {
+					results <- storagedeal.Failed
+					return
+				}
+				results <- res.State
+			}()
+		}
+
+		accepted := 0
+		for i := 0; i < cap(results); i++ {
+			if <-results == storagedeal.Accepted {
+				accepted++
+			}
+		}
+		assert.Equal(1, accepted)
+	})
+
+	t.Run("Asks the decider", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		var received DealDecisionRequest
+		decision := DealDecision{Accept: false, Reason: "no cat pictures"}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(decision) // nolint: errcheck
+		}))
+		defer server.Close()
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.decider", fmt.Sprintf("%q", server.URL)))
+
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("no cat pictures", res.Message)
+
+		proposalCid, err := convert.ToCid(&proposal.Proposal)
+		require.NoError(err)
+		assert.Equal(proposalCid, received.ProposalCid)
+		assert.Equal(porcelainAPI.payerAddress, received.Client)
+		assert.Equal(proposal.Duration, received.Proposal.Duration)
+
+		// Clients checking the terms of a proposal get the decider's answer too.
+		res, err = miner.checkDealTerms(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Equal("no cat pictures", res.Message)
+
+		decision = DealDecision{Accept: true}
+		res, err = miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, res.State)
+		res, err = miner.checkDealTerms(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Accepted, res.State)
+	})
+
+	t.Run("Rejects proposals when the decider fails", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+		require.NoError(porcelainAPI.config.Set("mining.dealPolicy.decider", fmt.Sprintf("%q", server.URL)))
+
+		res, err := miner.receiveStorageProposal(ctx, proposal)
+		require.NoError(err)
+		assert.Equal(storagedeal.Rejected, res.State)
+		assert.Contains(res.Message, "deal decider failed")
+	})
+}
+
 func TestDealsAwaitingSeal(t *testing.T) {
 	tf.UnitTest(t)
 
@@ -284,6 +570,43 @@ func TestDealsAwaitingSeal(t *testing.T) {
 		assert.Equal(cid0, miner.dealsAwaitingSeal.SectorsToDeals[42][0])
 	})
 
+	t.Run("MigrateDealsAwaitingSeal moves the legacy deals to the miner", func(t *testing.T) {
+
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dealsDs := repo.NewInMemoryRepo().DealsDatastore()
+		legacy := &Miner{
+			dealsAwaitingSeal: &dealsAwaitingSealStruct{
+				SectorsToDeals:    make(map[uint64][]cid.Cid),
+				SuccessfulSectors: make(map[uint64]*sectorbuilder.SealedSectorMetadata),
+				FailedSectors:     make(map[uint64]string),
+			},
+			dealsAwaitingSealDs: dealsDs,
+		}
+		legacy.dealsAwaitingSeal.add(wantSectorID, cid0)
+		marshalled, err := json.Marshal(legacy.dealsAwaitingSeal)
+		require.NoError(err)
+		legacyKey := datastore.NewKey(dealsAwatingSealDatastorePrefix)
+		require.NoError(dealsDs.Put(legacyKey, marshalled))
+
+		minerAddr := address.NewForTestGetter()()
+		require.NoError(MigrateDealsAwaitingSeal(dealsDs, minerAddr))
+
+		miner := &Miner{minerAddr: minerAddr, dealsAwaitingSealDs: dealsDs}
+		require.NoError(miner.loadDealsAwaitingSeal())
+		assert.Equal(cid0, miner.dealsAwaitingSeal.SectorsToDeals[42][0])
+
+		has, err := dealsDs.Has(legacyKey)
+		require.NoError(err)
+		assert.False(has)
+
+		// Nothing is left to migrate the second time.
+		require.NoError(MigrateDealsAwaitingSeal(dealsDs, minerAddr))
+		require.NoError(miner.loadDealsAwaitingSeal())
+		assert.Equal(cid0, miner.dealsAwaitingSeal.SectorsToDeals[42][0])
+	})
+
 	t.Run("add before success", func(t *testing.T) {
 
 		assert := assert.New(t)
@@ -377,6 +700,234 @@ func TestDealsAwaitingSeal(t *testing.T) {
 	})
 }
 
+func TestResumeDeals(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	addrGetter := address.NewForTestGetter()
+	minerAddr := addrGetter()
+	miner := newTestMiner(porcelainAPI)
+	miner.minerAddr = minerAddr
+	miner.dealsAwaitingSealDs = repo.NewInMemoryRepo().DealsDatastore()
+	require.NoError(miner.loadDealsAwaitingSeal())
+	miner.dealsAwaitingSeal.onSuccess = miner.onCommitSuccess
+	miner.dealsAwaitingSeal.onFail = miner.onCommitFail
+
+	newCid := types.NewCidForTestGetter()
+	putDeal := func(dealMiner address.Address, state storagedeal.State) cid.Cid {
+		c := newCid()
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Miner:    dealMiner,
+			Proposal: &storagedeal.Proposal{},
+			Response: &storagedeal.Response{State: state, ProposalCid: c},
+		}))
+		return c
+	}
+	state := func(c cid.Cid) storagedeal.State {
+		return porcelainAPI.DealGet(c).Response.State
+	}
+
+	committed := putDeal(minerAddr, storagedeal.Sealing)
+	miner.dealsAwaitingSeal.add(1, committed)
+	porcelainAPI.commitments["1"] = types.Commitments{CommD: types.CommD{1}}
+	staged := putDeal(minerAddr, storagedeal.Staged)
+	miner.dealsAwaitingSeal.add(2, staged)
+	lost := putDeal(minerAddr, storagedeal.Staged)
+	other := putDeal(addrGetter(), storagedeal.Staged)
+	posted := putDeal(minerAddr, storagedeal.Posted)
+
+	require.NoError(miner.ResumeDeals(context.Background()))
+
+	assert.Equal(storagedeal.Posted, state(committed))
+	assert.Equal(uint64(1), porcelainAPI.DealGet(committed).Response.ProofInfo.SectorID)
+	assert.Equal(storagedeal.Staged, state(staged))
+	assert.Equal(storagedeal.Failed, state(lost))
+	assert.Equal(storagedeal.Staged, state(other))
+	assert.Equal(storagedeal.Posted, state(posted))
+
+	// The staged deal moves on when its sector is sealed, and never back.
+	miner.OnSectorSealed(2)
+	assert.Equal(storagedeal.Sealing, state(staged))
+	assert.Error(miner.transitionDeal(staged, storagedeal.Staged, nil))
+	assert.Equal(storagedeal.Sealing, state(staged))
+}
+
+func TestAnnounceCommittedPiece(t *testing.T) {
+	tf.UnitTest(t)
+
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	miner := newTestMiner(porcelainAPI)
+
+	cidGetter := types.NewCidForTestGetter()
+	dealCid, pieceRef := cidGetter(), cidGetter()
+	require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+		Proposal: &storagedeal.Proposal{PieceRef: pieceRef},
+		Response: &storagedeal.Response{State: storagedeal.Sealing, ProposalCid: dealCid},
+	}))
+
+	miner.onCommitSuccess(dealCid, &sectorbuilder.SealedSectorMetadata{SectorID: 1})
+
+	select {
+	case provided := <-porcelainAPI.provided:
+		require.True(pieceRef.Equals(provided))
+	case <-time.After(time.Second):
+		t.Fatal("committed piece wasn't announced")
+	}
+}
+
+func TestCompleteDeals(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	addrGetter := address.NewForTestGetter()
+	minerAddr := addrGetter()
+	miner := newTestMiner(porcelainAPI)
+	miner.minerAddr = minerAddr
+
+	newCid := types.NewCidForTestGetter()
+	putDeal := func(dealMiner address.Address, state storagedeal.State, committedAt *types.BlockHeight) cid.Cid {
+		c := newCid()
+		resp := &storagedeal.Response{State: state, ProposalCid: c}
+		if committedAt != nil {
+			resp.ProofInfo = &storagedeal.ProofInfo{SectorID: 1, CommittedAt: committedAt}
+		}
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Miner:    dealMiner,
+			Proposal: &storagedeal.Proposal{Duration: 100},
+			Response: resp,
+		}))
+		return c
+	}
+	state := func(c cid.Cid) storagedeal.State {
+		return porcelainAPI.DealGet(c).Response.State
+	}
+
+	early := putDeal(minerAddr, storagedeal.Posted, types.NewBlockHeight(10))
+	late := putDeal(minerAddr, storagedeal.Posted, types.NewBlockHeight(50))
+	sealing := putDeal(minerAddr, storagedeal.Sealing, nil)
+	other := putDeal(addrGetter(), storagedeal.Posted, types.NewBlockHeight(10))
+
+	miner.completeDeals(types.NewBlockHeight(109))
+	assert.Equal(storagedeal.Posted, state(early))
+
+	miner.completeDeals(types.NewBlockHeight(110))
+	assert.Equal(storagedeal.Complete, state(early))
+	assert.Equal(storagedeal.Posted, state(late))
+	assert.Equal(storagedeal.Sealing, state(sealing))
+	assert.Equal(storagedeal.Posted, state(other))
+
+	miner.completeDeals(types.NewBlockHeight(150))
+	assert.Equal(storagedeal.Complete, state(late))
+
+	// Committed deals record when they were committed so they can complete.
+	porcelainAPI.blockHeight = types.NewBlockHeight(200)
+	miner.onCommitSuccess(sealing, &sectorbuilder.SealedSectorMetadata{SectorID: 2})
+	assert.Equal(storagedeal.Posted, state(sealing))
+	assert.Equal(types.NewBlockHeight(200), porcelainAPI.DealGet(sealing).Response.ProofInfo.CommittedAt)
+	miner.completeDeals(types.NewBlockHeight(300))
+	assert.Equal(storagedeal.Complete, state(sealing))
+}
+
+func TestProvidePieces(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	addrGetter := address.NewForTestGetter()
+	minerAddr := addrGetter()
+	miner := newTestMiner(porcelainAPI)
+	miner.minerAddr = minerAddr
+
+	cidGetter := types.NewCidForTestGetter()
+	putDeal := func(dealMiner address.Address, state storagedeal.State, pieceRef cid.Cid) {
+		require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+			Miner:    dealMiner,
+			Proposal: &storagedeal.Proposal{PieceRef: pieceRef},
+			Response: &storagedeal.Response{State: state, ProposalCid: cidGetter()},
+		}))
+	}
+
+	committed, shared, sealing, other := cidGetter(), cidGetter(), cidGetter(), cidGetter()
+	putDeal(minerAddr, storagedeal.Posted, committed)
+	putDeal(minerAddr, storagedeal.Posted, shared)
+	putDeal(minerAddr, storagedeal.Posted, shared)
+	putDeal(minerAddr, storagedeal.Sealing, sealing)
+	putDeal(addrGetter(), storagedeal.Posted, other)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go miner.ProvidePieces(ctx)
+
+	// The pieces of committed deals are announced when the miner starts, once each.
+	var provided []cid.Cid
+	for len(provided) < 2 {
+		select {
+		case c := <-porcelainAPI.provided:
+			provided = append(provided, c)
+		case <-time.After(time.Second):
+			t.Fatal("committed pieces weren't announced")
+		}
+	}
+	assert.ElementsMatch([]cid.Cid{committed, shared}, provided)
+
+	select {
+	case c := <-porcelainAPI.provided:
+		t.Fatalf("unexpected announcement of piece %s", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestManualTransferDeal(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	porcelainAPI := newMinerTestPorcelain(require)
+	miner := newTestMiner(porcelainAPI)
+	miner.dealsAwaitingSealDs = repo.NewInMemoryRepo().DealsDatastore()
+	require.NoError(miner.loadDealsAwaitingSeal())
+
+	piece := dag.NewRawNode([]byte("a truck full of hard drives"))
+	proposal := &storagedeal.Proposal{PieceRef: piece.Cid(), Size: types.NewBytesAmount(27), ManualTransfer: true}
+	proposalCid := types.NewCidForTestGetter()()
+	require.NoError(porcelainAPI.DealPut(&storagedeal.Deal{
+		Proposal: proposal,
+		Response: &storagedeal.Response{State: storagedeal.Accepted, ProposalCid: proposalCid},
+	}))
+
+	// The data can't be imported until the deal awaits it.
+	err := miner.ImportDealData(ctx, proposalCid, bytes.NewReader(piece.RawData()))
+	assert.Contains(err.Error(), "isn't awaiting data")
+
+	// The miner doesn't fetch the data of the deal but waits for it.
+	miner.processStorageDeal(proposalCid)
+	resp := porcelainAPI.DealGet(proposalCid).Response
+	assert.Equal(storagedeal.Transferring, resp.State)
+	assert.Equal("awaiting import of deal data", resp.Message)
+
+	// Data that isn't the piece is rejected and the deal keeps waiting.
+	err = miner.ImportDealData(ctx, proposalCid, bytes.NewReader([]byte("something else")))
+	assert.Contains(err.Error(), "not to the deal's piece")
+	assert.Equal(storagedeal.Transferring, porcelainAPI.DealGet(proposalCid).Response.State)
+
+	// Deals that transfer their data over the network can't import data.
+	proposal.ManualTransfer = false
+	err = miner.ImportDealData(ctx, proposalCid, bytes.NewReader(piece.RawData()))
+	assert.Contains(err.Error(), "doesn't transfer its data manually")
+}
+
 type minerTestPorcelain struct {
 	config        *cfg.Config
 	payerAddress  address.Address
@@ -389,6 +940,8 @@ type minerTestPorcelain struct {
 	channelEol    *types.BlockHeight
 	paymentStart  *types.BlockHeight
 	deals         map[cid.Cid]*storagedeal.Deal
+	commitments   map[string]types.Commitments
+	provided      chan cid.Cid
 
 	require *require.Assertions
 }
@@ -429,10 +982,15 @@ func newMinerTestPorcelain(require *require.Assertions) *minerTestPorcelain {
 		paymentStart:  blockHeight,
 		require:       require,
 		deals:         make(map[cid.Cid]*storagedeal.Deal),
+		commitments:   make(map[string]types.Commitments),
+		provided:      make(chan cid.Cid, 10),
 	}
 }
 
 func (mtp *minerTestPorcelain) ActorGetSignature(ctx context.Context, actorAddr address.Address, method string) (_ *exec.FunctionSignature, err error) {
+	if method == "getSectorCommitments" {
+		return &exec.FunctionSignature{Return: []abi.Type{abi.CommitmentsMap}}, nil
+	}
 	return nil, nil
 }
 
@@ -444,6 +1002,10 @@ func (mtp *minerTestPorcelain) MessageQuery(ctx context.Context, optFrom, to add
 	if method == "getProofsMode" {
 		return messageQueryGetProofsMode()
 	}
+	if method == "getSectorCommitments" {
+		commitments, err := (&abi.Value{Type: abi.CommitmentsMap, Val: mtp.commitments}).Serialize()
+		return [][]byte{commitments}, err
+	}
 	return mtp.messageQueryPaymentBrokerLs()
 }
 
@@ -481,6 +1043,13 @@ func (mtp *minerTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid,
 	return nil
 }
 
+func (mtp *minerTestPorcelain) NetworkReportPeer(p peer.ID, offense net.Offense, reason string) {}
+
+func (mtp *minerTestPorcelain) NetworkProvide(ctx context.Context, key cid.Cid) error {
+	mtp.provided <- key
+	return nil
+}
+
 func newTestMiner(api *minerTestPorcelain) *Miner {
 	return &Miner{
 		porcelainAPI:   api,
@@ -552,6 +1121,14 @@ func testSignedDealProposal(porcelainAPI *minerTestPorcelain, vouchers []*paymen
 	return signedProposal
 }
 
+func (mtp *minerTestPorcelain) DAGImportData(ctx context.Context, data io.Reader) (ipld.Node, error) {
+	raw, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	return dag.NewRawNode(raw), nil
+}
+
 func (mtp *minerTestPorcelain) DealsLs() ([]*storagedeal.Deal, error) {
 	var results []*storagedeal.Deal
 
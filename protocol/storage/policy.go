@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/util/convert"
+)
+
+// maxDealDecisionSize is the maximum size of the answer of a deal decider.
+const maxDealDecisionSize = 1 << 20
+
+// DealDecisionRequest is the JSON document a deal decider receives for a proposal.
+type DealDecisionRequest struct {
+	ProposalCid cid.Cid               `json:"proposalCid"`
+	Miner       address.Address       `json:"miner"`
+	Client      address.Address       `json:"client"`
+	Proposal    *storagedeal.Proposal `json:"proposal"`
+}
+
+// DealDecision is the JSON document a deal decider answers with.
+type DealDecision struct {
+	Accept bool   `json:"accept"`
+	Reason string `json:"reason"`
+}
+
+// dealDecider makes the final decision on a storage deal proposal on behalf of the miner operator.
+type dealDecider interface {
+	Decide(ctx context.Context, req *DealDecisionRequest) (*DealDecision, error)
+}
+
+// newDealDecider returns the decider for the decider config value: an http(s) URL the
+// request is posted to or an executable the request is written to.
+func newDealDecider(decider string) dealDecider {
+	if strings.HasPrefix(decider, "http://") || strings.HasPrefix(decider, "https://") {
+		return &httpDealDecider{url: decider, client: http.DefaultClient}
+	}
+	return &execDealDecider{path: decider}
+}
+
+// execDealDecider runs an executable with the request on its standard input and reads the
+// decision from its standard output.
+type execDealDecider struct {
+	path string
+}
+
+func (d *execDealDecider) Decide(ctx context.Context, req *DealDecisionRequest) (*DealDecision, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal deal decision request")
+	}
+
+	cmd := exec.CommandContext(ctx, d.path) // nolint: gosec
+	cmd.Stdin = bytes.NewReader(in)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, errors.Wrapf(err, "%s: %s", d.path, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, errors.Wrap(err, d.path)
+	}
+	return decodeDealDecision(bytes.NewReader(out))
+}
+
+// httpDealDecider posts the request to a URL and reads the decision from the response.
+type httpDealDecider struct {
+	url    string
+	client *http.Client
+}
+
+func (d *httpDealDecider) Decide(ctx context.Context, req *DealDecisionRequest) (*DealDecision, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal deal decision request")
+	}
+
+	httpReq, err := http.NewRequest("POST", d.url, bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	res, err := d.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", d.url, res.Status)
+	}
+	return decodeDealDecision(res.Body)
+}
+
+func decodeDealDecision(r io.Reader) (*DealDecision, error) {
+	out, err := ioutil.ReadAll(io.LimitReader(r, maxDealDecisionSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read deal decision")
+	}
+	var decision DealDecision
+	if err := json.Unmarshal(out, &decision); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal deal decision")
+	}
+	return &decision, nil
+}
+
+func (sm *Miner) getDealPolicy() (*config.DealPolicyConfig, error) {
+	policy, err := sm.porcelainAPI.ConfigGet("mining.dealPolicy")
+	if err != nil {
+		return nil, err
+	}
+	policyConfig, ok := policy.(*config.DealPolicyConfig)
+	if !ok || policyConfig == nil {
+		return nil, errors.New("Could not retrieve dealPolicy from config")
+	}
+	return policyConfig, nil
+}
+
+// validateDealPolicy checks a proposal against the client lists and piece size bounds of the
+// miner's deal policy. The duration bounds are terms the miner counter-offers.
+func (sm *Miner) validateDealPolicy(p *storagedeal.Proposal) error {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return err
+	}
+
+	client := p.Payment.Payer
+	if containsAddress(policy.ClientDenyList, client) {
+		return fmt.Errorf("client %s is not allowed to make deals", client)
+	}
+	if len(policy.ClientAllowList) > 0 && !containsAddress(policy.ClientAllowList, client) {
+		return fmt.Errorf("client %s is not allowed to make deals", client)
+	}
+
+	if p.Size == nil {
+		return fmt.Errorf("proposed deal has no size")
+	}
+	if p.Size.LessThan(types.NewBytesAmount(policy.MinPieceSize)) {
+		return fmt.Errorf("piece is %s bytes but the minimum is %d bytes", p.Size, policy.MinPieceSize)
+	}
+	if policy.MaxPieceSize > 0 && p.Size.GreaterThan(types.NewBytesAmount(policy.MaxPieceSize)) {
+		return fmt.Errorf("piece is %s bytes but the maximum is %d bytes", p.Size, policy.MaxPieceSize)
+	}
+	return nil
+}
+
+// validateClientQuota checks a proposal against the per-client quotas of the miner's deal
+// policy. Callers that go on to record the deal hold dealsLk, so that concurrent proposals
+// from a client can't exceed its quota.
+func (sm *Miner) validateClientQuota(p *storagedeal.Proposal) error {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return err
+	}
+
+	client := p.Payment.Payer
+	if policy.MaxClientDeals == 0 && policy.MaxClientBytes == 0 {
+		return nil
+	}
+	deals, size, err := sm.clientUsage(client)
+	if err != nil {
+		return err
+	}
+	if policy.MaxClientDeals > 0 && deals >= policy.MaxClientDeals {
+		return fmt.Errorf("client %s has reached its quota of %d deals", client, policy.MaxClientDeals)
+	}
+	if policy.MaxClientBytes > 0 && size.Add(p.Size).GreaterThan(types.NewBytesAmount(policy.MaxClientBytes)) {
+		return fmt.Errorf("client %s has %s bytes in deals, a %s byte piece would exceed its quota of %d bytes", client, size, p.Size, policy.MaxClientBytes)
+	}
+	return nil
+}
+
+// counterOffer returns the terms the miner accepts, and the reason for the offer, when the
+// duration or the price of the proposal doesn't match them. It returns a nil offer when the
+// proposal's terms are acceptable.
+func (sm *Miner) counterOffer(p *storagedeal.Proposal) (*storagedeal.CounterOffer, string, error) {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return nil, "", err
+	}
+	price, err := sm.getStoragePrice()
+	if err != nil {
+		return nil, "", err
+	}
+
+	offer := &storagedeal.CounterOffer{
+		Price:       price,
+		MinDuration: policy.MinDuration,
+		MaxDuration: policy.MaxDuration,
+		Collateral:  policy.Collateral,
+	}
+
+	if p.Duration < offer.MinDuration {
+		return offer, fmt.Sprintf("duration of %d blocks is less than the minimum of %d", p.Duration, offer.MinDuration), nil
+	}
+	if !offer.AcceptsDuration(p.Duration) {
+		return offer, fmt.Sprintf("duration of %d blocks is more than the maximum of %d", p.Duration, offer.MaxDuration), nil
+	}
+
+	expectedPrice := price.MulBigInt(big.NewInt(0).SetUint64(p.Duration)).MulBigInt(big.NewInt(0).SetUint64(p.Size.Uint64()))
+	if p.TotalPrice == nil || p.TotalPrice.LessThan(expectedPrice) {
+		return offer, fmt.Sprintf("proposed price (%s) is less than expected (%s) given asking price of %s", p.TotalPrice, expectedPrice, price), nil
+	}
+	return nil, "", nil
+}
+
+// clientUsage returns the number of deals and bytes the client has in progress or complete with the miner.
+func (sm *Miner) clientUsage(client address.Address) (uint64, *types.BytesAmount, error) {
+	deals, err := sm.porcelainAPI.DealsLs()
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "could not list deals")
+	}
+
+	count := uint64(0)
+	size := types.NewBytesAmount(0)
+	for _, d := range deals {
+		if d.Miner != sm.minerAddr || d.Proposal.Payment.Payer != client || d.Response == nil {
+			continue
+		}
+		switch d.Response.State {
+		case storagedeal.Unknown, storagedeal.Rejected, storagedeal.Failed, storagedeal.CounterOffered:
+			continue
+		}
+		count++
+		size = size.Add(d.Proposal.Size)
+	}
+	return count, size, nil
+}
+
+// decideDeal asks the decider of the miner's deal policy, if any, whether to accept a proposal.
+func (sm *Miner) decideDeal(ctx context.Context, p *storagedeal.Proposal) error {
+	policy, err := sm.getDealPolicy()
+	if err != nil {
+		return err
+	}
+	if policy.Decider == "" {
+		return nil
+	}
+
+	if policy.DeciderTimeout != "" {
+		timeout, err := time.ParseDuration(policy.DeciderTimeout)
+		if err != nil {
+			return errors.Wrap(err, "invalid deal decider timeout")
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	proposalCid, err := convert.ToCid(p)
+	if err != nil {
+		return errors.Wrap(err, "failed to get cid of proposal")
+	}
+	decision, err := newDealDecider(policy.Decider).Decide(ctx, &DealDecisionRequest{
+		ProposalCid: proposalCid,
+		Miner:       sm.minerAddr,
+		Client:      p.Payment.Payer,
+		Proposal:    p,
+	})
+	if err != nil {
+		log.Warningf("deal decider failed on proposal %s: %s", proposalCid, err)
+		return errors.Wrap(err, "deal decider failed")
+	}
+	if !decision.Accept {
+		if decision.Reason == "" {
+			return errors.New("deal rejected by the miner's policy")
+		}
+		return errors.New(decision.Reason)
+	}
+	return nil
+}
+
+func containsAddress(addrs []address.Address, addr address.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	"github.com/libp2p/go-libp2p-peer"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/net"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/util/convert"
+)
+
+// routerPorcelain is the subset of the porcelain API that MinerRouter needs.
+type routerPorcelain interface {
+	dealGetter
+	NetworkReportPeer(p peer.ID, offense net.Offense, reason string)
+}
+
+// MinerRouter serves the storage deal protocols of a host for all the storage
+// miners of a node. Proposals are handed to the miner they are made to.
+// Queries are answered from the deals store, which the miners share.
+type MinerRouter struct {
+	porcelainAPI routerPorcelain
+
+	lk     sync.RWMutex
+	miners map[address.Address]*Miner
+}
+
+// NewMinerRouter creates a MinerRouter and binds it to the storage deal
+// protocols of the host.
+func NewMinerRouter(h host.Host, porcelainAPI routerPorcelain) *MinerRouter {
+	r := &MinerRouter{
+		porcelainAPI: porcelainAPI,
+		miners:       make(map[address.Address]*Miner),
+	}
+
+	h.SetStreamHandler(makeDealProtocol, r.handleMakeDeal)
+	h.SetStreamHandler(queryDealProtocol, r.handleQueryDeal)
+	h.SetStreamHandler(dealTermsProtocol, r.handleDealTerms)
+
+	return r
+}
+
+// AddMiner routes the proposals made to the storage miner to it, in place of
+// any miner previously added for the same address.
+func (r *MinerRouter) AddMiner(sm *Miner) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.miners[sm.minerAddr] = sm
+}
+
+// RemoveMiner stops routing proposals to the storage miner of the address, so that
+// the node rejects the proposals made to it.
+func (r *MinerRouter) RemoveMiner(minerAddr address.Address) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	delete(r.miners, minerAddr)
+}
+
+// Miner returns the storage miner of the address, or nil if none was added.
+func (r *MinerRouter) Miner(minerAddr address.Address) *Miner {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.miners[minerAddr]
+}
+
+func (r *MinerRouter) handleMakeDeal(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var signedProposal storagedeal.SignedDealProposal
+	if err := cbu.NewMsgReader(s).ReadMsg(&signedProposal); err != nil {
+		log.Errorf("received invalid proposal: %s", err)
+		r.porcelainAPI.NetworkReportPeer(s.Conn().RemotePeer(), net.OffenseProtocolError, "invalid storage deal proposal")
+		return
+	}
+
+	resp, err := r.receiveStorageProposal(context.Background(), &signedProposal)
+	if err != nil {
+		log.Errorf("failed to process proposal: %s", err)
+		return
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+		log.Errorf("failed to write proposal response: %s", err)
+	}
+}
+
+// receiveStorageProposal hands the proposal to the storage miner it is made
+// to, or rejects it if the node doesn't run that miner.
+func (r *MinerRouter) receiveStorageProposal(ctx context.Context, sp *storagedeal.SignedDealProposal) (*storagedeal.Response, error) {
+	sm := r.Miner(sp.MinerAddress)
+	if sm == nil {
+		proposalCid, err := convert.ToCid(&sp.Proposal)
+		if err != nil {
+			return nil, err
+		}
+		return &storagedeal.Response{
+			State:       storagedeal.Rejected,
+			ProposalCid: proposalCid,
+			Message:     fmt.Sprintf("miner %s is not accepting deals", sp.MinerAddress),
+		}, nil
+	}
+	return sm.receiveStorageProposal(ctx, sp)
+}
+
+func (r *MinerRouter) handleDealTerms(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var signedProposal storagedeal.SignedDealProposal
+	if err := cbu.NewMsgReader(s).ReadMsg(&signedProposal); err != nil {
+		log.Errorf("received invalid terms proposal: %s", err)
+		r.porcelainAPI.NetworkReportPeer(s.Conn().RemotePeer(), net.OffenseProtocolError, "invalid storage deal terms proposal")
+		return
+	}
+
+	var resp *storagedeal.Response
+	var err error
+	if sm := r.Miner(signedProposal.MinerAddress); sm != nil {
+		resp, err = sm.checkDealTerms(context.Background(), &signedProposal)
+	} else {
+		// Rejects proposals made to miners the node doesn't run.
+		resp, err = r.receiveStorageProposal(context.Background(), &signedProposal)
+	}
+	if err != nil {
+		log.Errorf("failed to check proposal terms: %s", err)
+		return
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+		log.Errorf("failed to write terms response: %s", err)
+	}
+}
+
+// ImportDealData hands the data of a manual transfer deal to the storage miner
+// the deal was made with and returns the deal's response.
+func (r *MinerRouter) ImportDealData(ctx context.Context, proposalCid cid.Cid, data io.Reader) (*storagedeal.Response, error) {
+	d := r.porcelainAPI.DealGet(proposalCid)
+	if d == nil {
+		return nil, fmt.Errorf("no deal with proposal %s", proposalCid)
+	}
+	sm := r.Miner(d.Miner)
+	if sm == nil {
+		return nil, fmt.Errorf("node doesn't run miner %s of deal %s", d.Miner, proposalCid)
+	}
+	if err := sm.ImportDealData(ctx, proposalCid, data); err != nil {
+		return nil, err
+	}
+	return queryDeal(r.porcelainAPI, proposalCid), nil
+}
+
+func (r *MinerRouter) handleQueryDeal(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var q storagedeal.QueryRequest
+	if err := cbu.NewMsgReader(s).ReadMsg(&q); err != nil {
+		log.Errorf("received invalid query: %s", err)
+		r.porcelainAPI.NetworkReportPeer(s.Conn().RemotePeer(), net.OffenseProtocolError, "invalid storage deal query")
+		return
+	}
+
+	resp := queryDeal(r.porcelainAPI, q.Cid)
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+		log.Errorf("failed to write query response: %s", err)
+	}
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	tf "github.com/filecoin-project/go-filecoin/testhelpers/testflags"
+)
+
+func TestMinerRouterReceiveStorageProposal(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI, miner, proposal := defaultMinerTestSetup(require, VoucherInterval, defaultAmountInc)
+	miner.minerAddr = porcelainAPI.targetAddress
+	other := newTestMiner(porcelainAPI)
+	other.minerAddr = address.NewForTestGetter()()
+
+	router := &MinerRouter{porcelainAPI: porcelainAPI, miners: make(map[address.Address]*Miner)}
+
+	res, err := router.receiveStorageProposal(context.Background(), proposal)
+	require.NoError(err)
+	assert.Equal(storagedeal.Rejected, res.State)
+	assert.Contains(res.Message, "not accepting deals")
+
+	router.AddMiner(other)
+	router.AddMiner(miner)
+	assert.Equal(miner, router.Miner(porcelainAPI.targetAddress))
+
+	res, err = router.receiveStorageProposal(context.Background(), proposal)
+	require.NoError(err)
+	assert.Equal(storagedeal.Accepted, res.State)
+
+	router.RemoveMiner(miner.minerAddr)
+	assert.Nil(router.Miner(porcelainAPI.targetAddress))
+	assert.Equal(other, router.Miner(other.minerAddr))
+
+	res, err = router.receiveStorageProposal(context.Background(), proposal)
+	require.NoError(err)
+	assert.Equal(storagedeal.Rejected, res.State)
+}
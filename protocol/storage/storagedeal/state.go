@@ -17,8 +17,8 @@ const (
 	// Accepted means the deal was accepted but hasnt yet started
 	Accepted
 
-	// Started means the deal has started and the transfer is in progress
-	Started
+	// Transferring means the deal has started and the transfer of its data is in progress
+	Transferring
 
 	// Failed means the deal has failed for some reason
 	Failed
@@ -26,14 +26,31 @@ const (
 	// Posted means the deal has been posted to the blockchain
 	Posted
 
-	// Complete means the deal is complete
-	// TODO: distinguish this from 'Posted'
+	// Complete means the deal's duration has passed since its sector was committed
 	Complete
 
 	// Staged means that the data in the deal has been staged into a sector
 	Staged
+
+	// Sealing means the sector holding the data in the deal has been sealed and its
+	// commitment is being posted to the blockchain
+	Sealing
+
+	// CounterOffered means the miner did not accept the terms of the proposal and
+	// answered with the terms it would accept
+	CounterOffered
 )
 
+// progress orders the states of an accepted deal, from Accepted to Complete.
+var progress = map[State]int{
+	Accepted:     1,
+	Transferring: 2,
+	Staged:       3,
+	Sealing:      4,
+	Posted:       5,
+	Complete:     6,
+}
+
 func (s State) String() string {
 	switch s {
 	case Unknown:
@@ -42,8 +59,8 @@ func (s State) String() string {
 		return "rejected"
 	case Accepted:
 		return "accepted"
-	case Started:
-		return "started"
+	case Transferring:
+		return "transferring"
 	case Failed:
 		return "failed"
 	case Posted:
@@ -52,7 +69,31 @@ func (s State) String() string {
 		return "complete"
 	case Staged:
 		return "staged"
+	case Sealing:
+		return "sealing"
+	case CounterOffered:
+		return "counter-offered"
 	default:
 		return fmt.Sprintf("<unrecognized %d>", s)
 	}
 }
+
+// IsFinal returns true if a deal in the state doesn't change state anymore.
+func (s State) IsFinal() bool {
+	return s == Rejected || s == Failed || s == Complete || s == CounterOffered
+}
+
+// CanTransitionTo returns true if a deal in the state may move to the next state.
+// An accepted deal moves forward through Transferring, Staged, Sealing and Posted
+// to Complete, possibly skipping states, and may fail until it is complete.
+func (s State) CanTransitionTo(next State) bool {
+	from, ok := progress[s]
+	if !ok || s == Complete {
+		return false
+	}
+	if next == Failed {
+		return true
+	}
+	to, ok := progress[next]
+	return ok && to > from
+}
@@ -13,10 +13,12 @@ func init() {
 	cbor.RegisterCborType(PaymentInfo{})
 	cbor.RegisterCborType(Proposal{})
 	cbor.RegisterCborType(Response{})
+	cbor.RegisterCborType(CounterOffer{})
 	cbor.RegisterCborType(SignedDealProposal{})
 	cbor.RegisterCborType(ProofInfo{})
 	cbor.RegisterCborType(QueryRequest{})
 	cbor.RegisterCborType(Deal{})
+	cbor.RegisterCborType(Health{})
 }
 
 // PaymentInfo contains all the payment related information for a storage deal.
@@ -62,6 +64,11 @@ type Proposal struct {
 	// will use to pay the miner. It should be verifiable by the
 	// miner using on-chain information.
 	Payment PaymentInfo
+
+	// ManualTransfer tells the miner not to fetch the piece over the network.
+	// The miner operator imports the data out of band instead, e.g. from hard
+	// drives the client ships.
+	ManualTransfer bool `refmt:",omitempty"`
 }
 
 // Unmarshal a Proposal from bytes.
@@ -115,6 +122,28 @@ type Response struct {
 
 	// Signature is a signature from the miner over the response
 	Signature types.Signature
+
+	// CounterOffer holds the terms the miner would accept, when the state is CounterOffered
+	CounterOffer *CounterOffer `refmt:",omitempty"`
+}
+
+// CounterOffer is the terms a miner would accept for a deal whose proposal it did not accept.
+type CounterOffer struct {
+	// Price is the price per byte per block the miner asks
+	Price *types.AttoFIL
+
+	// MinDuration and MaxDuration bound the duration of a deal, in blocks. MaxDuration
+	// is 0 when the miner has no maximum.
+	MinDuration uint64
+	MaxDuration uint64
+
+	// Collateral is the amount the miner pledges to the deal
+	Collateral *types.AttoFIL
+}
+
+// AcceptsDuration returns true if the duration is within the bounds of the offer.
+func (co *CounterOffer) AcceptsDuration(duration uint64) bool {
+	return duration >= co.MinDuration && (co.MaxDuration == 0 || duration <= co.MaxDuration)
 }
 
 // Deal is a storage deal struct
@@ -122,6 +151,24 @@ type Deal struct {
 	Miner    address.Address
 	Proposal *Proposal
 	Response *Response
+
+	// Health is the last check of the deal by the client's deal monitor
+	Health *Health `refmt:",omitempty"`
+}
+
+// Health is the result of a client's check that its miner is keeping a deal.
+type Health struct {
+	// CheckedAt is the block height of the check
+	CheckedAt *types.BlockHeight
+
+	// Problems lists what the check found wrong with the deal. It is empty
+	// when the deal is healthy.
+	Problems []string
+}
+
+// Healthy returns true if the check found nothing wrong with the deal.
+func (h *Health) Healthy() bool {
+	return len(h.Problems) == 0
 }
 
 // ProofInfo contains the details about a seal proof, that the client needs to know to verify that his deal was posted on chain.
@@ -130,6 +177,11 @@ type ProofInfo struct {
 	SectorID uint64
 	CommR    []byte
 	CommD    []byte
+
+	// CommittedAt is the block height at which the miner saw the commitment
+	// of the sector on chain. The deal is complete once its duration has
+	// passed since.
+	CommittedAt *types.BlockHeight `refmt:",omitempty"`
 }
 
 // QueryRequest is used for making protocol api requests for deals
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// StoreParams are the parameters of storing data with several miners.
+type StoreParams struct {
+	// Replicas is the number of distinct miners to make deals with
+	Replicas int
+	// Duration is the number of blocks to store the data for
+	Duration uint64
+	// MaxPrice is the highest price per byte per block to pay, or nil for no limit.
+	// It is also the limit for accepting counter-offers.
+	MaxPrice *types.AttoFIL
+}
+
+// StoreResult is the outcome of storing data with several miners.
+type StoreResult struct {
+	// Deals are the deals made, one per miner
+	Deals []*storagedeal.Deal
+	// Failures are the errors of the proposals miners didn't accept, in the order they were made
+	Failures []StoreFailure
+}
+
+// StoreFailure is the error of a proposal a miner didn't accept.
+type StoreFailure struct {
+	Miner address.Address
+	Error string
+}
+
+// storeCandidate is a miner the client may propose a deal to.
+type storeCandidate struct {
+	ask         porcelain.Ask
+	power       *big.Int
+	reliability float64
+}
+
+// Store proposes deals to store the data with params.Replicas distinct miners, in
+// parallel. It ranks the miners by the price of their asks, then by how reliable they
+// were in the client's past deals, then by power. A miner most of whose past deals
+// with the client failed or turned unhealthy comes after all others. When a miner
+// doesn't accept a proposal or can't be reached, the client proposes to the next
+// miner in the ranking, until it has made params.Replicas deals or no miner remains.
+func (smc *Client) Store(ctx context.Context, data cid.Cid, params StoreParams) (*StoreResult, error) {
+	if params.Replicas < 1 {
+		return nil, errors.New("the number of replicas must be at least 1")
+	}
+
+	candidates, err := smc.storeCandidates(ctx, params.MaxPrice)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no miner has an ask within the maximum price")
+	}
+
+	var lk sync.Mutex
+	next := 0
+	result := &StoreResult{}
+	nextCandidate := func() (*storeCandidate, bool) {
+		lk.Lock()
+		defer lk.Unlock()
+		if len(result.Deals) >= params.Replicas || next >= len(candidates) {
+			return nil, false
+		}
+		next++
+		return candidates[next-1], true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < params.Replicas; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c, ok := nextCandidate(); ok; c, ok = nextCandidate() {
+				resp, err := smc.ProposeDeal(ctx, c.ask.Miner, data, c.ask.ID, params.Duration, false, false, params.MaxPrice)
+
+				lk.Lock()
+				if err != nil {
+					result.Failures = append(result.Failures, StoreFailure{Miner: c.ask.Miner, Error: err.Error()})
+					lk.Unlock()
+					continue
+				}
+				if d := smc.api.DealGet(resp.ProposalCid); d != nil {
+					result.Deals = append(result.Deals, d)
+				}
+				lk.Unlock()
+				return
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(result.Deals) == 0 {
+		return result, fmt.Errorf("no miner accepted a deal, tried %d miners", len(result.Failures))
+	}
+	return result, nil
+}
+
+// storeCandidates returns the miners with an unexpired ask within the max price, with
+// their cheapest ask, in ranking order.
+func (smc *Client) storeCandidates(ctx context.Context, maxPrice *types.AttoFIL) ([]*storeCandidate, error) {
+	height, err := smc.api.ChainBlockHeight()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get chain height")
+	}
+
+	asks := make(map[address.Address]porcelain.Ask)
+	for ask := range smc.api.ClientListAsks(ctx) {
+		if ask.Error != nil {
+			return nil, errors.Wrap(ask.Error, "could not list asks")
+		}
+		if ask.Expiry.LessThan(height) || (maxPrice != nil && ask.Price.GreaterThan(maxPrice)) {
+			continue
+		}
+		if best, ok := asks[ask.Miner]; ok && !ask.Price.LessThan(best.Price) {
+			continue
+		}
+		asks[ask.Miner] = ask
+	}
+
+	reliability, err := smc.minerReliability()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*storeCandidate
+	for miner, ask := range asks {
+		power, err := smc.api.MinerGetPower(ctx, miner)
+		if err != nil {
+			smc.log.Infof("skipping miner %s: could not get its power: %s", miner, err)
+			continue
+		}
+		candidates = append(candidates, &storeCandidate{ask: ask, power: power, reliability: reliability(miner)})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.reliability < 0.5) != (b.reliability < 0.5) {
+			return b.reliability < 0.5
+		}
+		if !a.ask.Price.Equal(b.ask.Price) {
+			return a.ask.Price.LessThan(b.ask.Price)
+		}
+		if a.reliability != b.reliability {
+			return a.reliability > b.reliability
+		}
+		if c := a.power.Cmp(b.power); c != 0 {
+			return c > 0
+		}
+		return a.ask.Miner.String() < b.ask.Miner.String()
+	})
+	return candidates, nil
+}
+
+// minerReliability returns a function giving the share of the client's past deals with a
+// miner that went well. A deal went badly when it failed or its last health check found
+// problems. Miners the client has no past deals with are given a neutral 0.5.
+func (smc *Client) minerReliability() (func(address.Address) float64, error) {
+	deals, err := smc.ListDeals()
+	if err != nil {
+		return nil, err
+	}
+
+	good := make(map[address.Address]int)
+	bad := make(map[address.Address]int)
+	for _, d := range deals {
+		switch {
+		case d.Response.State == storagedeal.Failed || (d.Health != nil && !d.Health.Healthy()):
+			bad[d.Miner]++
+		case d.Response.State == storagedeal.Rejected:
+		default:
+			good[d.Miner]++
+		}
+	}
+
+	return func(miner address.Address) float64 {
+		// Add one good and one bad deal so that a single deal doesn't settle a miner's reliability.
+		return float64(good[miner]+1) / float64(good[miner]+bad[miner]+2)
+	}, nil
+}
@@ -47,8 +47,24 @@ const (
 	},
 	"mining": {
 		"minerAddress": "empty",
+		"minerAddresses": [],
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"storagePrices": {},
+		"retrievalPrice": "0",
+		"dealPolicy": {
+			"clientAllowList": [],
+			"clientDenyList": [],
+			"minDuration": 0,
+			"maxDuration": 0,
+			"minPieceSize": 0,
+			"maxPieceSize": 0,
+			"maxClientDeals": 0,
+			"maxClientBytes": 0,
+			"collateral": "0",
+			"decider": "",
+			"deciderTimeout": "10s"
+		}
 	},
 	"wallet": {
 		"defaultAddress": "empty"
@@ -67,7 +83,9 @@ const (
 	},
 	"mpool": {
 		"maxPoolSize": 10000,
-		"maxNonceGap": "100"
+		"maxSenderMessages": 100,
+		"maxNonceGap": "100",
+		"replaceByFeePercent": 10
 	}
 }`
 )
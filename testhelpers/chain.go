@@ -57,7 +57,9 @@ func MkFakeChild(params FakeChildParams) (*types.Block, error) {
 		NewTestProcessor(),
 		powerTableView,
 		params.GenesisCid,
-		proofs.NewFakeVerifier(true, nil))
+		proofs.NewFakeVerifier(true, nil),
+		&TestBlockSignatureValidator{},
+		NewTestSectorsView(types.CommR{}))
 	params.Consensus = con
 	return MkFakeChildWithCon(params)
 }
@@ -110,6 +112,9 @@ func MkFakeChildCore(parent types.TipSet,
 	newBlock.ParentWeight = types.Uint64(w)
 	newBlock.Nonce = types.Uint64(nonce)
 	newBlock.StateRoot = stateRoot
+	if err := consensus.SignBlock(newBlock, minerPubKey, signer); err != nil {
+		return nil, err
+	}
 
 	return newBlock, nil
 }
@@ -11,6 +11,8 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
@@ -83,7 +85,7 @@ func NewValidTestBlockFromTipSet(baseTipSet types.TipSet, stateRootCid cid.Cid,
 	postProof := MakeRandomPoSTProofForTest()
 	ticket, _ := consensus.CreateTicket(postProof, minerPubKey, signer)
 
-	return &types.Block{
+	blk := &types.Block{
 		Miner:        minerAddr,
 		Ticket:       ticket,
 		Parents:      baseTipSet.ToSortedCidSet(),
@@ -93,6 +95,8 @@ func NewValidTestBlockFromTipSet(baseTipSet types.TipSet, stateRootCid cid.Cid,
 		StateRoot:    stateRootCid,
 		Proof:        postProof,
 	}
+	_ = consensus.SignBlock(blk, minerPubKey, signer)
+	return blk
 }
 
 // MakeRandomPoSTProofForTest creates a random proof.
@@ -106,6 +110,53 @@ func MakeRandomPoSTProofForTest() types.PoStProof {
 	return postProof
 }
 
+// TestBlockSignatureValidator is a block signature validator that accepts all
+// blocks, to simplify block creation in tests.
+type TestBlockSignatureValidator struct{}
+
+var _ consensus.BlockSignatureValidator = (*TestBlockSignatureValidator)(nil)
+
+// ValidateSignatures always returns nil.
+func (tbsv *TestBlockSignatureValidator) ValidateSignatures(ctx context.Context, st state.Tree, blk *types.Block) error {
+	return nil
+}
+
+// TestSectorsView is a sectors view in which every miner has committed the
+// same sectors.
+type TestSectorsView struct {
+	commRs []types.CommR
+}
+
+var _ consensus.SectorsView = (*TestSectorsView)(nil)
+
+// NewTestSectorsView creates a TestSectorsView in which every miner has
+// committed sectors with the given replica commitments.
+func NewTestSectorsView(commRs ...types.CommR) *TestSectorsView {
+	return &TestSectorsView{commRs: commRs}
+}
+
+// ElectionSectors returns the commitments of the view.
+func (tsv *TestSectorsView) ElectionSectors(ctx context.Context, st state.Tree, bstore blockstore.Blockstore, mAddr address.Address) (proofs.SortedCommRs, error) {
+	commRs := make([]types.CommR, len(tsv.commRs))
+	copy(commRs, tsv.commRs)
+	return proofs.NewSortedCommRs(commRs...), nil
+}
+
+// SectorSize always returns the test sector size.
+func (tsv *TestSectorsView) SectorSize(ctx context.Context, st state.Tree, bstore blockstore.Blockstore) (types.SectorSize, error) {
+	return types.OneKiBSectorSize, nil
+}
+
+// TestPoStGenerator generates the same proof of spacetime for any request.
+type TestPoStGenerator struct {
+	Proof types.PoStProof
+}
+
+// GeneratePoSt returns the proof of the generator.
+func (tpg *TestPoStGenerator) GeneratePoSt(req sectorbuilder.GeneratePoStRequest) (sectorbuilder.GeneratePoStResponse, error) {
+	return sectorbuilder.GeneratePoStResponse{Proofs: []types.PoStProof{tpg.Proof}}, nil
+}
+
 // TestSignedMessageValidator is a validator that doesn't validate to simplify message creation in tests.
 type TestSignedMessageValidator struct{}
 
@@ -7,6 +7,7 @@ import (
 	"io"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 
 	"github.com/ipfs/go-cid"
@@ -50,6 +51,19 @@ func (f *Filecoin) ClientProposeStorageDeal(ctx context.Context, data cid.Cid,
 	return &out, nil
 }
 
+// ClientStore runs the client store command against the filecoin process.
+func (f *Filecoin) ClientStore(ctx context.Context, data cid.Cid, duration uint64, replicas int) (*storage.StoreResult, error) {
+	var out storage.StoreResult
+	sDuration := fmt.Sprintf("--duration=%d", duration)
+	sReplicas := fmt.Sprintf("--replicas=%d", replicas)
+	sData := fmt.Sprintf("--cid=%s", data.String())
+
+	if err := f.RunCmdJSONWithStdin(ctx, nil, &out, "go-filecoin", "client", "store", sData, sDuration, sReplicas); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 // ClientQueryStorageDeal runs the client query-storage-deal command against the filecoin process.
 func (f *Filecoin) ClientQueryStorageDeal(ctx context.Context, prop cid.Cid) (*storagedeal.Response, error) {
 	var out storagedeal.Response
@@ -60,6 +74,12 @@ func (f *Filecoin) ClientQueryStorageDeal(ctx context.Context, prop cid.Cid) (*s
 	return &out, nil
 }
 
+// ClientListDeals runs the client list-deals command against the filecoin process.
+// A json decoder is returned that deals may be decoded from.
+func (f *Filecoin) ClientListDeals(ctx context.Context) (*json.Decoder, error) {
+	return f.RunCmdLDJSONWithStdin(ctx, nil, "go-filecoin", "client", "list-deals")
+}
+
 // ClientListAsks runs the client list-asks command against the filecoin process.
 // A json decoer is returned that asks may be decoded from.
 func (f *Filecoin) ClientListAsks(ctx context.Context) (*json.Decoder, error) {
@@ -2,6 +2,7 @@ package fast
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 
 	"github.com/ipfs/go-cid"
@@ -10,10 +11,31 @@ import (
 )
 
 // RetrievalClientRetrievePiece runs the retrieval-client retrieve-piece commands against the filecoin process.
-func (f *Filecoin) RetrievalClientRetrievePiece(ctx context.Context, pieceCID cid.Cid, minerAddr address.Address) (io.ReadCloser, error) {
-	out, err := f.RunCmdWithStdin(ctx, nil, "go-filecoin", "retrieval-client", "retrieve-piece", minerAddr.String(), pieceCID.String())
+func (f *Filecoin) RetrievalClientRetrievePiece(ctx context.Context, pieceCID cid.Cid, minerAddr address.Address, options ...ActionOption) (io.ReadCloser, error) {
+	args := []string{"go-filecoin", "retrieval-client", "retrieve-piece"}
+
+	for _, option := range options {
+		args = append(args, option()...)
+	}
+
+	args = append(args, minerAddr.String(), pieceCID.String())
+
+	out, err := f.RunCmdWithStdin(ctx, nil, args...)
 	if err != nil {
 		return nil, err
 	}
 	return out.Stdout(), nil
 }
+
+// RetrievalClientFind runs the retrieval-client find command against the filecoin process.
+func (f *Filecoin) RetrievalClientFind(ctx context.Context, pieceCID cid.Cid, options ...ActionOption) (*json.Decoder, error) {
+	args := []string{"go-filecoin", "retrieval-client", "find"}
+
+	for _, option := range options {
+		args = append(args, option()...)
+	}
+
+	args = append(args, pieceCID.String())
+
+	return f.RunCmdLDJSONWithStdin(ctx, nil, args...)
+}
@@ -3,6 +3,7 @@ package fast
 import (
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/libp2p/go-libp2p-peer"
 
@@ -115,3 +116,38 @@ func AOValidAt(bh *types.BlockHeight) ActionOption {
 		return []string{"--validat", sBH}
 	}
 }
+
+// AOMaxPrice provides the `--max-price=<fil>` option to actions
+func AOMaxPrice(price *big.Float) ActionOption {
+	sPrice := price.Text('f', -1)
+	return func() []string {
+		return []string{"--max-price", sPrice}
+	}
+}
+
+// AOOffset provides the `--offset=<bytes>` option to actions
+func AOOffset(offset uint64) ActionOption {
+	sOffset := fmt.Sprintf("%d", offset)
+	return func() []string {
+		return []string{"--offset", sOffset}
+	}
+}
+
+// AOLength provides the `--length=<bytes>` option to actions
+func AOLength(length uint64) ActionOption {
+	sLength := fmt.Sprintf("%d", length)
+	return func() []string {
+		return []string{"--length", sLength}
+	}
+}
+
+// AOOtherMiners provides the `--other-miners=<addrs>` option to actions
+func AOOtherMiners(miners ...address.Address) ActionOption {
+	var sMiners []string
+	for _, miner := range miners {
+		sMiners = append(sMiners, miner.String())
+	}
+	return func() []string {
+		return []string{"--other-miners", strings.Join(sMiners, ",")}
+	}
+}
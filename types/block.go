@@ -54,6 +54,26 @@ type Block struct {
 	// a challenge
 	Proof PoStProof `json:"proof"`
 
+	// BlockSig is the signature of the miner's key over the block, see
+	// SignatureData.
+	BlockSig Signature `json:"blockSig"`
+
+	// Timestamp is set on genesis blocks to the time of the start of the
+	// chain, in seconds since the unix epoch. The epochs of the chain are
+	// counted from it. It is zero for other blocks, whose epoch is their
+	// height, and for the genesis blocks of chains without epochs.
+	Timestamp Uint64 `json:"timestamp,omitempty" refmt:",omitempty"`
+
+	// BlockTime is set on genesis blocks with a Timestamp to the duration of
+	// the epochs of the chain, in milliseconds, so that all nodes of the chain
+	// agree on them.
+	BlockTime Uint64 `json:"blockTime,omitempty" refmt:",omitempty"`
+
+	// Consensus is set on the genesis blocks of chains that don't run expected
+	// consensus to the name of their consensus protocol, so that all nodes of
+	// the chain run the same one.
+	Consensus string `json:"consensus,omitempty" refmt:",omitempty"`
+
 	cachedCid cid.Cid
 
 	cachedBytes []byte
@@ -122,6 +142,21 @@ func (b *Block) String() string {
 	return fmt.Sprintf("Block cid=[%v]: %s", cid, string(js))
 }
 
+// SignatureData returns the bytes covered by BlockSig: the serialized block
+// without its signature.
+func (b *Block) SignatureData() []byte {
+	unsigned := *b
+	unsigned.BlockSig = nil
+	unsigned.cachedCid = cid.Undef
+	unsigned.cachedBytes = nil
+
+	bytes, err := cbor.DumpObject(&unsigned)
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
 // DecodeBlock decodes raw cbor bytes into a Block.
 func DecodeBlock(b []byte) (*Block, error) {
 	var out Block
@@ -285,3 +285,20 @@ func TestBlockJsonMarshal(t *testing.T) {
 	assert.Equal(uint8(123), unmarshalled.MessageReceipts[0].ExitCode)
 	assert.Equal([][]byte{{1, 2, 3}}, unmarshalled.MessageReceipts[0].Return)
 }
+
+func TestBlockSignatureData(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert := assert.New(t)
+
+	newCid := NewCidForTestGetter()
+	blk := NewBlockForTest(nil, 1)
+	blk.StateRoot = newCid()
+	unsigned := blk.SignatureData()
+
+	blk.BlockSig = Signature([]byte{1, 2, 3})
+	assert.Equal(unsigned, blk.SignatureData())
+
+	blk.StateRoot = newCid()
+	assert.NotEqual(unsigned, blk.SignatureData())
+}